@@ -0,0 +1,368 @@
+package features
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/spf13/afero"
+)
+
+// AIInteraction is a request to the AI and the answer it got, as written by
+// the AI.
+type AIInteraction struct {
+	// hash of the prompt, of the feature context and of the conversation
+	// history, the replays are matched by it and by the number of attempts
+	PromptHash     string               `json:"promptHash"`
+	Prompt         string               `json:"prompt"`
+	FeatureContext *Feature             `json:"featureContext,omitempty"`
+	History        []*AIMessage         `json:"history,omitempty"`
+	Attempts       []*GenerationAttempt `json:"attempts,omitempty"`
+	Instructions   string               `json:"instructions"`
+	// text blocks of the answer, when the AI answered in text
+	Answer []string `json:"answer,omitempty"`
+	// the tool the AI called to answer, when it did
+	ToolCall   *AIToolCall `json:"toolCall,omitempty"`
+	RecordedAt time.Time   `json:"recordedAt"`
+}
+
+// AICassette is the file the AI interactions are recorded to and replayed
+// from.
+type AICassette struct {
+	Interactions []*AIInteraction `json:"interactions"`
+}
+
+// LoadAICassette reads a cassette file, a missing file being an empty
+// cassette.
+func LoadAICassette(fs afero.Fs, path string) (*AICassette, error) {
+	cassetteJson, err := afero.ReadFile(fs, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &AICassette{Interactions: []*AIInteraction{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+
+	cassette := &AICassette{}
+	err = json.Unmarshal(cassetteJson, cassette)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+
+	return cassette, nil
+}
+
+func (c *AICassette) Save(fs afero.Fs, path string) error {
+	cassetteJson, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	err = fs.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create cassette folder: %w", err)
+	}
+
+	// written aside and renamed, so a crash doesn't leave half a cassette
+	tempFile, err := afero.TempFile(fs, filepath.Dir(path), ".cassette-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cassette file: %w", err)
+	}
+	_, err = tempFile.Write(cassetteJson)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		fs.Remove(tempFile.Name())
+		return fmt.Errorf("failed to write cassette %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// record adds an interaction, replacing the one recorded before for the same
+// request.
+func (c *AICassette) record(interaction *AIInteraction) {
+	for i, recorded := range c.Interactions {
+		if recorded.PromptHash == interaction.PromptHash && len(recorded.Attempts) == len(interaction.Attempts) {
+			c.Interactions[i] = interaction
+			return
+		}
+	}
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+// ReplayFallback tells what a replay answers to requests that were not
+// recorded.
+type ReplayFallback string
+
+const (
+	// requests that were not recorded fail with ErrNoRecordedAnswer
+	FailReplayFallback ReplayFallback = "fail"
+
+	// the last answer recorded for the same prompt is replayed, whatever the
+	// attempts, e.g. when the feature needs more repairs than when recorded
+	PromptReplayFallback ReplayFallback = "prompt"
+
+	// like PromptReplayFallback, but the last answer recorded is replayed when
+	// the prompt was never recorded
+	AnyReplayFallback ReplayFallback = "any"
+)
+
+var ErrNoRecordedAnswer = errors.New("no answer was recorded for the request")
+
+// find returns the interaction replayed for a request.
+func (c *AICassette) find(promptHash string, attemptsCount int, fallback ReplayFallback) (*AIInteraction, error) {
+	var samePrompt *AIInteraction
+	for _, interaction := range c.Interactions {
+		if interaction.PromptHash != promptHash {
+			continue
+		}
+		if len(interaction.Attempts) == attemptsCount {
+			return interaction, nil
+		}
+		samePrompt = interaction
+	}
+
+	if samePrompt != nil && (fallback == PromptReplayFallback || fallback == AnyReplayFallback) {
+		return samePrompt, nil
+	}
+	if len(c.Interactions) > 0 && fallback == AnyReplayFallback {
+		return c.Interactions[len(c.Interactions)-1], nil
+	}
+
+	return nil, fmt.Errorf("%w, prompt hash %s after %d attempts", ErrNoRecordedAnswer, promptHash, attemptsCount)
+}
+
+// aiPromptHash identifies the requests for the same feature.
+func aiPromptHash(prompt string, featureContext *Feature, history []*AIMessage) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(prompt))
+
+	if featureContext != nil {
+		featureContextJson, err := json.Marshal(featureContext)
+		if err != nil {
+			return "", fmt.Errorf("failed to JSON encode featureContext: %w", err)
+		}
+		hash.Write([]byte{0})
+		hash.Write(featureContextJson)
+	}
+
+	// hashed only when there is one, so the requests recorded before there
+	// were conversations keep their hash
+	if len(history) > 0 {
+		historyJson, err := json.Marshal(history)
+		if err != nil {
+			return "", fmt.Errorf("failed to JSON encode conversation history: %w", err)
+		}
+		hash.Write([]byte{1})
+		hash.Write(historyJson)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordedAnswer is the answer parsed by AIInstructions, either text blocks or
+// a tool call.
+type recordedAnswer struct {
+	blocks   []string
+	toolCall *AIToolCall
+}
+
+type aiAnswerRecorderKey struct{}
+
+// withAnswerRecorder returns a context where AIInstructions.ParseAnswer and
+// AIInstructions.ParseToolCall keep the answer they parse in answer.
+func withAnswerRecorder(ctx context.Context, answer *recordedAnswer) context.Context {
+	return context.WithValue(ctx, aiAnswerRecorderKey{}, answer)
+}
+
+func recordAnswer(ctx context.Context, blocks []string) {
+	answer, hasRecorder := ctx.Value(aiAnswerRecorderKey{}).(*recordedAnswer)
+	if hasRecorder {
+		answer.blocks = append([]string{}, blocks...)
+	}
+}
+
+func recordToolCall(ctx context.Context, toolCall *AIToolCall) {
+	answer, hasRecorder := ctx.Value(aiAnswerRecorderKey{}).(*recordedAnswer)
+	if hasRecorder {
+		answer.toolCall = toolCall
+	}
+}
+
+func NewRecordingAIGenerator(aiGenerator IAIGenerator, instructions *AIInstructions, fs afero.Fs, cassettePath string) IAIGenerator {
+	return &RecordingAIGenerator{
+		aiGenerator:  aiGenerator,
+		instructions: instructions,
+		fs:           fs,
+		cassettePath: cassettePath,
+	}
+}
+
+// RecordingAIGenerator records every answer of aiGenerator to a cassette, to
+// be replayed by a ReplayAIGenerator. Requests that get no answer, e.g.
+// because the provider is down, are not recorded.
+type RecordingAIGenerator struct {
+	aiGenerator  IAIGenerator
+	instructions *AIInstructions
+	fs           afero.Fs
+	cassettePath string
+
+	// serializes the cassette updates
+	mu sync.Mutex
+}
+
+func (g *RecordingAIGenerator) Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	answer := &recordedAnswer{}
+	feature, err := g.aiGenerator.Generate(withAnswerRecorder(ctx, answer), prompt, featureContext)
+	g.record(prompt, featureContext, conversationHistory(ctx), nil, answer)
+	return feature, err
+}
+
+func (g *RecordingAIGenerator) Repair(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	answer := &recordedAnswer{}
+	feature, err := g.aiGenerator.Repair(withAnswerRecorder(ctx, answer), prompt, featureContext, attempts)
+	g.record(prompt, featureContext, conversationHistory(ctx), attempts, answer)
+	return feature, err
+}
+
+// record adds an interaction to the cassette. Failing to record doesn't fail
+// the generation.
+func (g *RecordingAIGenerator) record(prompt string, featureContext *Feature, history []*AIMessage, attempts []*GenerationAttempt, answer *recordedAnswer) {
+	if answer.blocks == nil && answer.toolCall == nil {
+		return
+	}
+
+	err := g.recordInteraction(prompt, featureContext, history, attempts, answer)
+	if err != nil {
+		log.Error().Msgf("failed to record AI answer: %v", err)
+	}
+}
+
+func (g *RecordingAIGenerator) recordInteraction(prompt string, featureContext *Feature, history []*AIMessage, attempts []*GenerationAttempt, answer *recordedAnswer) error {
+	promptHash, err := aiPromptHash(prompt, featureContext, history)
+	if err != nil {
+		return err
+	}
+
+	instructions, err := g.instructions.System(featureContext)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cassette, err := LoadAICassette(g.fs, g.cassettePath)
+	if err != nil {
+		return err
+	}
+
+	cassette.record(&AIInteraction{
+		PromptHash:     promptHash,
+		Prompt:         prompt,
+		FeatureContext: featureContext,
+		History:        history,
+		Attempts:       attempts,
+		Instructions:   instructions,
+		Answer:         answer.blocks,
+		ToolCall:       answer.toolCall,
+		RecordedAt:     time.Now(),
+	})
+
+	return cassette.Save(g.fs, g.cassettePath)
+}
+
+var ErrMissingCassette = errors.New("the replay provider needs a cassette")
+
+// NewReplayProvider is the AIProviderFactory of ReplayProvider, replaying
+// from config.CassettePath.
+func NewReplayProvider(config *AIGeneratorConfig, instructions *AIInstructions) (IAIGenerator, error) {
+	if len(config.CassettePath) == 0 {
+		return nil, ErrMissingCassette
+	}
+
+	return NewReplayAIGenerator(instructions, afero.NewOsFs(), config.CassettePath, config.ReplayFallback)
+}
+
+func NewReplayAIGenerator(instructions *AIInstructions, fs afero.Fs, cassettePath string, fallback ReplayFallback) (IAIGenerator, error) {
+	exists, err := afero.Exists(fs, cassettePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", cassettePath, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w, %s does not exist", ErrMissingCassette, cassettePath)
+	}
+
+	cassette, err := LoadAICassette(fs, cassettePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fallback) == 0 {
+		fallback = FailReplayFallback
+	}
+
+	return &ReplayAIGenerator{
+		instructions: instructions,
+		cassette:     cassette,
+		fallback:     fallback,
+	}, nil
+}
+
+// ReplayAIGenerator answers with the answers recorded by a
+// RecordingAIGenerator, without calling any provider. The answers are parsed
+// again, so a recorded answer that couldn't be parsed fails the same way.
+type ReplayAIGenerator struct {
+	instructions *AIInstructions
+	cassette     *AICassette
+	fallback     ReplayFallback
+}
+
+func (g *ReplayAIGenerator) Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	return g.replay(ctx, prompt, featureContext, nil)
+}
+
+func (g *ReplayAIGenerator) Repair(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	return g.replay(ctx, prompt, featureContext, attempts)
+}
+
+func (g *ReplayAIGenerator) replay(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	promptHash, err := aiPromptHash(prompt, featureContext, conversationHistory(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	interaction, err := g.cassette.find(promptHash, len(attempts), g.fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	reportProgress(ctx, &GenerationEvent{Phase: PromptBuiltPhase})
+
+	if interaction.ToolCall != nil {
+		reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: string(interaction.ToolCall.Input)})
+		// replayed answers use no tokens
+		reportProgress(ctx, &GenerationEvent{Phase: UsagePhase, Usage: &AIUsage{}})
+		return g.instructions.ParseToolCall(ctx, interaction.ToolCall)
+	}
+
+	for _, block := range interaction.Answer {
+		reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: block})
+	}
+	reportProgress(ctx, &GenerationEvent{Phase: UsagePhase, Usage: &AIUsage{}})
+	return g.instructions.ParseAnswer(ctx, interaction.Answer)
+}
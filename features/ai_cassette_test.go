@@ -0,0 +1,189 @@
+package features_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAIInstructions(t *testing.T) *features.AIInstructions {
+	schema, _ := (&staticSchemaGenerator{}).GenerateSchemaSQL()
+	instructions, err := features.NewAIInstructions(testInstructionsTemplateData, schema, true)
+	assert.NoError(t, err)
+	return instructions
+}
+
+// newRecordingAIGenerator records the answers of an OpenAI-compatible
+// generator asking server.
+func newRecordingAIGenerator(t *testing.T, serverURL string, fs afero.Fs, cassettePath string) features.IAIGenerator {
+	instructions := newTestAIInstructions(t)
+	aiGenerator, err := features.NewOpenAICompatibleGenerator(&features.AIGeneratorConfig{
+		Model:   "llama3",
+		BaseURL: serverURL + "/v1",
+		APIKey:  "secret",
+	}, instructions)
+	assert.NoError(t, err)
+
+	return features.NewRecordingAIGenerator(aiGenerator, instructions, fs, cassettePath)
+}
+
+func TestAICassette(t *testing.T) {
+	t.Parallel()
+
+	feature := generatedFeature("tasks", "Tasks", "get-tasks")
+	featureJson, err := json.Marshal(feature)
+	assert.NoError(t, err)
+
+	contextFeature := generatedFeature("users", "Users", "get-users")
+
+	// records a generation that needs a repair, and one changing a feature
+	record := func(t *testing.T) afero.Fs {
+		fs := afero.NewMemMapFs()
+		server, _ := chatCompletionServer(t, "Here is the feature", string(featureJson), `{"error": "there are no users"}`)
+		recorder := newRecordingAIGenerator(t, server.URL, fs, "cassettes/tasks.json")
+
+		_, err := recorder.Generate(context.Background(), "list the tasks", nil)
+		invalidAnswerErr := &features.InvalidAnswerError{}
+		assert.ErrorAs(t, err, &invalidAnswerErr)
+
+		attempts := []*features.GenerationAttempt{{
+			Answer:      invalidAnswerErr.Answer,
+			Diagnostics: []*features.Diagnostic{{Source: features.AnswerDiagnostic, Message: invalidAnswerErr.Err.Error()}},
+		}}
+		_, err = recorder.Repair(context.Background(), "list the tasks", nil, attempts)
+		assert.NoError(t, err)
+
+		_, err = recorder.Generate(context.Background(), "list the users", contextFeature)
+		assert.EqualError(t, err, "AI error: there are no users")
+
+		// nothing is recorded without an answer
+		server.Close()
+		_, err = recorder.Generate(context.Background(), "list the projects", nil)
+		assert.Error(t, err)
+
+		return fs
+	}
+
+	t.Run("record", func(t *testing.T) {
+		t.Parallel()
+
+		fs := record(t)
+
+		cassette, err := features.LoadAICassette(fs, "cassettes/tasks.json")
+		assert.NoError(t, err)
+		assert.Len(t, cassette.Interactions, 3)
+
+		generate := cassette.Interactions[0]
+		assert.Equal(t, "list the tasks", generate.Prompt)
+		assert.Equal(t, []string{"Here is the feature"}, generate.Answer)
+		assert.Contains(t, generate.Instructions, "CREATE TABLE tasks")
+		assert.Empty(t, generate.Attempts)
+
+		repair := cassette.Interactions[1]
+		assert.Equal(t, generate.PromptHash, repair.PromptHash)
+		assert.Equal(t, []string{string(featureJson)}, repair.Answer)
+		assert.Len(t, repair.Attempts, 1)
+
+		changeUsers := cassette.Interactions[2]
+		assert.NotEqual(t, generate.PromptHash, changeUsers.PromptHash)
+		assert.Equal(t, contextFeature, changeUsers.FeatureContext)
+		assert.Contains(t, changeUsers.Instructions, `"name": "users"`)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		t.Parallel()
+
+		fs := record(t)
+
+		replay, err := features.NewReplayAIGenerator(newTestAIInstructions(t), fs, "cassettes/tasks.json", "")
+		assert.NoError(t, err)
+
+		phases := []features.GenerationPhase{}
+		ctx := features.WithGenerationProgress(context.Background(), func(event *features.GenerationEvent) {
+			phases = append(phases, event.Phase)
+		})
+
+		_, err = replay.Generate(ctx, "list the tasks", nil)
+		invalidAnswerErr := &features.InvalidAnswerError{}
+		assert.ErrorAs(t, err, &invalidAnswerErr)
+		assert.Equal(t, "Here is the feature", invalidAnswerErr.Answer)
+		assert.Equal(t, []features.GenerationPhase{features.PromptBuiltPhase, features.TokensPhase, features.UsagePhase}, phases)
+
+		attempts := []*features.GenerationAttempt{{Answer: invalidAnswerErr.Answer}}
+		replayedFeature, err := replay.Repair(ctx, "list the tasks", nil, attempts)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, replayedFeature)
+
+		_, err = replay.Generate(ctx, "list the users", contextFeature)
+		assert.EqualError(t, err, "AI error: there are no users")
+
+		// the feature context is part of the request
+		_, err = replay.Generate(ctx, "list the users", nil)
+		assert.ErrorIs(t, err, features.ErrNoRecordedAnswer)
+
+		_, err = replay.Repair(ctx, "list the tasks", nil, append(attempts, attempts...))
+		assert.ErrorIs(t, err, features.ErrNoRecordedAnswer)
+	})
+
+	t.Run("replay fallbacks", func(t *testing.T) {
+		t.Parallel()
+
+		fs := record(t)
+		attempts := []*features.GenerationAttempt{{Answer: "Here is the feature"}}
+
+		replay, err := features.NewReplayAIGenerator(newTestAIInstructions(t), fs, "cassettes/tasks.json", features.PromptReplayFallback)
+		assert.NoError(t, err)
+
+		replayedFeature, err := replay.Repair(context.Background(), "list the tasks", nil, append(attempts, attempts...))
+		assert.NoError(t, err)
+		assert.Equal(t, feature, replayedFeature)
+
+		_, err = replay.Generate(context.Background(), "list the projects", nil)
+		assert.ErrorIs(t, err, features.ErrNoRecordedAnswer)
+
+		replay, err = features.NewReplayAIGenerator(newTestAIInstructions(t), fs, "cassettes/tasks.json", features.AnyReplayFallback)
+		assert.NoError(t, err)
+
+		_, err = replay.Generate(context.Background(), "list the projects", nil)
+		assert.EqualError(t, err, "AI error: there are no users")
+	})
+
+	t.Run("tool calls", func(t *testing.T) {
+		t.Parallel()
+
+		fs := afero.NewMemMapFs()
+		server, _ := toolCallServer(t, &features.AIToolCall{Name: features.CreateFeatureTool, Input: featureJson})
+		recorder := newRecordingAIGenerator(t, server.URL, fs, "cassettes/tasks.json")
+
+		_, err := recorder.Generate(context.Background(), "list the tasks", nil)
+		assert.NoError(t, err)
+
+		cassette, err := features.LoadAICassette(fs, "cassettes/tasks.json")
+		assert.NoError(t, err)
+		assert.Len(t, cassette.Interactions, 1)
+		assert.Empty(t, cassette.Interactions[0].Answer)
+		assert.Equal(t, features.CreateFeatureTool, cassette.Interactions[0].ToolCall.Name)
+		assert.JSONEq(t, string(featureJson), string(cassette.Interactions[0].ToolCall.Input))
+
+		replay, err := features.NewReplayAIGenerator(newTestAIInstructions(t), fs, "cassettes/tasks.json", "")
+		assert.NoError(t, err)
+
+		replayedFeature, err := replay.Generate(context.Background(), "list the tasks", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, replayedFeature)
+	})
+
+	t.Run("missing cassette", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := features.NewReplayAIGenerator(newTestAIInstructions(t), afero.NewMemMapFs(), "cassettes/tasks.json", "")
+		assert.ErrorIs(t, err, features.ErrMissingCassette)
+
+		_, err = features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{Provider: features.ReplayProvider})
+		assert.ErrorIs(t, err, features.ErrMissingCassette)
+	})
+}
@@ -0,0 +1,355 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/features/instruction_files"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/prigas-dev/backoffice-ai/utils"
+	"github.com/spf13/afero"
+)
+
+type IAIGenerator interface {
+	Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error)
+	// Repair asks again for the feature described by prompt, showing the AI
+	// its previous answers and the problems found in each of them, oldest
+	// first.
+	Repair(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error)
+}
+
+type Feature struct {
+	Name             string                  `json:"name"`
+	Label            string                  `json:"label"`
+	Description      string                  `json:"description"`
+	ReactComponent   *ReactComponent         `json:"reactComponent"`
+	ServerOperations []*operations.Operation `json:"serverOperations"`
+}
+
+type ReactComponent struct {
+	TsxCode string `json:"tsxCode"`
+}
+
+// AIProvider names the service that answers the feature prompts.
+type AIProvider string
+
+const (
+	AnthropicProvider AIProvider = "anthropic"
+
+	// any server with an OpenAI-compatible chat completions endpoint, such as
+	// OpenAI itself, llama.cpp or Ollama
+	OpenAICompatibleProvider AIProvider = "openai"
+
+	// answers recorded in a cassette are replayed, for tests and offline
+	// development
+	ReplayProvider AIProvider = "replay"
+)
+
+type AIGeneratorConfig struct {
+	// defaults to AnthropicProvider
+	Provider AIProvider
+
+	// model name as the provider knows it, empty uses the provider default
+	Model string
+
+	// maximum tokens of each answer, defaults to DefaultAIMaxTokens
+	MaxTokens int
+
+	// defaults to DefaultAITemperature
+	Temperature *float64
+
+	// base URL of the provider API, e.g. http://localhost:11434/v1 for a local
+	// Ollama server. Empty uses the provider public API.
+	BaseURL string
+
+	// empty uses the provider environment variable, ANTHROPIC_API_KEY or
+	// OPENAI_API_KEY
+	APIKey string
+
+	// the AI answers in text instead of calling the create_feature and
+	// report_error tools, for models or servers without tool calling
+	DisableTools bool
+
+	// cassette file the replay provider answers from, and where the answers are
+	// recorded when Record is set
+	CassettePath string
+	Record       bool
+
+	// what the replay provider answers to requests that were not recorded,
+	// defaults to FailReplayFallback
+	ReplayFallback ReplayFallback
+}
+
+const (
+	DefaultAIMaxTokens   = 10_000
+	DefaultAITemperature = 0.5
+)
+
+func (c *AIGeneratorConfig) maxTokens() int {
+	if c.MaxTokens <= 0 {
+		return DefaultAIMaxTokens
+	}
+	return c.MaxTokens
+}
+
+func (c *AIGeneratorConfig) temperature() float64 {
+	if c.Temperature == nil {
+		return DefaultAITemperature
+	}
+	return *c.Temperature
+}
+
+// AIProviderFactory creates the generator of a provider. Every provider asks
+// for features with the same instructions, and reads the answers with them.
+type AIProviderFactory func(config *AIGeneratorConfig, instructions *AIInstructions) (IAIGenerator, error)
+
+var ErrUnknownAIProvider = errors.New("unknown AI provider")
+
+var (
+	aiProvidersMu sync.RWMutex
+	aiProviders   = map[AIProvider]AIProviderFactory{
+		AnthropicProvider:        NewAnthropicGenerator,
+		OpenAICompatibleProvider: NewOpenAICompatibleGenerator,
+		ReplayProvider:           NewReplayProvider,
+	}
+)
+
+// RegisterAIProvider makes a provider available to NewAIGenerator, replacing
+// the factory registered before with the same name.
+func RegisterAIProvider(provider AIProvider, factory AIProviderFactory) {
+	aiProvidersMu.Lock()
+	defer aiProvidersMu.Unlock()
+	aiProviders[provider] = factory
+}
+
+func NewAIGenerator(databaseSchemaGenerator IDatabaseSchemaGenerator, instructionsTemplateData *InstructionsTemplateData, config *AIGeneratorConfig) (IAIGenerator, error) {
+	if config == nil {
+		config = &AIGeneratorConfig{}
+	}
+	provider := config.Provider
+	if len(provider) == 0 {
+		provider = AnthropicProvider
+	}
+
+	aiProvidersMu.RLock()
+	factory, isRegistered := aiProviders[provider]
+	aiProvidersMu.RUnlock()
+	if !isRegistered {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAIProvider, provider)
+	}
+
+	schema, err := databaseSchemaGenerator.GenerateSchemaSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get db schema: %w", err)
+	}
+	log.Info().Msg("Got schema from SQLite3 database")
+
+	instructions, err := NewAIInstructions(instructionsTemplateData, schema, !config.DisableTools)
+	if err != nil {
+		return nil, err
+	}
+
+	aiGenerator, err := factory(config, instructions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s generator: %w", provider, err)
+	}
+
+	if config.Record {
+		if len(config.CassettePath) == 0 {
+			return nil, fmt.Errorf("failed to record %s answers: %w", provider, ErrMissingCassette)
+		}
+		aiGenerator = NewRecordingAIGenerator(aiGenerator, instructions, afero.NewOsFs(), config.CassettePath)
+	}
+
+	return aiGenerator, nil
+}
+
+type InstructionsTemplateData struct {
+	SystemName        string
+	SystemDescription string
+	DatabaseEngine    string
+	DatabaseHints     string
+}
+
+type AIInstructionsTemplateData struct {
+	SystemName        string
+	SystemDescription string
+	DatabaseEngine    string
+	DatabaseHints     string
+
+	DatabaseSchema    string
+	ErrorJSONSchema   string
+	FeatureJSONSchema string
+	ValidFeatureJSON  string
+	ValidFeatureFiles []instruction_files.File
+
+	// the AI answers by calling tools instead of writing JSON
+	UseTools bool
+
+	FeatureContext string
+}
+
+// AIInstructions renders what is sent to the AI and reads its answers, the
+// same way for every provider.
+type AIInstructions struct {
+	templateData *AIInstructionsTemplateData
+	tools        []*AITool
+}
+
+// NewAIInstructions creates the instructions of a provider, which answers by
+// calling tools when useTools is set.
+func NewAIInstructions(instructionsTemplateData *InstructionsTemplateData, databaseSchema string, useTools bool) (*AIInstructions, error) {
+	var tools []*AITool
+	if useTools {
+		var err error
+		tools, err = newAITools()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AI tools: %w", err)
+		}
+	}
+
+	return &AIInstructions{
+		tools: tools,
+		templateData: &AIInstructionsTemplateData{
+			SystemName:        instructionsTemplateData.SystemName,
+			SystemDescription: instructionsTemplateData.SystemDescription,
+			DatabaseEngine:    instructionsTemplateData.DatabaseEngine,
+			DatabaseHints:     instructionsTemplateData.DatabaseHints,
+			FeatureJSONSchema: instruction_files.FeatureJSONSchema.Content,
+			ErrorJSONSchema:   instruction_files.ErrorJSONSchema.Content,
+			ValidFeatureJSON:  instruction_files.ExampleFeatureJSON.Content,
+			ValidFeatureFiles: instruction_files.ExampleFeatureFiles,
+			DatabaseSchema:    databaseSchema,
+			UseTools:          useTools,
+		},
+	}, nil
+}
+
+// System renders the system instructions, describing featureContext when a
+// feature is being changed.
+func (i *AIInstructions) System(featureContext *Feature) (string, error) {
+	templateData := *i.templateData
+
+	if featureContext != nil {
+		featureContextEncoded, err := json.MarshalIndent(featureContext, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to JSON encode featureContext: %w", err)
+		}
+		templateData.FeatureContext = string(featureContextEncoded)
+	}
+
+	instructions, err := utils.DoTemplate("system-instructions", instruction_files.SystemInstructionsTemplate.Content, templateData)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate instructions: %w", err)
+	}
+
+	return instructions, nil
+}
+
+type AIMessageRole string
+
+const (
+	UserRole      AIMessageRole = "user"
+	AssistantRole AIMessageRole = "assistant"
+)
+
+type AIMessage struct {
+	Role AIMessageRole `json:"role"`
+	Text string        `json:"text"`
+}
+
+type conversationHistoryKey struct{}
+
+// WithConversationHistory returns a context where the generators ask for
+// features as a follow-up of history, the messages of the previous prompts.
+func WithConversationHistory(ctx context.Context, history []*AIMessage) context.Context {
+	return context.WithValue(ctx, conversationHistoryKey{}, history)
+}
+
+func conversationHistory(ctx context.Context) []*AIMessage {
+	history, _ := ctx.Value(conversationHistoryKey{}).([]*AIMessage)
+	return history
+}
+
+// Conversation returns the messages asking for the feature described by
+// prompt after history, where each unusable answer is followed by the
+// problems found in it. Consecutive messages of the same role are joined,
+// since providers expect the roles to alternate.
+func (i *AIInstructions) Conversation(history []*AIMessage, prompt string, attempts []*GenerationAttempt) []*AIMessage {
+	messages := []*AIMessage{}
+	add := func(role AIMessageRole, text string) {
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			messages[len(messages)-1].Text += "\n\n" + text
+			return
+		}
+		messages = append(messages, &AIMessage{Role: role, Text: text})
+	}
+
+	for _, message := range history {
+		add(message.Role, message.Text)
+	}
+	add(UserRole, prompt)
+	for _, attempt := range attempts {
+		add(AssistantRole, attempt.Answer)
+		add(UserRole, repairPrompt(attempt.Diagnostics))
+	}
+	return messages
+}
+
+var ErrNoValidAIAnswer = errors.New("the AI did not return any valid answer")
+
+type AIGenerationError struct {
+	Error string `json:"error"`
+}
+
+// ParseAnswer reads the feature from the text blocks of an answer, which may
+// wrap the JSON in prose or in markdown fences. It fails with an
+// *InvalidAnswerError when no block is a feature, so the answer can be sent
+// back to the AI, and with the error of the AI when it couldn't generate the
+// feature.
+func (i *AIInstructions) ParseAnswer(ctx context.Context, blocks []string) (*Feature, error) {
+	recordAnswer(ctx, blocks)
+
+	var lastErr error = nil
+
+	for _, block := range blocks {
+		log.Debug().Msg(block)
+
+		var blockErr error = nil
+		for _, candidate := range answerJSONCandidates(block) {
+			errorStructure := &AIGenerationError{}
+			err := json.Unmarshal([]byte(candidate), errorStructure)
+			if err == nil {
+				if len(errorStructure.Error) > 0 {
+					log.Info().Msg("The AI could not generate the feature")
+					return nil, fmt.Errorf("AI error: %s", errorStructure.Error)
+				}
+			}
+
+			feature := &Feature{}
+			err = json.Unmarshal([]byte(candidate), feature)
+			if err == nil {
+				log.Info().Msg("Successfully parsed AI answer")
+				reportProgress(ctx, &GenerationEvent{Phase: ParsedPhase})
+				return feature, nil
+			}
+
+			// the error of the whole block is the most telling
+			if blockErr == nil {
+				blockErr = err
+			}
+		}
+
+		lastErr = &InvalidAnswerError{Answer: block, Err: blockErr}
+	}
+
+	if lastErr == nil {
+		return nil, ErrNoValidAIAnswer
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,422 @@
+package features_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSchemaGenerator struct{}
+
+func (g *staticSchemaGenerator) GenerateSchemaInfo() (*features.SchemaInfo, error) {
+	return &features.SchemaInfo{}, nil
+}
+
+func (g *staticSchemaGenerator) GenerateSchemaSQL() (string, error) {
+	return "CREATE TABLE tasks (id INTEGER PRIMARY KEY, title TEXT NOT NULL);", nil
+}
+
+var testInstructionsTemplateData = &features.InstructionsTemplateData{
+	SystemName:        "Task Manager",
+	SystemDescription: "Task Manager is a system for managing a team's tasks.",
+	DatabaseEngine:    "sqlite3",
+}
+
+// chatCompletionServer streams answers in order, one per request, split in
+// chunks of a few characters. requests returns the bodies received so far.
+func chatCompletionServer(t *testing.T, answers ...string) (server *httptest.Server, requests func() []map[string]any) {
+	return chatServer(t, len(answers), func(w io.Writer, answer int) {
+		for chunk := range textChunks(answers[answer], 16) {
+			content, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", content)
+		}
+	})
+}
+
+// toolCallServer is a chatCompletionServer answering with tool calls, whose
+// arguments are split in chunks of a few characters.
+func toolCallServer(t *testing.T, toolCalls ...*features.AIToolCall) (server *httptest.Server, requests func() []map[string]any) {
+	return chatServer(t, len(toolCalls), func(w io.Writer, answer int) {
+		name, _ := json.Marshal(toolCalls[answer].Name)
+		fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"type\":\"function\",\"function\":{\"name\":%s,\"arguments\":\"\"}}]}}]}\n\n", name)
+		for chunk := range textChunks(string(toolCalls[answer].Input), 16) {
+			arguments, _ := json.Marshal(chunk)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":%s}}]}}]}\n\n", arguments)
+		}
+	})
+}
+
+// chatServer calls stream with the index of the answer to stream, the last
+// one being repeated once every answer was streamed. Each answer used 1000
+// input tokens and 200 output tokens.
+func chatServer(t *testing.T, answersCount int, stream func(w io.Writer, answer int)) (server *httptest.Server, requests func() []map[string]any) {
+	mu := sync.Mutex{}
+	receivedRequests := []map[string]any{}
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		request := map[string]any{}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		assert.NoError(t, err)
+
+		mu.Lock()
+		answer := min(len(receivedRequests), answersCount-1)
+		receivedRequests = append(receivedRequests, request)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		stream(w, answer)
+		streamOptions, _ := request["stream_options"].(map[string]any)
+		if streamOptions["include_usage"] == true {
+			fmt.Fprintf(w, "data: {\"model\":%q,\"choices\":[],\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":200}}\n\n", request["model"])
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return receivedRequests
+	}
+}
+
+func textChunks(text string, size int) func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(text) > 0 {
+			end := min(size, len(text))
+			if !yield(text[:end]) {
+				return
+			}
+			text = text[end:]
+		}
+	}
+}
+
+func TestOpenAICompatibleGenerator(t *testing.T) {
+	t.Parallel()
+
+	feature := generatedFeature("tasks", "Tasks", "get-tasks")
+	featureJson, err := json.Marshal(feature)
+	assert.NoError(t, err)
+
+	t.Run("generate", func(t *testing.T) {
+		t.Parallel()
+
+		server, requests := chatCompletionServer(t, string(featureJson))
+		temperature := 0.2
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider:    features.OpenAICompatibleProvider,
+			Model:       "llama3",
+			MaxTokens:   2000,
+			Temperature: &temperature,
+			BaseURL:     server.URL + "/v1/",
+			APIKey:      "secret",
+		})
+		assert.NoError(t, err)
+
+		phases := []features.GenerationPhase{}
+		answer := strings.Builder{}
+		var usage *features.AIUsage
+		ctx := features.WithGenerationProgress(context.Background(), func(event *features.GenerationEvent) {
+			phases = append(phases, event.Phase)
+			answer.WriteString(event.Text)
+			if event.Phase == features.UsagePhase {
+				usage = event.Usage
+			}
+		})
+
+		generatedFeature, err := aiGenerator.Generate(ctx, "list the tasks", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, generatedFeature)
+		assert.Equal(t, string(featureJson), answer.String())
+		assert.Equal(t, features.PromptBuiltPhase, phases[0])
+		assert.Equal(t, features.TokensPhase, phases[1])
+		assert.Equal(t, features.UsagePhase, phases[len(phases)-2])
+		assert.Equal(t, features.ParsedPhase, phases[len(phases)-1])
+		assert.Equal(t, "llama3", usage.Model)
+		assert.Equal(t, 1000, usage.InputTokens)
+		assert.Equal(t, 200, usage.OutputTokens)
+
+		assert.Len(t, requests(), 1)
+		request := requests()[0]
+		assert.Equal(t, "llama3", request["model"])
+		assert.Equal(t, 2000.0, request["max_tokens"])
+		assert.Equal(t, 0.2, request["temperature"])
+		assert.Equal(t, true, request["stream"])
+		assert.Equal(t, map[string]any{"include_usage": true}, request["stream_options"])
+
+		messages := request["messages"].([]any)
+		assert.Len(t, messages, 2)
+		system := messages[0].(map[string]any)
+		assert.Equal(t, "system", system["role"])
+		assert.Contains(t, system["content"], "CREATE TABLE tasks")
+		assert.Equal(t, map[string]any{"role": "user", "content": "list the tasks"}, messages[1])
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		t.Parallel()
+
+		server, requests := chatCompletionServer(t, "Here is the feature", string(featureJson))
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider: features.OpenAICompatibleProvider,
+			Model:    "llama3",
+			BaseURL:  server.URL + "/v1",
+			APIKey:   "secret",
+		})
+		assert.NoError(t, err)
+
+		_, err = aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		invalidAnswerErr := &features.InvalidAnswerError{}
+		assert.ErrorAs(t, err, &invalidAnswerErr)
+		assert.Equal(t, "Here is the feature", invalidAnswerErr.Answer)
+
+		attempts := []*features.GenerationAttempt{{
+			Answer:      invalidAnswerErr.Answer,
+			Diagnostics: []*features.Diagnostic{{Source: features.AnswerDiagnostic, Message: invalidAnswerErr.Err.Error()}},
+		}}
+		generatedFeature, err := aiGenerator.Repair(context.Background(), "list the tasks", nil, attempts)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, generatedFeature)
+
+		request := requests()[1]
+		assert.Equal(t, float64(features.DefaultAIMaxTokens), request["max_tokens"])
+		assert.Equal(t, features.DefaultAITemperature, request["temperature"])
+
+		messages := request["messages"].([]any)
+		assert.Len(t, messages, 4)
+		assert.Equal(t, map[string]any{"role": "assistant", "content": "Here is the feature"}, messages[2])
+		assert.Equal(t, "user", messages[3].(map[string]any)["role"])
+		assert.Contains(t, messages[3].(map[string]any)["content"], "[answer]")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		server, _ := chatCompletionServer(t, `{"error": "there is no tasks table"}`)
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider: features.OpenAICompatibleProvider,
+			Model:    "llama3",
+			BaseURL:  server.URL + "/v1",
+			APIKey:   "secret",
+		})
+		assert.NoError(t, err)
+
+		_, err = aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		assert.EqualError(t, err, "AI error: there is no tasks table")
+
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "model llama3 not found", http.StatusNotFound)
+		}))
+		t.Cleanup(unavailable.Close)
+
+		aiGenerator, err = features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider: features.OpenAICompatibleProvider,
+			Model:    "llama3",
+			BaseURL:  unavailable.URL,
+		})
+		assert.NoError(t, err)
+
+		_, err = aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		assert.ErrorContains(t, err, "404 Not Found: model llama3 not found")
+	})
+
+	t.Run("tool calls", func(t *testing.T) {
+		t.Parallel()
+
+		server, requests := toolCallServer(t,
+			&features.AIToolCall{Name: features.CreateFeatureTool, Input: featureJson},
+			&features.AIToolCall{Name: features.ReportErrorTool, Input: json.RawMessage(`{"error": "there are no users"}`)},
+			&features.AIToolCall{Name: "create_report", Input: featureJson},
+		)
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider: features.OpenAICompatibleProvider,
+			Model:    "llama3",
+			BaseURL:  server.URL + "/v1",
+			APIKey:   "secret",
+		})
+		assert.NoError(t, err)
+
+		answer := strings.Builder{}
+		ctx := features.WithGenerationProgress(context.Background(), func(event *features.GenerationEvent) {
+			answer.WriteString(event.Text)
+		})
+
+		generatedFeature, err := aiGenerator.Generate(ctx, "list the tasks", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, generatedFeature)
+		assert.Equal(t, string(featureJson), answer.String())
+
+		request := requests()[0]
+		assert.Equal(t, "required", request["tool_choice"])
+		toolNames := []any{}
+		for _, tool := range request["tools"].([]any) {
+			function := tool.(map[string]any)["function"].(map[string]any)
+			assert.Equal(t, "object", function["parameters"].(map[string]any)["type"])
+			toolNames = append(toolNames, function["name"])
+		}
+		assert.Equal(t, []any{features.CreateFeatureTool, features.ReportErrorTool}, toolNames)
+		system := request["messages"].([]any)[0].(map[string]any)
+		assert.Contains(t, system["content"], "calling either the create_feature tool")
+
+		_, err = aiGenerator.Generate(context.Background(), "list the users", nil)
+		assert.EqualError(t, err, "AI error: there are no users")
+
+		_, err = aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		invalidAnswerErr := &features.InvalidAnswerError{}
+		assert.ErrorAs(t, err, &invalidAnswerErr)
+		assert.ErrorContains(t, invalidAnswerErr.Err, `unknown tool "create_report"`)
+	})
+
+	t.Run("text answers", func(t *testing.T) {
+		t.Parallel()
+
+		server, requests := chatCompletionServer(t,
+			"Here is the feature:\n\n```json\n"+string(featureJson)+"\n```\n\nIt lists the tasks.",
+			"Sure! "+string(featureJson)+" Let me know if you need anything else.",
+		)
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider:     features.OpenAICompatibleProvider,
+			Model:        "llama3",
+			BaseURL:      server.URL + "/v1",
+			APIKey:       "secret",
+			DisableTools: true,
+		})
+		assert.NoError(t, err)
+
+		// fenced
+		generatedFeature, err := aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, generatedFeature)
+
+		// wrapped in prose
+		generatedFeature, err = aiGenerator.Generate(context.Background(), "list the tasks", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, feature, generatedFeature)
+
+		request := requests()[0]
+		assert.NotContains(t, request, "tools")
+		assert.NotContains(t, request, "tool_choice")
+		system := request["messages"].([]any)[0].(map[string]any)
+		assert.Contains(t, system["content"], "parsed by JSON decoder")
+	})
+}
+
+// anthropicToolCallServer streams a create_feature tool call with input,
+// split in chunks of a few characters. requests returns the bodies received
+// so far.
+func anthropicToolCallServer(t *testing.T, input string) (server *httptest.Server, requests func() []map[string]any) {
+	mu := sync.Mutex{}
+	receivedRequests := []map[string]any{}
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+
+		request := map[string]any{}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		assert.NoError(t, err)
+
+		mu.Lock()
+		receivedRequests = append(receivedRequests, request)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		event := func(name string, data string) {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+		}
+		event("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-3-7-sonnet-latest","usage":{"input_tokens":10,"output_tokens":1}}}`)
+		event("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"create_feature","input":{}}}`)
+		for chunk := range textChunks(input, 16) {
+			partialJson, _ := json.Marshal(chunk)
+			event("content_block_delta", fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":%s}}`, partialJson))
+		}
+		event("content_block_stop", `{"type":"content_block_stop","index":0}`)
+		event("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":100}}`)
+		event("message_stop", `{"type":"message_stop"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return receivedRequests
+	}
+}
+
+func TestAnthropicGenerator(t *testing.T) {
+	t.Parallel()
+
+	feature := generatedFeature("tasks", "Tasks", "get-tasks")
+	featureJson, err := json.Marshal(feature)
+	assert.NoError(t, err)
+
+	server, requests := anthropicToolCallServer(t, string(featureJson))
+	aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+		BaseURL: server.URL,
+		APIKey:  "secret",
+	})
+	assert.NoError(t, err)
+
+	answer := strings.Builder{}
+	var usage *features.AIUsage
+	ctx := features.WithGenerationProgress(context.Background(), func(event *features.GenerationEvent) {
+		answer.WriteString(event.Text)
+		if event.Phase == features.UsagePhase {
+			usage = event.Usage
+		}
+	})
+
+	generatedFeature, err := aiGenerator.Generate(ctx, "list the tasks", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, feature, generatedFeature)
+	assert.Equal(t, string(featureJson), answer.String())
+	assert.Equal(t, "claude-3-7-sonnet-latest", usage.Model)
+	assert.Equal(t, 10, usage.InputTokens)
+	assert.Equal(t, 100, usage.OutputTokens)
+
+	request := requests()[0]
+	assert.Equal(t, map[string]any{"type": "any", "disable_parallel_tool_use": true}, request["tool_choice"])
+
+	tools := request["tools"].([]any)
+	assert.Len(t, tools, 2)
+	createFeature := tools[0].(map[string]any)
+	assert.Equal(t, features.CreateFeatureTool, createFeature["name"])
+	inputSchema := createFeature["input_schema"].(map[string]any)
+	assert.Equal(t, "object", inputSchema["type"])
+	assert.Contains(t, inputSchema["required"], "reactComponent")
+	assert.NotContains(t, inputSchema, "$schema")
+	assert.Equal(t, features.ReportErrorTool, tools[1].(map[string]any)["name"])
+}
+
+func TestNewAIGenerator(t *testing.T) {
+	t.Parallel()
+
+	_, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{Provider: "gemini"})
+	assert.ErrorIs(t, err, features.ErrUnknownAIProvider)
+
+	_, err = features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{Provider: features.OpenAICompatibleProvider})
+	assert.ErrorIs(t, err, features.ErrMissingAIModel)
+
+	aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &features.AnthropicGenerator{}, aiGenerator)
+
+	features.RegisterAIProvider("scripted", func(config *features.AIGeneratorConfig, instructions *features.AIInstructions) (features.IAIGenerator, error) {
+		return &scriptedAIGenerator{}, nil
+	})
+	aiGenerator, err = features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{Provider: "scripted"})
+	assert.NoError(t, err)
+	assert.IsType(t, &scriptedAIGenerator{}, aiGenerator)
+}
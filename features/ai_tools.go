@@ -0,0 +1,138 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/features/instruction_files"
+)
+
+// The tools the AI answers with, when the provider supports tool calling.
+const (
+	CreateFeatureTool = "create_feature"
+	ReportErrorTool   = "report_error"
+)
+
+// AITool is a function the AI calls to answer, so the answer is structured by
+// the provider instead of being JSON written in text.
+type AITool struct {
+	Name        string
+	Description string
+	// JSON schema of the tool input, an object
+	InputSchema map[string]any
+}
+
+// AIToolCall is an answer given by calling a tool.
+type AIToolCall struct {
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+func newAITools() ([]*AITool, error) {
+	featureSchema, err := toolInputSchema(instruction_files.FeatureJSONSchema.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature schema: %w", err)
+	}
+
+	errorSchema, err := toolInputSchema(instruction_files.ErrorJSONSchema.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error schema: %w", err)
+	}
+
+	return []*AITool{
+		{
+			Name:        CreateFeatureTool,
+			Description: "Creates the feature asked by the user, or replaces the feature being changed.",
+			InputSchema: featureSchema,
+		},
+		{
+			Name:        ReportErrorTool,
+			Description: "Reports why the feature asked by the user can't be created with the database.",
+			InputSchema: errorSchema,
+		},
+	}, nil
+}
+
+// toolInputSchema reads a JSON schema as a tool input schema, which doesn't
+// declare its JSON schema version.
+func toolInputSchema(schemaJson string) (map[string]any, error) {
+	schema := map[string]any{}
+	err := json.Unmarshal([]byte(schemaJson), &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(schema, "$schema")
+	return schema, nil
+}
+
+// Tools returns the tools the AI must answer with, or nil when tools are
+// disabled and the answer is read from text.
+func (i *AIInstructions) Tools() []*AITool {
+	return i.tools
+}
+
+// ParseToolCall reads the feature from an answer given by calling a tool. It
+// fails like ParseAnswer.
+func (i *AIInstructions) ParseToolCall(ctx context.Context, toolCall *AIToolCall) (*Feature, error) {
+	recordToolCall(ctx, toolCall)
+
+	input := toolCall.Input
+	// some models send the input JSON encoded as a string
+	encodedInput := ""
+	if json.Unmarshal(input, &encodedInput) == nil {
+		input = json.RawMessage(encodedInput)
+	}
+
+	switch toolCall.Name {
+	case ReportErrorTool:
+		errorStructure := &AIGenerationError{}
+		err := json.Unmarshal(input, errorStructure)
+		if err != nil {
+			return nil, &InvalidAnswerError{Answer: string(input), Err: fmt.Errorf("invalid %s input: %w", ReportErrorTool, err)}
+		}
+		log.Info().Msg("The AI could not generate the feature")
+		return nil, fmt.Errorf("AI error: %s", errorStructure.Error)
+	case CreateFeatureTool:
+		feature := &Feature{}
+		err := json.Unmarshal(input, feature)
+		if err != nil {
+			return nil, &InvalidAnswerError{Answer: string(input), Err: fmt.Errorf("invalid %s input: %w", CreateFeatureTool, err)}
+		}
+		log.Info().Msg("Successfully parsed AI answer")
+		reportProgress(ctx, &GenerationEvent{Phase: ParsedPhase})
+		return feature, nil
+	}
+
+	return nil, &InvalidAnswerError{
+		Answer: string(input),
+		Err:    fmt.Errorf("unknown tool %s, answer with %s or %s", strconv.Quote(toolCall.Name), CreateFeatureTool, ReportErrorTool),
+	}
+}
+
+var fencedCodeRegexp = regexp.MustCompile("(?s)```[A-Za-z]*[ \t]*\r?\n(.*?)```")
+
+// answerJSONCandidates returns the texts that may be the JSON of an answer
+// written in text, most likely first: the whole text, the fenced code blocks,
+// and everything between the first { and the last }, for models that wrap
+// the JSON in prose.
+func answerJSONCandidates(text string) []string {
+	candidates := []string{strings.TrimSpace(text)}
+
+	for _, match := range fencedCodeRegexp.FindAllStringSubmatch(text, -1) {
+		candidates = append(candidates, strings.TrimSpace(match[1]))
+	}
+
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start >= 0 && end > start {
+		candidates = append(candidates, text[start:end+1])
+	}
+
+	return candidates
+}
@@ -2,180 +2,157 @@ package features
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"log"
-
-	_ "embed"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/prigas-dev/backoffice-ai/features/instruction_files"
-	"github.com/prigas-dev/backoffice-ai/operations"
-	"github.com/prigas-dev/backoffice-ai/utils"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/phuslu/log"
 )
 
-type IAIGenerator interface {
-	Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error)
-}
-
-type Feature struct {
-	Name             string                  `json:"name"`
-	Label            string                  `json:"label"`
-	Description      string                  `json:"description"`
-	ReactComponent   *ReactComponent         `json:"reactComponent"`
-	ServerOperations []*operations.Operation `json:"serverOperations"`
-}
-
-type ReactComponent struct {
-	TsxCode string `json:"tsxCode"`
-}
-
-func NewAIGenerator(databaseSchemaGenerator IDatabaseSchemaGenerator, instructionsTemplateData *InstructionsTemplateData) (IAIGenerator, error) {
-
-	schema, err := databaseSchemaGenerator.GenerateSchemaSQL()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get db schema: %w", err)
+func NewAnthropicGenerator(config *AIGeneratorConfig, instructions *AIInstructions) (IAIGenerator, error) {
+	model := config.Model
+	if len(model) == 0 {
+		model = anthropic.ModelClaude3_7SonnetLatest
 	}
 
-	log.Println("Got schema from SQLite3 database")
-	anthropicGenerator := &AnthropicGenerator{
-		instructionsTemplateData: &AnthropicInstructionsTemplateData{
-			SystemName:        instructionsTemplateData.SystemName,
-			SystemDescription: instructionsTemplateData.SystemDescription,
-			DatabaseEngine:    instructionsTemplateData.DatabaseEngine,
-			DatabaseHints:     instructionsTemplateData.DatabaseHints,
-			FeatureJSONSchema: instruction_files.FeatureJSONSchema.Content,
-			ErrorJSONSchema:   instruction_files.ErrorJSONSchema.Content,
-			ValidFeatureJSON:  instruction_files.ExampleFeatureJSON.Content,
-			ValidFeatureFiles: instruction_files.ExampleFeatureFiles,
-			DatabaseSchema:    schema,
-		},
+	options := []option.RequestOption{}
+	if len(config.BaseURL) > 0 {
+		options = append(options, option.WithBaseURL(config.BaseURL))
+	}
+	if len(config.APIKey) > 0 {
+		options = append(options, option.WithAPIKey(config.APIKey))
 	}
-	return anthropicGenerator, nil
-}
 
-type InstructionsTemplateData struct {
-	SystemName        string
-	SystemDescription string
-	DatabaseEngine    string
-	DatabaseHints     string
+	return &AnthropicGenerator{
+		client:       anthropic.NewClient(options...),
+		model:        model,
+		maxTokens:    config.maxTokens(),
+		temperature:  config.temperature(),
+		instructions: instructions,
+	}, nil
 }
 
 type AnthropicGenerator struct {
-	instructionsTemplateData *AnthropicInstructionsTemplateData
-}
-
-type AnthropicInstructionsTemplateData struct {
-	SystemName        string
-	SystemDescription string
-	DatabaseEngine    string
-	DatabaseHints     string
-
-	DatabaseSchema    string
-	ErrorJSONSchema   string
-	FeatureJSONSchema string
-	ValidFeatureJSON  string
-	ValidFeatureFiles []instruction_files.File
-
-	FeatureContext string
+	client       anthropic.Client
+	model        anthropic.Model
+	maxTokens    int
+	temperature  float64
+	instructions *AIInstructions
 }
 
 func (g *AnthropicGenerator) Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	return g.generate(ctx, prompt, featureContext, nil)
+}
 
-	client := anthropic.NewClient()
-
-	templateData := AnthropicInstructionsTemplateData{
-		SystemName:        g.instructionsTemplateData.SystemName,
-		SystemDescription: g.instructionsTemplateData.SystemDescription,
-		DatabaseEngine:    g.instructionsTemplateData.DatabaseEngine,
-		DatabaseHints:     g.instructionsTemplateData.DatabaseHints,
-		DatabaseSchema:    g.instructionsTemplateData.DatabaseSchema,
-		ErrorJSONSchema:   g.instructionsTemplateData.ErrorJSONSchema,
-		FeatureJSONSchema: g.instructionsTemplateData.FeatureJSONSchema,
-		ValidFeatureJSON:  g.instructionsTemplateData.ValidFeatureJSON,
-		ValidFeatureFiles: g.instructionsTemplateData.ValidFeatureFiles,
-	}
-
-	if featureContext != nil {
-		featureContextEncoded, err := json.MarshalIndent(featureContext, "", "  ")
-		if err != nil {
-			return nil, fmt.Errorf("failed to JSON encode featureContext: %w", err)
-		}
-		templateData.FeatureContext = string(featureContextEncoded)
-	}
+func (g *AnthropicGenerator) Repair(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	return g.generate(ctx, prompt, featureContext, attempts)
+}
 
-	instructions, err := utils.DoTemplate("system-instructions", instruction_files.SystemInstructionsTemplate.Content, templateData)
+func (g *AnthropicGenerator) generate(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	instructions, err := g.instructions.System(featureContext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate instructions: %w", err)
+		return nil, err
 	}
 
-	log.Println("Executed template successfuly")
+	reportProgress(ctx, &GenerationEvent{Phase: PromptBuiltPhase})
 
-	messages := []anthropic.MessageParam{
-		{
-			Role: anthropic.MessageParamRoleUser,
-			Content: []anthropic.ContentBlockParamUnion{
-				anthropic.ContentBlockParamOfRequestTextBlock(prompt),
-			},
-		},
+	messages := []anthropic.MessageParam{}
+	for _, message := range g.instructions.Conversation(conversationHistory(ctx), prompt, attempts) {
+		content := anthropic.ContentBlockParamOfRequestTextBlock(message.Text)
+		if message.Role == AssistantRole {
+			messages = append(messages, anthropic.NewAssistantMessage(content))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(content))
+		}
 	}
 
-	anthropicResponse, err := client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:       anthropic.ModelClaude3_7SonnetLatest,
-		MaxTokens:   10_000,
-		Temperature: anthropic.Float(0.5),
+	params := anthropic.MessageNewParams{
+		Model:       g.model,
+		MaxTokens:   int64(g.maxTokens),
+		Temperature: anthropic.Float(g.temperature),
 		System: []anthropic.TextBlockParam{
 			{
 				Text: instructions,
 			},
 		},
 		Messages: messages,
-	})
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to anthropic: %w", err)
+	options := []option.RequestOption{}
+	tools := g.instructions.Tools()
+	if len(tools) > 0 {
+		params.Tools, options = anthropicTools(tools)
+		// the AI must answer with one of the tools, never with text
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{
+			OfToolChoiceAny: &anthropic.ToolChoiceAnyParam{DisableParallelToolUse: anthropic.Bool(true)},
+		}
 	}
 
-	log.Println("Got response from anthropic")
+	// streamed, so the progress can be reported while the answer is written
+	startedAt := time.Now()
+	stream := g.client.Messages.NewStreaming(ctx, params, options...)
+	defer stream.Close()
 
-	var lastErr error = nil
+	anthropicResponse := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
 
-	for _, block := range anthropicResponse.Content {
-		switch block := block.AsAny().(type) {
-		case anthropic.TextBlock:
-
-			log.Println(block.Text)
-
-			errorStructure := &AIGenerationError{}
-			err := json.Unmarshal([]byte(block.Text), errorStructure)
-			if err == nil {
-				if len(errorStructure.Error) > 0 {
-					log.Println("Anthropic could not generate the view")
-					return nil, fmt.Errorf("anthropic error: %s", errorStructure.Error)
-				}
-			}
+		err := anthropicResponse.Accumulate(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read anthropic response: %w", err)
+		}
 
-			feature := &Feature{}
-			err = json.Unmarshal([]byte(block.Text), feature)
-			if err == nil {
-				log.Println("Successfully parsed anthropic response")
-				return feature, nil
+		switch event := event.AsAny().(type) {
+		case anthropic.ContentBlockDeltaEvent:
+			switch delta := event.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: delta.Text})
+			case anthropic.InputJSONDelta:
+				reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: delta.PartialJSON})
 			}
-
-			lastErr = fmt.Errorf("failed to parse anthropic response, %s: %w", block.Text, err)
 		}
 	}
 
-	if lastErr == nil {
-		return nil, ErrNoValidAnthropicResponse
+	err = stream.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to anthropic: %w", err)
 	}
 
-	return nil, lastErr
-}
+	log.Info().Msg("Got response from anthropic")
+	reportProgress(ctx, &GenerationEvent{Phase: UsagePhase, Usage: &AIUsage{
+		Model:        string(anthropicResponse.Model),
+		InputTokens:  int(anthropicResponse.Usage.InputTokens),
+		OutputTokens: int(anthropicResponse.Usage.OutputTokens),
+		LatencyMs:    time.Since(startedAt).Milliseconds(),
+	}})
 
-var ErrNoValidAnthropicResponse = errors.New("anthropic did not return any valid response")
+	blocks := []string{}
+	for _, block := range anthropicResponse.Content {
+		switch block.Type {
+		case "tool_use":
+			return g.instructions.ParseToolCall(ctx, &AIToolCall{Name: block.Name, Input: block.Input})
+		case "text":
+			blocks = append(blocks, block.Text)
+		}
+	}
 
-type AIGenerationError struct {
-	Error string `json:"error"`
+	// the AI answered with text even though it was asked to call a tool
+	return g.instructions.ParseAnswer(ctx, blocks)
+}
+
+// anthropicTools returns the tools of a request, and the options setting their
+// input schemas as they are, with their required fields and definitions,
+// which anthropic.ToolInputSchemaParam doesn't encode.
+func anthropicTools(tools []*AITool) ([]anthropic.ToolUnionParam, []option.RequestOption) {
+	anthropicTools := []anthropic.ToolUnionParam{}
+	options := []option.RequestOption{}
+	for i, tool := range tools {
+		anthropicTool := anthropic.ToolUnionParamOfTool(anthropic.ToolInputSchemaParam{}, tool.Name)
+		anthropicTool.OfTool.Description = anthropic.String(tool.Description)
+
+		anthropicTools = append(anthropicTools, anthropicTool)
+		options = append(options, option.WithJSONSet(fmt.Sprintf("tools.%d.input_schema", i), tool.InputSchema))
+	}
+	return anthropicTools, options
 }
@@ -2,10 +2,15 @@ package features
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"path"
 	"strings"
+	"sync"
 
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/operations"
 	"github.com/prigas-dev/backoffice-ai/utils"
 	"github.com/spf13/afero"
 )
@@ -13,23 +18,71 @@ import (
 type IComponentStore interface {
 	AddComponent(name string, tsxCode []byte) error
 	GetComponent(name string) ([]byte, error)
+	DeleteComponent(name string) error
 }
 
-func NewFsComponentStore(fs ComponentsFs) IComponentStore {
-	return &FsComponentStore{
-		fs: fs,
+var ErrComponentNotFound = errors.New("component not found")
+
+func NewFsComponentStore(fs ComponentsFs, operationStore operations.IOperationStore) IComponentStore {
+	s := &FsComponentStore{
+		frontendSources: frontendSources{
+			fs:             fs,
+			operationStore: operationStore,
+		},
 	}
+
+	s.watchOperations()
+
+	return s
 }
 
 type ComponentsFs afero.Fs
 
 type FsComponentStore struct {
-	fs ComponentsFs
+	frontendSources
+}
+
+// frontendSources writes the component files and the sources generated from
+// them and from the operations, which are bundled by the frontend builder.
+type frontendSources struct {
+	// features.tsx is generated from the components folder, so concurrent
+	// writes could leave a component out of it
+	mu             sync.Mutex
+	fs             ComponentsFs
+	operationStore operations.IOperationStore
+}
+
+// watchOperations regenerates the operations client whenever an operation
+// changes. Components import the typed client, so it must follow the stored
+// operations before the frontend is built.
+func (s *frontendSources) watchOperations() {
+	s.operationStore.OnOperationChanged(func(operationName string) {
+		err := s.regenerateOperationsClient()
+		if err != nil {
+			log.Error().Msgf("failed to regenerate operations client after operation %s changed: %v", operationName, err)
+		}
+	})
 }
 
 var componentsFolder = path.Join("src", "components")
 
 func (s *FsComponentStore) AddComponent(name string, tsxCode []byte) error {
+	return s.writeComponent(name, tsxCode)
+}
+
+func (s *FsComponentStore) DeleteComponent(name string) error {
+	_, err := s.fs.Stat(path.Join(componentsFolder, fmt.Sprintf("%s.tsx", name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete component %s: %w", name, ErrComponentNotFound)
+	}
+
+	return s.removeComponent(name)
+}
+
+func (s *frontendSources) writeComponent(name string, tsxCode []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.fs.MkdirAll(componentsFolder, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create components folder: %w", err)
@@ -48,10 +101,27 @@ func (s *FsComponentStore) AddComponent(name string, tsxCode []byte) error {
 	return nil
 }
 
+func (s *frontendSources) removeComponent(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.fs.Remove(path.Join(componentsFolder, fmt.Sprintf("%s.tsx", name)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove component file: %w", err)
+	}
+
+	err = s.regenerateFeatureComponentsList()
+	if err != nil {
+		return fmt.Errorf("failed to regenerate root: %w", err)
+	}
+
+	return nil
+}
+
 //go:embed features.tsx.tmpl
 var featuresTsxTemplate string
 
-func (s *FsComponentStore) regenerateFeatureComponentsList() error {
+func (s *frontendSources) regenerateFeatureComponentsList() error {
 	componentNames := []string{}
 	componentFiles, err := afero.ReadDir(s.fs, componentsFolder)
 	if err != nil {
@@ -60,11 +130,11 @@ func (s *FsComponentStore) regenerateFeatureComponentsList() error {
 
 	for _, info := range componentFiles {
 		if info.IsDir() {
-			return nil
+			continue
 		}
 
 		if !strings.HasSuffix(info.Name(), ".tsx") {
-			return nil
+			continue
 		}
 
 		componentName := strings.TrimSuffix(info.Name(), ".tsx")
@@ -88,8 +158,85 @@ func (s *FsComponentStore) regenerateFeatureComponentsList() error {
 	return nil
 }
 
+//go:embed operations.ts.tmpl
+var operationsTsTemplate string
+
+type operationClientTemplateData struct {
+	Name           string
+	TypeName       string
+	FunctionName   string
+	ParametersType string
+	ResultType     string
+	NoParameters   bool
+}
+
+func (s *frontendSources) regenerateOperationsClient() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the components using broken operations fail to build, the others
+	// still can
+	allOperations, _, err := s.operationStore.ListOperations()
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	operationsTs, err := renderOperationsClient(allOperations)
+	if err != nil {
+		return err
+	}
+
+	err = afero.WriteFile(s.fs, "src/operations.ts", []byte(operationsTs), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write operations.ts file: %w", err)
+	}
+
+	return nil
+}
+
+// renderOperationsClient generates operations.ts, the typed client of the
+// operations imported by the components.
+func renderOperationsClient(allOperations []*operations.Operation) (string, error) {
+	operationsData := utils.Map(allOperations, func(operation *operations.Operation) *operationClientTemplateData {
+		typeName := operations.TypeScriptName(operation.Name)
+		parameters := &operations.ValueSchema{
+			Type: operations.Object,
+			Spec: &operations.ObjectSpec{Properties: operation.Parameters},
+		}
+		resultType := "unknown"
+		if operation.Return != nil {
+			resultType = operation.Return.ToTypeScript(0)
+		}
+
+		return &operationClientTemplateData{
+			Name:           operation.Name,
+			TypeName:       typeName,
+			FunctionName:   operationClientFunctionName(typeName),
+			ParametersType: parameters.ToTypeScript(0),
+			ResultType:     resultType,
+			NoParameters:   len(operation.Parameters) == 0,
+		}
+	})
+
+	operationsTs, err := utils.DoTemplate("operations.ts", operationsTsTemplate, map[string]any{
+		"Operations": operationsData,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate operations.ts: %w", err)
+	}
+
+	return operationsTs, nil
+}
+
+func operationClientFunctionName(typeName string) string {
+	return strings.ToLower(typeName[:1]) + typeName[1:]
+}
+
 func (s *FsComponentStore) GetComponent(name string) ([]byte, error) {
 	content, err := afero.ReadFile(s.fs, path.Join(componentsFolder, fmt.Sprintf("%s.tsx", name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read component %s.tsx: %w", name, ErrComponentNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read component %s.tsx: %w", name, err)
 	}
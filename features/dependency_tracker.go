@@ -0,0 +1,288 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+var ErrOperationNotReferenced = errors.New("operation is not used by any feature")
+
+// IDependencyTracker follows which features use which operations, so that
+// operations no feature uses anymore can be found and removed.
+type IDependencyTracker interface {
+	BuildGraph() (*DependencyGraph, error)
+	// CheckOperationExecutable fails with ErrOperationNotReferenced when no
+	// feature uses the operation, unless unreferenced operations are allowed.
+	CheckOperationExecutable(operationName string) error
+	// CollectOrphanedOperations deletes the operations no feature uses. With
+	// dryRun it only reports them.
+	CollectOrphanedOperations(dryRun bool) (*GarbageCollection, error)
+}
+
+type DependencyConfig struct {
+	// lets operations no feature uses be executed
+	AllowUnreferencedOperations bool
+
+	// orphaned operations whose active version is more recent than this are
+	// kept, since the feature using them may still be being stored
+	GarbageCollectionMinAge time.Duration
+}
+
+type DependencyGraph struct {
+	// FeatureOperations maps each feature, including broken ones, to the
+	// operations it uses
+	FeatureOperations map[string][]string `json:"featureOperations"`
+	// OperationFeatures maps each stored operation to the features using it
+	OperationFeatures map[string][]string `json:"operationFeatures"`
+	// OrphanedOperations are stored, but no feature uses them
+	OrphanedOperations []string `json:"orphanedOperations"`
+	// DanglingReferences are operations used by a feature, but not stored
+	DanglingReferences []*DanglingReference `json:"danglingReferences"`
+	// UnreadableFeatures are broken features whose manifest can't be read, so
+	// the operations they use are unknown
+	UnreadableFeatures []string `json:"unreadableFeatures"`
+}
+
+type DanglingReference struct {
+	Feature   string `json:"feature"`
+	Operation string `json:"operation"`
+}
+
+type GarbageCollection struct {
+	DryRun bool `json:"dryRun"`
+	// Deleted are the orphaned operations removed, or to be removed in a dry run
+	Deleted []string `json:"deleted"`
+	// Kept are orphaned operations changed too recently to be removed
+	Kept []string `json:"kept"`
+}
+
+func NewDependencyTracker(featureStore IFeatureStore, operationStore operations.IOperationStore, config *DependencyConfig) IDependencyTracker {
+	if config == nil {
+		config = &DependencyConfig{}
+	}
+
+	tracker := &DependencyTracker{
+		featureStore:   featureStore,
+		operationStore: operationStore,
+		config:         config,
+	}
+
+	featureStore.OnFeatureChanged(func(string) { tracker.invalidateReferencedOperations() })
+	operationStore.OnOperationChanged(func(string) { tracker.invalidateReferencedOperations() })
+
+	return tracker
+}
+
+type DependencyTracker struct {
+	featureStore   IFeatureStore
+	operationStore operations.IOperationStore
+	config         *DependencyConfig
+
+	// referencedOperations caches the operations used by any feature, since
+	// they are checked on every execution. It's nil until built, and reset
+	// whenever a feature or an operation changes.
+	mu                   sync.Mutex
+	referencedOperations map[string]bool
+	// generation counts the invalidations, so a set built while a feature
+	// changed isn't cached
+	generation int
+}
+
+func (d *DependencyTracker) BuildGraph() (*DependencyGraph, error) {
+	featureOperations, unreadableFeatures, err := d.featureOperations()
+	if err != nil {
+		return nil, err
+	}
+
+	storedOperations, brokenOperations, err := d.operationStore.ListOperations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	graph := &DependencyGraph{
+		FeatureOperations:  featureOperations,
+		OperationFeatures:  map[string][]string{},
+		OrphanedOperations: []string{},
+		DanglingReferences: []*DanglingReference{},
+		UnreadableFeatures: unreadableFeatures,
+	}
+
+	for _, operation := range storedOperations {
+		graph.OperationFeatures[operation.Name] = []string{}
+	}
+	// broken operations are stored too, features using them are fixed with
+	// the operation, and unused ones can be collected
+	for _, brokenOperation := range brokenOperations {
+		graph.OperationFeatures[brokenOperation.Name] = []string{}
+	}
+
+	for _, featureName := range slices.Sorted(maps.Keys(featureOperations)) {
+		for _, operationName := range featureOperations[featureName] {
+			usingFeatures, isStored := graph.OperationFeatures[operationName]
+			if !isStored {
+				graph.DanglingReferences = append(graph.DanglingReferences, &DanglingReference{
+					Feature:   featureName,
+					Operation: operationName,
+				})
+				continue
+			}
+
+			if !slices.Contains(usingFeatures, featureName) {
+				graph.OperationFeatures[operationName] = append(usingFeatures, featureName)
+			}
+		}
+	}
+
+	for _, operationName := range slices.Sorted(maps.Keys(graph.OperationFeatures)) {
+		if len(graph.OperationFeatures[operationName]) == 0 {
+			graph.OrphanedOperations = append(graph.OrphanedOperations, operationName)
+		}
+	}
+
+	return graph, nil
+}
+
+// featureOperations returns the operations used by each feature. Broken
+// features count too, so fixing them doesn't require regenerating their
+// operations. Broken features without a readable manifest are returned
+// separately.
+func (d *DependencyTracker) featureOperations() (map[string][]string, []string, error) {
+	featureManifests, brokenFeatures, err := d.featureStore.GetAllFeatures()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get features: %w", err)
+	}
+
+	featureOperations := map[string][]string{}
+	unreadableFeatures := []string{}
+	for _, featureManifest := range featureManifests {
+		featureOperations[featureManifest.Name] = featureManifest.Operations
+	}
+	for _, brokenFeature := range brokenFeatures {
+		if brokenFeature.Operations == nil {
+			unreadableFeatures = append(unreadableFeatures, brokenFeature.Name)
+			continue
+		}
+		featureOperations[brokenFeature.Name] = brokenFeature.Operations
+	}
+
+	return featureOperations, unreadableFeatures, nil
+}
+
+func (d *DependencyTracker) CheckOperationExecutable(operationName string) error {
+	if d.config.AllowUnreferencedOperations {
+		return nil
+	}
+
+	referencedOperations, err := d.getReferencedOperations()
+	if err != nil {
+		return err
+	}
+
+	if !referencedOperations[operationName] {
+		return fmt.Errorf("operation %s can't be executed: %w", operationName, ErrOperationNotReferenced)
+	}
+
+	return nil
+}
+
+func (d *DependencyTracker) getReferencedOperations() (map[string]bool, error) {
+	d.mu.Lock()
+	referencedOperations := d.referencedOperations
+	generation := d.generation
+	d.mu.Unlock()
+
+	if referencedOperations != nil {
+		return referencedOperations, nil
+	}
+
+	featureOperations, _, err := d.featureOperations()
+	if err != nil {
+		return nil, err
+	}
+
+	referencedOperations = map[string]bool{}
+	for _, operationNames := range featureOperations {
+		for _, operationName := range operationNames {
+			referencedOperations[operationName] = true
+		}
+	}
+
+	d.mu.Lock()
+	if d.generation == generation {
+		d.referencedOperations = referencedOperations
+	}
+	d.mu.Unlock()
+
+	return referencedOperations, nil
+}
+
+func (d *DependencyTracker) invalidateReferencedOperations() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.referencedOperations = nil
+	d.generation++
+}
+
+func (d *DependencyTracker) CollectOrphanedOperations(dryRun bool) (*GarbageCollection, error) {
+	graph, err := d.BuildGraph()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(graph.UnreadableFeatures) > 0 {
+		return nil, fmt.Errorf("feature %s is broken and the operations it uses are unknown, fix or remove it before collecting operations", graph.UnreadableFeatures[0])
+	}
+
+	collection := &GarbageCollection{
+		DryRun:  dryRun,
+		Deleted: []string{},
+		Kept:    []string{},
+	}
+
+	for _, operationName := range graph.OrphanedOperations {
+		isRecent, err := d.isRecentlyChanged(operationName)
+		if err != nil {
+			return nil, err
+		}
+		if isRecent {
+			collection.Kept = append(collection.Kept, operationName)
+			continue
+		}
+
+		if !dryRun {
+			err := d.operationStore.DeleteOperation(operationName)
+			if err != nil && !errors.Is(err, operations.ErrOperationNotFound) {
+				return nil, fmt.Errorf("failed to delete orphaned operation %s: %w", operationName, err)
+			}
+		}
+		collection.Deleted = append(collection.Deleted, operationName)
+	}
+
+	return collection, nil
+}
+
+func (d *DependencyTracker) isRecentlyChanged(operationName string) (bool, error) {
+	if d.config.GarbageCollectionMinAge <= 0 {
+		return false, nil
+	}
+
+	versions, err := d.operationStore.ListOperationVersions(operationName)
+	if err != nil {
+		return false, fmt.Errorf("failed to list operation %s versions: %w", operationName, err)
+	}
+
+	for _, version := range versions {
+		if version.Active {
+			return time.Since(version.CreatedAt) < d.config.GarbageCollectionMinAge, nil
+		}
+	}
+
+	return false, nil
+}
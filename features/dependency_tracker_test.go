@@ -0,0 +1,116 @@
+package features_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyTracker(t *testing.T) {
+	newStores := func() (afero.Fs, features.IFeatureStore, operations.IOperationStore) {
+		featuresFs := afero.NewMemMapFs()
+		operationStore := operations.NewFsOperationStore(afero.NewMemMapFs())
+		componentStore := features.NewFsComponentStore(afero.NewMemMapFs(), operationStore)
+		featureStore := features.NewFsFeatureStore(featuresFs, operationStore, componentStore)
+
+		return featuresFs, featureStore, operationStore
+	}
+
+	t.Run("graph", func(t *testing.T) {
+		t.Parallel()
+
+		featuresFs, featureStore, operationStore := newStores()
+		tracker := features.NewDependencyTracker(featureStore, operationStore, nil)
+
+		featureStore.AddFeature(newFeature("tasks", "v1", "get-tasks", "get-users"))
+		featureStore.AddFeature(newFeature("users", "v1", "get-users", "delete-user"))
+		operationStore.AddOperation(newFeature("old", "", "get-old-tasks").ServerOperations[0])
+		operationStore.DeleteOperation("delete-user")
+		afero.WriteFile(featuresFs, "invalid/feature_manifest.json", []byte(`{`), 0755)
+
+		graph, err := tracker.BuildGraph()
+		assert.NoError(t, err)
+		assert.Equal(t, &features.DependencyGraph{
+			FeatureOperations: map[string][]string{
+				"tasks": {"get-tasks", "get-users"},
+				"users": {"get-users", "delete-user"},
+			},
+			OperationFeatures: map[string][]string{
+				"get-tasks":     {"tasks"},
+				"get-users":     {"tasks", "users"},
+				"get-old-tasks": {},
+			},
+			OrphanedOperations: []string{"get-old-tasks"},
+			DanglingReferences: []*features.DanglingReference{
+				{Feature: "users", Operation: "delete-user"},
+			},
+			UnreadableFeatures: []string{"invalid"},
+		}, graph)
+
+		_, err = tracker.CollectOrphanedOperations(false)
+		assert.ErrorContains(t, err, "invalid")
+	})
+
+	t.Run("execution of unreferenced operations", func(t *testing.T) {
+		t.Parallel()
+
+		_, featureStore, operationStore := newStores()
+		featureStore.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		operationStore.AddOperation(newFeature("old", "", "get-old-tasks").ServerOperations[0])
+
+		tracker := features.NewDependencyTracker(featureStore, operationStore, nil)
+		assert.NoError(t, tracker.CheckOperationExecutable("get-tasks"))
+		assert.ErrorIs(t, tracker.CheckOperationExecutable("get-old-tasks"), features.ErrOperationNotReferenced)
+
+		// the referenced operations are cached until a feature changes
+		featureStore.AddFeature(newFeature("old", "v1", "get-old-tasks"))
+		assert.NoError(t, tracker.CheckOperationExecutable("get-old-tasks"))
+
+		_, err := featureStore.DeleteFeature("old", false)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, tracker.CheckOperationExecutable("get-old-tasks"), features.ErrOperationNotReferenced)
+
+		tracker = features.NewDependencyTracker(featureStore, operationStore, &features.DependencyConfig{
+			AllowUnreferencedOperations: true,
+		})
+		assert.NoError(t, tracker.CheckOperationExecutable("get-old-tasks"))
+	})
+
+	t.Run("garbage collection", func(t *testing.T) {
+		t.Parallel()
+
+		_, featureStore, operationStore := newStores()
+		featureStore.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		featureStore.AddFeature(newFeature("tasks", "v2", "list-tasks"))
+
+		tracker := features.NewDependencyTracker(featureStore, operationStore, &features.DependencyConfig{
+			GarbageCollectionMinAge: time.Hour,
+		})
+
+		collection, err := tracker.CollectOrphanedOperations(false)
+		assert.NoError(t, err)
+		assert.Equal(t, &features.GarbageCollection{Deleted: []string{}, Kept: []string{"get-tasks"}}, collection)
+
+		tracker = features.NewDependencyTracker(featureStore, operationStore, nil)
+
+		collection, err = tracker.CollectOrphanedOperations(true)
+		assert.NoError(t, err)
+		assert.Equal(t, &features.GarbageCollection{DryRun: true, Deleted: []string{"get-tasks"}, Kept: []string{}}, collection)
+
+		_, err = operationStore.GetOperation("get-tasks")
+		assert.NoError(t, err)
+
+		collection, err = tracker.CollectOrphanedOperations(false)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"get-tasks"}, collection.Deleted)
+
+		_, err = operationStore.GetOperation("get-tasks")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+		_, err = operationStore.GetOperation("list-tasks")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,107 @@
+package features
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prigas-dev/backoffice-ai/frontend"
+)
+
+type DiagnosticSource string
+
+const (
+	// the AI answer is not a feature JSON
+	AnswerDiagnostic DiagnosticSource = "answer"
+	// the feature JSON doesn't follow the feature schema
+	SchemaDiagnostic DiagnosticSource = "schema"
+	// the feature or operation names can't be used as file and function names
+	NameDiagnostic DiagnosticSource = "name"
+	// an operation script doesn't compile or doesn't declare run
+	JavascriptDiagnostic DiagnosticSource = "javascript"
+	// the react component doesn't type check, bundle or export a component
+	TsxDiagnostic DiagnosticSource = "tsx"
+	// the react component calls operations that don't exist
+	ReferenceDiagnostic DiagnosticSource = "reference"
+	// the react component doesn't type check or bundle with the frontend
+	BuildDiagnostic DiagnosticSource = "build"
+)
+
+// Diagnostic is a problem found in a generated feature, reported back to
+// the AI so it can fix it.
+type Diagnostic struct {
+	Source DiagnosticSource `json:"source"`
+	// Location is the file, and the line and column when known, of the problem
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	if len(d.Location) == 0 {
+		return fmt.Sprintf("[%s] %s", d.Source, d.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", d.Source, d.Location, d.Message)
+}
+
+func formatDiagnostics(diagnostics []*Diagnostic) string {
+	lines := []string{}
+	for _, diagnostic := range diagnostics {
+		lines = append(lines, fmt.Sprintf("- %s", diagnostic))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// GenerationAttempt is an answer of the AI that could not be used.
+type GenerationAttempt struct {
+	Answer      string        `json:"answer"`
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
+
+// InvalidAnswerError is returned by AI generators when the answer can't be
+// parsed as a feature, so the answer can be sent back to be fixed.
+type InvalidAnswerError struct {
+	Answer string
+	Err    error
+}
+
+func (e *InvalidAnswerError) Error() string {
+	return fmt.Sprintf("failed to parse AI answer, %s: %v", e.Answer, e.Err)
+}
+
+func (e *InvalidAnswerError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidFeatureError is returned when a feature that isn't generated, like a
+// fork, fails validation.
+type InvalidFeatureError struct {
+	Feature     string
+	Diagnostics []*Diagnostic
+}
+
+func (e *InvalidFeatureError) Error() string {
+	return fmt.Sprintf("feature %s is invalid:\n%s", e.Feature, formatDiagnostics(e.Diagnostics))
+}
+
+// repairPrompt asks the AI to fix its last answer.
+func repairPrompt(diagnostics []*Diagnostic) string {
+	return fmt.Sprintf(`The feature you answered can't be used, these problems were found:
+%s
+
+Answer again with the whole feature JSON, fixing these problems and following the same instructions.`, formatDiagnostics(diagnostics))
+}
+
+func buildDiagnostics(source DiagnosticSource, messages []*frontend.BuildMessage) []*Diagnostic {
+	diagnostics := []*Diagnostic{}
+	for _, message := range messages {
+		diagnostic := &Diagnostic{Source: source, Message: message.Text}
+		switch {
+		case len(message.File) == 0:
+		case message.Line == 0:
+			diagnostic.Location = message.File
+		default:
+			diagnostic.Location = fmt.Sprintf("%s:%d:%d", message.File, message.Line, message.Column)
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
@@ -0,0 +1,172 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/prigas-dev/backoffice-ai/utils"
+)
+
+type IFeatureHistory interface {
+	ListRevisions(featureName string) ([]*FeatureRevisionInfo, error)
+	// DiffRevisions returns a unified diff of the files of two revisions of a
+	// feature: its manifest, its component and the code and manifest of each
+	// operation.
+	DiffRevisions(featureName string, fromRevision int, toRevision int) (string, error)
+	// RollbackFeature stores the feature of an older revision as the live
+	// feature, records it as a new revision and rebuilds the frontend.
+	RollbackFeature(featureName string, revision int) (*FeatureRevision, error)
+}
+
+func NewFeatureHistory(featureStore IFeatureStore, revisionStore IFeatureRevisionStore, frontendBuilder frontend.IBuilder) IFeatureHistory {
+	return &FeatureHistory{
+		featureStore:    featureStore,
+		revisionStore:   revisionStore,
+		frontendBuilder: frontendBuilder,
+	}
+}
+
+type FeatureHistory struct {
+	featureStore    IFeatureStore
+	revisionStore   IFeatureRevisionStore
+	frontendBuilder frontend.IBuilder
+}
+
+func (h *FeatureHistory) ListRevisions(featureName string) ([]*FeatureRevisionInfo, error) {
+	return h.revisionStore.ListFeatureRevisions(featureName)
+}
+
+func (h *FeatureHistory) DiffRevisions(featureName string, fromRevision int, toRevision int) (string, error) {
+	from, err := h.revisionStore.GetFeatureRevision(featureName, fromRevision)
+	if err != nil {
+		return "", err
+	}
+
+	to, err := h.revisionStore.GetFeatureRevision(featureName, toRevision)
+	if err != nil {
+		return "", err
+	}
+
+	return DiffFeatures(from.Feature, to.Feature)
+}
+
+func (h *FeatureHistory) RollbackFeature(featureName string, revision int) (*FeatureRevision, error) {
+	oldRevision, err := h.revisionStore.GetFeatureRevision(featureName, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// revisions from before a rename keep the old name
+	feature := *oldRevision.Feature
+	feature.Name = featureName
+
+	err = h.featureStore.AddFeature(&feature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store feature %s revision %d: %w", featureName, revision, err)
+	}
+
+	newRevision := &FeatureRevision{
+		FeatureRevisionInfo: FeatureRevisionInfo{
+			CreatedAt:      time.Now(),
+			RolledBackFrom: revision,
+		},
+		Feature: &feature,
+	}
+	err = h.revisionStore.AddFeatureRevision(newRevision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record rollback of feature %s: %w", featureName, err)
+	}
+
+	err = h.frontendBuilder.BuildFrontend()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build frontend: %w", err)
+	}
+
+	return newRevision, nil
+}
+
+// DiffFeatures returns a unified diff of the files of two features. Files
+// only in one of them are diffed against /dev/null.
+func DiffFeatures(from *Feature, to *Feature) (string, error) {
+	fromFiles, err := featureFiles(from)
+	if err != nil {
+		return "", err
+	}
+
+	toFiles, err := featureFiles(to)
+	if err != nil {
+		return "", err
+	}
+
+	fileNames := slices.Sorted(maps.Keys(fromFiles))
+	for fileName := range toFiles {
+		if _, isFromFile := fromFiles[fileName]; !isFromFile {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	slices.Sort(fileNames)
+
+	var diff strings.Builder
+	for _, fileName := range fileNames {
+		fromContent, isFromFile := fromFiles[fileName]
+		toContent, isToFile := toFiles[fileName]
+
+		fromName := "a/" + fileName
+		if !isFromFile {
+			fromName = "/dev/null"
+		}
+		toName := "b/" + fileName
+		if !isToFile {
+			toName = "/dev/null"
+		}
+
+		diff.WriteString(utils.UnifiedDiff(fromName, toName, fromContent, toContent))
+	}
+
+	return diff.String(), nil
+}
+
+// featureFiles lays out a feature as the files it is stored in.
+func featureFiles(feature *Feature) (map[string]string, error) {
+	files := map[string]string{}
+
+	featureManifest, err := json.MarshalIndent(&FeatureManifest{
+		Name:        feature.Name,
+		Label:       feature.Label,
+		Description: feature.Description,
+		Operations:  featureOperationNames(feature),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode feature %s manifest: %w", feature.Name, err)
+	}
+	files["feature_manifest.json"] = string(featureManifest) + "\n"
+
+	if feature.ReactComponent != nil {
+		files["component.tsx"] = feature.ReactComponent.TsxCode
+	}
+
+	for _, operation := range feature.ServerOperations {
+		operationManifest, err := json.MarshalIndent(&operations.OperationManifest{
+			Name:       operation.Name,
+			Kind:       operation.Kind,
+			Parameters: operation.Parameters,
+			Return:     operation.Return,
+			Limits:     operation.Limits,
+		}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode operation %s manifest: %w", operation.Name, err)
+		}
+
+		files[path.Join("operations", operation.Name, "operation_manifest.json")] = string(operationManifest) + "\n"
+		files[path.Join("operations", operation.Name, "operation.js")] = operation.JavascriptCode
+	}
+
+	return files, nil
+}
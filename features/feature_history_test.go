@@ -0,0 +1,188 @@
+package features_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsFeatureRevisionStore(t *testing.T) {
+	testFeatureRevisionStore(t, func() features.IFeatureRevisionStore {
+		return features.NewFsFeatureRevisionStore(afero.NewMemMapFs())
+	})
+}
+
+func TestSqlFeatureRevisionStore(t *testing.T) {
+	testFeatureRevisionStore(t, func() features.IFeatureRevisionStore {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return features.NewSqlFeatureRevisionStore(db)
+	})
+}
+
+func testFeatureRevisionStore(t *testing.T, newStore func() features.IFeatureRevisionStore) {
+	t.Run("add, get and list", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		revisions, err := store.ListFeatureRevisions("tasks")
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		createdAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		firstRevision := newFeatureRevision(newFeature("tasks", "v1", "get-tasks"), "list tasks", createdAt)
+		err = store.AddFeatureRevision(firstRevision)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, firstRevision.Revision)
+
+		err = store.AddFeatureRevision(newFeatureRevision(newFeature("users", "v1"), "list users", createdAt))
+		assert.NoError(t, err)
+
+		secondRevision := newFeatureRevision(newFeature("tasks", "v2", "get-tasks"), "add a filter", createdAt.Add(time.Minute))
+		err = store.AddFeatureRevision(secondRevision)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, secondRevision.Revision)
+
+		revisions, err = store.ListFeatureRevisions("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, []*features.FeatureRevisionInfo{
+			&firstRevision.FeatureRevisionInfo,
+			&secondRevision.FeatureRevisionInfo,
+		}, revisions)
+
+		revision, err := store.GetFeatureRevision("tasks", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "list tasks", revision.Prompt)
+		assert.Equal(t, "v1", revision.Feature.ReactComponent.TsxCode)
+		assert.Equal(t, `function run() { return 1 }`, revision.Feature.ServerOperations[0].JavascriptCode)
+
+		_, err = store.GetFeatureRevision("tasks", 3)
+		assert.ErrorIs(t, err, features.ErrFeatureRevisionNotFound)
+	})
+}
+
+func TestFeatureHistory(t *testing.T) {
+	t.Run("diff", func(t *testing.T) {
+		t.Parallel()
+
+		from := newFeature("tasks", "line 1\nline 2\nline 3\n", "get-tasks", "delete-task")
+		to := newFeature("tasks", "line 1\nline 2 changed\nline 3\n", "get-tasks")
+
+		diff, err := features.DiffFeatures(from, to)
+		assert.NoError(t, err)
+		assert.Equal(t, `--- a/component.tsx
++++ b/component.tsx
+@@ -1,3 +1,3 @@
+ line 1
+-line 2
++line 2 changed
+ line 3
+--- a/feature_manifest.json
++++ b/feature_manifest.json
+@@ -3,7 +3,6 @@
+   "label": "tasks",
+   "description": "",
+   "operations": [
+-    "get-tasks",
+-    "delete-task"
++    "get-tasks"
+   ]
+ }
+--- a/operations/delete-task/operation.js
++++ /dev/null
+@@ -1 +0,0 @@
+-function run() { return 1 }
+\ No newline at end of file
+--- a/operations/delete-task/operation_manifest.json
++++ /dev/null
+@@ -1,10 +0,0 @@
+-{
+-  "name": "delete-task",
+-  "parameters": {},
+-  "return": {
+-    "type": "number",
+-    "spec": {
+-      "nullable": false
+-    }
+-  }
+-}
+`, diff)
+
+		diff, err = features.DiffFeatures(to, to)
+		assert.NoError(t, err)
+		assert.Empty(t, diff)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		t.Parallel()
+
+		featureStore, operationStore, _ := newFsFeatureStore(nil)
+		revisionStore := features.NewFsFeatureRevisionStore(afero.NewMemMapFs())
+		builder := &countingBuilder{}
+		history := features.NewFeatureHistory(featureStore, revisionStore, builder)
+
+		for _, feature := range []*features.Feature{
+			newFeature("tasks", "v1", "get-tasks"),
+			newFeature("tasks", "v2", "get-tasks", "create-task"),
+		} {
+			err := featureStore.AddFeature(feature)
+			assert.NoError(t, err)
+			err = revisionStore.AddFeatureRevision(newFeatureRevision(feature, "prompt", time.Now()))
+			assert.NoError(t, err)
+		}
+
+		newRevision, err := history.RollbackFeature("tasks", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, newRevision.Revision)
+		assert.Equal(t, 1, newRevision.RolledBackFrom)
+		assert.Equal(t, 1, builder.builds)
+
+		feature, err := featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+		assert.Len(t, feature.ServerOperations, 1)
+
+		getTasks, err := operationStore.GetOperation("get-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, getTasks.Version)
+
+		revisions, err := history.ListRevisions("tasks")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 3)
+
+		_, err = history.RollbackFeature("tasks", 4)
+		assert.ErrorIs(t, err, features.ErrFeatureRevisionNotFound)
+		assert.Equal(t, 1, builder.builds)
+	})
+}
+
+type countingBuilder struct {
+	builds int
+}
+
+func (b *countingBuilder) BuildFrontend() error {
+	b.builds++
+	return nil
+}
+
+func (b *countingBuilder) Close() {}
+
+func newFeatureRevision(feature *features.Feature, prompt string, createdAt time.Time) *features.FeatureRevision {
+	return &features.FeatureRevision{
+		FeatureRevisionInfo: features.FeatureRevisionInfo{
+			CreatedAt: createdAt,
+			Prompt:    prompt,
+		},
+		Feature: feature,
+	}
+}
@@ -0,0 +1,107 @@
+package features
+
+import (
+	"fmt"
+
+	"github.com/prigas-dev/backoffice-ai/frontend"
+)
+
+// IFeatureManager deletes and renames features together with their
+// revisions and sessions, and rebuilds the frontend so it stops routing to the old name.
+type IFeatureManager interface {
+	DeleteFeature(name string, dryRun bool) (*FeatureDeletion, error)
+	RenameFeature(name string, newName string, dryRun bool) (*FeatureRename, error)
+}
+
+func NewFeatureManager(featureStore IFeatureStore, revisionStore IFeatureRevisionStore, sessionStore IFeatureSessionStore, frontendBuilder frontend.IBuilder) IFeatureManager {
+	return &FeatureManager{
+		featureStore:    featureStore,
+		revisionStore:   revisionStore,
+		sessionStore:    sessionStore,
+		frontendBuilder: frontendBuilder,
+	}
+}
+
+type FeatureManager struct {
+	featureStore    IFeatureStore
+	revisionStore   IFeatureRevisionStore
+	sessionStore    IFeatureSessionStore
+	frontendBuilder frontend.IBuilder
+}
+
+func (m *FeatureManager) DeleteFeature(name string, dryRun bool) (*FeatureDeletion, error) {
+	revisions, err := m.revisionStore.ListFeatureRevisions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	deletion, err := m.featureStore.DeleteFeature(name, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	deletion.Revisions = len(revisions)
+
+	if dryRun {
+		return deletion, nil
+	}
+
+	err = m.revisionStore.DeleteFeatureRevisions(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete revisions of feature %s: %w", name, err)
+	}
+
+	err = m.sessionStore.DeleteFeatureSessions(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete sessions of feature %s: %w", name, err)
+	}
+
+	err = m.frontendBuilder.BuildFrontend()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build frontend: %w", err)
+	}
+
+	return deletion, nil
+}
+
+func (m *FeatureManager) RenameFeature(name string, newName string, dryRun bool) (*FeatureRename, error) {
+	revisions, err := m.revisionStore.ListFeatureRevisions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// checked before renaming the feature, so the revisions can always follow it
+	newNameRevisions, err := m.revisionStore.ListFeatureRevisions(newName)
+	if err != nil {
+		return nil, err
+	}
+	if len(newNameRevisions) > 0 {
+		return nil, fmt.Errorf("failed to rename feature %s to %s: %w", name, newName, ErrFeatureHasRevisions)
+	}
+
+	rename, err := m.featureStore.RenameFeature(name, newName, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	rename.Revisions = len(revisions)
+
+	if dryRun {
+		return rename, nil
+	}
+
+	err = m.revisionStore.RenameFeatureRevisions(name, newName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move revisions of feature %s: %w", name, err)
+	}
+
+	err = m.sessionStore.RenameFeatureSessions(name, newName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move sessions of feature %s: %w", name, err)
+	}
+
+	err = m.frontendBuilder.BuildFrontend()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build frontend: %w", err)
+	}
+
+	return rename, nil
+}
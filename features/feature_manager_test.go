@@ -0,0 +1,79 @@
+package features_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureManager(t *testing.T) {
+	t.Run("revisions follow the feature", func(t *testing.T) {
+		t.Parallel()
+
+		featureStore, _, _ := newFsFeatureStore(nil)
+		revisionStore := features.NewFsFeatureRevisionStore(afero.NewMemMapFs())
+		sessionStore := features.NewFsFeatureSessionStore(afero.NewMemMapFs())
+		builder := &countingBuilder{}
+		manager := features.NewFeatureManager(featureStore, revisionStore, sessionStore, builder)
+
+		for _, feature := range []*features.Feature{
+			newFeature("tasks", "v1", "get-tasks"),
+			newFeature("tasks", "v2", "get-tasks"),
+			newFeature("users", "v1", "get-users"),
+		} {
+			err := featureStore.AddFeature(feature)
+			assert.NoError(t, err)
+			err = revisionStore.AddFeatureRevision(newFeatureRevision(feature, "prompt", time.Now()))
+			assert.NoError(t, err)
+		}
+		for id, featureName := range map[string]string{"s1": "tasks", "s2": "users", "s3": ""} {
+			err := sessionStore.SaveFeatureSession(newFeatureSession(id, featureName, time.Now()))
+			assert.NoError(t, err)
+		}
+
+		rename, err := manager.RenameFeature("tasks", "team-tasks", true)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, rename.Revisions)
+		assert.Equal(t, 0, builder.builds)
+
+		_, err = manager.RenameFeature("tasks", "team-tasks", false)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, builder.builds)
+
+		revisions, err := revisionStore.ListFeatureRevisions("team-tasks")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 2)
+		revisions, err = revisionStore.ListFeatureRevisions("tasks")
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		session, err := sessionStore.GetFeatureSession("s1")
+		assert.NoError(t, err)
+		assert.Equal(t, "team-tasks", session.FeatureName)
+
+		deletion, err := manager.DeleteFeature("users", true)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deletion.Revisions)
+		assert.Equal(t, []string{"get-users"}, deletion.Operations)
+
+		_, err = manager.DeleteFeature("users", false)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, builder.builds)
+
+		revisions, err = revisionStore.ListFeatureRevisions("users")
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		_, err = sessionStore.GetFeatureSession("s2")
+		assert.ErrorIs(t, err, features.ErrFeatureSessionNotFound)
+		sessions, err := sessionStore.ListFeatureSessions("")
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+
+		_, err = manager.DeleteFeature("users", false)
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+	})
+}
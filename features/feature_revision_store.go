@@ -0,0 +1,227 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrFeatureRevisionNotFound = errors.New("feature revision not found")
+
+// IFeatureRevisionStore keeps every generated version of a feature as a
+// numbered revision, starting at 1.
+type IFeatureRevisionStore interface {
+	// AddFeatureRevision stores revision as the next revision of its feature
+	// and sets its Revision number.
+	AddFeatureRevision(revision *FeatureRevision) error
+	GetFeatureRevision(featureName string, revision int) (*FeatureRevision, error)
+	// ListFeatureRevisions returns the revisions of a feature, oldest first.
+	// Features generated before revisions were kept have none.
+	ListFeatureRevisions(featureName string) ([]*FeatureRevisionInfo, error)
+	DeleteFeatureRevisions(featureName string) error
+	// RenameFeatureRevisions moves the revisions of a feature to newName,
+	// which must have no revisions.
+	RenameFeatureRevisions(featureName string, newName string) error
+}
+
+var ErrFeatureHasRevisions = errors.New("feature already has revisions")
+
+type FeatureRevisionInfo struct {
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Prompt is the prompt the feature was generated from, empty for rollbacks
+	// and forks
+	Prompt string `json:"prompt"`
+	// RolledBackFrom is the revision a rollback restored
+	RolledBackFrom int `json:"rolledBackFrom,omitempty"`
+}
+
+type FeatureRevision struct {
+	FeatureRevisionInfo
+	Feature *Feature `json:"feature"`
+}
+
+// FsFeatureRevisionStore keeps each revision in a file:
+//
+//	{feature name}/{revision}.json
+type FsFeatureRevisionStore struct {
+	mu sync.Mutex
+	fs FeatureRevisionsFs
+}
+
+type FeatureRevisionsFs afero.Fs
+
+func NewFsFeatureRevisionStore(fs FeatureRevisionsFs) IFeatureRevisionStore {
+	return &FsFeatureRevisionStore{
+		fs: fs,
+	}
+}
+
+func (s *FsFeatureRevisionStore) AddFeatureRevision(revision *FeatureRevision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	featureName := revision.Feature.Name
+
+	revisionNumbers, err := s.readRevisionNumbers(featureName)
+	if err != nil {
+		return err
+	}
+
+	nextRevision := 1
+	if len(revisionNumbers) > 0 {
+		nextRevision = revisionNumbers[len(revisionNumbers)-1] + 1
+	}
+
+	err = s.fs.MkdirAll(featureName, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create feature %s revisions folder: %w", featureName, err)
+	}
+
+	storedRevision := *revision
+	storedRevision.Revision = nextRevision
+
+	revisionJson, err := json.MarshalIndent(storedRevision, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feature %s revision %d: %w", featureName, nextRevision, err)
+	}
+
+	// the revision file is renamed into place once complete, so a partially
+	// written revision is never read
+	temporaryFileName := path.Join(featureName, fmt.Sprintf(".%d.json.tmp", nextRevision))
+	err = afero.WriteFile(s.fs, temporaryFileName, revisionJson, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write feature %s revision %d: %w", featureName, nextRevision, err)
+	}
+
+	err = s.fs.Rename(temporaryFileName, revisionFileName(featureName, nextRevision))
+	if err != nil {
+		s.fs.Remove(temporaryFileName)
+		return fmt.Errorf("failed to write feature %s revision %d: %w", featureName, nextRevision, err)
+	}
+
+	revision.Revision = nextRevision
+
+	return nil
+}
+
+func (s *FsFeatureRevisionStore) GetFeatureRevision(featureName string, revision int) (*FeatureRevision, error) {
+	revisionFileName := revisionFileName(featureName, revision)
+
+	revisionJson, err := afero.ReadFile(s.fs, revisionFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to get feature %s revision %d: %w", featureName, revision, ErrFeatureRevisionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", revisionFileName, err)
+	}
+
+	featureRevision := &FeatureRevision{}
+	err = json.Unmarshal(revisionJson, featureRevision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feature revision json from file %s: %w", revisionFileName, err)
+	}
+
+	return featureRevision, nil
+}
+
+func (s *FsFeatureRevisionStore) ListFeatureRevisions(featureName string) ([]*FeatureRevisionInfo, error) {
+	revisionNumbers, err := s.readRevisionNumbers(featureName)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []*FeatureRevisionInfo{}
+	for _, revisionNumber := range revisionNumbers {
+		revision, err := s.GetFeatureRevision(featureName, revisionNumber)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision.FeatureRevisionInfo)
+	}
+
+	return revisions, nil
+}
+
+func (s *FsFeatureRevisionStore) DeleteFeatureRevisions(featureName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.fs.RemoveAll(featureName)
+	if err != nil {
+		return fmt.Errorf("failed to remove feature %s revisions folder: %w", featureName, err)
+	}
+
+	return nil
+}
+
+func (s *FsFeatureRevisionStore) RenameFeatureRevisions(featureName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newRevisionNumbers, err := s.readRevisionNumbers(newName)
+	if err != nil {
+		return err
+	}
+	if len(newRevisionNumbers) > 0 {
+		return fmt.Errorf("failed to move revisions of feature %s to %s: %w", featureName, newName, ErrFeatureHasRevisions)
+	}
+
+	revisionNumbers, err := s.readRevisionNumbers(featureName)
+	if err != nil {
+		return err
+	}
+
+	err = s.fs.RemoveAll(newName)
+	if err != nil {
+		return fmt.Errorf("failed to remove feature %s revisions folder: %w", newName, err)
+	}
+
+	if len(revisionNumbers) == 0 {
+		return nil
+	}
+
+	err = s.fs.Rename(featureName, newName)
+	if err != nil {
+		return fmt.Errorf("failed to move revisions of feature %s to %s: %w", featureName, newName, err)
+	}
+
+	return nil
+}
+
+// readRevisionNumbers returns the sorted revision numbers of a feature.
+func (s *FsFeatureRevisionStore) readRevisionNumbers(featureName string) ([]int, error) {
+	files, err := afero.ReadDir(s.fs, featureName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature %s revisions folder: %w", featureName, err)
+	}
+
+	revisionNumbers := []int{}
+	for _, file := range files {
+		revisionNumber, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil || file.IsDir() {
+			// temporary files
+			continue
+		}
+		revisionNumbers = append(revisionNumbers, revisionNumber)
+	}
+	slices.Sort(revisionNumbers)
+
+	return revisionNumbers, nil
+}
+
+func revisionFileName(featureName string, revision int) string {
+	return path.Join(featureName, fmt.Sprintf("%d.json", revision))
+}
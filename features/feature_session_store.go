@@ -0,0 +1,264 @@
+package features
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrFeatureSessionNotFound = errors.New("feature session not found")
+
+type SessionMessageKind string
+
+const (
+	// a prompt of the user
+	PromptMessage SessionMessageKind = "prompt"
+	// a feature answered by the AI, as JSON, or an answer that couldn't be
+	// used
+	AnswerMessage SessionMessageKind = "answer"
+	// the problems found in the previous answer, sent back to the AI
+	FeedbackMessage SessionMessageKind = "feedback"
+	// why the previous prompt failed, e.g. the AI couldn't generate the
+	// feature
+	ErrorMessage SessionMessageKind = "error"
+)
+
+type SessionMessage struct {
+	Kind      SessionMessageKind `json:"kind"`
+	Text      string             `json:"text"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+type FeatureSessionInfo struct {
+	ID string `json:"id"`
+	// FeatureName is the feature the session generated and refines, empty
+	// until a prompt of the session generates one
+	FeatureName string `json:"featureName,omitempty"`
+	// Title is the first prompt of the session
+	Title string `json:"title"`
+	// ForkedFrom is the session this one was forked from
+	ForkedFrom string    `json:"forkedFrom,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// FeatureSession is a conversation with the AI about a feature, where each
+// prompt follows up on the previous ones.
+type FeatureSession struct {
+	FeatureSessionInfo
+	Messages []*SessionMessage `json:"messages"`
+}
+
+// conversation returns the messages of the session as they are sent to the
+// AI.
+func (s *FeatureSession) conversation() []*AIMessage {
+	messages := []*AIMessage{}
+	for _, message := range s.Messages {
+		role := UserRole
+		if message.Kind == AnswerMessage {
+			role = AssistantRole
+		}
+		messages = append(messages, &AIMessage{Role: role, Text: message.Text})
+	}
+	return messages
+}
+
+// IFeatureSessionStore keeps the feature sessions, so they can be resumed
+// after the server restarts.
+type IFeatureSessionStore interface {
+	// SaveFeatureSession adds the session, or replaces it if its ID is stored.
+	SaveFeatureSession(session *FeatureSession) error
+	GetFeatureSession(id string) (*FeatureSession, error)
+	// ListFeatureSessions returns the sessions of a feature, or every session
+	// when featureName is empty, oldest first.
+	ListFeatureSessions(featureName string) ([]*FeatureSessionInfo, error)
+	DeleteFeatureSessions(featureName string) error
+	// RenameFeatureSessions moves the sessions of a feature to newName.
+	RenameFeatureSessions(featureName string, newName string) error
+}
+
+func newFeatureSessionID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// FsFeatureSessionStore keeps each session in a file:
+//
+//	{id}.json
+type FsFeatureSessionStore struct {
+	mu sync.Mutex
+	fs FeatureSessionsFs
+}
+
+type FeatureSessionsFs afero.Fs
+
+func NewFsFeatureSessionStore(fs FeatureSessionsFs) IFeatureSessionStore {
+	return &FsFeatureSessionStore{
+		fs: fs,
+	}
+}
+
+func (s *FsFeatureSessionStore) SaveFeatureSession(session *FeatureSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeSession(session)
+}
+
+func (s *FsFeatureSessionStore) writeSession(session *FeatureSession) error {
+	sessionJson, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feature session %s: %w", session.ID, err)
+	}
+
+	// the session file is renamed into place once complete, so a partially
+	// written session is never read
+	temporaryFileName := fmt.Sprintf(".%s.json.tmp", session.ID)
+	err = afero.WriteFile(s.fs, temporaryFileName, sessionJson, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write feature session %s: %w", session.ID, err)
+	}
+
+	err = s.fs.Rename(temporaryFileName, featureSessionFileName(session.ID))
+	if err != nil {
+		s.fs.Remove(temporaryFileName)
+		return fmt.Errorf("failed to write feature session %s: %w", session.ID, err)
+	}
+
+	return nil
+}
+
+func (s *FsFeatureSessionStore) GetFeatureSession(id string) (*FeatureSession, error) {
+	// ids come from requests, they must not point outside the sessions folder
+	if strings.ContainsAny(id, `/\.`) {
+		return nil, fmt.Errorf("failed to get feature session %s: %w", id, ErrFeatureSessionNotFound)
+	}
+
+	sessionFileName := featureSessionFileName(id)
+
+	sessionJson, err := afero.ReadFile(s.fs, sessionFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to get feature session %s: %w", id, ErrFeatureSessionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", sessionFileName, err)
+	}
+
+	session := &FeatureSession{}
+	err = json.Unmarshal(sessionJson, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feature session json from file %s: %w", sessionFileName, err)
+	}
+
+	return session, nil
+}
+
+func (s *FsFeatureSessionStore) ListFeatureSessions(featureName string) ([]*FeatureSessionInfo, error) {
+	sessions, err := s.readSessions(featureName)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionInfos := []*FeatureSessionInfo{}
+	for _, session := range sessions {
+		sessionInfos = append(sessionInfos, &session.FeatureSessionInfo)
+	}
+
+	return sessionInfos, nil
+}
+
+func (s *FsFeatureSessionStore) DeleteFeatureSessions(featureName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.readSessions(featureName)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		// sessions without a feature are not deleted with any
+		if session.FeatureName != featureName {
+			continue
+		}
+		err := s.fs.Remove(featureSessionFileName(session.ID))
+		if err != nil {
+			return fmt.Errorf("failed to remove feature session %s: %w", session.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *FsFeatureSessionStore) RenameFeatureSessions(featureName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.readSessions(featureName)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.FeatureName != featureName {
+			continue
+		}
+		session.FeatureName = newName
+		err := s.writeSession(session)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readSessions returns the sessions of a feature, or every session when
+// featureName is empty, oldest first.
+func (s *FsFeatureSessionStore) readSessions(featureName string) ([]*FeatureSession, error) {
+	sessionFiles, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feature sessions folder: %w", err)
+	}
+
+	sessions := []*FeatureSession{}
+	for _, sessionFile := range sessionFiles {
+		if sessionFile.IsDir() || strings.HasPrefix(sessionFile.Name(), ".") || path.Ext(sessionFile.Name()) != ".json" {
+			continue
+		}
+
+		session, err := s.GetFeatureSession(strings.TrimSuffix(sessionFile.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(featureName) > 0 && session.FeatureName != featureName {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	slices.SortStableFunc(sessions, func(a *FeatureSession, b *FeatureSession) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	return sessions, nil
+}
+
+func featureSessionFileName(id string) string {
+	return fmt.Sprintf("%s.json", id)
+}
@@ -0,0 +1,363 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+var (
+	ErrFeatureSessionBusy         = errors.New("the session is already generating a feature")
+	ErrFeatureSessionHasNoFeature = errors.New("the session has not generated a feature yet")
+	ErrOperationAlreadyExists     = errors.New("operation already exists")
+)
+
+// IFeatureSessions generates features in conversations, where each prompt
+// follows up on the prompts sent before it, the answers of the AI and the
+// problems found in them.
+type IFeatureSessions interface {
+	// CreateSession starts a session generating a new feature, or changing
+	// featureName when it's not empty.
+	CreateSession(featureName string) (*FeatureSession, error)
+	// SendPrompt generates the feature of a session from prompt and the
+	// messages sent before it. The messages of the prompt are kept even when
+	// the generation fails, so the next prompt can follow up on the failure.
+	SendPrompt(ctx context.Context, id string, prompt string) (*Feature, error)
+	// ForkSession copies the feature of a session as featureName, with a new
+	// session refining the copy that starts with the messages of the forked
+	// one. The copy gets its own operations, named after featureName, so
+	// refining it doesn't change the forked feature.
+	// The copy is validated before it is stored, failing with an
+	// *InvalidFeatureError when it has problems.
+	ForkSession(id string, featureName string) (*FeatureSession, error)
+	GetSession(id string) (*FeatureSession, error)
+	// ListSessions returns the sessions of a feature, or every session when
+	// featureName is empty, oldest first.
+	ListSessions(featureName string) ([]*FeatureSessionInfo, error)
+}
+
+func NewFeatureSessions(featureGenerator IFeatureGenerator, featureStore IFeatureStore, featureValidator IFeatureValidator, operationStore operations.IOperationStore, revisionStore IFeatureRevisionStore, sessionStore IFeatureSessionStore, frontendBuilder frontend.IBuilder) IFeatureSessions {
+	return &FeatureSessions{
+		featureGenerator: featureGenerator,
+		featureStore:     featureStore,
+		featureValidator: featureValidator,
+		operationStore:   operationStore,
+		revisionStore:    revisionStore,
+		sessionStore:     sessionStore,
+		frontendBuilder:  frontendBuilder,
+		busySessions:     map[string]bool{},
+	}
+}
+
+type FeatureSessions struct {
+	featureGenerator IFeatureGenerator
+	featureStore     IFeatureStore
+	featureValidator IFeatureValidator
+	operationStore   operations.IOperationStore
+	revisionStore    IFeatureRevisionStore
+	sessionStore     IFeatureSessionStore
+	frontendBuilder  frontend.IBuilder
+
+	// mu guards busySessions, the ids of the sessions generating a feature
+	mu           sync.Mutex
+	busySessions map[string]bool
+}
+
+func (s *FeatureSessions) CreateSession(featureName string) (*FeatureSession, error) {
+	if len(featureName) > 0 {
+		_, err := s.featureStore.GetFeature(featureName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := newFeatureSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &FeatureSession{
+		FeatureSessionInfo: FeatureSessionInfo{
+			ID:          id,
+			FeatureName: featureName,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		Messages: []*SessionMessage{},
+	}
+
+	err = s.sessionStore.SaveFeatureSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *FeatureSessions) SendPrompt(ctx context.Context, id string, prompt string) (*Feature, error) {
+	err := s.lockSession(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlockSession(id)
+
+	session, err := s.sessionStore.GetFeatureSession(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stored feature, rather than the last answer, since the feature may
+	// have been rolled back or changed outside of the session
+	var featureContext *Feature
+	if len(session.FeatureName) > 0 {
+		featureContext, err = s.featureStore.GetFeature(session.FeatureName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messages := []*SessionMessage{{Kind: PromptMessage, Text: prompt, CreatedAt: time.Now()}}
+
+	ctx = WithConversationHistory(ctx, session.conversation())
+	ctx = withProgressListener(ctx, func(event *GenerationEvent) {
+		if event.Phase != RepairingPhase || event.Attempt == nil {
+			return
+		}
+		messages = append(messages,
+			&SessionMessage{Kind: AnswerMessage, Text: event.Attempt.Answer, CreatedAt: time.Now()},
+			&SessionMessage{Kind: FeedbackMessage, Text: repairPrompt(event.Attempt.Diagnostics), CreatedAt: time.Now()},
+		)
+	})
+
+	feature, generateErr := s.featureGenerator.GenerateFeature(ctx, prompt, featureContext)
+	if generateErr == nil {
+		answer, err := json.MarshalIndent(feature, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode generated feature: %w", err)
+		}
+		messages = append(messages, &SessionMessage{Kind: AnswerMessage, Text: string(answer), CreatedAt: time.Now()})
+		session.FeatureName = feature.Name
+	} else {
+		messages = append(messages, &SessionMessage{
+			Kind:      ErrorMessage,
+			Text:      fmt.Sprintf("The feature could not be generated: %v", generateErr),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if len(session.Title) == 0 {
+		session.Title = prompt
+	}
+	session.Messages = append(session.Messages, messages...)
+	session.UpdatedAt = time.Now()
+
+	err = s.sessionStore.SaveFeatureSession(session)
+	if generateErr != nil {
+		return nil, generateErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return feature, nil
+}
+
+func (s *FeatureSessions) lockSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.busySessions[id] {
+		return fmt.Errorf("failed to use session %s: %w", id, ErrFeatureSessionBusy)
+	}
+	s.busySessions[id] = true
+
+	return nil
+}
+
+func (s *FeatureSessions) unlockSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busySessions, id)
+}
+
+func (s *FeatureSessions) ForkSession(id string, featureName string) (*FeatureSession, error) {
+	err := validateFeatureName(featureName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.lockSession(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlockSession(id)
+
+	session, err := s.sessionStore.GetFeatureSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.FeatureName) == 0 {
+		return nil, fmt.Errorf("failed to fork session %s: %w", id, ErrFeatureSessionHasNoFeature)
+	}
+
+	feature, err := s.featureStore.GetFeature(session.FeatureName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.featureStore.GetFeature(featureName)
+	if err == nil {
+		return nil, fmt.Errorf("failed to fork session %s as feature %s: %w", id, featureName, ErrFeatureAlreadyExists)
+	}
+	if !errors.Is(err, ErrFeatureNotFound) {
+		return nil, err
+	}
+
+	forkedFeature := forkFeature(feature, featureName)
+	for _, operation := range forkedFeature.ServerOperations {
+		_, err := s.operationStore.GetOperation(operation.Name)
+		if err == nil {
+			return nil, fmt.Errorf("failed to fork session %s as feature %s, operation %s: %w", id, featureName, operation.Name, ErrOperationAlreadyExists)
+		}
+		if !errors.Is(err, operations.ErrOperationNotFound) {
+			return nil, fmt.Errorf("failed to check operation %s: %w", operation.Name, err)
+		}
+	}
+
+	report, err := s.featureValidator.Validate(forkedFeature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate feature %s: %w", featureName, err)
+	}
+	if !report.Valid {
+		return nil, fmt.Errorf("failed to fork session %s: %w", id, &InvalidFeatureError{Feature: featureName, Diagnostics: report.Diagnostics()})
+	}
+
+	err = s.featureStore.AddFeature(forkedFeature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store feature %s: %w", featureName, err)
+	}
+
+	err = s.revisionStore.AddFeatureRevision(&FeatureRevision{
+		FeatureRevisionInfo: FeatureRevisionInfo{
+			CreatedAt: time.Now(),
+		},
+		Feature: forkedFeature,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record revision of feature %s: %w", featureName, err)
+	}
+
+	err = s.frontendBuilder.BuildFrontend()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build frontend: %w", err)
+	}
+
+	forkID, err := newFeatureSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	fork := &FeatureSession{
+		FeatureSessionInfo: FeatureSessionInfo{
+			ID:          forkID,
+			FeatureName: featureName,
+			Title:       session.Title,
+			ForkedFrom:  session.ID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		Messages: session.Messages,
+	}
+
+	err = s.sessionStore.SaveFeatureSession(fork)
+	if err != nil {
+		return nil, err
+	}
+
+	return fork, nil
+}
+
+// operationReferenceRegexp matches the operation fetched by a component, or a
+// whole identifier, so getTasks isn't found in getTasksByUser
+var operationReferenceRegexp = regexp.MustCompile(`/operations/execute/([A-Za-z0-9_-]+)|[A-Za-z_$][A-Za-z0-9_$]*`)
+
+// forkFeature copies feature as featureName. Operations are stored by name for
+// every feature, so the copy gets operations prefixed with featureName, and its
+// component is changed to call them through both fetch and the typed client.
+func forkFeature(feature *Feature, featureName string) *Feature {
+	tsxCode := feature.ReactComponent.TsxCode
+
+	imported := map[string]bool{}
+	for _, match := range operationsImportRegexp.FindAllStringSubmatch(tsxCode, -1) {
+		for _, importedName := range strings.Split(match[1], ",") {
+			importedName = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(importedName), "type "))
+			importedName, _, _ = strings.Cut(importedName, " ")
+			imported[importedName] = true
+		}
+	}
+
+	operationNames := map[string]string{}
+	identifiers := map[string]string{}
+	forkedOperations := []*operations.Operation{}
+	for _, operation := range feature.ServerOperations {
+		forkedOperation := *operation
+		forkedOperation.Name = fmt.Sprintf("%s-%s", featureName, operation.Name)
+		forkedOperation.Version = 0
+		forkedOperations = append(forkedOperations, &forkedOperation)
+
+		operationNames[operation.Name] = forkedOperation.Name
+		typeName := operations.TypeScriptName(operation.Name)
+		forkedTypeName := operations.TypeScriptName(forkedOperation.Name)
+		identifiers[operationClientFunctionName(typeName)] = operationClientFunctionName(forkedTypeName)
+		identifiers[typeName+"Parameters"] = forkedTypeName + "Parameters"
+		identifiers[typeName+"Result"] = forkedTypeName + "Result"
+	}
+	for identifier := range identifiers {
+		if !imported[identifier] {
+			delete(identifiers, identifier)
+		}
+	}
+
+	// a single pass, so renamed references are never renamed again
+	tsxCode = operationReferenceRegexp.ReplaceAllStringFunc(tsxCode, func(reference string) string {
+		if operationName, isFetch := strings.CutPrefix(reference, "/operations/execute/"); isFetch {
+			forkedName, isForked := operationNames[operationName]
+			if !isForked {
+				return reference
+			}
+			return "/operations/execute/" + forkedName
+		}
+
+		forkedIdentifier, isForked := identifiers[reference]
+		if !isForked {
+			return reference
+		}
+		return forkedIdentifier
+	})
+
+	forkedFeature := *feature
+	forkedFeature.Name = featureName
+	forkedFeature.ReactComponent = &ReactComponent{TsxCode: tsxCode}
+	forkedFeature.ServerOperations = forkedOperations
+
+	return &forkedFeature
+}
+
+func (s *FeatureSessions) GetSession(id string) (*FeatureSession, error) {
+	return s.sessionStore.GetFeatureSession(id)
+}
+
+func (s *FeatureSessions) ListSessions(featureName string) ([]*FeatureSessionInfo, error) {
+	return s.sessionStore.ListFeatureSessions(featureName)
+}
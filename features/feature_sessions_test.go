@@ -0,0 +1,366 @@
+package features_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsFeatureSessionStore(t *testing.T) {
+	testFeatureSessionStore(t, func() features.IFeatureSessionStore {
+		return features.NewFsFeatureSessionStore(afero.NewMemMapFs())
+	})
+}
+
+func TestSqlFeatureSessionStore(t *testing.T) {
+	testFeatureSessionStore(t, func() features.IFeatureSessionStore {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return features.NewSqlFeatureSessionStore(db)
+	})
+}
+
+func testFeatureSessionStore(t *testing.T, newStore func() features.IFeatureSessionStore) {
+	t.Run("save, get and list", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		sessions, err := store.ListFeatureSessions("")
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		createdAt := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+		tasks := newFeatureSession("s1", "tasks", createdAt)
+		users := newFeatureSession("s2", "users", createdAt.Add(time.Minute))
+		newFeature := newFeatureSession("s3", "", createdAt.Add(2*time.Minute))
+		for _, session := range []*features.FeatureSession{tasks, users, newFeature} {
+			err := store.SaveFeatureSession(session)
+			assert.NoError(t, err)
+		}
+
+		tasks.Messages = append(tasks.Messages, &features.SessionMessage{Kind: features.AnswerMessage, Text: "{}", CreatedAt: createdAt})
+		tasks.UpdatedAt = createdAt.Add(time.Hour)
+		err = store.SaveFeatureSession(tasks)
+		assert.NoError(t, err)
+
+		session, err := store.GetFeatureSession("s1")
+		assert.NoError(t, err)
+		assert.Equal(t, tasks, session)
+
+		sessions, err = store.ListFeatureSessions("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, []*features.FeatureSessionInfo{&tasks.FeatureSessionInfo}, sessions)
+
+		sessions, err = store.ListFeatureSessions("")
+		assert.NoError(t, err)
+		assert.Equal(t, []*features.FeatureSessionInfo{&tasks.FeatureSessionInfo, &users.FeatureSessionInfo, &newFeature.FeatureSessionInfo}, sessions)
+
+		_, err = store.GetFeatureSession("s4")
+		assert.ErrorIs(t, err, features.ErrFeatureSessionNotFound)
+	})
+
+	t.Run("rename and delete", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+		for id, featureName := range map[string]string{"s1": "tasks", "s2": "tasks", "s3": "users", "s4": ""} {
+			err := store.SaveFeatureSession(newFeatureSession(id, featureName, time.Now()))
+			assert.NoError(t, err)
+		}
+
+		err := store.RenameFeatureSessions("tasks", "team-tasks")
+		assert.NoError(t, err)
+
+		sessions, err := store.ListFeatureSessions("team-tasks")
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+
+		err = store.DeleteFeatureSessions("team-tasks")
+		assert.NoError(t, err)
+
+		sessions, err = store.ListFeatureSessions("")
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 2)
+		_, err = store.GetFeatureSession("s1")
+		assert.ErrorIs(t, err, features.ErrFeatureSessionNotFound)
+	})
+}
+
+func TestFeatureSessions(t *testing.T) {
+	// generated features are also saved to AiGeneratedViews, in the working
+	// directory
+	t.Chdir(t.TempDir())
+	err := os.Mkdir("AiGeneratedViews", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := generatedFeature("tasks", "v1", "get-tasks")
+	v1Json, err := json.Marshal(v1)
+	assert.NoError(t, err)
+	v2 := generatedFeature("tasks", "v2", "get-tasks")
+	v2Json, err := json.Marshal(v2)
+	assert.NoError(t, err)
+
+	newSessions := func(answers ...string) (features.IFeatureSessions, features.IFeatureStore, features.IFeatureRevisionStore, func() []map[string]any) {
+		server, requests := chatCompletionServer(t, answers...)
+		aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+			Provider: features.OpenAICompatibleProvider,
+			Model:    "llama3",
+			BaseURL:  server.URL + "/v1",
+			APIKey:   "secret",
+		})
+		assert.NoError(t, err)
+
+		featureStore, operationStore, _ := newFsFeatureStore(nil)
+		revisionStore := features.NewFsFeatureRevisionStore(afero.NewMemMapFs())
+		builder := &countingBuilder{}
+		validator := newFeatureValidator(operations.NewInMemoryOperationStore())
+		generator := features.NewReactFeatureGenerator(nil, featureStore, revisionStore, aiGenerator, validator, nil, builder, nil, &features.FeatureGeneratorConfig{
+			MaxAttempts: 2,
+		})
+
+		sessionStore := features.NewFsFeatureSessionStore(afero.NewMemMapFs())
+		sessions := features.NewFeatureSessions(generator, featureStore, newFeatureValidator(operationStore), operationStore, revisionStore, sessionStore, builder)
+
+		return sessions, featureStore, revisionStore, requests
+	}
+
+	t.Run("prompts follow up on the conversation", func(t *testing.T) {
+		sessions, featureStore, _, requests := newSessions("Here is the feature", string(v1Json), string(v2Json))
+
+		session, err := sessions.CreateSession("")
+		assert.NoError(t, err)
+
+		feature, err := sessions.SendPrompt(context.Background(), session.ID, "list the tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, v1, feature)
+
+		feature, err = sessions.SendPrompt(context.Background(), session.ID, "now make the due date column sortable")
+		assert.NoError(t, err)
+		assert.Equal(t, v2, feature)
+
+		session, err = sessions.GetSession(session.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "tasks", session.FeatureName)
+		assert.Equal(t, "list the tasks", session.Title)
+		kinds := []features.SessionMessageKind{}
+		for _, message := range session.Messages {
+			kinds = append(kinds, message.Kind)
+		}
+		assert.Equal(t, []features.SessionMessageKind{
+			features.PromptMessage, features.AnswerMessage, features.FeedbackMessage, features.AnswerMessage,
+			features.PromptMessage, features.AnswerMessage,
+		}, kinds)
+
+		storedFeature, err := featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, v2.ReactComponent.TsxCode, storedFeature.ReactComponent.TsxCode)
+
+		// the follow-up is sent after the whole conversation, with the stored
+		// feature as context
+		followUp := requests()[2]
+		messages := followUp["messages"].([]any)
+		assert.Len(t, messages, 6)
+		assert.Contains(t, messages[0].(map[string]any)["content"], `v1\u003c/div`)
+		assert.Equal(t, map[string]any{"role": "user", "content": "list the tasks"}, messages[1])
+		assert.Equal(t, map[string]any{"role": "assistant", "content": "Here is the feature"}, messages[2])
+		assert.Equal(t, "user", messages[3].(map[string]any)["role"])
+		assert.Equal(t, "assistant", messages[4].(map[string]any)["role"])
+		assert.Contains(t, messages[4].(map[string]any)["content"], `v1\u003c/div`)
+		assert.Equal(t, map[string]any{"role": "user", "content": "now make the due date column sortable"}, messages[5])
+
+		sessionInfos, err := sessions.ListSessions("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, []*features.FeatureSessionInfo{&session.FeatureSessionInfo}, sessionInfos)
+	})
+
+	t.Run("failed prompts are kept", func(t *testing.T) {
+		sessions, _, _, requests := newSessions(`{"error": "there is no projects table"}`, string(v1Json))
+
+		session, err := sessions.CreateSession("")
+		assert.NoError(t, err)
+
+		_, err = sessions.SendPrompt(context.Background(), session.ID, "list the projects")
+		assert.EqualError(t, err, "failed to create page component view: AI error: there is no projects table")
+
+		_, err = sessions.SendPrompt(context.Background(), session.ID, "list the tasks then")
+		assert.NoError(t, err)
+
+		// the failure and the new prompt are joined, so the roles alternate
+		messages := requests()[1]["messages"].([]any)
+		assert.Len(t, messages, 2)
+		assert.Contains(t, messages[1].(map[string]any)["content"], "The feature could not be generated: failed to create page component view: AI error: there is no projects table")
+		assert.Contains(t, messages[1].(map[string]any)["content"], "list the tasks then")
+
+		_, err = sessions.SendPrompt(context.Background(), "unknown", "list the tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureSessionNotFound)
+
+		_, err = sessions.CreateSession("users")
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+	})
+
+	t.Run("fork", func(t *testing.T) {
+		sessions, featureStore, revisionStore, _ := newSessions(string(v1Json))
+
+		session, err := sessions.CreateSession("")
+		assert.NoError(t, err)
+
+		_, err = sessions.ForkSession(session.ID, "team-tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureSessionHasNoFeature)
+
+		_, err = sessions.SendPrompt(context.Background(), session.ID, "list the tasks")
+		assert.NoError(t, err)
+		session, err = sessions.GetSession(session.ID)
+		assert.NoError(t, err)
+
+		_, err = sessions.ForkSession(session.ID, "team tasks")
+		assert.ErrorIs(t, err, features.ErrInvalidFeatureName)
+
+		fork, err := sessions.ForkSession(session.ID, "team-tasks")
+		assert.NoError(t, err)
+		assert.NotEqual(t, session.ID, fork.ID)
+		assert.Equal(t, session.ID, fork.ForkedFrom)
+		assert.Equal(t, "team-tasks", fork.FeatureName)
+		assert.Equal(t, session.Messages, fork.Messages)
+
+		forkedFeature, err := featureStore.GetFeature("team-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, v1.ReactComponent.TsxCode, forkedFeature.ReactComponent.TsxCode)
+		revisions, err := revisionStore.ListFeatureRevisions("team-tasks")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 1)
+
+		_, err = sessions.ForkSession(session.ID, "team-tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureAlreadyExists)
+
+		// the original session still refines the original feature
+		sessionInfos, err := sessions.ListSessions("tasks")
+		assert.NoError(t, err)
+		assert.Len(t, sessionInfos, 1)
+	})
+
+	t.Run("refining a fork keeps the forked feature", func(t *testing.T) {
+		forkV2 := generatedFeature("team-tasks", "v2", "team-tasks-get-tasks", "team-tasks-get-users")
+		forkV2.ServerOperations[0].JavascriptCode = `function run() { return 2 }`
+		forkV2Json, err := json.Marshal(forkV2)
+		assert.NoError(t, err)
+
+		sessions, featureStore, _, _ := newSessions(string(forkV2Json))
+
+		tasks := newFeature("tasks", `import { getTasks, type GetTasksResult, getUsers as listUsers } from "../operations";
+
+export default function Component() {
+  const getTasksByUser = (tasks: GetTasksResult) => tasks;
+  fetch("/operations/execute/get-tasks");
+  return <div>{getTasksByUser(getTasks())}</div>;
+}
+`, "get-tasks", "get-users")
+		for _, operation := range tasks.ServerOperations {
+			operation.Kind = operations.QueryKind
+		}
+		err = featureStore.AddFeature(tasks)
+		assert.NoError(t, err)
+		session, err := sessions.CreateSession("tasks")
+		assert.NoError(t, err)
+
+		fork, err := sessions.ForkSession(session.ID, "team-tasks")
+		assert.NoError(t, err)
+
+		forkedFeature, err := featureStore.GetFeature("team-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "team-tasks-get-tasks", forkedFeature.ServerOperations[0].Name)
+		assert.Equal(t, "team-tasks-get-users", forkedFeature.ServerOperations[1].Name)
+		assert.Equal(t, `import { teamTasksGetTasks, type TeamTasksGetTasksResult, teamTasksGetUsers as listUsers } from "../operations";
+
+export default function Component() {
+  const getTasksByUser = (tasks: TeamTasksGetTasksResult) => tasks;
+  fetch("/operations/execute/team-tasks-get-tasks");
+  return <div>{getTasksByUser(teamTasksGetTasks())}</div>;
+}
+`, forkedFeature.ReactComponent.TsxCode)
+
+		_, err = sessions.SendPrompt(context.Background(), fork.ID, "return 2 tasks")
+		assert.NoError(t, err)
+
+		forkedFeature, err = featureStore.GetFeature("team-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, `function run() { return 2 }`, forkedFeature.ServerOperations[0].JavascriptCode)
+
+		feature, err := featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, tasks.ReactComponent.TsxCode, feature.ReactComponent.TsxCode)
+		assert.Equal(t, "get-tasks", feature.ServerOperations[0].Name)
+		assert.Equal(t, `function run() { return 1 }`, feature.ServerOperations[0].JavascriptCode)
+
+		// operations keep their names when the fork is renamed, so forking
+		// again as team-tasks would overwrite them
+		_, err = featureStore.RenameFeature("team-tasks", "other-tasks", false)
+		assert.NoError(t, err)
+		_, err = sessions.ForkSession(session.ID, "team-tasks")
+		assert.ErrorIs(t, err, features.ErrOperationAlreadyExists)
+	})
+
+	t.Run("invalid forks are not stored", func(t *testing.T) {
+		sessions, featureStore, revisionStore, _ := newSessions()
+
+		tasks := generatedFeature("tasks", "v1", "get-tasks")
+		tasks.ReactComponent.TsxCode = `export default function Component() {
+  fetch("/operations/execute/get-tasks");
+  fetch("/operations/execute/get-tasks-by-user");
+  return <div>v1</div>;
+}
+`
+		err := featureStore.AddFeature(tasks)
+		assert.NoError(t, err)
+		session, err := sessions.CreateSession("tasks")
+		assert.NoError(t, err)
+
+		_, err = sessions.ForkSession(session.ID, "team-tasks")
+		invalidFeatureErr := &features.InvalidFeatureError{}
+		if assert.ErrorAs(t, err, &invalidFeatureErr) {
+			assert.Equal(t, "team-tasks", invalidFeatureErr.Feature)
+			// only whole operation names are renamed
+			assert.Equal(t, []*features.Diagnostic{{
+				Source:   features.ReferenceDiagnostic,
+				Location: "components/team-tasks.tsx",
+				Message:  "the component calls operation get-tasks-by-user, which is not declared in serverOperations",
+			}}, invalidFeatureErr.Diagnostics)
+		}
+
+		_, err = featureStore.GetFeature("team-tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+		revisions, err := revisionStore.ListFeatureRevisions("team-tasks")
+		assert.NoError(t, err)
+		assert.Empty(t, revisions)
+	})
+}
+
+func newFeatureSession(id string, featureName string, createdAt time.Time) *features.FeatureSession {
+	return &features.FeatureSession{
+		FeatureSessionInfo: features.FeatureSessionInfo{
+			ID:          id,
+			FeatureName: featureName,
+			Title:       "list the tasks",
+			CreatedAt:   createdAt,
+			UpdatedAt:   createdAt,
+		},
+		Messages: []*features.SessionMessage{
+			{Kind: features.PromptMessage, Text: "list the tasks", CreatedAt: createdAt},
+		},
+	}
+}
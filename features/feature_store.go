@@ -2,18 +2,118 @@ package features
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 
+	"github.com/google/uuid"
+	"github.com/phuslu/log"
 	"github.com/prigas-dev/backoffice-ai/operations"
 	"github.com/prigas-dev/backoffice-ai/utils"
 	"github.com/spf13/afero"
 )
 
 type IFeatureStore interface {
-	GetAllFeatures() ([]*FeatureManifest, error)
+	// GetAllFeatures returns the features that can be loaded, and separately
+	// the ones that are broken, e.g. by a missing operation
+	GetAllFeatures() ([]*FeatureManifest, []*BrokenFeature, error)
 	GetFeature(name string) (*Feature, error)
 	AddFeature(feature *Feature) error
+	// DeleteFeature removes the feature, its component and the operations no
+	// other feature uses. With dryRun it only reports what would be removed.
+	DeleteFeature(name string, dryRun bool) (*FeatureDeletion, error)
+	// RenameFeature moves the feature and its component to newName. The
+	// operations keep their names. With dryRun it only checks the rename is
+	// possible.
+	RenameFeature(name string, newName string, dryRun bool) (*FeatureRename, error)
+	// OnFeatureChanged registers listener to be called whenever a feature is
+	// added, deleted or renamed. A rename notifies both names.
+	OnFeatureChanged(listener func(featureName string))
+}
+
+var (
+	ErrFeatureNotFound      = errors.New("feature not found")
+	ErrFeatureAlreadyExists = errors.New("feature already exists")
+	ErrInvalidFeatureName   = errors.New("invalid feature name")
+)
+
+// FeatureDeletion lists what deleting a feature removes.
+type FeatureDeletion struct {
+	Feature string `json:"feature"`
+	DryRun  bool   `json:"dryRun"`
+	// Operations are removed with the feature, since no other feature uses them
+	Operations []string `json:"operations"`
+	// SharedOperations are kept, since other features use them
+	SharedOperations []string `json:"sharedOperations"`
+	// Revisions is the number of revisions of the feature removed with it
+	Revisions int `json:"revisions"`
+}
+
+type FeatureRename struct {
+	Feature string `json:"feature"`
+	NewName string `json:"newName"`
+	DryRun  bool   `json:"dryRun"`
+	// Revisions is the number of revisions of the feature moved to the new name
+	Revisions int `json:"revisions"`
+}
+
+// feature names are used as folder, file and import names
+var featureNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func validateFeatureName(name string) error {
+	if !featureNameRegexp.MatchString(name) {
+		return fmt.Errorf("%w %q: only letters, digits, - and _ are allowed", ErrInvalidFeatureName, name)
+	}
+	return nil
+}
+
+// planFeatureDeletion splits the operations of a feature in the ones only it
+// uses and the ones other features use too.
+func planFeatureDeletion(featureManifest *FeatureManifest, otherFeaturesOperations map[string]bool) *FeatureDeletion {
+	deletion := &FeatureDeletion{
+		Feature:          featureManifest.Name,
+		Operations:       []string{},
+		SharedOperations: []string{},
+	}
+
+	for _, operationName := range featureManifest.Operations {
+		if slices.Contains(deletion.Operations, operationName) || slices.Contains(deletion.SharedOperations, operationName) {
+			continue
+		}
+		if otherFeaturesOperations[operationName] {
+			deletion.SharedOperations = append(deletion.SharedOperations, operationName)
+		} else {
+			deletion.Operations = append(deletion.Operations, operationName)
+		}
+	}
+
+	return deletion
+}
+
+type featureListeners struct {
+	mu        sync.RWMutex
+	listeners []func(featureName string)
+}
+
+func (l *featureListeners) OnFeatureChanged(listener func(featureName string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listeners = append(l.listeners, listener)
+}
+
+func (l *featureListeners) notifyFeatureChanged(featureName string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, listener := range l.listeners {
+		listener(featureName)
+	}
 }
 
 type FeatureManifest struct {
@@ -23,44 +123,100 @@ type FeatureManifest struct {
 	Operations  []string `json:"operations"`
 }
 
+type BrokenFeature struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+	// Operations the feature uses, empty when its manifest can't be read
+	Operations []string `json:"operations,omitempty"`
+}
+
 func NewFsFeatureStore(fs FeaturesFs, operationStore operations.IOperationStore, componentStore IComponentStore) IFeatureStore {
-	return &FsFeatureStore{
+	store := &FsFeatureStore{
 		fs:             fs,
 		operationStore: operationStore,
 		componentStore: componentStore,
 	}
+
+	store.sweepTemporaryFolders()
+
+	return store
 }
 
 type FeaturesFs afero.Fs
 
 type FsFeatureStore struct {
+	featureListeners
+	// serializes the writes, whose undo steps and temporary folders would
+	// otherwise interleave when the same feature is written twice at once
+	mu             sync.Mutex
 	fs             afero.Fs
 	operationStore operations.IOperationStore
 	componentStore IComponentStore
 }
 
-func (s *FsFeatureStore) GetAllFeatures() ([]*FeatureManifest, error) {
+func (s *FsFeatureStore) GetAllFeatures() ([]*FeatureManifest, []*BrokenFeature, error) {
 	files, err := afero.ReadDir(s.fs, ".")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read features directory: %w", err)
+		return nil, nil, fmt.Errorf("failed to read features directory: %w", err)
 	}
 
 	features := []*FeatureManifest{}
+	brokenFeatures := []*BrokenFeature{}
 
 	for _, featureDir := range files {
 		featureName := featureDir.Name()
+		if !featureDir.IsDir() || isTemporaryFeatureFolder(featureName) {
+			continue
+		}
+
 		feature, err := s.getFeatureManifest(featureName)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get feature %s: %w", featureName, err)
+			brokenFeatures = append(brokenFeatures, &BrokenFeature{
+				Name:  featureName,
+				Error: err.Error(),
+			})
+			continue
+		}
+
+		err = s.checkFeatureDependencies(feature)
+		if err != nil {
+			brokenFeatures = append(brokenFeatures, &BrokenFeature{
+				Name:       featureName,
+				Error:      err.Error(),
+				Operations: feature.Operations,
+			})
+			continue
 		}
+
 		features = append(features, feature)
 	}
 
-	return features, nil
+	return features, brokenFeatures, nil
+}
+
+// checkFeatureDependencies fails when the component or an operation of the
+// feature is missing.
+func (s *FsFeatureStore) checkFeatureDependencies(feature *FeatureManifest) error {
+	_, err := s.componentStore.GetComponent(feature.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get component of feature %s: %w", feature.Name, err)
+	}
+
+	for _, operationName := range feature.Operations {
+		_, err := s.operationStore.GetOperation(operationName)
+		if err != nil {
+			return fmt.Errorf("failed to get operation %s of feature %s: %w", operationName, feature.Name, err)
+		}
+	}
+
+	return nil
 }
 
 func (s *FsFeatureStore) getFeatureManifest(name string) (*FeatureManifest, error) {
 	featureManifestFile, err := s.fs.Open(path.Join(name, "feature_manifest.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open feature_manifest.json of feature %s: %w", name, ErrFeatureNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open feature_manifest.json of feature %s: %w", name, err)
 	}
@@ -110,44 +266,400 @@ func (s *FsFeatureStore) GetFeature(name string) (*Feature, error) {
 	return feature, nil
 }
 
+// AddFeature stages the feature manifest in a temporary folder, writes the
+// component and the operations, and only then renames the staged folder into
+// place. The component and the operations live in other stores, so they can't
+// be staged with the manifest: if any step fails they are restored to their
+// previous versions, but if the server stops in between they are left written
+// with the previous manifest. The staged folder is then swept the next time
+// the store is created. Writes to the store are serialized, so the undo steps
+// only ever cover the write that failed.
 func (s *FsFeatureStore) AddFeature(feature *Feature) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stagingFolder := temporaryFeatureFolder("staging", feature.Name)
+	defer s.fs.RemoveAll(stagingFolder)
 
-	err := s.fs.MkdirAll(feature.Name, 0755)
+	err := s.writeFeatureManifest(stagingFolder, &FeatureManifest{
+		Name:        feature.Name,
+		Label:       feature.Label,
+		Description: feature.Description,
+		Operations:  featureOperationNames(feature),
+	})
+	if err != nil {
+		return err
+	}
+
+	undo := &undoStack{}
+
+	err = s.addFeatureDependencies(feature, undo)
+	if err == nil {
+		err = s.replaceFeatureFolder(stagingFolder, feature.Name)
+	}
+	if err != nil {
+		undoErr := undo.run()
+		if undoErr != nil {
+			return fmt.Errorf("%w (rollback also failed: %w)", err, undoErr)
+		}
+		return err
+	}
+
+	s.notifyFeatureChanged(feature.Name)
+
+	return nil
+}
+
+func (s *FsFeatureStore) writeFeatureManifest(folder string, featureManifest *FeatureManifest) error {
+	err := s.fs.MkdirAll(folder, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to create feature %s directory: %w", feature.Name, err)
+		return fmt.Errorf("failed to create feature %s directory: %w", featureManifest.Name, err)
 	}
 
-	featureManifestFile, err := s.fs.Create(path.Join(feature.Name, "feature_manifest.json"))
+	featureManifestFile, err := s.fs.Create(path.Join(folder, "feature_manifest.json"))
 	if err != nil {
-		return fmt.Errorf("failed to create feature %s manifest file: %w", feature.Name, err)
+		return fmt.Errorf("failed to create feature %s manifest file: %w", featureManifest.Name, err)
 	}
 	defer featureManifestFile.Close()
 
 	encoder := json.NewEncoder(featureManifestFile)
 	encoder.SetIndent("", "  ")
 
-	featureManifest := FeatureManifest{
-		Name:        feature.Name,
-		Label:       feature.Label,
-		Description: feature.Description,
-		Operations:  utils.Map(feature.ServerOperations, func(operation *operations.Operation) string { return operation.Name }),
-	}
 	err = encoder.Encode(featureManifest)
 	if err != nil {
-		return fmt.Errorf("failed to write feature %s manifest file: %w", feature.Name, err)
+		return fmt.Errorf("failed to write feature %s manifest file: %w", featureManifest.Name, err)
 	}
 
+	return nil
+}
+
+// addFeatureDependencies writes the component and the operations of feature,
+// pushing to undo how to restore each of them.
+func (s *FsFeatureStore) addFeatureDependencies(feature *Feature, undo *undoStack) error {
+	previousTsxCode, err := s.componentStore.GetComponent(feature.Name)
+	if err != nil && !errors.Is(err, ErrComponentNotFound) {
+		return fmt.Errorf("failed to get current component of feature %s: %w", feature.Name, err)
+	}
+	hasPreviousComponent := err == nil
+
 	err = s.componentStore.AddComponent(feature.Name, []byte(feature.ReactComponent.TsxCode))
 	if err != nil {
 		return fmt.Errorf("failed to store component for feature: %s: %w", feature.Name, err)
 	}
+	undo.push(func() error {
+		if hasPreviousComponent {
+			return s.componentStore.AddComponent(feature.Name, previousTsxCode)
+		}
+		return s.componentStore.DeleteComponent(feature.Name)
+	})
 
 	for _, operation := range feature.ServerOperations {
-		err := s.operationStore.AddOperation(operation)
+		previousOperation, err := s.operationStore.GetOperation(operation.Name)
+		if err != nil && !errors.Is(err, operations.ErrOperationNotFound) {
+			return fmt.Errorf("failed to get current operation %s for feature %s: %w", operation.Name, feature.Name, err)
+		}
+		hasPreviousOperation := err == nil
+
+		err = s.operationStore.AddOperation(operation)
 		if err != nil {
 			return fmt.Errorf("failed to add operation %s for feature %s: %w", operation.Name, feature.Name, err)
 		}
+		undo.push(func() error {
+			if !hasPreviousOperation {
+				return s.operationStore.DeleteOperation(operation.Name)
+			}
+			previousVersion := previousOperation.Version
+			if previousVersion == 0 {
+				// operations stored before versioning become version 1 once a
+				// new version is added
+				previousVersion = 1
+			}
+			return s.operationStore.RollbackOperation(operation.Name, previousVersion)
+		})
+	}
+
+	return nil
+}
+
+// replaceFeatureFolder renames the staged folder to the feature folder. An
+// existing feature folder is moved aside first and restored if the rename
+// fails.
+func (s *FsFeatureStore) replaceFeatureFolder(stagingFolder string, featureName string) error {
+	exists, err := afero.DirExists(s.fs, featureName)
+	if err != nil {
+		return fmt.Errorf("failed to check feature %s directory: %w", featureName, err)
+	}
+
+	if !exists {
+		err = s.fs.Rename(stagingFolder, featureName)
+		if err != nil {
+			return fmt.Errorf("failed to move feature %s into place: %w", featureName, err)
+		}
+		return nil
+	}
+
+	backupFolder := temporaryFeatureFolder("backup", featureName)
+	err = s.fs.Rename(featureName, backupFolder)
+	if err != nil {
+		return fmt.Errorf("failed to move current feature %s aside: %w", featureName, err)
+	}
+
+	err = s.fs.Rename(stagingFolder, featureName)
+	if err != nil {
+		restoreErr := s.fs.Rename(backupFolder, featureName)
+		if restoreErr != nil {
+			return fmt.Errorf("failed to move feature %s into place: %w (restoring it also failed: %w)", featureName, err, restoreErr)
+		}
+		return fmt.Errorf("failed to move feature %s into place: %w", featureName, err)
+	}
+
+	err = s.fs.RemoveAll(backupFolder)
+	if err != nil {
+		return fmt.Errorf("failed to remove previous feature %s: %w", featureName, err)
 	}
 
 	return nil
 }
+
+func (s *FsFeatureStore) DeleteFeature(name string, dryRun bool) (*FeatureDeletion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	featureManifest, err := s.getFeatureManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	otherFeaturesOperations, err := s.otherFeaturesOperations(name)
+	if err != nil {
+		return nil, err
+	}
+
+	deletion := planFeatureDeletion(featureManifest, otherFeaturesOperations)
+	deletion.DryRun = dryRun
+	if dryRun {
+		return deletion, nil
+	}
+
+	// the feature stops being listed as soon as its folder is moved aside.
+	// If removing the component or an operation fails afterwards, they are
+	// left unused.
+	deletingFolder := temporaryFeatureFolder("deleting", name)
+	err = s.fs.Rename(name, deletingFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move feature %s aside: %w", name, err)
+	}
+	defer s.fs.RemoveAll(deletingFolder)
+	s.notifyFeatureChanged(name)
+
+	err = s.componentStore.DeleteComponent(name)
+	if err != nil && !errors.Is(err, ErrComponentNotFound) {
+		return nil, fmt.Errorf("failed to delete component of feature %s: %w", name, err)
+	}
+
+	for _, operationName := range deletion.Operations {
+		err := s.operationStore.DeleteOperation(operationName)
+		if err != nil && !errors.Is(err, operations.ErrOperationNotFound) {
+			return nil, fmt.Errorf("failed to delete operation %s of feature %s: %w", operationName, name, err)
+		}
+	}
+
+	return deletion, nil
+}
+
+// otherFeaturesOperations returns the names of the operations used by every
+// feature but featureName, including broken features.
+func (s *FsFeatureStore) otherFeaturesOperations(featureName string) (map[string]bool, error) {
+	files, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read features directory: %w", err)
+	}
+
+	operationNames := map[string]bool{}
+	for _, featureDir := range files {
+		if !featureDir.IsDir() || isTemporaryFeatureFolder(featureDir.Name()) || featureDir.Name() == featureName {
+			continue
+		}
+
+		featureManifest, err := s.getFeatureManifest(featureDir.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check which operations feature %s uses: %w", featureDir.Name(), err)
+		}
+
+		for _, operationName := range featureManifest.Operations {
+			operationNames[operationName] = true
+		}
+	}
+
+	return operationNames, nil
+}
+
+func (s *FsFeatureStore) RenameFeature(name string, newName string, dryRun bool) (*FeatureRename, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := validateFeatureName(newName)
+	if err != nil {
+		return nil, err
+	}
+
+	featureManifest, err := s.getFeatureManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := afero.DirExists(s.fs, newName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check feature %s directory: %w", newName, err)
+	}
+	if exists {
+		return nil, fmt.Errorf("failed to rename feature %s to %s: %w", name, newName, ErrFeatureAlreadyExists)
+	}
+
+	tsxCode, err := s.componentStore.GetComponent(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get component of feature %s: %w", name, err)
+	}
+
+	rename := &FeatureRename{
+		Feature: name,
+		NewName: newName,
+		DryRun:  dryRun,
+	}
+	if dryRun {
+		return rename, nil
+	}
+
+	stagingFolder := temporaryFeatureFolder("staging", newName)
+	defer s.fs.RemoveAll(stagingFolder)
+
+	featureManifest.Name = newName
+	err = s.writeFeatureManifest(stagingFolder, featureManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.componentStore.AddComponent(newName, tsxCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store component for feature %s: %w", newName, err)
+	}
+
+	err = s.fs.Rename(stagingFolder, newName)
+	if err != nil {
+		undoErr := s.componentStore.DeleteComponent(newName)
+		if undoErr != nil {
+			return nil, fmt.Errorf("failed to move feature %s into place: %w (rollback also failed: %w)", newName, err, undoErr)
+		}
+		return nil, fmt.Errorf("failed to move feature %s into place: %w", newName, err)
+	}
+	defer s.notifyFeatureChanged(name)
+	s.notifyFeatureChanged(newName)
+
+	err = s.fs.RemoveAll(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove feature %s: %w", name, err)
+	}
+
+	err = s.componentStore.DeleteComponent(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete component of feature %s: %w", name, err)
+	}
+
+	return rename, nil
+}
+
+const temporaryFeatureFolderPrefix = "."
+
+// temporaryFeatureFolder returns a unique hidden folder name, which
+// GetAllFeatures ignores.
+func temporaryFeatureFolder(purpose string, featureName string) string {
+	return fmt.Sprintf("%s%s-%s-%s", temporaryFeatureFolderPrefix, purpose, featureName, uuid.NewString())
+}
+
+func isTemporaryFeatureFolder(folder string) bool {
+	return strings.HasPrefix(folder, temporaryFeatureFolderPrefix)
+}
+
+// sweepTemporaryFolders removes the temporary folders left by a server that
+// stopped while writing a feature. A feature moved aside but not replaced yet
+// is moved back into place.
+func (s *FsFeatureStore) sweepTemporaryFolders() {
+	files, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		log.Error().Msgf("failed to read features directory: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		folder := file.Name()
+		if !file.IsDir() {
+			continue
+		}
+
+		purpose, featureName, isTemporary := parseTemporaryFeatureFolder(folder)
+		if !isTemporary {
+			continue
+		}
+
+		if purpose == "backup" {
+			exists, err := afero.DirExists(s.fs, featureName)
+			if err != nil {
+				log.Error().Msgf("failed to check feature %s directory: %v", featureName, err)
+				continue
+			}
+			if !exists {
+				err := s.fs.Rename(folder, featureName)
+				if err != nil {
+					log.Error().Msgf("failed to restore feature %s from %s: %v", featureName, folder, err)
+				}
+				continue
+			}
+		}
+
+		err := s.fs.RemoveAll(folder)
+		if err != nil {
+			log.Error().Msgf("failed to remove temporary feature folder %s: %v", folder, err)
+		}
+	}
+}
+
+// parseTemporaryFeatureFolder splits a folder named by temporaryFeatureFolder
+// in its purpose and feature name.
+func parseTemporaryFeatureFolder(folder string) (string, string, bool) {
+	for _, purpose := range []string{"staging", "backup", "deleting"} {
+		rest, hasPrefix := strings.CutPrefix(folder, fmt.Sprintf("%s%s-", temporaryFeatureFolderPrefix, purpose))
+		// the feature name is followed by - and a uuid
+		if !hasPrefix || len(rest) < 38 {
+			continue
+		}
+
+		featureName, id := rest[:len(rest)-37], rest[len(rest)-36:]
+		if rest[len(rest)-37] != '-' || uuid.Validate(id) != nil {
+			continue
+		}
+		return purpose, featureName, true
+	}
+
+	return "", "", false
+}
+
+// undoStack runs the pushed functions in reverse order.
+type undoStack struct {
+	fns []func() error
+}
+
+func (u *undoStack) push(fn func() error) {
+	u.fns = append(u.fns, fn)
+}
+
+func (u *undoStack) run() error {
+	errs := []error{}
+	for i := len(u.fns) - 1; i >= 0; i-- {
+		errs = append(errs, u.fns[i]())
+	}
+	return errors.Join(errs...)
+}
+
+func featureOperationNames(feature *Feature) []string {
+	return utils.Map(feature.ServerOperations, func(operation *operations.Operation) string { return operation.Name })
+}
@@ -0,0 +1,352 @@
+package features_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/prigas-dev/backoffice-ai/utils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsFeatureStore(t *testing.T) {
+	t.Run("add and get", func(t *testing.T) {
+		t.Parallel()
+
+		store, _, _ := newFsFeatureStore(nil)
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+
+		feature, err := store.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+		assert.Equal(t, "get-tasks", feature.ServerOperations[0].Name)
+
+		err = store.AddFeature(newFeature("tasks", "v2", "get-tasks"))
+		assert.NoError(t, err)
+
+		featureManifests, brokenFeatures, err := store.GetAllFeatures()
+		assert.NoError(t, err)
+		assert.Empty(t, brokenFeatures)
+		assert.Len(t, featureManifests, 1)
+
+		feature, err = store.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", feature.ReactComponent.TsxCode)
+	})
+
+	t.Run("failed add is rolled back", func(t *testing.T) {
+		t.Parallel()
+
+		errFailedWrite := errors.New("failed write")
+		store, operationStore, componentStore := newFsFeatureStore(func(operation *operations.Operation) error {
+			if operation.Name == "delete-task" {
+				return errFailedWrite
+			}
+			return nil
+		})
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+
+		err = store.AddFeature(newFeature("tasks", "v2", "get-tasks", "create-task", "delete-task"))
+		assert.ErrorIs(t, err, errFailedWrite)
+
+		feature, err := store.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+		assert.Len(t, feature.ServerOperations, 1)
+
+		getTasks, err := operationStore.GetOperation("get-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, getTasks.Version)
+
+		_, err = operationStore.GetOperation("create-task")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+
+		err = store.AddFeature(newFeature("users", "v1", "delete-task"))
+		assert.ErrorIs(t, err, errFailedWrite)
+
+		_, err = componentStore.GetComponent("users")
+		assert.ErrorIs(t, err, features.ErrComponentNotFound)
+
+		featureManifests, brokenFeatures, err := store.GetAllFeatures()
+		assert.NoError(t, err)
+		assert.Empty(t, brokenFeatures)
+		assert.Equal(t, []string{"tasks"}, []string{featureManifests[0].Name})
+	})
+
+	t.Run("concurrent adds", func(t *testing.T) {
+		t.Parallel()
+
+		store, operationStore, componentStore := newFsFeatureStore(func(operation *operations.Operation) error {
+			if operation.Name == "delete-task" {
+				// gives the other adds time to run before this one is undone
+				time.Sleep(time.Millisecond)
+				return errors.New("failed write")
+			}
+			return nil
+		})
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				operationNames := []string{"get-tasks"}
+				if i%2 == 1 {
+					operationNames = append(operationNames, "delete-task")
+				}
+				feature := newFeature("tasks", fmt.Sprintf("v%d", i), operationNames...)
+				feature.ServerOperations[0].JavascriptCode = fmt.Sprintf("function run() { return %d }", i)
+				store.AddFeature(feature)
+			}()
+		}
+		wg.Wait()
+
+		// the feature is left as one of the adds that succeeded wrote it
+		feature, err := store.GetFeature("tasks")
+		assert.NoError(t, err)
+		tsxCode, err := componentStore.GetComponent("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, feature.ReactComponent.TsxCode, string(tsxCode))
+
+		var i int
+		fmt.Sscanf(feature.ReactComponent.TsxCode, "v%d", &i)
+		assert.Equal(t, 0, i%2)
+		getTasks, err := operationStore.GetOperation("get-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("function run() { return %d }", i), getTasks.JavascriptCode)
+	})
+
+	t.Run("broken features are reported separately", func(t *testing.T) {
+		t.Parallel()
+
+		featuresFs := afero.NewMemMapFs()
+		operationStore := operations.NewInMemoryOperationStore()
+		componentStore := features.NewFsComponentStore(afero.NewMemMapFs(), operationStore)
+		store := features.NewFsFeatureStore(featuresFs, operationStore, componentStore)
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+		err = store.AddFeature(newFeature("users", "v1", "get-users"))
+		assert.NoError(t, err)
+
+		afero.WriteFile(featuresFs, "invalid/feature_manifest.json", []byte(`{`), 0755)
+		err = operationStore.DeleteOperation("get-users")
+		assert.NoError(t, err)
+
+		featureManifests, brokenFeatures, err := store.GetAllFeatures()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"tasks"}, []string{featureManifests[0].Name})
+		assert.Len(t, brokenFeatures, 2)
+		assert.Equal(t, "invalid", brokenFeatures[0].Name)
+		assert.Equal(t, "users", brokenFeatures[1].Name)
+		assert.Contains(t, brokenFeatures[1].Error, "get-users")
+	})
+
+	t.Run("temporary folders are swept", func(t *testing.T) {
+		t.Parallel()
+
+		featuresFs := afero.NewMemMapFs()
+		operationStore := operations.NewInMemoryOperationStore()
+		componentStore := features.NewFsComponentStore(afero.NewMemMapFs(), operationStore)
+		store := features.NewFsFeatureStore(featuresFs, operationStore, componentStore)
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+		err = store.AddFeature(newFeature("users", "v1", "get-users"))
+		assert.NoError(t, err)
+
+		// the server stopped while replacing users and deleting tasks
+		id := "0b9d5e2c-8f1a-4c3e-9a57-2f6d1e8b4c70"
+		err = featuresFs.Rename("users", ".backup-users-"+id)
+		assert.NoError(t, err)
+		afero.WriteFile(featuresFs, ".staging-users-"+id+"/feature_manifest.json", []byte(`{}`), 0755)
+		afero.WriteFile(featuresFs, ".deleting-tasks-"+id+"/feature_manifest.json", []byte(`{}`), 0755)
+		afero.WriteFile(featuresFs, ".backup-tasks-"+id+"/feature_manifest.json", []byte(`{}`), 0755)
+
+		store = features.NewFsFeatureStore(featuresFs, operationStore, componentStore)
+
+		folders, err := afero.ReadDir(featuresFs, ".")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"tasks", "users"}, utils.Map(folders, func(folder os.FileInfo) string { return folder.Name() }))
+
+		feature, err := store.GetFeature("users")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+	})
+
+	testFeatureStore(t, func() (features.IFeatureStore, operations.IOperationStore, features.IComponentStore) {
+		return newFsFeatureStore(nil)
+	})
+}
+
+func TestSqlFeatureStore(t *testing.T) {
+	testFeatureStore(t, func() (features.IFeatureStore, operations.IOperationStore, features.IComponentStore) {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		operationStore := operations.NewSqlOperationStore(db)
+		componentStore, err := features.NewSqlComponentStore(db, afero.NewMemMapFs(), operationStore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := features.NewSqlFeatureStore(db, operationStore, componentStore)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return store, operationStore, componentStore
+	})
+}
+
+func testFeatureStore(t *testing.T, newStores func() (features.IFeatureStore, operations.IOperationStore, features.IComponentStore)) {
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		store, operationStore, componentStore := newStores()
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks", "get-users", "get-tasks"))
+		assert.NoError(t, err)
+		err = store.AddFeature(newFeature("users", "v1", "get-users"))
+		assert.NoError(t, err)
+
+		deletion, err := store.DeleteFeature("tasks", true)
+		assert.NoError(t, err)
+		assert.Equal(t, &features.FeatureDeletion{
+			Feature:          "tasks",
+			DryRun:           true,
+			Operations:       []string{"get-tasks"},
+			SharedOperations: []string{"get-users"},
+		}, deletion)
+
+		_, err = store.GetFeature("tasks")
+		assert.NoError(t, err)
+
+		deletion, err = store.DeleteFeature("tasks", false)
+		assert.NoError(t, err)
+		assert.False(t, deletion.DryRun)
+
+		_, err = store.GetFeature("tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+		_, err = componentStore.GetComponent("tasks")
+		assert.ErrorIs(t, err, features.ErrComponentNotFound)
+		_, err = operationStore.GetOperation("get-tasks")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+		_, err = operationStore.GetOperation("get-users")
+		assert.NoError(t, err)
+
+		featureManifests, brokenFeatures, err := store.GetAllFeatures()
+		assert.NoError(t, err)
+		assert.Empty(t, brokenFeatures)
+		assert.Len(t, featureManifests, 1)
+
+		_, err = store.DeleteFeature("tasks", false)
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		t.Parallel()
+
+		store, _, componentStore := newStores()
+
+		err := store.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+		err = store.AddFeature(newFeature("users", "v1", "get-users"))
+		assert.NoError(t, err)
+
+		_, err = store.RenameFeature("tasks", "users", false)
+		assert.ErrorIs(t, err, features.ErrFeatureAlreadyExists)
+		_, err = store.RenameFeature("tasks", "../tasks", false)
+		assert.ErrorIs(t, err, features.ErrInvalidFeatureName)
+		_, err = store.RenameFeature("missing", "other", false)
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+
+		rename, err := store.RenameFeature("tasks", "team-tasks", true)
+		assert.NoError(t, err)
+		assert.Equal(t, &features.FeatureRename{Feature: "tasks", NewName: "team-tasks", DryRun: true}, rename)
+
+		_, err = store.GetFeature("team-tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+
+		_, err = store.RenameFeature("tasks", "team-tasks", false)
+		assert.NoError(t, err)
+
+		feature, err := store.GetFeature("team-tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "team-tasks", feature.Name)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+		assert.Equal(t, "get-tasks", feature.ServerOperations[0].Name)
+
+		_, err = store.GetFeature("tasks")
+		assert.ErrorIs(t, err, features.ErrFeatureNotFound)
+		_, err = componentStore.GetComponent("tasks")
+		assert.ErrorIs(t, err, features.ErrComponentNotFound)
+
+		featureManifests, _, err := store.GetAllFeatures()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"team-tasks", "users"}, []string{featureManifests[0].Name, featureManifests[1].Name})
+	})
+}
+
+type failingOperationStore struct {
+	operations.IOperationStore
+	fail func(operation *operations.Operation) error
+}
+
+func (s *failingOperationStore) AddOperation(operation *operations.Operation) error {
+	err := s.fail(operation)
+	if err != nil {
+		return err
+	}
+	return s.IOperationStore.AddOperation(operation)
+}
+
+func newFsFeatureStore(fail func(operation *operations.Operation) error) (features.IFeatureStore, operations.IOperationStore, features.IComponentStore) {
+	var operationStore operations.IOperationStore = operations.NewFsOperationStore(afero.NewMemMapFs())
+	if fail != nil {
+		operationStore = &failingOperationStore{IOperationStore: operationStore, fail: fail}
+	}
+	componentStore := features.NewFsComponentStore(afero.NewMemMapFs(), operationStore)
+	store := features.NewFsFeatureStore(afero.NewMemMapFs(), operationStore, componentStore)
+
+	return store, operationStore, componentStore
+}
+
+func newFeature(name string, tsxCode string, operationNames ...string) *features.Feature {
+	feature := &features.Feature{
+		Name:  name,
+		Label: name,
+		ReactComponent: &features.ReactComponent{
+			TsxCode: tsxCode,
+		},
+		ServerOperations: []*operations.Operation{},
+	}
+
+	for _, operationName := range operationNames {
+		feature.ServerOperations = append(feature.ServerOperations, &operations.Operation{
+			Name:           operationName,
+			JavascriptCode: `function run() { return 1 }`,
+			Parameters:     map[string]*operations.ValueSchema{},
+			Return: &operations.ValueSchema{
+				Type: operations.Number,
+				Spec: &operations.NumberSpec{},
+			},
+		})
+	}
+
+	return feature
+}
@@ -0,0 +1,308 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prigas-dev/backoffice-ai/features/instruction_files"
+	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/prigas-dev/backoffice-ai/utils"
+)
+
+// IFeatureValidator checks a generated feature before any of it is stored.
+type IFeatureValidator interface {
+	// Validate runs every check on the feature. The error is only returned
+	// when the checks can't run, problems of the feature are in the report.
+	Validate(feature *Feature) (*ValidationReport, error)
+}
+
+type ValidationReport struct {
+	Valid  bool               `json:"valid"`
+	Checks []*ValidationCheck `json:"checks"`
+}
+
+type ValidationCheck struct {
+	Check DiagnosticSource `json:"check"`
+	// Skipped is set when the check didn't run because of problems found by
+	// the checks before it
+	Skipped     bool          `json:"skipped,omitempty"`
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostics returns the problems found by every check.
+func (r *ValidationReport) Diagnostics() []*Diagnostic {
+	diagnostics := []*Diagnostic{}
+	for _, check := range r.Checks {
+		diagnostics = append(diagnostics, check.Diagnostics...)
+	}
+	return diagnostics
+}
+
+func NewFeatureValidator(operationStore operations.IOperationStore, sourceChecker frontend.ISourceChecker) IFeatureValidator {
+	return &FeatureValidator{
+		operationStore: operationStore,
+		sourceChecker:  sourceChecker,
+	}
+}
+
+type FeatureValidator struct {
+	operationStore operations.IOperationStore
+	sourceChecker  frontend.ISourceChecker
+}
+
+func (v *FeatureValidator) Validate(feature *Feature) (*ValidationReport, error) {
+	schemaDiagnostics, err := checkFeatureSchema(feature)
+	if err != nil {
+		return nil, err
+	}
+
+	storedOperations, _, err := v.operationStore.ListOperations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	// the feature operations replace the stored ones with the same name
+	candidateOperations := slices.DeleteFunc(storedOperations, func(operation *operations.Operation) bool {
+		return slices.ContainsFunc(feature.ServerOperations, func(featureOperation *operations.Operation) bool {
+			return featureOperation.Name == operation.Name
+		})
+	})
+	candidateOperations = append(candidateOperations, feature.ServerOperations...)
+
+	report := &ValidationReport{
+		Checks: []*ValidationCheck{
+			{Check: SchemaDiagnostic, Diagnostics: schemaDiagnostics},
+			{Check: NameDiagnostic, Diagnostics: checkFeatureNames(feature, candidateOperations)},
+			{Check: JavascriptDiagnostic, Diagnostics: checkOperationScripts(feature)},
+		},
+	}
+
+	// the component is checked with the generated sources, which can't be
+	// generated from operations that don't follow the schema
+	hasComponent := feature.ReactComponent != nil && len(feature.ReactComponent.TsxCode) > 0
+	canCheckComponent := hasComponent && len(report.Checks[0].Diagnostics) == 0 && len(report.Checks[1].Diagnostics) == 0
+
+	var operationsTs string
+	if canCheckComponent {
+		operationsTs, err = renderOperationsClient(candidateOperations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	componentCheck := &ValidationCheck{Check: TsxDiagnostic, Skipped: !canCheckComponent, Diagnostics: []*Diagnostic{}}
+	if canCheckComponent {
+		componentCheck.Diagnostics, err = v.checkComponent(feature, operationsTs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	referenceCheck := &ValidationCheck{Check: ReferenceDiagnostic, Skipped: !hasComponent, Diagnostics: []*Diagnostic{}}
+	if hasComponent {
+		referenceCheck.Diagnostics = checkOperationReferences(feature, candidateOperations)
+	}
+
+	// the other components are checked with the operations of the feature,
+	// once the component itself builds
+	canCheckFrontend := canCheckComponent && len(componentCheck.Diagnostics) == 0
+	frontendCheck := &ValidationCheck{Check: BuildDiagnostic, Skipped: !canCheckFrontend, Diagnostics: []*Diagnostic{}}
+	if canCheckFrontend {
+		frontendCheck.Diagnostics, err = v.checkFrontend(feature, operationsTs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report.Checks = append(report.Checks, componentCheck, referenceCheck, frontendCheck)
+	report.Valid = len(report.Diagnostics()) == 0
+
+	return report, nil
+}
+
+// checkFeatureSchema validates the feature against the feature JSON schema
+// given to the AI.
+func checkFeatureSchema(feature *Feature) ([]*Diagnostic, error) {
+	featureJson, err := json.Marshal(feature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode feature: %w", err)
+	}
+
+	violations, err := utils.ValidateJSONSchema([]byte(instruction_files.FeatureJSONSchema.Content), featureJson)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate feature schema: %w", err)
+	}
+
+	diagnostics := utils.Map(violations, func(violation *utils.JSONSchemaViolation) *Diagnostic {
+		return &Diagnostic{Source: SchemaDiagnostic, Location: violation.Path, Message: violation.Message}
+	})
+
+	// the JSON schema can't tell whether a pattern is a valid regular expression
+	for i, operation := range feature.ServerOperations {
+		var patternErr *operations.InvalidPatternError
+		if errors.As(operation.CheckPatterns(), &patternErr) {
+			diagnostics = append(diagnostics, &Diagnostic{
+				Source:   SchemaDiagnostic,
+				Location: fmt.Sprintf("/serverOperations/%d%s", i, patternErr.Path),
+				Message:  fmt.Sprintf("invalid pattern %s: %v", patternErr.Pattern, patternErr.Err),
+			})
+		}
+	}
+
+	return diagnostics, nil
+}
+
+// checkFeatureNames checks the names used as folder, file and function
+// names. The operations of the feature must have TypeScript names different
+// from each other and from the rest of candidateOperations.
+func checkFeatureNames(feature *Feature, candidateOperations []*operations.Operation) []*Diagnostic {
+	diagnostics := []*Diagnostic{}
+
+	err := validateFeatureName(feature.Name)
+	if err != nil {
+		diagnostics = append(diagnostics, &Diagnostic{Source: NameDiagnostic, Message: err.Error()})
+	}
+
+	operationNames := map[string]bool{}
+	for _, operation := range feature.ServerOperations {
+		if !featureNameRegexp.MatchString(operation.Name) {
+			diagnostics = append(diagnostics, &Diagnostic{Source: NameDiagnostic, Message: fmt.Sprintf("invalid operation name %q, it must match %s", operation.Name, featureNameRegexp)})
+		}
+		if operationNames[operation.Name] {
+			diagnostics = append(diagnostics, &Diagnostic{Source: NameDiagnostic, Message: fmt.Sprintf("operation %s is declared more than once", operation.Name)})
+		}
+		operationNames[operation.Name] = true
+	}
+
+	typeNameOperations := map[string]string{}
+	for _, operation := range candidateOperations {
+		if !operationNames[operation.Name] {
+			typeNameOperations[operations.TypeScriptName(operation.Name)] = operation.Name
+		}
+	}
+	for _, operation := range feature.ServerOperations {
+		typeName := operations.TypeScriptName(operation.Name)
+		otherName, hasTypeName := typeNameOperations[typeName]
+		if hasTypeName && otherName != operation.Name {
+			diagnostics = append(diagnostics, &Diagnostic{Source: NameDiagnostic, Message: fmt.Sprintf("operations %s and %s are both named %s in TypeScript, rename %s", otherName, operation.Name, typeName, operation.Name)})
+			continue
+		}
+		typeNameOperations[typeName] = operation.Name
+	}
+
+	return diagnostics
+}
+
+func checkOperationScripts(feature *Feature) []*Diagnostic {
+	diagnostics := []*Diagnostic{}
+	for _, operation := range feature.ServerOperations {
+		scriptFile := fmt.Sprintf("operations/%s/operation.js", operation.Name)
+		err := operations.CheckOperationScript(scriptFile, operation.JavascriptCode)
+		if err != nil {
+			diagnostics = append(diagnostics, &Diagnostic{Source: JavascriptDiagnostic, Location: scriptFile, Message: err.Error()})
+		}
+	}
+	return diagnostics
+}
+
+// checkComponent type checks and bundles the component on its own, with the
+// operations client it would be built with.
+func (v *FeatureValidator) checkComponent(feature *Feature, operationsTs string) ([]*Diagnostic, error) {
+	componentFile := fmt.Sprintf("components/%s.tsx", feature.Name)
+	check, err := v.sourceChecker.CheckSources(map[string]string{
+		componentFile:   feature.ReactComponent.TsxCode,
+		"operations.ts": operationsTs,
+	}, componentFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check component %s: %w", feature.Name, err)
+	}
+
+	diagnostics := buildDiagnostics(TsxDiagnostic, check.Messages)
+	if len(check.Messages) == 0 && !slices.Contains(check.Exports, "default") {
+		// features.tsx lazy loads the default export of each component
+		diagnostics = append(diagnostics, &Diagnostic{Source: TsxDiagnostic, Location: componentFile, Message: "the component must be the default export"})
+	}
+
+	return diagnostics, nil
+}
+
+// checkFrontend type checks and bundles the whole frontend with the component
+// and the operations client of the feature, since changed operations may break
+// the components of other features using them.
+func (v *FeatureValidator) checkFrontend(feature *Feature, operationsTs string) ([]*Diagnostic, error) {
+	check, err := v.sourceChecker.CheckFrontend(map[string]string{
+		fmt.Sprintf("components/%s.tsx", feature.Name): feature.ReactComponent.TsxCode,
+		"operations.ts": operationsTs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check frontend with feature %s: %w", feature.Name, err)
+	}
+
+	return buildDiagnostics(BuildDiagnostic, check.Messages), nil
+}
+
+var (
+	// components either fetch operations themselves or import their typed
+	// client
+	operationFetchRegexp   = regexp.MustCompile(`/operations/execute/([A-Za-z0-9_-]+)`)
+	operationsImportRegexp = regexp.MustCompile(`import\s+(?:type\s+)?\{([^}]*)\}\s*from\s*["']\.\./operations["']`)
+)
+
+// checkOperationReferences checks that the operations the component calls
+// are declared by the feature or stored.
+func checkOperationReferences(feature *Feature, candidateOperations []*operations.Operation) []*Diagnostic {
+	componentFile := fmt.Sprintf("components/%s.tsx", feature.Name)
+	tsxCode := feature.ReactComponent.TsxCode
+
+	operationNames := map[string]bool{}
+	clientExports := map[string]bool{
+		"OperationError":           true,
+		"OperationValidationError": true,
+	}
+	for _, operation := range candidateOperations {
+		operationNames[operation.Name] = true
+
+		typeName := operations.TypeScriptName(operation.Name)
+		clientExports[operationClientFunctionName(typeName)] = true
+		clientExports[typeName+"Parameters"] = true
+		clientExports[typeName+"Result"] = true
+	}
+
+	diagnostics := []*Diagnostic{}
+	reported := map[string]bool{}
+
+	for _, match := range operationFetchRegexp.FindAllStringSubmatch(tsxCode, -1) {
+		operationName := match[1]
+		if operationNames[operationName] || reported[operationName] {
+			continue
+		}
+		reported[operationName] = true
+		diagnostics = append(diagnostics, &Diagnostic{
+			Source:   ReferenceDiagnostic,
+			Location: componentFile,
+			Message:  fmt.Sprintf("the component calls operation %s, which is not declared in serverOperations", operationName),
+		})
+	}
+
+	for _, match := range operationsImportRegexp.FindAllStringSubmatch(tsxCode, -1) {
+		for _, importedName := range strings.Split(match[1], ",") {
+			importedName = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(importedName), "type "))
+			importedName, _, _ = strings.Cut(importedName, " ")
+			if len(importedName) == 0 || clientExports[importedName] || reported[importedName] {
+				continue
+			}
+			reported[importedName] = true
+			diagnostics = append(diagnostics, &Diagnostic{
+				Source:   ReferenceDiagnostic,
+				Location: componentFile,
+				Message:  fmt.Sprintf("the component imports %s from ../operations, but no operation in serverOperations generates it", importedName),
+			})
+		}
+	}
+
+	return diagnostics
+}
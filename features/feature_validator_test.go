@@ -0,0 +1,171 @@
+package features_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/features/instruction_files"
+	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFeatureValidator(operationStore operations.IOperationStore) features.IFeatureValidator {
+	// without a TypeScript compiler the components are only bundled
+	return features.NewFeatureValidator(operationStore, frontend.NewSourceChecker(&frontend.BuilderConfig{}))
+}
+
+// generatedFeature is a feature as the AI would answer it, which passes
+// validation.
+func generatedFeature(name string, text string, operationNames ...string) *features.Feature {
+	feature := newFeature(name, componentTsx(text), operationNames...)
+	for _, operation := range feature.ServerOperations {
+		operation.Kind = operations.QueryKind
+	}
+	return feature
+}
+
+func componentTsx(text string) string {
+	return "export default function Component() {\n  return <div>" + text + "</div>;\n}\n"
+}
+
+func checkDiagnostics(report *features.ValidationReport, check features.DiagnosticSource) []*features.Diagnostic {
+	for _, validationCheck := range report.Checks {
+		if validationCheck.Check == check {
+			return validationCheck.Diagnostics
+		}
+	}
+	return nil
+}
+
+func TestFeatureValidator(t *testing.T) {
+	t.Run("the example feature is valid", func(t *testing.T) {
+		t.Parallel()
+
+		feature := &features.Feature{}
+		err := json.Unmarshal([]byte(instruction_files.ExampleFeatureJSON.Content), feature)
+		assert.NoError(t, err)
+
+		exampleFiles := map[string]string{}
+		for _, file := range instruction_files.ExampleFeatureFiles {
+			exampleFiles[file.Filename] = file.Content
+		}
+		feature.ReactComponent.TsxCode = exampleFiles["Component.tsx"]
+		for _, operation := range feature.ServerOperations {
+			operation.JavascriptCode = exampleFiles[operation.Name+".js"]
+		}
+
+		_, operationStore, _ := newFsFeatureStore(nil)
+		report, err := newFeatureValidator(operationStore).Validate(feature)
+		assert.NoError(t, err)
+		assert.Empty(t, report.Diagnostics())
+		assert.True(t, report.Valid)
+		assert.Len(t, report.Checks, 6)
+		for _, check := range report.Checks {
+			assert.False(t, check.Skipped, check.Check)
+		}
+	})
+
+	t.Run("each check reports its problems", func(t *testing.T) {
+		t.Parallel()
+
+		_, operationStore, _ := newFsFeatureStore(nil)
+		operationStore.AddOperation(generatedFeature("users", "", "get-users").ServerOperations[0])
+		validator := newFeatureValidator(operationStore)
+
+		feature := generatedFeature("tasks", "", "get-tasks", "create-task")
+		feature.ServerOperations[0].Kind = "read"
+		feature.ServerOperations[1].JavascriptCode = `function create() {}`
+		feature.ReactComponent.TsxCode = `import { getTasks, getUsers, deleteTask } from "../operations";
+
+export function Component() {
+  fetch("/operations/execute/get-users");
+  fetch("/operations/execute/update-task");
+  return <div />;
+}
+`
+		report, err := validator.Validate(feature)
+		assert.NoError(t, err)
+		assert.False(t, report.Valid)
+
+		assert.Equal(t, []*features.Diagnostic{{
+			Source:   features.SchemaDiagnostic,
+			Location: "/serverOperations/0/kind",
+			Message:  `must be one of ["query","mutation"]`,
+		}}, checkDiagnostics(report, features.SchemaDiagnostic))
+		assert.Empty(t, checkDiagnostics(report, features.NameDiagnostic))
+
+		javascriptDiagnostics := checkDiagnostics(report, features.JavascriptDiagnostic)
+		assert.Len(t, javascriptDiagnostics, 1)
+		assert.Equal(t, "operations/create-task/operation.js", javascriptDiagnostics[0].Location)
+
+		// the schema problem prevents generating the operations client
+		assert.True(t, report.Checks[3].Skipped)
+
+		referenceDiagnostics := checkDiagnostics(report, features.ReferenceDiagnostic)
+		assert.Len(t, referenceDiagnostics, 2)
+		assert.Contains(t, referenceDiagnostics[0].Message, "update-task")
+		assert.Contains(t, referenceDiagnostics[1].Message, "deleteTask")
+
+		feature.ServerOperations[0].Kind = operations.QueryKind
+		report, err = validator.Validate(feature)
+		assert.NoError(t, err)
+		assert.Equal(t, []*features.Diagnostic{{
+			Source:   features.TsxDiagnostic,
+			Location: "components/tasks.tsx",
+			Message:  "the component must be the default export",
+		}}, checkDiagnostics(report, features.TsxDiagnostic))
+
+		feature.ReactComponent.TsxCode = "export default function Component() {\n  return <div>;\n}\n"
+		report, err = validator.Validate(feature)
+		assert.NoError(t, err)
+		tsxDiagnostics := checkDiagnostics(report, features.TsxDiagnostic)
+		assert.NotEmpty(t, tsxDiagnostics)
+		assert.Equal(t, "components/tasks.tsx:3:1", tsxDiagnostics[0].Location)
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		t.Parallel()
+
+		_, operationStore, _ := newFsFeatureStore(nil)
+		report, err := newFeatureValidator(operationStore).Validate(generatedFeature("../tasks", "", "get tasks", "get-users", "get-users"))
+		assert.NoError(t, err)
+		assert.Len(t, checkDiagnostics(report, features.NameDiagnostic), 3)
+		assert.True(t, report.Checks[3].Skipped)
+	})
+
+	t.Run("conflicting TypeScript names", func(t *testing.T) {
+		t.Parallel()
+
+		_, operationStore, _ := newFsFeatureStore(nil)
+		operationStore.AddOperation(generatedFeature("users", "", "get-users").ServerOperations[0])
+
+		report, err := newFeatureValidator(operationStore).Validate(generatedFeature("tasks", "", "get-tasks", "get_tasks", "get_users"))
+		assert.NoError(t, err)
+
+		nameDiagnostics := checkDiagnostics(report, features.NameDiagnostic)
+		assert.Len(t, nameDiagnostics, 2)
+		assert.Equal(t, "operations get-tasks and get_tasks are both named GetTasks in TypeScript, rename get_tasks", nameDiagnostics[0].Message)
+		assert.Equal(t, "operations get-users and get_users are both named GetUsers in TypeScript, rename get_users", nameDiagnostics[1].Message)
+	})
+
+	t.Run("invalid patterns", func(t *testing.T) {
+		t.Parallel()
+
+		_, operationStore, _ := newFsFeatureStore(nil)
+		feature := generatedFeature("tasks", "", "get-tasks")
+		feature.ServerOperations[0].Parameters["code"] = &operations.ValueSchema{
+			Type: operations.String,
+			Spec: &operations.StringSpec{Pattern: "[0-9"},
+		}
+
+		report, err := newFeatureValidator(operationStore).Validate(feature)
+		assert.NoError(t, err)
+
+		schemaDiagnostics := checkDiagnostics(report, features.SchemaDiagnostic)
+		assert.Len(t, schemaDiagnostics, 1)
+		assert.Equal(t, "/serverOperations/0/parameters/code/spec/pattern", schemaDiagnostics[0].Location)
+		assert.Contains(t, schemaDiagnostics[0].Message, "invalid pattern [0-9")
+	})
+}
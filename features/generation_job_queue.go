@@ -0,0 +1,344 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+var (
+	ErrGenerationQueueFull   = errors.New("too many generation jobs are queued")
+	ErrGenerationJobFinished = errors.New("generation job already finished")
+)
+
+// IGenerationJobQueue generates features in the background, a few at a time.
+type IGenerationJobQueue interface {
+	// EnqueueJob queues the generation of a feature from prompt, changing
+	// contextFeatureName when it's not empty, accounted to user. It fails
+	// with ErrGenerationQueueFull when too many jobs are waiting.
+	EnqueueJob(user string, prompt string, contextFeatureName string) (*GenerationJob, error)
+	GetJob(id string) (*GenerationJob, error)
+	// CancelJob cancels a queued job right away. A running job is canceled
+	// once its generation stops, which may be after its feature was stored,
+	// in which case the job still succeeds.
+	CancelJob(id string) (*GenerationJob, error)
+	// Close stops the workers, canceling the running jobs. Queued jobs are
+	// resumed the next time the queue is created.
+	Close()
+}
+
+type GenerationJobsConfig struct {
+	// how many features are generated at the same time
+	Workers int
+
+	// how many jobs can wait for a worker, more are refused
+	QueueSize int
+}
+
+func NewGenerationJobQueue(featureGenerator IFeatureGenerator, featureStore IFeatureStore, jobStore IGenerationJobStore, config *GenerationJobsConfig) (IGenerationJobQueue, error) {
+	if config == nil {
+		config = &GenerationJobsConfig{}
+	}
+	workers := max(config.Workers, 1)
+	queueSize := max(config.QueueSize, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := &GenerationJobQueue{
+		featureGenerator: featureGenerator,
+		featureStore:     featureStore,
+		jobStore:         jobStore,
+		ctx:              ctx,
+		cancel:           cancel,
+		queueSize:        queueSize,
+		jobQueued:        make(chan struct{}, 1),
+		activeJobs:       map[string]*activeGenerationJob{},
+	}
+
+	err := q.resumeJobs()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	for range workers {
+		q.workers.Add(1)
+		go q.work()
+	}
+
+	return q, nil
+}
+
+type GenerationJobQueue struct {
+	featureGenerator IFeatureGenerator
+	featureStore     IFeatureStore
+	jobStore         IGenerationJobStore
+
+	// canceled when the queue is closed, every job context derives from it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	queueSize int
+	// wakes an idle worker when a job is queued
+	jobQueued chan struct{}
+	workers   sync.WaitGroup
+
+	// mu guards queue, activeJobs and the jobs in it, which are written to
+	// the job store whenever they change
+	mu sync.Mutex
+	// ids of the queued jobs, oldest first. Canceled jobs are removed, so
+	// they don't take the place of new ones.
+	queue      []string
+	activeJobs map[string]*activeGenerationJob
+}
+
+// activeGenerationJob is a queued or running job.
+type activeGenerationJob struct {
+	job    *GenerationJob
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// resumeJobs queues again the jobs that were queued when the server stopped.
+// Jobs that were running are failed, since part of the feature may have been
+// stored already.
+func (q *GenerationJobQueue) resumeJobs() error {
+	jobs, err := q.jobStore.ListGenerationJobs()
+	if err != nil {
+		return fmt.Errorf("failed to list generation jobs: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range jobs {
+		switch {
+		case job.Status == JobRunning:
+			q.finishJob(job, fmt.Errorf("the server stopped while the job was running"))
+		case job.Status == JobQueued && len(q.queue) >= q.queueSize:
+			q.finishJob(job, ErrGenerationQueueFull)
+		case job.Status == JobQueued:
+			q.queueJob(job)
+		}
+	}
+
+	return nil
+}
+
+func (q *GenerationJobQueue) EnqueueJob(user string, prompt string, contextFeatureName string) (*GenerationJob, error) {
+	id, err := newGenerationJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &GenerationJob{
+		ID:                 id,
+		Status:             JobQueued,
+		Prompt:             prompt,
+		User:               user,
+		ContextFeatureName: contextFeatureName,
+		CreatedAt:          time.Now(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.queue) >= q.queueSize {
+		return nil, ErrGenerationQueueFull
+	}
+
+	err = q.jobStore.SaveGenerationJob(job)
+	if err != nil {
+		return nil, err
+	}
+
+	q.queueJob(job)
+
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+func (q *GenerationJobQueue) queueJob(job *GenerationJob) {
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.activeJobs[job.ID] = &activeGenerationJob{
+		job:    job,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	q.queue = append(q.queue, job.ID)
+	q.wakeWorker()
+}
+
+// wakeWorker wakes an idle worker, if none is about to take a job already.
+func (q *GenerationJobQueue) wakeWorker() {
+	select {
+	case q.jobQueued <- struct{}{}:
+	default:
+	}
+}
+
+// dequeueJob takes the oldest queued job, returning false when there is
+// none or the queue is closed.
+func (q *GenerationJobQueue) dequeueJob() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.queue) == 0 || q.ctx.Err() != nil {
+		return "", false
+	}
+	id := q.queue[0]
+	q.queue = q.queue[1:]
+	if len(q.queue) > 0 {
+		// another worker can take the next one
+		q.wakeWorker()
+	}
+	return id, true
+}
+
+func (q *GenerationJobQueue) GetJob(id string) (*GenerationJob, error) {
+	q.mu.Lock()
+	activeJob, isActive := q.activeJobs[id]
+	if isActive {
+		jobCopy := *activeJob.job
+		q.mu.Unlock()
+		return &jobCopy, nil
+	}
+	q.mu.Unlock()
+
+	return q.jobStore.GetGenerationJob(id)
+}
+
+func (q *GenerationJobQueue) CancelJob(id string) (*GenerationJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	activeJob, isActive := q.activeJobs[id]
+	if !isActive {
+		job, err := q.jobStore.GetGenerationJob(id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to cancel generation job %s, its status is %s: %w", id, job.Status, ErrGenerationJobFinished)
+	}
+
+	activeJob.cancel()
+	if activeJob.job.Status == JobQueued {
+		q.queue = slices.DeleteFunc(q.queue, func(queuedID string) bool { return queuedID == id })
+		delete(q.activeJobs, id)
+		q.finishJob(activeJob.job, context.Canceled)
+	}
+
+	jobCopy := *activeJob.job
+	return &jobCopy, nil
+}
+
+func (q *GenerationJobQueue) work() {
+	defer q.workers.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.jobQueued:
+			for {
+				id, isQueued := q.dequeueJob()
+				if !isQueued {
+					break
+				}
+				q.runJob(id)
+			}
+		}
+	}
+}
+
+func (q *GenerationJobQueue) runJob(id string) {
+	q.mu.Lock()
+	activeJob, isActive := q.activeJobs[id]
+	if !isActive || q.ctx.Err() != nil {
+		q.mu.Unlock()
+		return
+	}
+	startedAt := time.Now()
+	activeJob.job.Status = JobRunning
+	activeJob.job.StartedAt = &startedAt
+	q.saveJob(activeJob.job)
+	prompt := activeJob.job.Prompt
+	contextFeatureName := activeJob.job.ContextFeatureName
+	user := activeJob.job.User
+	q.mu.Unlock()
+
+	ctx := WithGenerationUser(activeJob.ctx, user)
+	ctx = WithGenerationProgress(ctx, func(event *GenerationEvent) {
+		if event.Phase == TokensPhase || event.Phase == UsagePhase {
+			return
+		}
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		activeJob.job.Phase = event.Phase
+		q.saveJob(activeJob.job)
+	})
+
+	var feature *Feature
+	featureContext, err := q.getFeatureContext(contextFeatureName)
+	if err == nil {
+		feature, err = q.featureGenerator.GenerateFeature(ctx, prompt, featureContext)
+	}
+	if err != nil && activeJob.ctx.Err() != nil {
+		err = context.Canceled
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.activeJobs, id)
+	activeJob.cancel()
+
+	if err == nil {
+		activeJob.job.FeatureName = feature.Name
+	}
+	q.finishJob(activeJob.job, err)
+}
+
+func (q *GenerationJobQueue) getFeatureContext(contextFeatureName string) (*Feature, error) {
+	if len(contextFeatureName) == 0 {
+		return nil, nil
+	}
+
+	return q.featureStore.GetFeature(contextFeatureName)
+}
+
+// finishJob records the outcome of a job, err being nil when it succeeded.
+func (q *GenerationJobQueue) finishJob(job *GenerationJob, err error) {
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+
+	switch {
+	case err == nil:
+		job.Status = JobSucceeded
+	case errors.Is(err, context.Canceled):
+		job.Status = JobCanceled
+	default:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	}
+
+	q.saveJob(job)
+}
+
+func (q *GenerationJobQueue) saveJob(job *GenerationJob) {
+	err := q.jobStore.SaveGenerationJob(job)
+	if err != nil {
+		log.Error().Msgf("failed to save generation job %s: %v", job.ID, err)
+	}
+}
+
+func (q *GenerationJobQueue) Close() {
+	q.cancel()
+	q.workers.Wait()
+}
@@ -0,0 +1,225 @@
+package features_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingFeatureGenerator generates a feature named after the prompt once
+// released, or fails with the error released.
+type blockingFeatureGenerator struct {
+	started chan string
+	release chan error
+}
+
+func newBlockingFeatureGenerator() *blockingFeatureGenerator {
+	return &blockingFeatureGenerator{
+		started: make(chan string, 16),
+		release: make(chan error),
+	}
+}
+
+func (g *blockingFeatureGenerator) GenerateFeature(ctx context.Context, prompt string, featureContext *features.Feature) (*features.Feature, error) {
+	g.started <- prompt
+	select {
+	case err := <-g.release:
+		if err != nil {
+			return nil, err
+		}
+		return newFeature(prompt, "v1"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func waitForJob(t *testing.T, jobQueue features.IGenerationJobQueue, id string, status features.GenerationJobStatus) *features.GenerationJob {
+	var job *features.GenerationJob
+	assert.Eventually(t, func() bool {
+		var err error
+		job, err = jobQueue.GetJob(id)
+		return err == nil && job.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestGenerationJobQueue(t *testing.T) {
+	newJobQueue := func(t *testing.T, generator features.IFeatureGenerator, jobStore features.IGenerationJobStore, config *features.GenerationJobsConfig) features.IGenerationJobQueue {
+		featureStore, _, _ := newFsFeatureStore(nil)
+		featureStore.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+
+		jobQueue, err := features.NewGenerationJobQueue(generator, featureStore, jobStore, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(jobQueue.Close)
+
+		return jobQueue
+	}
+
+	t.Run("jobs run in the background", func(t *testing.T) {
+		t.Parallel()
+
+		generator := newBlockingFeatureGenerator()
+		jobStore := features.NewFsGenerationJobStore(afero.NewMemMapFs())
+		jobQueue := newJobQueue(t, generator, jobStore, nil)
+
+		job, err := jobQueue.EnqueueJob("alice", "users", "")
+		assert.NoError(t, err)
+		assert.Equal(t, features.JobQueued, job.Status)
+		assert.Equal(t, "alice", job.User)
+
+		assert.Equal(t, "users", <-generator.started)
+		waitForJob(t, jobQueue, job.ID, features.JobRunning)
+
+		generator.release <- nil
+		job = waitForJob(t, jobQueue, job.ID, features.JobSucceeded)
+		assert.Equal(t, "users", job.FeatureName)
+		assert.NotNil(t, job.FinishedAt)
+
+		storedJob, err := jobStore.GetGenerationJob(job.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, features.JobSucceeded, storedJob.Status)
+		assert.Equal(t, "alice", storedJob.User)
+
+		job, err = jobQueue.EnqueueJob("", "tasks", "missing")
+		assert.NoError(t, err)
+		job = waitForJob(t, jobQueue, job.ID, features.JobFailed)
+		assert.Contains(t, job.Error, "missing")
+
+		_, err = jobQueue.GetJob("missing")
+		assert.ErrorIs(t, err, features.ErrGenerationJobNotFound)
+	})
+
+	t.Run("failed and canceled jobs", func(t *testing.T) {
+		t.Parallel()
+
+		generator := newBlockingFeatureGenerator()
+		jobQueue := newJobQueue(t, generator, features.NewFsGenerationJobStore(afero.NewMemMapFs()), &features.GenerationJobsConfig{
+			Workers:   1,
+			QueueSize: 1,
+		})
+
+		running, err := jobQueue.EnqueueJob("", "tasks", "tasks")
+		assert.NoError(t, err)
+		<-generator.started
+
+		queued, err := jobQueue.EnqueueJob("", "users", "")
+		assert.NoError(t, err)
+
+		_, err = jobQueue.EnqueueJob("", "projects", "")
+		assert.ErrorIs(t, err, features.ErrGenerationQueueFull)
+
+		queued, err = jobQueue.CancelJob(queued.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, features.JobCanceled, queued.Status)
+
+		// the canceled job frees its place in the queue
+		failing, err := jobQueue.EnqueueJob("", "projects", "")
+		assert.NoError(t, err)
+
+		_, err = jobQueue.CancelJob(running.ID)
+		assert.NoError(t, err)
+		waitForJob(t, jobQueue, running.ID, features.JobCanceled)
+
+		_, err = jobQueue.CancelJob(running.ID)
+		assert.ErrorIs(t, err, features.ErrGenerationJobFinished)
+
+		assert.Equal(t, "projects", <-generator.started)
+
+		generator.release <- errors.New("invalid answer")
+		failing = waitForJob(t, jobQueue, failing.ID, features.JobFailed)
+		assert.Equal(t, "invalid answer", failing.Error)
+	})
+
+	t.Run("queued jobs resume", func(t *testing.T) {
+		t.Parallel()
+
+		jobStore := features.NewFsGenerationJobStore(afero.NewMemMapFs())
+		jobStore.SaveGenerationJob(&features.GenerationJob{ID: "running", Status: features.JobRunning, Prompt: "tasks", CreatedAt: time.Now()})
+		jobStore.SaveGenerationJob(&features.GenerationJob{ID: "queued", Status: features.JobQueued, Prompt: "users", CreatedAt: time.Now()})
+
+		generator := newBlockingFeatureGenerator()
+		jobQueue := newJobQueue(t, generator, jobStore, nil)
+
+		waitForJob(t, jobQueue, "running", features.JobFailed)
+
+		assert.Equal(t, "users", <-generator.started)
+		generator.release <- nil
+		waitForJob(t, jobQueue, "queued", features.JobSucceeded)
+	})
+}
+
+func TestFsGenerationJobStore(t *testing.T) {
+	testGenerationJobStore(t, func() features.IGenerationJobStore {
+		return features.NewFsGenerationJobStore(afero.NewMemMapFs())
+	})
+}
+
+func TestSqlGenerationJobStore(t *testing.T) {
+	testGenerationJobStore(t, func() features.IGenerationJobStore {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return features.NewSqlGenerationJobStore(db)
+	})
+}
+
+func testGenerationJobStore(t *testing.T, newStore func() features.IGenerationJobStore) {
+	t.Run("save, get and list", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+		createdAt := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+		for _, job := range []*features.GenerationJob{
+			{ID: "b", Status: features.JobQueued, Prompt: "users", CreatedAt: createdAt},
+			{ID: "a", Status: features.JobQueued, Prompt: "tasks", User: "alice", ContextFeatureName: "tasks", CreatedAt: createdAt.Add(time.Second)},
+		} {
+			err := store.SaveGenerationJob(job)
+			assert.NoError(t, err)
+		}
+
+		finishedAt := createdAt.Add(time.Minute)
+		err := store.SaveGenerationJob(&features.GenerationJob{
+			ID:                 "a",
+			Status:             features.JobSucceeded,
+			Prompt:             "tasks",
+			User:               "alice",
+			ContextFeatureName: "tasks",
+			Phase:              features.BundleBuiltPhase,
+			FeatureName:        "tasks",
+			CreatedAt:          createdAt.Add(time.Second),
+			StartedAt:          &createdAt,
+			FinishedAt:         &finishedAt,
+		})
+		assert.NoError(t, err)
+
+		job, err := store.GetGenerationJob("a")
+		assert.NoError(t, err)
+		assert.Equal(t, features.JobSucceeded, job.Status)
+		assert.Equal(t, "tasks", job.FeatureName)
+		assert.Equal(t, "alice", job.User)
+		assert.True(t, finishedAt.Equal(*job.FinishedAt))
+
+		jobs, err := store.ListGenerationJobs()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b", "a"}, []string{jobs[0].ID, jobs[1].ID})
+		assert.Nil(t, jobs[0].StartedAt)
+
+		_, err = store.GetGenerationJob("missing")
+		assert.ErrorIs(t, err, features.ErrGenerationJobNotFound)
+		_, err = store.GetGenerationJob("../a")
+		assert.ErrorIs(t, err, features.ErrGenerationJobNotFound)
+	})
+}
@@ -0,0 +1,171 @@
+package features
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var ErrGenerationJobNotFound = errors.New("generation job not found")
+
+type GenerationJobStatus string
+
+const (
+	JobQueued    GenerationJobStatus = "queued"
+	JobRunning   GenerationJobStatus = "running"
+	JobSucceeded GenerationJobStatus = "succeeded"
+	JobFailed    GenerationJobStatus = "failed"
+	JobCanceled  GenerationJobStatus = "canceled"
+)
+
+// IsFinished tells whether a job with this status will not change anymore.
+func (s GenerationJobStatus) IsFinished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// GenerationJob is a feature generation run in the background.
+type GenerationJob struct {
+	ID     string              `json:"id"`
+	Status GenerationJobStatus `json:"status"`
+	Prompt string              `json:"prompt"`
+	// User the generation is accounted to, empty when anonymous
+	User string `json:"user,omitempty"`
+	// ContextFeatureName is the feature being changed, empty when a new
+	// feature is being created
+	ContextFeatureName string `json:"contextFeatureName,omitempty"`
+	// Phase is the last generation phase reached by a running job
+	Phase GenerationPhase `json:"phase,omitempty"`
+	// FeatureName is the generated feature, once the job succeeded
+	FeatureName string     `json:"featureName,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// IGenerationJobStore keeps the generation jobs, so their outcome can still
+// be queried after the server restarts.
+type IGenerationJobStore interface {
+	// SaveGenerationJob adds the job, or replaces it if its ID is stored.
+	SaveGenerationJob(job *GenerationJob) error
+	GetGenerationJob(id string) (*GenerationJob, error)
+	// ListGenerationJobs returns the jobs, oldest first.
+	ListGenerationJobs() ([]*GenerationJob, error)
+}
+
+func newGenerationJobID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// FsGenerationJobStore keeps each job in a file:
+//
+//	{id}.json
+type FsGenerationJobStore struct {
+	mu sync.Mutex
+	fs GenerationJobsFs
+}
+
+type GenerationJobsFs afero.Fs
+
+func NewFsGenerationJobStore(fs GenerationJobsFs) IGenerationJobStore {
+	return &FsGenerationJobStore{
+		fs: fs,
+	}
+}
+
+func (s *FsGenerationJobStore) SaveGenerationJob(job *GenerationJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobJson, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode generation job %s: %w", job.ID, err)
+	}
+
+	// the job file is renamed into place once complete, so a partially written
+	// job is never read
+	temporaryFileName := fmt.Sprintf(".%s.json.tmp", job.ID)
+	err = afero.WriteFile(s.fs, temporaryFileName, jobJson, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write generation job %s: %w", job.ID, err)
+	}
+
+	err = s.fs.Rename(temporaryFileName, generationJobFileName(job.ID))
+	if err != nil {
+		s.fs.Remove(temporaryFileName)
+		return fmt.Errorf("failed to write generation job %s: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+func (s *FsGenerationJobStore) GetGenerationJob(id string) (*GenerationJob, error) {
+	// ids come from requests, they must not point outside the jobs folder
+	if strings.ContainsAny(id, `/\.`) {
+		return nil, fmt.Errorf("failed to get generation job %s: %w", id, ErrGenerationJobNotFound)
+	}
+
+	jobFileName := generationJobFileName(id)
+
+	jobJson, err := afero.ReadFile(s.fs, jobFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to get generation job %s: %w", id, ErrGenerationJobNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", jobFileName, err)
+	}
+
+	job := &GenerationJob{}
+	err = json.Unmarshal(jobJson, job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generation job json from file %s: %w", jobFileName, err)
+	}
+
+	return job, nil
+}
+
+func (s *FsGenerationJobStore) ListGenerationJobs() ([]*GenerationJob, error) {
+	jobFiles, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation jobs folder: %w", err)
+	}
+
+	jobs := []*GenerationJob{}
+	for _, jobFile := range jobFiles {
+		if jobFile.IsDir() || strings.HasPrefix(jobFile.Name(), ".") || path.Ext(jobFile.Name()) != ".json" {
+			continue
+		}
+
+		job, err := s.GetGenerationJob(strings.TrimSuffix(jobFile.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	slices.SortStableFunc(jobs, func(a *GenerationJob, b *GenerationJob) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	return jobs, nil
+}
+
+func generationJobFileName(id string) string {
+	return fmt.Sprintf("%s.json", id)
+}
@@ -0,0 +1,83 @@
+package features
+
+import (
+	"context"
+
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+type GenerationPhase string
+
+const (
+	// the instructions for the AI were rendered
+	PromptBuiltPhase GenerationPhase = "prompt_built"
+	// the AI streamed part of its answer, in GenerationEvent.Text
+	TokensPhase GenerationPhase = "tokens"
+	// the AI finished answering, the tokens it used are in
+	// GenerationEvent.Usage
+	UsagePhase GenerationPhase = "usage"
+	// the AI answer was parsed as a feature
+	ParsedPhase GenerationPhase = "parsed"
+	// the parsed feature was checked before storing it
+	ValidatedPhase GenerationPhase = "validated"
+	// the operations of the feature were run once with synthesized arguments,
+	// their results are in GenerationEvent.DryRuns
+	TestedPhase GenerationPhase = "tested"
+	// problems were found in the feature, in GenerationEvent.Text, and the AI
+	// is asked to fix them. The answer and its problems are in
+	// GenerationEvent.Attempt.
+	RepairingPhase GenerationPhase = "repairing"
+	// the feature, its component and its operations were stored
+	StoredPhase GenerationPhase = "stored"
+	// the frontend bundle was rebuilt with the feature
+	BundleBuiltPhase GenerationPhase = "bundle_built"
+	// the generation finished, the feature is in GenerationEvent.Feature
+	DonePhase GenerationPhase = "done"
+	// the generation failed, the reason is in GenerationEvent.Error
+	ErrorPhase GenerationPhase = "error"
+)
+
+type GenerationEvent struct {
+	Phase   GenerationPhase `json:"phase"`
+	Text    string          `json:"text,omitempty"`
+	Feature *Feature        `json:"feature,omitempty"`
+	// Report is the validation report of the feature, in the validated phase
+	Report *ValidationReport `json:"report,omitempty"`
+	// DryRuns are the results of running the operations, in the tested phase
+	DryRuns []*operations.DryRunResult `json:"dryRuns,omitempty"`
+	// Attempt is the answer being repaired, in the repairing phase
+	Attempt *GenerationAttempt `json:"attempt,omitempty"`
+	// Usage is what the answer of the AI used, in the usage phase
+	Usage *AIUsage `json:"usage,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// GenerationProgress receives the events of a feature generation, in order.
+type GenerationProgress func(event *GenerationEvent)
+
+type generationProgressKey struct{}
+
+// WithGenerationProgress returns a context that makes the generators report
+// their progress to progress.
+func WithGenerationProgress(ctx context.Context, progress GenerationProgress) context.Context {
+	return context.WithValue(ctx, generationProgressKey{}, progress)
+}
+
+// withProgressListener returns a context where the events are sent to
+// listener, and then to the progress ctx already had, if any.
+func withProgressListener(ctx context.Context, listener GenerationProgress) context.Context {
+	progress, hasProgress := ctx.Value(generationProgressKey{}).(GenerationProgress)
+	return WithGenerationProgress(ctx, func(event *GenerationEvent) {
+		listener(event)
+		if hasProgress {
+			progress(event)
+		}
+	})
+}
+
+func reportProgress(ctx context.Context, event *GenerationEvent) {
+	progress, hasProgress := ctx.Value(generationProgressKey{}).(GenerationProgress)
+	if hasProgress {
+		progress(event)
+	}
+}
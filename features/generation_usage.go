@@ -0,0 +1,347 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrGenerationQuotaExceeded = errors.New("generation quota exceeded")
+
+// AIUsage is what one answer of the AI used.
+type AIUsage struct {
+	// Model is the model that answered, as the provider names it
+	Model        string `json:"model"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+	// LatencyMs is the time from sending the request until the whole answer
+	// was read
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+// GenerationUsage is what a feature generation used, summing every answer
+// asked from the AI.
+type GenerationUsage struct {
+	// User asked for the generation, empty for anonymous requests
+	User string `json:"user,omitempty"`
+	// FeatureName is the generated feature, or the feature being changed when
+	// the generation failed
+	FeatureName string `json:"featureName,omitempty"`
+	// Model is the model of the last answer
+	Model        string `json:"model,omitempty"`
+	Answers      int    `json:"answers"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+	// LatencyMs is the time spent waiting for the AI
+	LatencyMs int64 `json:"latencyMs"`
+	// Cost is estimated in USD from the prices of the models
+	Cost      float64   `json:"cost"`
+	Succeeded bool      `json:"succeeded"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ModelPrice is in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// DefaultModelPrices are the public prices of the most used models, keyed by
+// model name prefix, so dated versions such as claude-3-7-sonnet-20250219 are
+// priced too.
+var DefaultModelPrices = map[string]*ModelPrice{
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"claude-3-opus":     {Input: 15, Output: 75},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+}
+
+// DefaultEstimatedGenerationCost is a few answers of the priced models.
+const DefaultEstimatedGenerationCost = 0.1
+
+type GenerationUsageConfig struct {
+	// prices of the models keyed by model name prefix, the longest prefix
+	// wins and "" prices every other model. Defaults to DefaultModelPrices.
+	// Models without a price cost nothing, e.g. the ones served locally.
+	Prices map[string]*ModelPrice
+
+	// estimated cost in USD that the generations of each user, and of every
+	// user together, may reach in a day (UTC). 0 is unlimited.
+	UserDailyBudget     float64
+	InstanceDailyBudget float64
+
+	// estimated cost in USD of a generation, counted against the budgets
+	// while it runs, until its cost is known. Defaults to
+	// DefaultEstimatedGenerationCost.
+	EstimatedGenerationCost float64
+
+	// UserHeader is the request header naming the user of a generation. Any
+	// client can set it, so it must only be set when a trusted proxy in front
+	// of the server authenticates the users and overwrites the header. Empty
+	// accounts every generation to the anonymous user.
+	UserHeader string
+}
+
+// IGenerationUsageTracker accounts what the feature generations cost and
+// enforces the daily budgets.
+type IGenerationUsageTracker interface {
+	// CheckQuota fails with ErrGenerationQuotaExceeded when the user, or the
+	// whole instance, already spent its budget today. Running generations
+	// count with their estimated cost.
+	CheckQuota(user string) error
+	// ReserveQuota checks the quota of user and reserves the estimated cost
+	// of a generation, so generations started together can't all pass the
+	// check. The reservation, nil when there is no budget, is settled by
+	// SettleGeneration.
+	ReserveQuota(user string) (*QuotaReservation, error)
+	// SettleGeneration records usage like RecordGeneration, replacing the
+	// estimated cost of reservation with its real cost.
+	SettleGeneration(reservation *QuotaReservation, usage *GenerationUsage, answers []*AIUsage) error
+	// RecordGeneration stores usage with the totals of its answers.
+	RecordGeneration(usage *GenerationUsage, answers []*AIUsage) error
+	// Report sums the generations since the given time.
+	Report(since time.Time) (*UsageReport, error)
+}
+
+// QuotaReservation is the estimated cost of a running generation.
+type QuotaReservation struct {
+	User string
+	Cost float64
+}
+
+// UsageTotals sums the usage of some generations.
+type UsageTotals struct {
+	Generations  int     `json:"generations"`
+	Answers      int     `json:"answers"`
+	InputTokens  int     `json:"inputTokens"`
+	OutputTokens int     `json:"outputTokens"`
+	LatencyMs    int64   `json:"latencyMs"`
+	Cost         float64 `json:"cost"`
+}
+
+func (t *UsageTotals) add(usage *GenerationUsage) {
+	t.Generations++
+	t.Answers += usage.Answers
+	t.InputTokens += usage.InputTokens
+	t.OutputTokens += usage.OutputTokens
+	t.LatencyMs += usage.LatencyMs
+	t.Cost += usage.Cost
+}
+
+type UsageReport struct {
+	Since time.Time    `json:"since"`
+	Total *UsageTotals `json:"total"`
+	// Days are keyed by UTC date, e.g. 2025-04-01
+	Days map[string]*UsageTotals `json:"days"`
+	// Features are keyed by feature name, "" for failed generations of new
+	// features
+	Features map[string]*UsageTotals `json:"features"`
+	// Users are keyed by user, "" for anonymous requests
+	Users map[string]*UsageTotals `json:"users"`
+}
+
+func NewGenerationUsageTracker(usageStore IGenerationUsageStore, config *GenerationUsageConfig) IGenerationUsageTracker {
+	if config == nil {
+		config = &GenerationUsageConfig{}
+	}
+	prices := config.Prices
+	if prices == nil {
+		prices = DefaultModelPrices
+	}
+
+	estimatedCost := config.EstimatedGenerationCost
+	if estimatedCost <= 0 {
+		estimatedCost = DefaultEstimatedGenerationCost
+	}
+
+	return &GenerationUsageTracker{
+		usageStore:    usageStore,
+		prices:        prices,
+		estimatedCost: estimatedCost,
+		config:        config,
+		reservations:  map[*QuotaReservation]bool{},
+	}
+}
+
+type GenerationUsageTracker struct {
+	usageStore    IGenerationUsageStore
+	prices        map[string]*ModelPrice
+	estimatedCost float64
+	config        *GenerationUsageConfig
+
+	// mu guards reservations, the running generations, and serializes
+	// checking the quota with recording usage
+	mu           sync.Mutex
+	reservations map[*QuotaReservation]bool
+}
+
+func (t *GenerationUsageTracker) hasBudget() bool {
+	return t.config.UserDailyBudget > 0 || t.config.InstanceDailyBudget > 0
+}
+
+func (t *GenerationUsageTracker) CheckQuota(user string) error {
+	if !t.hasBudget() {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.checkQuota(user)
+}
+
+func (t *GenerationUsageTracker) ReserveQuota(user string) (*QuotaReservation, error) {
+	if !t.hasBudget() {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.checkQuota(user)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := &QuotaReservation{User: user, Cost: t.estimatedCost}
+	t.reservations[reservation] = true
+	return reservation, nil
+}
+
+// checkQuota is CheckQuota, with mu held.
+func (t *GenerationUsageTracker) checkQuota(user string) error {
+	generations, err := t.usageStore.ListGenerationUsage(startOfDay(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	userCost := 0.0
+	instanceCost := 0.0
+	for _, generation := range generations {
+		instanceCost += generation.Cost
+		if generation.User == user {
+			userCost += generation.Cost
+		}
+	}
+	for reservation := range t.reservations {
+		instanceCost += reservation.Cost
+		if reservation.User == user {
+			userCost += reservation.Cost
+		}
+	}
+
+	if t.config.UserDailyBudget > 0 && userCost >= t.config.UserDailyBudget {
+		return fmt.Errorf("%w: the generations of today cost $%.2f, the daily budget of each user is $%.2f", ErrGenerationQuotaExceeded, userCost, t.config.UserDailyBudget)
+	}
+	if t.config.InstanceDailyBudget > 0 && instanceCost >= t.config.InstanceDailyBudget {
+		return fmt.Errorf("%w: the generations of today cost $%.2f, the daily budget of the instance is $%.2f", ErrGenerationQuotaExceeded, instanceCost, t.config.InstanceDailyBudget)
+	}
+
+	return nil
+}
+
+func (t *GenerationUsageTracker) SettleGeneration(reservation *QuotaReservation, usage *GenerationUsage, answers []*AIUsage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the reservation is released even when recording fails, or it would
+	// count against the budgets until the server restarts
+	delete(t.reservations, reservation)
+	return t.recordGeneration(usage, answers)
+}
+
+func (t *GenerationUsageTracker) RecordGeneration(usage *GenerationUsage, answers []*AIUsage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.recordGeneration(usage, answers)
+}
+
+// recordGeneration is RecordGeneration, with mu held.
+func (t *GenerationUsageTracker) recordGeneration(usage *GenerationUsage, answers []*AIUsage) error {
+	for _, answer := range answers {
+		usage.Model = answer.Model
+		usage.Answers++
+		usage.InputTokens += answer.InputTokens
+		usage.OutputTokens += answer.OutputTokens
+		usage.LatencyMs += answer.LatencyMs
+		usage.Cost += t.cost(answer)
+	}
+
+	return t.usageStore.AddGenerationUsage(usage)
+}
+
+// cost estimates what an answer cost, from the price with the longest prefix
+// of its model.
+func (t *GenerationUsageTracker) cost(answer *AIUsage) float64 {
+	var price *ModelPrice
+	pricePrefix := ""
+	for prefix, modelPrice := range t.prices {
+		if !strings.HasPrefix(answer.Model, prefix) {
+			continue
+		}
+		if price == nil || len(prefix) > len(pricePrefix) {
+			price = modelPrice
+			pricePrefix = prefix
+		}
+	}
+	if price == nil {
+		return 0
+	}
+
+	return (float64(answer.InputTokens)*price.Input + float64(answer.OutputTokens)*price.Output) / 1_000_000
+}
+
+func (t *GenerationUsageTracker) Report(since time.Time) (*UsageReport, error) {
+	generations, err := t.usageStore.ListGenerationUsage(since)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UsageReport{
+		Since:    since,
+		Total:    &UsageTotals{},
+		Days:     map[string]*UsageTotals{},
+		Features: map[string]*UsageTotals{},
+		Users:    map[string]*UsageTotals{},
+	}
+	for _, generation := range generations {
+		report.Total.add(generation)
+		addUsageTotals(report.Days, generation.CreatedAt.UTC().Format(time.DateOnly), generation)
+		addUsageTotals(report.Features, generation.FeatureName, generation)
+		addUsageTotals(report.Users, generation.User, generation)
+	}
+
+	return report, nil
+}
+
+func addUsageTotals(totals map[string]*UsageTotals, key string, usage *GenerationUsage) {
+	if totals[key] == nil {
+		totals[key] = &UsageTotals{}
+	}
+	totals[key].add(usage)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+type generationUserKey struct{}
+
+// WithGenerationUser returns a context where the generations are accounted to
+// user.
+func WithGenerationUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, generationUserKey{}, user)
+}
+
+func generationUser(ctx context.Context) string {
+	user, _ := ctx.Value(generationUserKey{}).(string)
+	return user
+}
@@ -0,0 +1,138 @@
+package features
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// IGenerationUsageStore keeps the usage of every feature generation.
+type IGenerationUsageStore interface {
+	AddGenerationUsage(usage *GenerationUsage) error
+	// ListGenerationUsage returns the generations created since the given
+	// time, oldest first.
+	ListGenerationUsage(since time.Time) ([]*GenerationUsage, error)
+}
+
+// FsGenerationUsageStore appends the generations of each day (UTC) to a file
+// with one JSON per line:
+//
+//	{yyyy-mm-dd}.jsonl
+type FsGenerationUsageStore struct {
+	mu sync.Mutex
+	fs GenerationUsageFs
+}
+
+type GenerationUsageFs afero.Fs
+
+func NewFsGenerationUsageStore(fs GenerationUsageFs) IGenerationUsageStore {
+	return &FsGenerationUsageStore{
+		fs: fs,
+	}
+}
+
+func (s *FsGenerationUsageStore) AddGenerationUsage(usage *GenerationUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usageJson, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to encode generation usage: %w", err)
+	}
+
+	usageFileName := generationUsageFileName(usage.CreatedAt)
+	usageFile, err := s.fs.OpenFile(usageFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("could not open file %s: %w", usageFileName, err)
+	}
+	defer usageFile.Close()
+
+	_, err = usageFile.Write(append(usageJson, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write generation usage to file %s: %w", usageFileName, err)
+	}
+
+	return nil
+}
+
+func (s *FsGenerationUsageStore) ListGenerationUsage(since time.Time) ([]*GenerationUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usageFiles, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation usage folder: %w", err)
+	}
+
+	// file names sort by day, and the lines of each file by time
+	fileNames := []string{}
+	for _, usageFile := range usageFiles {
+		if usageFile.IsDir() || path.Ext(usageFile.Name()) != ".jsonl" {
+			continue
+		}
+		if usageFile.Name() < generationUsageFileName(since) {
+			continue
+		}
+		fileNames = append(fileNames, usageFile.Name())
+	}
+	slices.Sort(fileNames)
+
+	generations := []*GenerationUsage{}
+	for _, fileName := range fileNames {
+		fileGenerations, err := s.readUsageFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		for _, generation := range fileGenerations {
+			if generation.CreatedAt.Before(since) {
+				continue
+			}
+			generations = append(generations, generation)
+		}
+	}
+
+	return generations, nil
+}
+
+func (s *FsGenerationUsageStore) readUsageFile(fileName string) ([]*GenerationUsage, error) {
+	usageFile, err := s.fs.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", fileName, err)
+	}
+	defer usageFile.Close()
+
+	generations := []*GenerationUsage{}
+	scanner := bufio.NewScanner(usageFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		generation := &GenerationUsage{}
+		err := json.Unmarshal([]byte(line), generation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse generation usage json from file %s: %w", fileName, err)
+		}
+		generations = append(generations, generation)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", fileName, err)
+	}
+
+	return generations, nil
+}
+
+func generationUsageFileName(t time.Time) string {
+	return fmt.Sprintf("%s.jsonl", t.UTC().Format(time.DateOnly))
+}
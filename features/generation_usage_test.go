@@ -0,0 +1,277 @@
+package features_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsGenerationUsageStore(t *testing.T) {
+	testGenerationUsageStore(t, func() features.IGenerationUsageStore {
+		return features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+	})
+}
+
+func TestSqlGenerationUsageStore(t *testing.T) {
+	testGenerationUsageStore(t, func() features.IGenerationUsageStore {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return features.NewSqlGenerationUsageStore(db)
+	})
+}
+
+func testGenerationUsageStore(t *testing.T, newStore func() features.IGenerationUsageStore) {
+	t.Run("add and list", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+		day := time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)
+
+		generations := []*features.GenerationUsage{
+			{User: "alice", FeatureName: "tasks", Model: "gpt-4o", Answers: 1, InputTokens: 1000, OutputTokens: 200, LatencyMs: 1500, Cost: 0.0045, Succeeded: true, CreatedAt: day.Add(-time.Second / 2)},
+			{User: "bob", Answers: 2, InputTokens: 2000, OutputTokens: 400, Cost: 0.009, CreatedAt: day},
+			{FeatureName: "users", Answers: 1, Succeeded: true, CreatedAt: day.Add(10 * time.Hour)},
+		}
+		for _, generation := range generations {
+			err := store.AddGenerationUsage(generation)
+			assert.NoError(t, err)
+		}
+
+		listed, err := store.ListGenerationUsage(time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, listed, 3)
+		assert.Equal(t, "alice", listed[0].User)
+		assert.Equal(t, "gpt-4o", listed[0].Model)
+		assert.Equal(t, 0.0045, listed[0].Cost)
+		assert.True(t, listed[0].Succeeded)
+		assert.True(t, generations[0].CreatedAt.Equal(listed[0].CreatedAt))
+
+		listed, err = store.ListGenerationUsage(day)
+		assert.NoError(t, err)
+		assert.Len(t, listed, 2)
+		assert.Equal(t, "bob", listed[0].User)
+		assert.Equal(t, "users", listed[1].FeatureName)
+
+		listed, err = store.ListGenerationUsage(day.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, listed, 1)
+	})
+}
+
+func TestGenerationUsageTracker(t *testing.T) {
+	t.Run("answers are priced by model", func(t *testing.T) {
+		t.Parallel()
+
+		usageStore := features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+		tracker := features.NewGenerationUsageTracker(usageStore, nil)
+
+		usage := &features.GenerationUsage{User: "alice", FeatureName: "tasks", Succeeded: true, CreatedAt: time.Now()}
+		err := tracker.RecordGeneration(usage, []*features.AIUsage{
+			{Model: "gpt-4o-mini-2024-07-18", InputTokens: 1_000_000, OutputTokens: 100_000, LatencyMs: 2000},
+			{Model: "claude-3-5-haiku-20241022", InputTokens: 1_000_000, OutputTokens: 100_000, LatencyMs: 3000},
+			{Model: "llama3", InputTokens: 1_000_000, OutputTokens: 100_000, LatencyMs: 5000},
+		})
+		assert.NoError(t, err)
+
+		generations, err := usageStore.ListGenerationUsage(time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, generations, 1)
+		assert.Equal(t, "llama3", generations[0].Model)
+		assert.Equal(t, 3, generations[0].Answers)
+		assert.Equal(t, 3_000_000, generations[0].InputTokens)
+		assert.Equal(t, 300_000, generations[0].OutputTokens)
+		assert.Equal(t, int64(10_000), generations[0].LatencyMs)
+		// gpt-4o-mini and not gpt-4o prices, and local models are free
+		assert.InDelta(t, 0.15+0.06+0.8+0.4, generations[0].Cost, 1e-9)
+	})
+
+	t.Run("quotas", func(t *testing.T) {
+		t.Parallel()
+
+		usageStore := features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+		tracker := features.NewGenerationUsageTracker(usageStore, &features.GenerationUsageConfig{
+			Prices:              map[string]*features.ModelPrice{"": {Input: 1, Output: 5}},
+			UserDailyBudget:     1,
+			InstanceDailyBudget: 1.5,
+		})
+
+		record := func(user string, createdAt time.Time) {
+			err := tracker.RecordGeneration(&features.GenerationUsage{User: user, CreatedAt: createdAt}, []*features.AIUsage{
+				{Model: "llama3", InputTokens: 500_000, OutputTokens: 100_000},
+			})
+			assert.NoError(t, err)
+		}
+
+		// yesterday doesn't count
+		record("alice", time.Now().Add(-24*time.Hour))
+		record("alice", time.Now().Add(-24*time.Hour))
+		assert.NoError(t, tracker.CheckQuota("alice"))
+
+		// each generation costs $1
+		record("alice", time.Now())
+		err := tracker.CheckQuota("alice")
+		assert.ErrorIs(t, err, features.ErrGenerationQuotaExceeded)
+		assert.NoError(t, tracker.CheckQuota("bob"))
+
+		record("bob", time.Now())
+		assert.ErrorIs(t, tracker.CheckQuota("bob"), features.ErrGenerationQuotaExceeded)
+		assert.ErrorIs(t, tracker.CheckQuota("carol"), features.ErrGenerationQuotaExceeded)
+	})
+
+	t.Run("running generations count against the quotas", func(t *testing.T) {
+		t.Parallel()
+
+		usageStore := features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+		tracker := features.NewGenerationUsageTracker(usageStore, &features.GenerationUsageConfig{
+			Prices:                  map[string]*features.ModelPrice{"": {Input: 1, Output: 5}},
+			UserDailyBudget:         1,
+			InstanceDailyBudget:     1.5,
+			EstimatedGenerationCost: 0.5,
+		})
+
+		first, err := tracker.ReserveQuota("alice")
+		assert.NoError(t, err)
+		second, err := tracker.ReserveQuota("alice")
+		assert.NoError(t, err)
+
+		// the estimated cost of the running generations reached the budget
+		_, err = tracker.ReserveQuota("alice")
+		assert.ErrorIs(t, err, features.ErrGenerationQuotaExceeded)
+		assert.NoError(t, tracker.CheckQuota("bob"))
+
+		// settled to its real cost of $0.10
+		err = tracker.SettleGeneration(first, &features.GenerationUsage{User: "alice", CreatedAt: time.Now()}, []*features.AIUsage{
+			{Model: "llama3", InputTokens: 50_000, OutputTokens: 10_000},
+		})
+		assert.NoError(t, err)
+		third, err := tracker.ReserveQuota("alice")
+		assert.NoError(t, err)
+
+		fourth, err := tracker.ReserveQuota("bob")
+		assert.NoError(t, err)
+		_, err = tracker.ReserveQuota("carol")
+		assert.ErrorIs(t, err, features.ErrGenerationQuotaExceeded)
+
+		// failed generations that cost nothing free their reservation
+		err = tracker.SettleGeneration(second, &features.GenerationUsage{User: "alice", CreatedAt: time.Now()}, nil)
+		assert.NoError(t, err)
+		err = tracker.SettleGeneration(third, &features.GenerationUsage{User: "alice", CreatedAt: time.Now()}, nil)
+		assert.NoError(t, err)
+		err = tracker.SettleGeneration(fourth, &features.GenerationUsage{User: "bob", CreatedAt: time.Now()}, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, tracker.CheckQuota("alice"))
+		assert.NoError(t, tracker.CheckQuota("carol"))
+
+		generations, err := usageStore.ListGenerationUsage(time.Time{})
+		assert.NoError(t, err)
+		assert.Len(t, generations, 4)
+	})
+
+	t.Run("report", func(t *testing.T) {
+		t.Parallel()
+
+		usageStore := features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+		tracker := features.NewGenerationUsageTracker(usageStore, nil)
+
+		day := time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)
+		for _, generation := range []*features.GenerationUsage{
+			{User: "alice", FeatureName: "tasks", Cost: 1, InputTokens: 10, CreatedAt: day.Add(-time.Hour)},
+			{User: "alice", FeatureName: "tasks", Cost: 2, InputTokens: 20, CreatedAt: day.Add(time.Hour)},
+			{User: "bob", FeatureName: "users", Cost: 4, InputTokens: 40, CreatedAt: day.Add(2 * time.Hour)},
+			{FeatureName: "tasks", Cost: 8, InputTokens: 80, CreatedAt: day.Add(25 * time.Hour)},
+		} {
+			err := usageStore.AddGenerationUsage(generation)
+			assert.NoError(t, err)
+		}
+
+		report, err := tracker.Report(day)
+		assert.NoError(t, err)
+		assert.Equal(t, &features.UsageTotals{Generations: 3, InputTokens: 140, Cost: 14}, report.Total)
+		assert.Equal(t, map[string]*features.UsageTotals{
+			"2025-04-02": {Generations: 2, InputTokens: 60, Cost: 6},
+			"2025-04-03": {Generations: 1, InputTokens: 80, Cost: 8},
+		}, report.Days)
+		assert.Equal(t, map[string]*features.UsageTotals{
+			"tasks": {Generations: 2, InputTokens: 100, Cost: 10},
+			"users": {Generations: 1, InputTokens: 40, Cost: 4},
+		}, report.Features)
+		assert.Equal(t, map[string]*features.UsageTotals{
+			"alice": {Generations: 1, InputTokens: 20, Cost: 2},
+			"bob":   {Generations: 1, InputTokens: 40, Cost: 4},
+			"":      {Generations: 1, InputTokens: 80, Cost: 8},
+		}, report.Users)
+	})
+}
+
+func TestReactFeatureGeneratorUsage(t *testing.T) {
+	// generated features are also saved to AiGeneratedViews, in the working
+	// directory
+	t.Chdir(t.TempDir())
+	err := os.Mkdir("AiGeneratedViews", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	featureJson, err := json.Marshal(generatedFeature("tasks", "v1", "get-tasks"))
+	assert.NoError(t, err)
+
+	server, requests := chatCompletionServer(t, "Here is the feature", string(featureJson))
+	aiGenerator, err := features.NewAIGenerator(&staticSchemaGenerator{}, testInstructionsTemplateData, &features.AIGeneratorConfig{
+		Provider: features.OpenAICompatibleProvider,
+		Model:    "llama3",
+		BaseURL:  server.URL + "/v1",
+		APIKey:   "secret",
+	})
+	assert.NoError(t, err)
+
+	usageStore := features.NewFsGenerationUsageStore(afero.NewMemMapFs())
+	tracker := features.NewGenerationUsageTracker(usageStore, &features.GenerationUsageConfig{
+		Prices:          map[string]*features.ModelPrice{"llama3": {Input: 1, Output: 5}},
+		UserDailyBudget: 0.004,
+	})
+
+	featureStore, _, _ := newFsFeatureStore(nil)
+	validator := newFeatureValidator(operations.NewInMemoryOperationStore())
+	generator := features.NewReactFeatureGenerator(nil, featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), aiGenerator, validator, nil, &countingBuilder{}, tracker, &features.FeatureGeneratorConfig{
+		MaxAttempts: 2,
+	})
+
+	ctx := features.WithGenerationUser(context.Background(), "alice")
+	_, err = generator.GenerateFeature(ctx, "list the tasks", nil)
+	assert.NoError(t, err)
+
+	generations, err := usageStore.ListGenerationUsage(time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, generations, 1)
+	generation := generations[0]
+	assert.Equal(t, "alice", generation.User)
+	assert.Equal(t, "tasks", generation.FeatureName)
+	assert.Equal(t, "llama3", generation.Model)
+	assert.Equal(t, 2, generation.Answers)
+	assert.Equal(t, 2000, generation.InputTokens)
+	assert.Equal(t, 400, generation.OutputTokens)
+	assert.InDelta(t, 0.004, generation.Cost, 1e-9)
+	assert.True(t, generation.Succeeded)
+
+	// alice spent her budget, the AI is not asked anymore
+	_, err = generator.GenerateFeature(ctx, "list the tasks", nil)
+	assert.ErrorIs(t, err, features.ErrGenerationQuotaExceeded)
+	assert.Len(t, requests(), 2)
+
+	_, err = generator.GenerateFeature(context.Background(), "list the tasks", nil)
+	assert.NoError(t, err)
+	assert.Len(t, requests(), 3)
+}
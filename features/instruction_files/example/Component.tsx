@@ -1,6 +1,11 @@
 import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
 import { Button, Form, Spinner } from "react-bootstrap";
 import { useForm } from "react-hook-form";
+import {
+  getUsername,
+  updateUsername,
+  UpdateUsernameParameters,
+} from "../operations";
 
 export default function Component() {
   const { data: username, isPending, isError, error } = useQueryUsername();
@@ -24,22 +29,13 @@ export default function Component() {
   return <UsernameForm initialUsername={username} />;
 }
 
-type GetUsernameResponseBody = {
-  username: string;
-};
 function useQueryUsername() {
   // Query to fetch the username
   const query = useQuery({
     queryKey: ["username"],
     queryFn: async function (): Promise<string> {
-      const responseBody = await executeOperation<{}, GetUsernameResponseBody>(
-        "get-username",
-        {}
-      );
-      if (!responseBody.success) {
-        throw new Error(responseBody.message);
-      }
-      return responseBody.result.username;
+      const result = await getUsername();
+      return result.username;
     },
   });
 
@@ -51,7 +47,7 @@ function UsernameForm(props: { initialUsername: string }) {
     register,
     handleSubmit,
     formState: { errors },
-  } = useForm<UpdateUsernameRequestBody>({
+  } = useForm<UpdateUsernameParameters>({
     defaultValues: {
       username: props.initialUsername,
     },
@@ -59,7 +55,7 @@ function UsernameForm(props: { initialUsername: string }) {
 
   const mutation = useMutationUsername();
 
-  function onSubmit(data: UpdateUsernameRequestBody) {
+  function onSubmit(data: UpdateUsernameParameters) {
     mutation.mutate(data);
   }
 
@@ -93,25 +89,13 @@ function UsernameForm(props: { initialUsername: string }) {
   );
 }
 
-type UpdateUsernameRequestBody = {
-  username: string;
-};
-type UpdateUsernameResponseBody = {
-  username: string;
-};
 function useMutationUsername() {
   const queryClient = useQueryClient();
   // Mutation to update the username
   const mutation = useMutation({
-    mutationFn: async (data: UpdateUsernameRequestBody) => {
-      const responseBody = await executeOperation<
-        UpdateUsernameRequestBody,
-        UpdateUsernameResponseBody
-      >("update-username", data);
-      if (!responseBody.success) {
-        throw new Error(responseBody.message);
-      }
-      return responseBody.result.username;
+    mutationFn: async (data: UpdateUsernameParameters) => {
+      const result = await updateUsername(data);
+      return result.username;
     },
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ["username"] });
@@ -120,22 +104,3 @@ function useMutationUsername() {
 
   return mutation;
 }
-
-type OperationResult<TReturn> =
-  | { success: true; result: TReturn }
-  | { success: false; message: string };
-async function executeOperation<TParameters, TReturn>(
-  operationName: string,
-  parameters: TParameters
-): Promise<OperationResult<TReturn>> {
-  const response = await fetch(`/operations/execute/${operationName}`, {
-    method: "POST",
-    headers: {
-      "Content-Type": "application/json",
-    },
-    body: JSON.stringify({ parameters }),
-  });
-
-  const operationResult = await response.json();
-  return operationResult;
-}
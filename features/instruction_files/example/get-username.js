@@ -1,10 +1,8 @@
 function run() {
-  const user = query("SELECT username FROM user LIMIT 1;");
-  if (user.length === 0) {
+  const user = queryOne("SELECT username FROM user LIMIT 1;");
+  if (user == null) {
     throw new Error("user not found");
   }
 
-  const username = user[0][0];
-
-  return { username };
+  return { username: user.username };
 }
@@ -1,5 +1,5 @@
 function run({ username }) {
-  query("UPDATE user SET username = ?;", username);
+  exec("UPDATE user SET username = ?;", username);
 
   return { username };
 }
@@ -0,0 +1,91 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+var ErrMetadataNotEmpty = errors.New("metadata database already has operations")
+
+// MigrateToSql copies the operations, with all their versions, and then the
+// features with their components into the sql stores as part of tx. The sql
+// stores must be empty, and since nothing is written when tx is rolled back, a
+// failed migration can simply be run again.
+func MigrateToSql(tx *metadata.Tx, fromFeatures IFeatureStore, fromOperations operations.IOperationStore, toFeatures IFeatureStore, toOperations operations.IOperationStore) error {
+	txFeatureStore, isTransactional := toFeatures.(ITxFeatureStore)
+	if !isTransactional {
+		return fmt.Errorf("invalid feature store: %w", ErrStoreNotTransactional)
+	}
+	txOperationStore, isTransactional := toOperations.(operations.ITxOperationStore)
+	if !isTransactional {
+		return fmt.Errorf("invalid operation store: %w", ErrStoreNotTransactional)
+	}
+
+	existingOperations, brokenOperations, err := toOperations.ListOperations()
+	if err != nil {
+		return fmt.Errorf("failed to list migrated operations: %w", err)
+	}
+	if len(existingOperations) > 0 || len(brokenOperations) > 0 {
+		return ErrMetadataNotEmpty
+	}
+
+	err = operations.CopyOperations(tx, fromOperations, txOperationStore)
+	if err != nil {
+		return fmt.Errorf("failed to migrate operations: %w", err)
+	}
+
+	featureManifests, brokenFeatures, err := fromFeatures.GetAllFeatures()
+	if err != nil {
+		return fmt.Errorf("failed to get features: %w", err)
+	}
+	if len(brokenFeatures) > 0 {
+		return fmt.Errorf("feature %s is broken, fix or remove it before migrating: %s", brokenFeatures[0].Name, brokenFeatures[0].Error)
+	}
+
+	for _, featureManifest := range featureManifests {
+		feature, err := fromFeatures.GetFeature(featureManifest.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get feature %s: %w", featureManifest.Name, err)
+		}
+
+		err = txFeatureStore.ImportFeatureTx(tx, featureManifest, []byte(feature.ReactComponent.TsxCode))
+		if err != nil {
+			return fmt.Errorf("failed to migrate feature %s: %w", featureManifest.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// CopyFeatureRevisions copies the revisions of the given features as part of
+// tx, keeping their numbers when to has no revisions of them yet.
+func CopyFeatureRevisions(tx *metadata.Tx, featureNames []string, from IFeatureRevisionStore, to IFeatureRevisionStore) error {
+	txRevisionStore, isTransactional := to.(ITxFeatureRevisionStore)
+	if !isTransactional {
+		return fmt.Errorf("invalid feature revision store: %w", ErrStoreNotTransactional)
+	}
+
+	for _, featureName := range featureNames {
+		revisions, err := from.ListFeatureRevisions(featureName)
+		if err != nil {
+			return fmt.Errorf("failed to list feature %s revisions: %w", featureName, err)
+		}
+
+		for _, revisionInfo := range revisions {
+			revision, err := from.GetFeatureRevision(featureName, revisionInfo.Revision)
+			if err != nil {
+				return err
+			}
+
+			err = txRevisionStore.AddFeatureRevisionTx(tx, revision)
+			if err != nil {
+				return fmt.Errorf("failed to add feature %s revision %d: %w", featureName, revisionInfo.Revision, err)
+			}
+		}
+	}
+
+	return nil
+}
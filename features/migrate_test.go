@@ -0,0 +1,65 @@
+package features_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateToSql(t *testing.T) {
+	t.Run("failed migration can be run again", func(t *testing.T) {
+		t.Parallel()
+
+		featuresFs := afero.NewMemMapFs()
+		fsOperationStore := operations.NewFsOperationStore(afero.NewMemMapFs())
+		fsComponentStore := features.NewFsComponentStore(afero.NewMemMapFs(), fsOperationStore)
+		fsFeatureStore := features.NewFsFeatureStore(featuresFs, fsOperationStore, fsComponentStore)
+
+		err := fsFeatureStore.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+		afero.WriteFile(featuresFs, "invalid/feature_manifest.json", []byte(`{`), 0755)
+
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		sqlOperationStore := operations.NewSqlOperationStore(db)
+		sqlComponentStore, err := features.NewSqlComponentStore(db, afero.NewMemMapFs(), sqlOperationStore)
+		assert.NoError(t, err)
+		sqlFeatureStore, err := features.NewSqlFeatureStore(db, sqlOperationStore, sqlComponentStore)
+		assert.NoError(t, err)
+
+		migrate := func() error {
+			return db.WithTx(t.Context(), func(tx *metadata.Tx) error {
+				return features.MigrateToSql(tx, fsFeatureStore, fsOperationStore, sqlFeatureStore, sqlOperationStore)
+			})
+		}
+
+		err = migrate()
+		assert.ErrorContains(t, err, "invalid")
+
+		_, err = sqlOperationStore.GetOperation("get-tasks")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+
+		err = featuresFs.RemoveAll("invalid")
+		assert.NoError(t, err)
+
+		err = migrate()
+		assert.NoError(t, err)
+
+		feature, err := sqlFeatureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", feature.ReactComponent.TsxCode)
+		assert.Equal(t, "get-tasks", feature.ServerOperations[0].Name)
+
+		err = migrate()
+		assert.ErrorIs(t, err, features.ErrMetadataNotEmpty)
+	})
+}
@@ -0,0 +1,298 @@
+package features
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+var ErrMissingAIModel = errors.New("the model of an OpenAI-compatible provider is required")
+
+func NewOpenAICompatibleGenerator(config *AIGeneratorConfig, instructions *AIInstructions) (IAIGenerator, error) {
+	if len(config.Model) == 0 {
+		return nil, ErrMissingAIModel
+	}
+
+	baseURL := config.BaseURL
+	if len(baseURL) == 0 {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	apiKey := config.APIKey
+	if len(apiKey) == 0 {
+		// local servers usually don't need one
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	return &OpenAICompatibleGenerator{
+		client:       http.DefaultClient,
+		endpoint:     strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+		apiKey:       apiKey,
+		model:        config.Model,
+		maxTokens:    config.maxTokens(),
+		temperature:  config.temperature(),
+		instructions: instructions,
+	}, nil
+}
+
+// OpenAICompatibleGenerator asks for features through the chat completions
+// API of OpenAI, which llama.cpp, Ollama and most other servers also serve.
+type OpenAICompatibleGenerator struct {
+	client       *http.Client
+	endpoint     string
+	apiKey       string
+	model        string
+	maxTokens    int
+	temperature  float64
+	instructions *AIInstructions
+}
+
+type openAIChatRequest struct {
+	Model       string               `json:"model"`
+	Messages    []*openAIChatMessage `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature float64              `json:"temperature"`
+	Stream      bool                 `json:"stream"`
+	// asks for the usage in the last chunk of the stream
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Tools         []*openAITool        `json:"tools,omitempty"`
+	ToolChoice    string               `json:"tool_choice,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int `json:"index"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// chatCompletion is a streamed chat completion, read whole.
+type chatCompletion struct {
+	Text string
+	// ToolCall is the first tool call of the answer, nil when the AI didn't
+	// call any tool
+	ToolCall *AIToolCall
+	// Model is empty when the server doesn't tell it
+	Model string
+	// the tokens are 0 when the server doesn't report the usage
+	InputTokens  int
+	OutputTokens int
+}
+
+func (g *OpenAICompatibleGenerator) Generate(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	return g.generate(ctx, prompt, featureContext, nil)
+}
+
+func (g *OpenAICompatibleGenerator) Repair(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	return g.generate(ctx, prompt, featureContext, attempts)
+}
+
+func (g *OpenAICompatibleGenerator) generate(ctx context.Context, prompt string, featureContext *Feature, attempts []*GenerationAttempt) (*Feature, error) {
+	instructions, err := g.instructions.System(featureContext)
+	if err != nil {
+		return nil, err
+	}
+
+	reportProgress(ctx, &GenerationEvent{Phase: PromptBuiltPhase})
+
+	messages := []*openAIChatMessage{{Role: "system", Content: instructions}}
+	for _, message := range g.instructions.Conversation(conversationHistory(ctx), prompt, attempts) {
+		messages = append(messages, &openAIChatMessage{Role: string(message.Role), Content: message.Text})
+	}
+
+	chatRequest := &openAIChatRequest{
+		Model:       g.model,
+		Messages:    messages,
+		MaxTokens:   g.maxTokens,
+		Temperature: g.temperature,
+		// streamed, so the progress can be reported while the answer is written
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	}
+
+	tools := g.instructions.Tools()
+	if len(tools) > 0 {
+		for _, tool := range tools {
+			chatRequest.Tools = append(chatRequest.Tools, &openAITool{
+				Type:     "function",
+				Function: openAIToolFunction{Name: tool.Name, Description: tool.Description, Parameters: tool.InputSchema},
+			})
+		}
+		// the AI must answer with one of the tools, never with text
+		chatRequest.ToolChoice = "required"
+	}
+
+	requestBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "text/event-stream")
+	if len(g.apiKey) > 0 {
+		request.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	startedAt := time.Now()
+	response, err := g.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", g.endpoint, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("%s answered %s: %s", g.endpoint, response.Status, strings.TrimSpace(string(body)))
+	}
+
+	completion, err := readChatCompletionStream(ctx, response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat response: %w", err)
+	}
+
+	log.Info().Msgf("Got response from %s", g.endpoint)
+
+	model := completion.Model
+	if len(model) == 0 {
+		model = g.model
+	}
+	reportProgress(ctx, &GenerationEvent{Phase: UsagePhase, Usage: &AIUsage{
+		Model:        model,
+		InputTokens:  completion.InputTokens,
+		OutputTokens: completion.OutputTokens,
+		LatencyMs:    time.Since(startedAt).Milliseconds(),
+	}})
+
+	if completion.ToolCall != nil {
+		return g.instructions.ParseToolCall(ctx, completion.ToolCall)
+	}
+
+	// the server doesn't support tools, or the AI answered with text anyway
+	return g.instructions.ParseAnswer(ctx, []string{completion.Text})
+}
+
+// readChatCompletionStream joins the content of the chunks of a streamed chat
+// completion, reporting each of them as progress.
+func readChatCompletionStream(ctx context.Context, body io.Reader) (*chatCompletion, error) {
+	completion := &chatCompletion{}
+	answer := strings.Builder{}
+
+	// the name and the arguments of each tool call come in pieces, keyed by
+	// the tool call index
+	toolCallNames := map[int]string{}
+	toolCallArguments := map[int]*strings.Builder{}
+	firstToolCall := -1
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, isData := strings.CutPrefix(scanner.Text(), "data:")
+		if !isData {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		chunk := &openAIChatChunk{}
+		err := json.Unmarshal([]byte(data), chunk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk %q: %w", data, err)
+		}
+
+		if len(chunk.Model) > 0 {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.InputTokens = chunk.Usage.PromptTokens
+			completion.OutputTokens = chunk.Usage.CompletionTokens
+		}
+
+		for _, choice := range chunk.Choices {
+			for _, toolCall := range choice.Delta.ToolCalls {
+				if firstToolCall < 0 {
+					firstToolCall = toolCall.Index
+				}
+				if toolCallArguments[toolCall.Index] == nil {
+					toolCallArguments[toolCall.Index] = &strings.Builder{}
+				}
+				toolCallNames[toolCall.Index] += toolCall.Function.Name
+				toolCallArguments[toolCall.Index].WriteString(toolCall.Function.Arguments)
+				if len(toolCall.Function.Arguments) > 0 {
+					reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: toolCall.Function.Arguments})
+				}
+			}
+
+			if len(choice.Delta.Content) == 0 {
+				continue
+			}
+			answer.WriteString(choice.Delta.Content)
+			reportProgress(ctx, &GenerationEvent{Phase: TokensPhase, Text: choice.Delta.Content})
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	completion.Text = answer.String()
+	if firstToolCall >= 0 {
+		completion.ToolCall = &AIToolCall{
+			Name:  toolCallNames[firstToolCall],
+			Input: json.RawMessage(toolCallArguments[firstToolCall].String()),
+		}
+	}
+
+	return completion, nil
+}
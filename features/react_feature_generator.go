@@ -4,10 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/phuslu/log"
 	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
 
 	_ "embed"
 )
@@ -16,27 +20,152 @@ type IFeatureGenerator interface {
 	GenerateFeature(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error)
 }
 
-func NewReactFeatureGenerator(db *sql.DB, featureStore IFeatureStore, aiGenerator IAIGenerator, frontendBuilder frontend.IBuilder) IFeatureGenerator {
+type FeatureGeneratorConfig struct {
+	// how many answers are asked from the AI, including the first one, before
+	// giving up on fixing the feature
+	MaxAttempts int
+}
+
+func NewReactFeatureGenerator(db *sql.DB, featureStore IFeatureStore, revisionStore IFeatureRevisionStore, aiGenerator IAIGenerator, featureValidator IFeatureValidator, operationDryRunner operations.IOperationDryRunner, frontendBuilder frontend.IBuilder, usageTracker IGenerationUsageTracker, config *FeatureGeneratorConfig) IFeatureGenerator {
+	if config == nil {
+		config = &FeatureGeneratorConfig{}
+	}
+
 	return &ReactFeatureGenerator{
-		db:              db,
-		featureStore:    featureStore,
-		aiGenerator:     aiGenerator,
-		frontendBuilder: frontendBuilder,
+		db:                 db,
+		featureStore:       featureStore,
+		revisionStore:      revisionStore,
+		aiGenerator:        aiGenerator,
+		featureValidator:   featureValidator,
+		operationDryRunner: operationDryRunner,
+		frontendBuilder:    frontendBuilder,
+		usageTracker:       usageTracker,
+		config:             config,
 	}
 }
 
 type ReactFeatureGenerator struct {
-	db              *sql.DB
-	featureStore    IFeatureStore
-	aiGenerator     IAIGenerator
-	frontendBuilder frontend.IBuilder
+	db               *sql.DB
+	featureStore     IFeatureStore
+	revisionStore    IFeatureRevisionStore
+	aiGenerator      IAIGenerator
+	featureValidator IFeatureValidator
+	// runs the operations of each generated feature once, may be nil
+	operationDryRunner operations.IOperationDryRunner
+	frontendBuilder    frontend.IBuilder
+	// accounts the usage of each generation and enforces the quotas, may be
+	// nil
+	usageTracker IGenerationUsageTracker
+	config       *FeatureGeneratorConfig
 }
 
+var ErrInvalidGeneratedFeature = errors.New("invalid generated feature")
+
+// GenerateFeature asks the AI for a feature and sends back the problems found
+// in it until it checks, stores and builds, or until MaxAttempts answers were
+// asked.
 func (g *ReactFeatureGenerator) GenerateFeature(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	if g.usageTracker == nil {
+		return g.generateFeature(ctx, prompt, featureContext)
+	}
+
+	user := generationUser(ctx)
+	reservation, err := g.usageTracker.ReserveQuota(user)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := []*AIUsage{}
+	ctx = withProgressListener(ctx, func(event *GenerationEvent) {
+		if event.Phase == UsagePhase && event.Usage != nil {
+			answers = append(answers, event.Usage)
+		}
+	})
+
+	feature, err := g.generateFeature(ctx, prompt, featureContext)
+
+	usage := &GenerationUsage{User: user, Succeeded: err == nil, CreatedAt: time.Now()}
+	if err == nil {
+		usage.FeatureName = feature.Name
+	} else if featureContext != nil {
+		usage.FeatureName = featureContext.Name
+	}
+	recordErr := g.usageTracker.SettleGeneration(reservation, usage, answers)
+	if recordErr != nil {
+		// the generation is over, only the reports miss its usage
+		log.Error().Msgf("failed to record generation usage: %v", recordErr)
+	}
+
+	return feature, err
+}
 
-	feature, err := g.aiGenerator.Generate(ctx, prompt, featureContext)
+func (g *ReactFeatureGenerator) generateFeature(ctx context.Context, prompt string, featureContext *Feature) (*Feature, error) {
+	maxAttempts := max(g.config.MaxAttempts, 1)
+
+	attempts := []*GenerationAttempt{}
+	for {
+		var feature *Feature
+		var err error
+		if len(attempts) == 0 {
+			feature, err = g.aiGenerator.Generate(ctx, prompt, featureContext)
+		} else {
+			feature, err = g.aiGenerator.Repair(ctx, prompt, featureContext, attempts)
+		}
+
+		attempt, err := g.tryFeature(ctx, prompt, feature, err)
+		if err != nil {
+			return nil, err
+		}
+		if attempt == nil {
+			return feature, nil
+		}
+
+		attempts = append(attempts, attempt)
+		if len(attempts) >= maxAttempts {
+			return nil, fmt.Errorf("%w, still not fixed after %d attempts:\n%s", ErrInvalidGeneratedFeature, len(attempts), formatDiagnostics(attempt.Diagnostics))
+		}
+
+		log.Info().Msgf("repairing generated feature, attempt %d of %d:\n%s", len(attempts)+1, maxAttempts, formatDiagnostics(attempt.Diagnostics))
+		reportProgress(ctx, &GenerationEvent{Phase: RepairingPhase, Text: formatDiagnostics(attempt.Diagnostics), Attempt: attempt})
+	}
+}
+
+// tryFeature checks, stores and builds a feature answered by the AI. It
+// returns the attempt to send back to the AI when the answer can be fixed,
+// or nil when the feature was stored. The feature is only stored once it
+// type checks and bundles with the whole frontend, so it is written once.
+func (g *ReactFeatureGenerator) tryFeature(ctx context.Context, prompt string, feature *Feature, generateErr error) (*GenerationAttempt, error) {
+	invalidAnswerErr := &InvalidAnswerError{}
+	if errors.As(generateErr, &invalidAnswerErr) {
+		return &GenerationAttempt{
+			Answer:      invalidAnswerErr.Answer,
+			Diagnostics: []*Diagnostic{{Source: AnswerDiagnostic, Message: invalidAnswerErr.Err.Error()}},
+		}, nil
+	}
+	if generateErr != nil {
+		return nil, fmt.Errorf("failed to create page component view: %w", generateErr)
+	}
+
+	answer, err := json.MarshalIndent(feature, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode generated feature: %w", err)
+	}
+
+	report, err := g.featureValidator.Validate(feature)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create page component view: %w", err)
+		return nil, fmt.Errorf("failed to validate generated feature: %w", err)
+	}
+	if !report.Valid {
+		return &GenerationAttempt{Answer: string(answer), Diagnostics: report.Diagnostics()}, nil
+	}
+	reportProgress(ctx, &GenerationEvent{Phase: ValidatedPhase, Report: report})
+
+	if g.operationDryRunner != nil {
+		dryRuns, err := g.dryRunOperations(ctx, feature)
+		if err != nil {
+			return nil, err
+		}
+		reportProgress(ctx, &GenerationEvent{Phase: TestedPhase, DryRuns: dryRuns})
 	}
 
 	err = SaveFeatureToJsonFile(feature)
@@ -48,13 +177,46 @@ func (g *ReactFeatureGenerator) GenerateFeature(ctx context.Context, prompt stri
 	if err != nil {
 		return nil, fmt.Errorf("failed to store feature %s: %w", feature.Name, err)
 	}
+	reportProgress(ctx, &GenerationEvent{Phase: StoredPhase})
+
+	err = g.revisionStore.AddFeatureRevision(&FeatureRevision{
+		FeatureRevisionInfo: FeatureRevisionInfo{
+			CreatedAt: time.Now(),
+			Prompt:    prompt,
+		},
+		Feature: feature,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record revision of feature %s: %w", feature.Name, err)
+	}
 
+	// the feature was checked with the frontend sources already, so the build
+	// only fails on problems elsewhere in the frontend, the AI can't fix them
 	err = g.frontendBuilder.BuildFrontend()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build frontend: %w", err)
 	}
+	reportProgress(ctx, &GenerationEvent{Phase: BundleBuiltPhase})
+
+	return nil, nil
+}
 
-	return feature, nil
+// dryRunOperations runs each operation of the feature once, so wrong queries
+// show up in the generation instead of in the hands of users. Failed runs are
+// only reported, since synthesized arguments may make a correct operation fail.
+func (g *ReactFeatureGenerator) dryRunOperations(ctx context.Context, feature *Feature) ([]*operations.DryRunResult, error) {
+	dryRuns := []*operations.DryRunResult{}
+	for _, operation := range feature.ServerOperations {
+		dryRun, err := g.operationDryRunner.DryRun(ctx, operation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dry run operation %s: %w", operation.Name, err)
+		}
+		if !dryRun.Success {
+			log.Warn().Msgf("dry run of operation %s failed: %s", operation.Name, dryRun)
+		}
+		dryRuns = append(dryRuns, dryRun)
+	}
+	return dryRuns, nil
 }
 
 func SaveFeatureToJsonFile(p *Feature) error {
@@ -0,0 +1,301 @@
+package features_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/frontend"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type aiAnswer struct {
+	feature *features.Feature
+	err     error
+}
+
+// scriptedAIGenerator answers in order, first to Generate and then to
+// Repair, repeating the last answer when there are no more.
+type scriptedAIGenerator struct {
+	answers []*aiAnswer
+	repairs [][]*features.GenerationAttempt
+}
+
+func (g *scriptedAIGenerator) Generate(ctx context.Context, prompt string, featureContext *features.Feature) (*features.Feature, error) {
+	return g.nextAnswer()
+}
+
+func (g *scriptedAIGenerator) Repair(ctx context.Context, prompt string, featureContext *features.Feature, attempts []*features.GenerationAttempt) (*features.Feature, error) {
+	g.repairs = append(g.repairs, append([]*features.GenerationAttempt{}, attempts...))
+	return g.nextAnswer()
+}
+
+func (g *scriptedAIGenerator) nextAnswer() (*features.Feature, error) {
+	answer := g.answers[0]
+	if len(g.answers) > 1 {
+		g.answers = g.answers[1:]
+	}
+	return answer.feature, answer.err
+}
+
+// failingBuilder fails the first builds with the errors, in order.
+type failingBuilder struct {
+	countingBuilder
+	errs []error
+}
+
+func (b *failingBuilder) BuildFrontend() error {
+	b.builds++
+	if len(b.errs) == 0 {
+		return nil
+	}
+	err := b.errs[0]
+	b.errs = b.errs[1:]
+	return err
+}
+
+// failingFrontendChecker checks sources like the frontend checker it embeds,
+// but reports the messages of fail for the whole frontend.
+type failingFrontendChecker struct {
+	frontend.ISourceChecker
+	fail func(sources map[string]string) []*frontend.BuildMessage
+}
+
+func (c *failingFrontendChecker) CheckFrontend(sources map[string]string) (*frontend.SourceCheck, error) {
+	return &frontend.SourceCheck{Messages: c.fail(sources), Exports: []string{}}, nil
+}
+
+func TestReactFeatureGenerator(t *testing.T) {
+	// generated features are also saved to AiGeneratedViews, in the working
+	// directory
+	t.Chdir(t.TempDir())
+	err := os.Mkdir("AiGeneratedViews", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generateValidated := func(featureStore features.IFeatureStore, revisionStore features.IFeatureRevisionStore, aiGenerator features.IAIGenerator, validator features.IFeatureValidator, dryRunner operations.IOperationDryRunner, builder frontend.IBuilder) ([]*features.GenerationEvent, *features.Feature, error) {
+		generator := features.NewReactFeatureGenerator(nil, featureStore, revisionStore, aiGenerator, validator, dryRunner, builder, nil, &features.FeatureGeneratorConfig{
+			MaxAttempts: 4,
+		})
+
+		events := []*features.GenerationEvent{}
+		ctx := features.WithGenerationProgress(context.Background(), func(event *features.GenerationEvent) {
+			events = append(events, event)
+		})
+
+		feature, err := generator.GenerateFeature(ctx, "prompt", nil)
+		return events, feature, err
+	}
+
+	generate := func(featureStore features.IFeatureStore, revisionStore features.IFeatureRevisionStore, aiGenerator features.IAIGenerator, dryRunner operations.IOperationDryRunner, builder frontend.IBuilder) ([]*features.GenerationEvent, *features.Feature, error) {
+		return generateValidated(featureStore, revisionStore, aiGenerator, newFeatureValidator(operations.NewInMemoryOperationStore()), dryRunner, builder)
+	}
+
+	t.Run("invalid features are not stored", func(t *testing.T) {
+		noDefaultExport := generatedFeature("tasks", "v1", "get-tasks")
+		noDefaultExport.ReactComponent.TsxCode = "export function Component() {\n  return null;\n}\n"
+		noRunFunction := generatedFeature("tasks", "v1", "get-tasks")
+		noRunFunction.ServerOperations[0].JavascriptCode = `function execute() { return 1 }`
+		unknownOperation := generatedFeature("tasks", "v1", "get-tasks")
+		unknownOperation.ReactComponent.TsxCode += `fetch("/operations/execute/get-users");`
+
+		for _, feature := range []*features.Feature{
+			generatedFeature("../tasks", "v1", "get-tasks"),
+			newFeature("tasks", "", "get-tasks"),
+			generatedFeature("tasks", "v1", "get tasks"),
+			generatedFeature("tasks", "<div>", "get-tasks"),
+			generatedFeature("tasks", "v1", "get-tasks", "get-tasks"),
+			noDefaultExport,
+			noRunFunction,
+			unknownOperation,
+		} {
+			featureStore, _, _ := newFsFeatureStore(nil)
+			builder := &countingBuilder{}
+			aiGenerator := &scriptedAIGenerator{answers: []*aiAnswer{{feature: feature}}}
+
+			events, _, err := generate(featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), aiGenerator, nil, builder)
+			assert.ErrorIs(t, err, features.ErrInvalidGeneratedFeature)
+			assert.Equal(t, []features.GenerationPhase{features.RepairingPhase, features.RepairingPhase, features.RepairingPhase}, generationPhases(events))
+			assert.Len(t, aiGenerator.repairs, 3)
+			assert.Equal(t, 0, builder.builds)
+
+			featureManifests, brokenFeatures, err := featureStore.GetAllFeatures()
+			assert.NoError(t, err)
+			assert.Empty(t, featureManifests)
+			assert.Empty(t, brokenFeatures)
+		}
+	})
+
+	t.Run("problems are sent back to the AI", func(t *testing.T) {
+		featureStore, _, _ := newFsFeatureStore(nil)
+		revisionStore := features.NewFsFeatureRevisionStore(afero.NewMemMapFs())
+
+		invalidScript := generatedFeature("tasks", "v1", "get-tasks")
+		invalidScript.ServerOperations[0].JavascriptCode = `function run( {`
+
+		aiGenerator := &scriptedAIGenerator{answers: []*aiAnswer{
+			{err: &features.InvalidAnswerError{Answer: "not json", Err: errors.New("invalid character 'o'")}},
+			{feature: invalidScript},
+			{feature: generatedFeature("tasks", "v1", "get-tasks")},
+			{feature: generatedFeature("tasks", "v2", "get-tasks")},
+		}}
+		// the operations of the feature break another component
+		validator := features.NewFeatureValidator(operations.NewInMemoryOperationStore(), &failingFrontendChecker{
+			ISourceChecker: frontend.NewSourceChecker(&frontend.BuilderConfig{}),
+			fail: func(sources map[string]string) []*frontend.BuildMessage {
+				if sources["components/tasks.tsx"] != componentTsx("v1") {
+					return []*frontend.BuildMessage{}
+				}
+				return []*frontend.BuildMessage{
+					{File: "components/users.tsx", Line: 3, Column: 7, Text: "error TS2304: Cannot find name 'v1'."},
+				}
+			},
+		})
+		builder := &countingBuilder{}
+
+		events, feature, err := generateValidated(featureStore, revisionStore, aiGenerator, validator, nil, builder)
+		assert.NoError(t, err)
+		assert.Equal(t, componentTsx("v2"), feature.ReactComponent.TsxCode)
+		assert.Equal(t, []features.GenerationPhase{
+			features.RepairingPhase,
+			features.RepairingPhase,
+			features.RepairingPhase,
+			features.ValidatedPhase, features.StoredPhase, features.BundleBuiltPhase,
+		}, generationPhases(events))
+		assert.Equal(t, 1, builder.builds)
+
+		attempts := aiGenerator.repairs[2]
+		assert.Len(t, attempts, 3)
+		assert.Equal(t, "not json", attempts[0].Answer)
+		assert.Equal(t, features.AnswerDiagnostic, attempts[0].Diagnostics[0].Source)
+		assert.Equal(t, features.JavascriptDiagnostic, attempts[1].Diagnostics[0].Source)
+		assert.Equal(t, "operations/get-tasks/operation.js", attempts[1].Diagnostics[0].Location)
+		assert.Equal(t, &features.Diagnostic{
+			Source:   features.BuildDiagnostic,
+			Location: "components/users.tsx:3:7",
+			Message:  "error TS2304: Cannot find name 'v1'.",
+		}, attempts[2].Diagnostics[0])
+
+		storedFeature, err := featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, componentTsx("v2"), storedFeature.ReactComponent.TsxCode)
+
+		revisions, err := revisionStore.ListFeatureRevisions("tasks")
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 1)
+	})
+
+	t.Run("build problems outside the feature are not repaired", func(t *testing.T) {
+		featureStore, _, _ := newFsFeatureStore(nil)
+		err := featureStore.AddFeature(newFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+
+		aiGenerator := &scriptedAIGenerator{answers: []*aiAnswer{{feature: generatedFeature("tasks", "v2", "get-tasks")}}}
+		buildErr := &frontend.BuildError{Stage: "build", Messages: []*frontend.BuildMessage{
+			{File: "frontend/src/components/users.tsx", Line: 1, Column: 1, Text: "Unexpected end of file"},
+		}}
+		builder := &failingBuilder{errs: []error{buildErr}}
+
+		_, _, err = generate(featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), aiGenerator, nil, builder)
+		assert.ErrorIs(t, err, buildErr)
+		assert.Empty(t, aiGenerator.repairs)
+
+		// the feature was checked with the frontend sources before being
+		// stored, it's kept until the rest of the frontend is fixed
+		feature, err := featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+		assert.Equal(t, componentTsx("v2"), feature.ReactComponent.TsxCode)
+	})
+
+	t.Run("operations are dry run", func(t *testing.T) {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+		_, err = db.Exec("CREATE TABLE tasks (id INTEGER PRIMARY KEY, title TEXT NOT NULL);")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		feature := generatedFeature("tasks", "v1", "count-tasks", "add-task")
+		feature.ServerOperations[0].JavascriptCode = `function run() { return queryOne("SELECT count(*) AS total FROM tasks;").total }`
+		feature.ServerOperations[1].Kind = operations.MutationKind
+		feature.ServerOperations[1].JavascriptCode = `function run() { return exec("INSERT INTO tasks (name) VALUES ('a');").rowsAffected }`
+
+		featureStore, _, _ := newFsFeatureStore(nil)
+		aiGenerator := &scriptedAIGenerator{answers: []*aiAnswer{{feature: feature}}}
+
+		events, _, err := generate(featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), aiGenerator, operations.NewOperationDryRunner(db, nil), &countingBuilder{})
+		assert.NoError(t, err)
+		assert.Equal(t, []features.GenerationPhase{
+			features.ValidatedPhase, features.TestedPhase, features.StoredPhase, features.BundleBuiltPhase,
+		}, generationPhases(events))
+
+		// failed dry runs are reported, the feature is still stored
+		dryRuns := events[1].DryRuns
+		assert.Len(t, dryRuns, 2)
+		assert.True(t, dryRuns[0].Success, dryRuns[0].Error)
+		assert.Equal(t, int64(0), dryRuns[0].Result)
+		assert.False(t, dryRuns[1].Success)
+		assert.Contains(t, dryRuns[1].Error, "table tasks has no column named name")
+
+		_, err = featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+	})
+
+	t.Run("recorded generations are replayed", func(t *testing.T) {
+		invalidScript := generatedFeature("tasks", "v1", "get-tasks")
+		invalidScript.ServerOperations[0].JavascriptCode = `function run( {`
+		invalidScriptJson, err := json.Marshal(invalidScript)
+		assert.NoError(t, err)
+		featureJson, err := json.Marshal(generatedFeature("tasks", "v1", "get-tasks"))
+		assert.NoError(t, err)
+
+		cassettesFs := afero.NewMemMapFs()
+		server, _ := chatCompletionServer(t, string(invalidScriptJson), string(featureJson))
+		recorder := newRecordingAIGenerator(t, server.URL, cassettesFs, "tasks.json")
+
+		featureStore, _, _ := newFsFeatureStore(nil)
+		recordedEvents, recordedFeature, err := generate(featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), recorder, nil, &countingBuilder{})
+		assert.NoError(t, err)
+		server.Close()
+
+		replay, err := features.NewReplayAIGenerator(newTestAIInstructions(t), cassettesFs, "tasks.json", features.FailReplayFallback)
+		assert.NoError(t, err)
+
+		featureStore, _, _ = newFsFeatureStore(nil)
+		replayedEvents, replayedFeature, err := generate(featureStore, features.NewFsFeatureRevisionStore(afero.NewMemMapFs()), replay, nil, &countingBuilder{})
+		assert.NoError(t, err)
+		assert.Equal(t, recordedFeature, replayedFeature)
+		// the answers are replayed at once instead of in chunks
+		isTokens := func(phase features.GenerationPhase) bool { return phase == features.TokensPhase }
+		replayedPhases := slices.DeleteFunc(generationPhases(replayedEvents), isTokens)
+		assert.Equal(t, slices.DeleteFunc(generationPhases(recordedEvents), isTokens), replayedPhases)
+		assert.Contains(t, replayedPhases, features.RepairingPhase)
+
+		_, err = featureStore.GetFeature("tasks")
+		assert.NoError(t, err)
+	})
+}
+
+func generationPhases(events []*features.GenerationEvent) []features.GenerationPhase {
+	phases := []features.GenerationPhase{}
+	for _, event := range events {
+		phases = append(phases, event.Phase)
+	}
+	return phases
+}
@@ -0,0 +1,153 @@
+package features
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+// ITxComponentStore is a store that can add components as part of a larger
+// metadata transaction, e.g. together with their feature.
+type ITxComponentStore interface {
+	IComponentStore
+	AddComponentTx(tx *metadata.Tx, name string, tsxCode []byte) error
+	DeleteComponentTx(tx *metadata.Tx, name string) error
+}
+
+// SqlComponentStore keeps the TSX code of components in the metadata
+// database. The component files in fs are still written, since the frontend
+// builder bundles them, but only after the database transaction commits.
+type SqlComponentStore struct {
+	frontendSources
+	db *metadata.DB
+}
+
+// NewSqlComponentStore writes the component files of every stored component,
+// so the frontend sources match the database even if the process stopped
+// before writing them.
+func NewSqlComponentStore(db *metadata.DB, fs ComponentsFs, operationStore operations.IOperationStore) (IComponentStore, error) {
+	s := &SqlComponentStore{
+		frontendSources: frontendSources{
+			fs:             fs,
+			operationStore: operationStore,
+		},
+		db: db,
+	}
+
+	err := s.syncComponentFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write component files: %w", err)
+	}
+
+	s.watchOperations()
+
+	return s, nil
+}
+
+func (s *SqlComponentStore) AddComponent(name string, tsxCode []byte) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.AddComponentTx(tx, name, tsxCode)
+	})
+}
+
+func (s *SqlComponentStore) AddComponentTx(tx *metadata.Tx, name string, tsxCode []byte) error {
+	_, err := tx.Exec(`
+		INSERT INTO components (name, tsx_code) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET tsx_code = excluded.tsx_code
+	`, name, string(tsxCode))
+	if err != nil {
+		return fmt.Errorf("failed to write component %s: %w", name, err)
+	}
+
+	tx.AfterCommit(func() {
+		err := s.writeComponent(name, tsxCode)
+		if err != nil {
+			// the file is written again by syncComponentFiles on the next start
+			log.Error().Msgf("failed to write component %s file: %v", name, err)
+		}
+	})
+
+	return nil
+}
+
+func (s *SqlComponentStore) DeleteComponent(name string) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.DeleteComponentTx(tx, name)
+	})
+}
+
+func (s *SqlComponentStore) DeleteComponentTx(tx *metadata.Tx, name string) error {
+	result, err := tx.Exec(`DELETE FROM components WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete component %s: %w", name, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete component %s: %w", name, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("failed to delete component %s: %w", name, ErrComponentNotFound)
+	}
+
+	tx.AfterCommit(func() {
+		err := s.removeComponent(name)
+		if err != nil {
+			log.Error().Msgf("failed to remove component %s file: %v", name, err)
+		}
+	})
+
+	return nil
+}
+
+func (s *SqlComponentStore) GetComponent(name string) ([]byte, error) {
+	var tsxCode string
+	err := s.db.QueryRow(`SELECT tsx_code FROM components WHERE name = ?`, name).Scan(&tsxCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read component %s: %w", name, ErrComponentNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read component %s: %w", name, err)
+	}
+
+	return []byte(tsxCode), nil
+}
+
+func (s *SqlComponentStore) syncComponentFiles() error {
+	rows, err := s.db.Query(`SELECT name, tsx_code FROM components ORDER BY name`)
+	if err != nil {
+		return fmt.Errorf("failed to list components: %w", err)
+	}
+	defer rows.Close()
+
+	hasComponents := false
+	for rows.Next() {
+		var name string
+		var tsxCode string
+		err := rows.Scan(&name, &tsxCode)
+		if err != nil {
+			return fmt.Errorf("failed to read component: %w", err)
+		}
+
+		err = s.writeComponent(name, []byte(tsxCode))
+		if err != nil {
+			return err
+		}
+		hasComponents = true
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("failed to list components: %w", err)
+	}
+
+	if !hasComponents {
+		return nil
+	}
+
+	return s.regenerateOperationsClient()
+}
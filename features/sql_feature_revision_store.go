@@ -0,0 +1,172 @@
+package features
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+)
+
+// ITxFeatureRevisionStore is a store that can add revisions as part of a
+// larger metadata transaction, e.g. together with every migrated feature.
+type ITxFeatureRevisionStore interface {
+	IFeatureRevisionStore
+	AddFeatureRevisionTx(tx *metadata.Tx, revision *FeatureRevision) error
+}
+
+type SqlFeatureRevisionStore struct {
+	db *metadata.DB
+}
+
+func NewSqlFeatureRevisionStore(db *metadata.DB) IFeatureRevisionStore {
+	return &SqlFeatureRevisionStore{
+		db: db,
+	}
+}
+
+func (s *SqlFeatureRevisionStore) AddFeatureRevision(revision *FeatureRevision) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.AddFeatureRevisionTx(tx, revision)
+	})
+}
+
+func (s *SqlFeatureRevisionStore) AddFeatureRevisionTx(tx *metadata.Tx, revision *FeatureRevision) error {
+	featureName := revision.Feature.Name
+
+	featureJson, err := json.Marshal(revision.Feature)
+	if err != nil {
+		return fmt.Errorf("failed to encode feature %s revision: %w", featureName, err)
+	}
+
+	var nextRevision int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(revision), 0) + 1 FROM feature_revisions WHERE feature_name = ?
+	`, featureName).Scan(&nextRevision)
+	if err != nil {
+		return fmt.Errorf("failed to get next revision of feature %s: %w", featureName, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO feature_revisions (feature_name, revision, created_at, prompt, rolled_back_from, feature)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, featureName, nextRevision, revision.CreatedAt.UTC().Format(time.RFC3339Nano), revision.Prompt, revision.RolledBackFrom, string(featureJson))
+	if err != nil {
+		return fmt.Errorf("failed to write feature %s revision %d: %w", featureName, nextRevision, err)
+	}
+
+	tx.AfterCommit(func() {
+		revision.Revision = nextRevision
+	})
+
+	return nil
+}
+
+func (s *SqlFeatureRevisionStore) GetFeatureRevision(featureName string, revision int) (*FeatureRevision, error) {
+	row := s.db.QueryRow(`
+		SELECT revision, created_at, prompt, rolled_back_from, feature
+		FROM feature_revisions
+		WHERE feature_name = ? AND revision = ?
+	`, featureName, revision)
+
+	featureRevision := &FeatureRevision{}
+	var featureJson string
+	err := scanFeatureRevisionInfo(row, &featureRevision.FeatureRevisionInfo, &featureJson)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get feature %s revision %d: %w", featureName, revision, ErrFeatureRevisionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature %s revision %d: %w", featureName, revision, err)
+	}
+
+	err = json.Unmarshal([]byte(featureJson), &featureRevision.Feature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feature %s revision %d json: %w", featureName, revision, err)
+	}
+
+	return featureRevision, nil
+}
+
+func (s *SqlFeatureRevisionStore) ListFeatureRevisions(featureName string) ([]*FeatureRevisionInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT revision, created_at, prompt, rolled_back_from
+		FROM feature_revisions
+		WHERE feature_name = ?
+		ORDER BY revision
+	`, featureName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature %s revisions: %w", featureName, err)
+	}
+	defer rows.Close()
+
+	revisions := []*FeatureRevisionInfo{}
+	for rows.Next() {
+		revision := &FeatureRevisionInfo{}
+		err := scanFeatureRevisionInfo(rows, revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feature %s revision: %w", featureName, err)
+		}
+		revisions = append(revisions, revision)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature %s revisions: %w", featureName, err)
+	}
+
+	return revisions, nil
+}
+
+type featureRevisionScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFeatureRevisionInfo(row featureRevisionScanner, revision *FeatureRevisionInfo, extra ...any) error {
+	var createdAt string
+	dest := append([]any{&revision.Revision, &createdAt, &revision.Prompt, &revision.RolledBackFrom}, extra...)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	revision.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return fmt.Errorf("invalid creation time of revision %d: %w", revision.Revision, err)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureRevisionStore) DeleteFeatureRevisions(featureName string) error {
+	_, err := s.db.Exec(`DELETE FROM feature_revisions WHERE feature_name = ?`, featureName)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature %s revisions: %w", featureName, err)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureRevisionStore) RenameFeatureRevisions(featureName string, newName string) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		var hasRevisions bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM feature_revisions WHERE feature_name = ?)
+		`, newName).Scan(&hasRevisions)
+		if err != nil {
+			return fmt.Errorf("failed to check feature %s revisions: %w", newName, err)
+		}
+		if hasRevisions {
+			return fmt.Errorf("failed to move revisions of feature %s to %s: %w", featureName, newName, ErrFeatureHasRevisions)
+		}
+
+		_, err = tx.Exec(`UPDATE feature_revisions SET feature_name = ? WHERE feature_name = ?`, newName, featureName)
+		if err != nil {
+			return fmt.Errorf("failed to move revisions of feature %s to %s: %w", featureName, newName, err)
+		}
+
+		return nil
+	})
+}
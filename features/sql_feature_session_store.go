@@ -0,0 +1,138 @@
+package features
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+)
+
+type SqlFeatureSessionStore struct {
+	db *metadata.DB
+}
+
+func NewSqlFeatureSessionStore(db *metadata.DB) IFeatureSessionStore {
+	return &SqlFeatureSessionStore{
+		db: db,
+	}
+}
+
+func (s *SqlFeatureSessionStore) SaveFeatureSession(session *FeatureSession) error {
+	messagesJson, err := json.Marshal(session.Messages)
+	if err != nil {
+		return fmt.Errorf("failed to encode feature session %s messages: %w", session.ID, err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO feature_sessions (id, feature_name, title, forked_from, created_at, updated_at, messages)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			feature_name = excluded.feature_name,
+			title = excluded.title,
+			updated_at = excluded.updated_at,
+			messages = excluded.messages
+	`, session.ID, session.FeatureName, session.Title, session.ForkedFrom,
+		session.CreatedAt.UTC().Format(time.RFC3339Nano), session.UpdatedAt.UTC().Format(time.RFC3339Nano), string(messagesJson))
+	if err != nil {
+		return fmt.Errorf("failed to write feature session %s: %w", session.ID, err)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureSessionStore) GetFeatureSession(id string) (*FeatureSession, error) {
+	row := s.db.QueryRow(`
+		SELECT id, feature_name, title, forked_from, created_at, updated_at, messages
+		FROM feature_sessions
+		WHERE id = ?
+	`, id)
+
+	session := &FeatureSession{}
+	var messagesJson string
+	err := scanFeatureSessionInfo(row, &session.FeatureSessionInfo, &messagesJson)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get feature session %s: %w", id, ErrFeatureSessionNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature session %s: %w", id, err)
+	}
+
+	err = json.Unmarshal([]byte(messagesJson), &session.Messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feature session %s messages json: %w", id, err)
+	}
+
+	return session, nil
+}
+
+func (s *SqlFeatureSessionStore) ListFeatureSessions(featureName string) ([]*FeatureSessionInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT id, feature_name, title, forked_from, created_at, updated_at
+		FROM feature_sessions
+		WHERE ? = '' OR feature_name = ?
+		ORDER BY rowid
+	`, featureName, featureName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*FeatureSessionInfo{}
+	for rows.Next() {
+		session := &FeatureSessionInfo{}
+		err := scanFeatureSessionInfo(rows, session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feature session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func scanFeatureSessionInfo(row featureRevisionScanner, session *FeatureSessionInfo, extra ...any) error {
+	var createdAt, updatedAt string
+	dest := append([]any{&session.ID, &session.FeatureName, &session.Title, &session.ForkedFrom, &createdAt, &updatedAt}, extra...)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	session.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return fmt.Errorf("invalid creation time of feature session %s: %w", session.ID, err)
+	}
+
+	session.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt)
+	if err != nil {
+		return fmt.Errorf("invalid update time of feature session %s: %w", session.ID, err)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureSessionStore) DeleteFeatureSessions(featureName string) error {
+	_, err := s.db.Exec(`DELETE FROM feature_sessions WHERE feature_name = ?`, featureName)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature %s sessions: %w", featureName, err)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureSessionStore) RenameFeatureSessions(featureName string, newName string) error {
+	_, err := s.db.Exec(`UPDATE feature_sessions SET feature_name = ? WHERE feature_name = ?`, newName, featureName)
+	if err != nil {
+		return fmt.Errorf("failed to move sessions of feature %s to %s: %w", featureName, newName, err)
+	}
+
+	return nil
+}
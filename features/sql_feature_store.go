@@ -0,0 +1,423 @@
+package features
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+var ErrStoreNotTransactional = errors.New("store does not support metadata transactions")
+
+// ITxFeatureStore is a store that can import features as part of a larger
+// metadata transaction, e.g. together with every other migrated feature.
+type ITxFeatureStore interface {
+	IFeatureStore
+	// ImportFeatureTx stores a feature whose operations are already stored.
+	ImportFeatureTx(tx *metadata.Tx, featureManifest *FeatureManifest, tsxCode []byte) error
+}
+
+// SqlFeatureStore keeps features in the metadata database. A feature is
+// written in a single transaction together with its component and operations,
+// so it is never stored partially.
+type SqlFeatureStore struct {
+	featureListeners
+	db             *metadata.DB
+	operationStore operations.ITxOperationStore
+	componentStore ITxComponentStore
+}
+
+func NewSqlFeatureStore(db *metadata.DB, operationStore operations.IOperationStore, componentStore IComponentStore) (IFeatureStore, error) {
+	txOperationStore, isTransactional := operationStore.(operations.ITxOperationStore)
+	if !isTransactional {
+		return nil, fmt.Errorf("invalid operation store: %w", ErrStoreNotTransactional)
+	}
+
+	txComponentStore, isTransactional := componentStore.(ITxComponentStore)
+	if !isTransactional {
+		return nil, fmt.Errorf("invalid component store: %w", ErrStoreNotTransactional)
+	}
+
+	return &SqlFeatureStore{
+		db:             db,
+		operationStore: txOperationStore,
+		componentStore: txComponentStore,
+	}, nil
+}
+
+func (s *SqlFeatureStore) GetAllFeatures() ([]*FeatureManifest, []*BrokenFeature, error) {
+	rows, err := s.db.Query(`SELECT name, label, description FROM features ORDER BY name`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list features: %w", err)
+	}
+	defer rows.Close()
+
+	allFeatures := []*FeatureManifest{}
+	for rows.Next() {
+		feature := &FeatureManifest{}
+		err := rows.Scan(&feature.Name, &feature.Label, &feature.Description)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read feature: %w", err)
+		}
+		allFeatures = append(allFeatures, feature)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list features: %w", err)
+	}
+
+	features := []*FeatureManifest{}
+	brokenFeatures := []*BrokenFeature{}
+	for _, feature := range allFeatures {
+		feature.Operations, err = s.getFeatureOperationNames(feature.Name)
+		if err == nil {
+			err = s.checkFeatureDependencies(feature)
+		}
+		if err != nil {
+			brokenFeatures = append(brokenFeatures, &BrokenFeature{
+				Name:       feature.Name,
+				Error:      err.Error(),
+				Operations: feature.Operations,
+			})
+			continue
+		}
+
+		features = append(features, feature)
+	}
+
+	return features, brokenFeatures, nil
+}
+
+// checkFeatureDependencies fails when the component or an operation of the
+// feature is missing, e.g. because the operation was deleted.
+func (s *SqlFeatureStore) checkFeatureDependencies(feature *FeatureManifest) error {
+	var missingComponent bool
+	var missingOperation sql.NullString
+	err := s.db.QueryRow(`
+		SELECT
+			NOT EXISTS (SELECT 1 FROM components WHERE name = ?),
+			(
+				SELECT fo.operation_name
+				FROM feature_operations fo
+				LEFT JOIN operations o ON o.name = fo.operation_name
+				WHERE fo.feature_name = ? AND o.name IS NULL
+				ORDER BY fo.position
+				LIMIT 1
+			)
+	`, feature.Name, feature.Name).Scan(&missingComponent, &missingOperation)
+	if err != nil {
+		return fmt.Errorf("failed to check dependencies of feature %s: %w", feature.Name, err)
+	}
+
+	if missingComponent {
+		return fmt.Errorf("failed to get component of feature %s: %w", feature.Name, ErrComponentNotFound)
+	}
+	if missingOperation.Valid {
+		return fmt.Errorf("failed to get operation %s of feature %s: %w", missingOperation.String, feature.Name, operations.ErrOperationNotFound)
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureStore) getFeatureManifest(name string) (*FeatureManifest, error) {
+	feature := &FeatureManifest{}
+	err := s.db.QueryRow(`SELECT name, label, description FROM features WHERE name = ?`, name).
+		Scan(&feature.Name, &feature.Label, &feature.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get feature %s: %w", name, ErrFeatureNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature %s: %w", name, err)
+	}
+
+	feature.Operations, err = s.getFeatureOperationNames(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return feature, nil
+}
+
+func (s *SqlFeatureStore) getFeatureOperationNames(featureName string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT operation_name FROM feature_operations WHERE feature_name = ? ORDER BY position
+	`, featureName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations of feature %s: %w", featureName, err)
+	}
+	defer rows.Close()
+
+	operationNames := []string{}
+	for rows.Next() {
+		var operationName string
+		err := rows.Scan(&operationName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation of feature %s: %w", featureName, err)
+		}
+		operationNames = append(operationNames, operationName)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations of feature %s: %w", featureName, err)
+	}
+
+	return operationNames, nil
+}
+
+func (s *SqlFeatureStore) GetFeature(name string) (*Feature, error) {
+	featureManifest, err := s.getFeatureManifest(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest of feature %s: %w", name, err)
+	}
+
+	operations := []*operations.Operation{}
+	for _, operationName := range featureManifest.Operations {
+
+		operation, err := s.operationStore.GetOperation(operationName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get operation %s: %w", operationName, err)
+		}
+
+		operations = append(operations, operation)
+	}
+
+	reactComponentContent, err := s.componentStore.GetComponent(featureManifest.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read component content of feature %s: %w", featureManifest.Name, err)
+	}
+
+	feature := &Feature{
+		Name:        featureManifest.Name,
+		Label:       featureManifest.Label,
+		Description: featureManifest.Description,
+		ReactComponent: &ReactComponent{
+			TsxCode: string(reactComponentContent),
+		},
+		ServerOperations: operations,
+	}
+
+	return feature, nil
+}
+
+func (s *SqlFeatureStore) AddFeature(feature *Feature) error {
+	err := s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		err := s.addFeatureManifest(tx, &FeatureManifest{
+			Name:        feature.Name,
+			Label:       feature.Label,
+			Description: feature.Description,
+			Operations:  featureOperationNames(feature),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = s.componentStore.AddComponentTx(tx, feature.Name, []byte(feature.ReactComponent.TsxCode))
+		if err != nil {
+			return fmt.Errorf("failed to store component for feature: %s: %w", feature.Name, err)
+		}
+
+		for _, operation := range feature.ServerOperations {
+			err := s.operationStore.AddOperationTx(tx, operation)
+			if err != nil {
+				return fmt.Errorf("failed to add operation %s for feature %s: %w", operation.Name, feature.Name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notifyFeatureChanged(feature.Name)
+
+	return nil
+}
+
+func (s *SqlFeatureStore) ImportFeatureTx(tx *metadata.Tx, featureManifest *FeatureManifest, tsxCode []byte) error {
+	err := s.addFeatureManifest(tx, featureManifest)
+	if err != nil {
+		return err
+	}
+
+	err = s.componentStore.AddComponentTx(tx, featureManifest.Name, tsxCode)
+	if err != nil {
+		return fmt.Errorf("failed to store component for feature: %s: %w", featureManifest.Name, err)
+	}
+
+	tx.AfterCommit(func() {
+		s.notifyFeatureChanged(featureManifest.Name)
+	})
+
+	return nil
+}
+
+func (s *SqlFeatureStore) addFeatureManifest(tx *metadata.Tx, featureManifest *FeatureManifest) error {
+	_, err := tx.Exec(`
+		INSERT INTO features (name, label, description) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET label = excluded.label, description = excluded.description
+	`, featureManifest.Name, featureManifest.Label, featureManifest.Description)
+	if err != nil {
+		return fmt.Errorf("failed to write feature %s: %w", featureManifest.Name, err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM feature_operations WHERE feature_name = ?`, featureManifest.Name)
+	if err != nil {
+		return fmt.Errorf("failed to clear operations of feature %s: %w", featureManifest.Name, err)
+	}
+
+	for position, operationName := range featureManifest.Operations {
+		_, err := tx.Exec(`
+			INSERT INTO feature_operations (feature_name, position, operation_name) VALUES (?, ?, ?)
+		`, featureManifest.Name, position, operationName)
+		if err != nil {
+			return fmt.Errorf("failed to write operation %s of feature %s: %w", operationName, featureManifest.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlFeatureStore) DeleteFeature(name string, dryRun bool) (*FeatureDeletion, error) {
+	featureManifest, err := s.getFeatureManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	otherFeaturesOperations, err := s.otherFeaturesOperations(name)
+	if err != nil {
+		return nil, err
+	}
+
+	deletion := planFeatureDeletion(featureManifest, otherFeaturesOperations)
+	deletion.DryRun = dryRun
+	if dryRun {
+		return deletion, nil
+	}
+
+	err = s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		_, err := tx.Exec(`DELETE FROM features WHERE name = ?`, name)
+		if err != nil {
+			return fmt.Errorf("failed to delete feature %s: %w", name, err)
+		}
+
+		err = s.componentStore.DeleteComponentTx(tx, name)
+		if err != nil && !errors.Is(err, ErrComponentNotFound) {
+			return fmt.Errorf("failed to delete component of feature %s: %w", name, err)
+		}
+
+		for _, operationName := range deletion.Operations {
+			err := s.operationStore.DeleteOperationTx(tx, operationName)
+			if err != nil && !errors.Is(err, operations.ErrOperationNotFound) {
+				return fmt.Errorf("failed to delete operation %s of feature %s: %w", operationName, name, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyFeatureChanged(name)
+
+	return deletion, nil
+}
+
+// otherFeaturesOperations returns the names of the operations used by every
+// feature but featureName.
+func (s *SqlFeatureStore) otherFeaturesOperations(featureName string) (map[string]bool, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT operation_name FROM feature_operations WHERE feature_name != ?
+	`, featureName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations of other features: %w", err)
+	}
+	defer rows.Close()
+
+	operationNames := map[string]bool{}
+	for rows.Next() {
+		var operationName string
+		err := rows.Scan(&operationName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation of other features: %w", err)
+		}
+		operationNames[operationName] = true
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations of other features: %w", err)
+	}
+
+	return operationNames, nil
+}
+
+func (s *SqlFeatureStore) RenameFeature(name string, newName string, dryRun bool) (*FeatureRename, error) {
+	err := validateFeatureName(newName)
+	if err != nil {
+		return nil, err
+	}
+
+	featureManifest, err := s.getFeatureManifest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.getFeatureManifest(newName)
+	if err == nil {
+		return nil, fmt.Errorf("failed to rename feature %s to %s: %w", name, newName, ErrFeatureAlreadyExists)
+	}
+	if !errors.Is(err, ErrFeatureNotFound) {
+		return nil, err
+	}
+
+	tsxCode, err := s.componentStore.GetComponent(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get component of feature %s: %w", name, err)
+	}
+
+	rename := &FeatureRename{
+		Feature: name,
+		NewName: newName,
+		DryRun:  dryRun,
+	}
+	if dryRun {
+		return rename, nil
+	}
+
+	err = s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		featureManifest.Name = newName
+		err := s.addFeatureManifest(tx, featureManifest)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM features WHERE name = ?`, name)
+		if err != nil {
+			return fmt.Errorf("failed to delete feature %s: %w", name, err)
+		}
+
+		err = s.componentStore.AddComponentTx(tx, newName, tsxCode)
+		if err != nil {
+			return fmt.Errorf("failed to store component for feature %s: %w", newName, err)
+		}
+
+		err = s.componentStore.DeleteComponentTx(tx, name)
+		if err != nil {
+			return fmt.Errorf("failed to delete component of feature %s: %w", name, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyFeatureChanged(name)
+	s.notifyFeatureChanged(newName)
+
+	return rename, nil
+}
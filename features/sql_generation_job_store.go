@@ -0,0 +1,133 @@
+package features
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+)
+
+type SqlGenerationJobStore struct {
+	db *metadata.DB
+}
+
+func NewSqlGenerationJobStore(db *metadata.DB) IGenerationJobStore {
+	return &SqlGenerationJobStore{
+		db: db,
+	}
+}
+
+func (s *SqlGenerationJobStore) SaveGenerationJob(job *GenerationJob) error {
+	_, err := s.db.Exec(`
+		INSERT INTO generation_jobs (id, status, prompt, user, context_feature_name, phase, feature_name, error, created_at, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			phase = excluded.phase,
+			feature_name = excluded.feature_name,
+			error = excluded.error,
+			started_at = excluded.started_at,
+			finished_at = excluded.finished_at
+	`, job.ID, job.Status, job.Prompt, job.User, job.ContextFeatureName, job.Phase, job.FeatureName, job.Error,
+		formatJobTime(&job.CreatedAt), formatJobTime(job.StartedAt), formatJobTime(job.FinishedAt))
+	if err != nil {
+		return fmt.Errorf("failed to write generation job %s: %w", job.ID, err)
+	}
+
+	return nil
+}
+
+func (s *SqlGenerationJobStore) GetGenerationJob(id string) (*GenerationJob, error) {
+	row := s.db.QueryRow(`
+		SELECT id, status, prompt, user, context_feature_name, phase, feature_name, error, created_at, started_at, finished_at
+		FROM generation_jobs
+		WHERE id = ?
+	`, id)
+
+	job, err := scanGenerationJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get generation job %s: %w", id, ErrGenerationJobNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generation job %s: %w", id, err)
+	}
+
+	return job, nil
+}
+
+func (s *SqlGenerationJobStore) ListGenerationJobs() ([]*GenerationJob, error) {
+	rows, err := s.db.Query(`
+		SELECT id, status, prompt, user, context_feature_name, phase, feature_name, error, created_at, started_at, finished_at
+		FROM generation_jobs
+		ORDER BY rowid
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generation jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*GenerationJob{}
+	for rows.Next() {
+		job, err := scanGenerationJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generation job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generation jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+func scanGenerationJob(row featureRevisionScanner) (*GenerationJob, error) {
+	job := &GenerationJob{}
+	var createdAt string
+	var startedAt, finishedAt sql.NullString
+
+	err := row.Scan(&job.ID, &job.Status, &job.Prompt, &job.User, &job.ContextFeatureName, &job.Phase, &job.FeatureName, &job.Error, &createdAt, &startedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid creation time of generation job %s: %w", job.ID, err)
+	}
+
+	job.StartedAt, err = parseJobTime(startedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time of generation job %s: %w", job.ID, err)
+	}
+
+	job.FinishedAt, err = parseJobTime(finishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid finish time of generation job %s: %w", job.ID, err)
+	}
+
+	return job, nil
+}
+
+func formatJobTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339Nano), Valid: true}
+}
+
+func parseJobTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,72 @@
+package features
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+)
+
+type SqlGenerationUsageStore struct {
+	db *metadata.DB
+}
+
+func NewSqlGenerationUsageStore(db *metadata.DB) IGenerationUsageStore {
+	return &SqlGenerationUsageStore{
+		db: db,
+	}
+}
+
+func (s *SqlGenerationUsageStore) AddGenerationUsage(usage *GenerationUsage) error {
+	_, err := s.db.Exec(`
+		INSERT INTO generation_usage (day, created_at, user, feature_name, model, answers, input_tokens, output_tokens, latency_ms, cost, succeeded)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, usage.CreatedAt.UTC().Format(time.DateOnly), usage.CreatedAt.UTC().Format(time.RFC3339Nano), usage.User, usage.FeatureName, usage.Model,
+		usage.Answers, usage.InputTokens, usage.OutputTokens, usage.LatencyMs, usage.Cost, usage.Succeeded)
+	if err != nil {
+		return fmt.Errorf("failed to write generation usage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SqlGenerationUsageStore) ListGenerationUsage(since time.Time) ([]*GenerationUsage, error) {
+	// created_at doesn't sort as text, since RFC3339Nano drops trailing
+	// zeros, so rows are found by day and filtered by time
+	rows, err := s.db.Query(`
+		SELECT created_at, user, feature_name, model, answers, input_tokens, output_tokens, latency_ms, cost, succeeded
+		FROM generation_usage
+		WHERE day >= ?
+		ORDER BY rowid
+	`, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generation usage: %w", err)
+	}
+	defer rows.Close()
+
+	generations := []*GenerationUsage{}
+	for rows.Next() {
+		generation := &GenerationUsage{}
+		var createdAt string
+		err := rows.Scan(&createdAt, &generation.User, &generation.FeatureName, &generation.Model, &generation.Answers,
+			&generation.InputTokens, &generation.OutputTokens, &generation.LatencyMs, &generation.Cost, &generation.Succeeded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read generation usage: %w", err)
+		}
+
+		generation.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation time of generation usage: %w", err)
+		}
+		if generation.CreatedAt.Before(since) {
+			continue
+		}
+		generations = append(generations, generation)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generation usage: %w", err)
+	}
+
+	return generations, nil
+}
@@ -2,12 +2,22 @@ package frontend
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/evanw/esbuild/pkg/api"
 	"github.com/phuslu/log"
 )
 
+var ErrTypeScriptCompilerNotFound = errors.New("typescript compiler not found, run npm install in the frontend folder")
+
 type IBuilder interface {
 	BuildFrontend() error
 	Close()
@@ -19,6 +29,14 @@ type BuilderConfig struct {
 
 	// where the build results will be outputed to
 	DestinationFolder string
+
+	// TypeScript compiler used to type check the sources before bundling, since
+	// esbuild only strips the types. Type checking is skipped when empty, and
+	// builds fail with ErrTypeScriptCompilerNotFound when it is not installed.
+	TypeScriptCompiler string
+
+	// tsconfig.json passed to the TypeScript compiler
+	TsConfig string
 }
 
 func NewBuilder(config *BuilderConfig) (IBuilder, error) {
@@ -31,15 +49,8 @@ func NewBuilder(config *BuilderConfig) (IBuilder, error) {
 		Outdir:      config.DestinationFolder,
 		JSX:         api.JSXAutomatic,
 		JSXDev:      true,
-		Loader: map[string]api.Loader{
-			".ts":   api.LoaderTS,
-			".tsx":  api.LoaderTSX,
-			".js":   api.LoaderJS,
-			".jsx":  api.LoaderJSX,
-			".css":  api.LoaderCSS,
-			".json": api.LoaderJSON,
-		},
-		Write: true,
+		Loader:      sourceLoaders,
+		Write:       true,
 	})
 
 	if err != nil {
@@ -47,17 +58,76 @@ func NewBuilder(config *BuilderConfig) (IBuilder, error) {
 	}
 
 	builder := &Builder{
-		ctx: ctx,
+		ctx:      ctx,
+		config:   config,
+		requests: make(chan chan error),
+		stopped:  make(chan struct{}),
 	}
 
+	go builder.serveBuildRequests()
+
 	return builder, nil
 }
 
+var sourceLoaders = map[string]api.Loader{
+	".ts":   api.LoaderTS,
+	".tsx":  api.LoaderTSX,
+	".js":   api.LoaderJS,
+	".jsx":  api.LoaderJSX,
+	".css":  api.LoaderCSS,
+	".json": api.LoaderJSON,
+}
+
 type Builder struct {
-	ctx api.BuildContext
+	ctx    api.BuildContext
+	config *BuilderConfig
+
+	// builds are requested through this queue and run one at a time, since
+	// the esbuild context and the output folder can't be shared by two builds
+	requests chan chan error
+	stopped  chan struct{}
 }
 
+// BuildFrontend waits for a build that starts after it is called, so the
+// bundle includes every source written before the call.
 func (b *Builder) BuildFrontend() error {
+	result := make(chan error, 1)
+	b.requests <- result
+	return <-result
+}
+
+func (b *Builder) serveBuildRequests() {
+	defer close(b.stopped)
+
+	for request := range b.requests {
+		// requests made while the previous build ran are all served by the
+		// next build, which bundles the sources as they are when it starts
+		waiting := []chan error{request}
+	collectRequests:
+		for {
+			select {
+			case request, isOpen := <-b.requests:
+				if !isOpen {
+					break collectRequests
+				}
+				waiting = append(waiting, request)
+			default:
+				break collectRequests
+			}
+		}
+
+		err := b.build()
+		for _, result := range waiting {
+			result <- err
+		}
+	}
+}
+
+func (b *Builder) build() error {
+	err := b.typeCheck()
+	if err != nil {
+		return err
+	}
 
 	buildResult := b.ctx.Rebuild()
 
@@ -67,12 +137,153 @@ func (b *Builder) BuildFrontend() error {
 
 	if len(buildResult.Errors) > 0 {
 		log.Error().Msgf("build warnings: %+v", buildResult.Errors)
-		return fmt.Errorf("build failed: %+v", buildResult.Errors)
+		return &BuildError{Stage: "build", Messages: buildMessages(buildResult.Errors)}
 	}
 
 	return nil
 }
 
+func (b *Builder) typeCheck() error {
+	shouldTypeCheck, err := checkTypeScriptCompiler(b.config)
+	if err != nil {
+		return err
+	}
+	if !shouldTypeCheck {
+		return nil
+	}
+
+	messages, err := runTypeCheck(b.config.TypeScriptCompiler, b.config.TsConfig)
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		return &BuildError{Stage: "type check", Messages: messages}
+	}
+
+	return nil
+}
+
+// checkTypeScriptCompiler tells whether the sources should be type checked,
+// failing when a compiler is configured but not installed.
+func checkTypeScriptCompiler(config *BuilderConfig) (bool, error) {
+	if len(config.TypeScriptCompiler) == 0 {
+		return false, nil
+	}
+
+	_, err := os.Stat(config.TypeScriptCompiler)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("failed to type check, %s: %w", config.TypeScriptCompiler, ErrTypeScriptCompilerNotFound)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find typescript compiler %s: %w", config.TypeScriptCompiler, err)
+	}
+
+	return true, nil
+}
+
+// runTypeCheck type checks the tsconfig.json project, returning the errors
+// found in the sources.
+func runTypeCheck(typeScriptCompiler string, project string) ([]*BuildMessage, error) {
+	output, err := exec.Command(typeScriptCompiler, "--noEmit", "--project", project).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		log.Error().Msgf("type check errors: %s", output)
+		return typeCheckMessages(string(output)), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("type check failed: %w\n%s", err, output)
+	}
+
+	return nil, nil
+}
+
+// BuildError is returned when the sources don't type check or bundle. Its
+// messages point to the source files as the tools report them, relative to
+// the working directory.
+type BuildError struct {
+	Stage    string
+	Messages []*BuildMessage
+}
+
+type BuildMessage struct {
+	File string `json:"file,omitempty"`
+	// Line and Column are 1-based, zero when unknown
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Text   string `json:"text"`
+}
+
+func (m *BuildMessage) String() string {
+	switch {
+	case len(m.File) == 0:
+		return m.Text
+	case m.Line == 0:
+		return fmt.Sprintf("%s: %s", m.File, m.Text)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", m.File, m.Line, m.Column, m.Text)
+	}
+}
+
+func (e *BuildError) Error() string {
+	messages := []string{}
+	for _, message := range e.Messages {
+		messages = append(messages, message.String())
+	}
+	return fmt.Sprintf("%s failed:\n%s", e.Stage, strings.Join(messages, "\n"))
+}
+
+func buildMessages(esbuildMessages []api.Message) []*BuildMessage {
+	messages := []*BuildMessage{}
+	for _, esbuildMessage := range esbuildMessages {
+		message := &BuildMessage{Text: esbuildMessage.Text}
+		if esbuildMessage.Location != nil {
+			message.File = esbuildMessage.Location.File
+			message.Line = esbuildMessage.Location.Line
+			// esbuild columns are 0-based
+			message.Column = esbuildMessage.Location.Column + 1
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// tsc reports errors as "src/file.tsx(12,5): error TS2322: ...", with the
+// details of an error on the following indented lines
+var typeCheckErrorRegexp = regexp.MustCompile(`^(.+)\((\d+),(\d+)\): error (.*)$`)
+
+func typeCheckMessages(output string) []*BuildMessage {
+	messages := []*BuildMessage{}
+	for _, line := range strings.Split(output, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		match := typeCheckErrorRegexp.FindStringSubmatch(line)
+		if match != nil {
+			lineNumber, _ := strconv.Atoi(match[2])
+			column, _ := strconv.Atoi(match[3])
+			messages = append(messages, &BuildMessage{
+				File:   filepath.ToSlash(match[1]),
+				Line:   lineNumber,
+				Column: column,
+				Text:   match[4],
+			})
+			continue
+		}
+
+		if len(messages) > 0 && strings.HasPrefix(line, " ") {
+			lastMessage := messages[len(messages)-1]
+			lastMessage.Text += "\n" + strings.TrimSpace(line)
+			continue
+		}
+
+		messages = append(messages, &BuildMessage{Text: strings.TrimSpace(line)})
+	}
+	return messages
+}
+
 func (b *Builder) Close() {
+	close(b.requests)
+	<-b.stopped
 	b.ctx.Dispose()
 }
@@ -0,0 +1,268 @@
+package frontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// ISourceChecker type checks and bundles sources that are not part of the
+// frontend yet, leaving the frontend sources and bundle untouched.
+type ISourceChecker interface {
+	// CheckSources writes sources, keyed by their path relative to the
+	// frontend src folder, to a scratch folder, then type checks them and
+	// bundles entrypoint. Packages are not bundled, only type checked.
+	CheckSources(sources map[string]string, entrypoint string) (*SourceCheck, error)
+	// CheckFrontend copies the frontend sources to a scratch folder, adding
+	// or replacing sources there, then type checks them and bundles the
+	// frontend entrypoint, so changes are checked with every component before
+	// any of them is written. Nothing is checked without an entrypoint.
+	CheckFrontend(sources map[string]string) (*SourceCheck, error)
+}
+
+type SourceCheck struct {
+	// Messages are the type check and bundle errors, their files are relative
+	// to the scratch folder, like the sources keys
+	Messages []*BuildMessage
+	// Exports are the names exported by the entrypoint, "default" included
+	Exports []string
+}
+
+func NewSourceChecker(config *BuilderConfig) ISourceChecker {
+	return &SourceChecker{
+		config: config,
+	}
+}
+
+type SourceChecker struct {
+	config *BuilderConfig
+}
+
+func (c *SourceChecker) CheckSources(sources map[string]string, entrypoint string) (*SourceCheck, error) {
+	scratchFolder, err := c.createScratchFolder()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratchFolder)
+
+	err = writeSources(scratchFolder, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.check(scratchFolder, entrypoint)
+}
+
+func (c *SourceChecker) CheckFrontend(sources map[string]string) (*SourceCheck, error) {
+	if len(c.config.Entrypoint) == 0 {
+		return &SourceCheck{Messages: []*BuildMessage{}, Exports: []string{}}, nil
+	}
+
+	scratchFolder, err := c.createScratchFolder()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratchFolder)
+
+	sourceFolder := filepath.Dir(c.config.Entrypoint)
+	err = copySources(sourceFolder, scratchFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeSources(scratchFolder, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	entrypoint, err := filepath.Rel(sourceFolder, c.config.Entrypoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find entrypoint %s: %w", c.config.Entrypoint, err)
+	}
+
+	return c.check(scratchFolder, filepath.ToSlash(entrypoint))
+}
+
+// writeSources writes sources, keyed by their slash separated path, to
+// folder.
+func writeSources(folder string, sources map[string]string) error {
+	for sourcePath, source := range sources {
+		sourceFile := filepath.Join(folder, filepath.FromSlash(sourcePath))
+		err := os.MkdirAll(filepath.Dir(sourceFile), 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create folder of source %s: %w", sourcePath, err)
+		}
+		err = os.WriteFile(sourceFile, []byte(source), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write source %s: %w", sourcePath, err)
+		}
+	}
+
+	return nil
+}
+
+// copySources copies the files of sourceFolder to folder.
+func copySources(sourceFolder string, folder string) error {
+	err := filepath.WalkDir(sourceFolder, func(sourceFile string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativeFile, err := filepath.Rel(sourceFolder, sourceFile)
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(folder, relativeFile)
+
+		if entry.IsDir() {
+			return os.MkdirAll(file, 0755)
+		}
+
+		content, err := os.ReadFile(sourceFile)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(file, content, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy frontend sources: %w", err)
+	}
+
+	return nil
+}
+
+// check type checks the sources in scratchFolder and bundles entrypoint.
+func (c *SourceChecker) check(scratchFolder string, entrypoint string) (*SourceCheck, error) {
+	check := &SourceCheck{
+		Messages: []*BuildMessage{},
+		Exports:  []string{},
+	}
+
+	shouldTypeCheck, err := checkTypeScriptCompiler(c.config)
+	if err != nil {
+		return nil, err
+	}
+	if shouldTypeCheck {
+		messages, err := c.typeCheck(scratchFolder)
+		if err != nil {
+			return nil, err
+		}
+		check.Messages = append(check.Messages, messages...)
+	}
+
+	buildResult := api.Build(api.BuildOptions{
+		EntryPoints: []string{filepath.Join(scratchFolder, filepath.FromSlash(entrypoint))},
+		Bundle:      true,
+		Format:      api.FormatESModule,
+		Outdir:      filepath.Join(scratchFolder, "out"),
+		JSX:         api.JSXAutomatic,
+		Loader:      sourceLoaders,
+		Packages:    api.PackagesExternal,
+		Metafile:    true,
+		Write:       false,
+	})
+	check.Messages = append(check.Messages, buildMessages(buildResult.Errors)...)
+
+	if len(buildResult.Errors) == 0 {
+		check.Exports, err = entrypointExports(buildResult.Metafile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, message := range check.Messages {
+		message.File = relativeSourcePath(scratchFolder, message.File)
+	}
+
+	return check, nil
+}
+
+// createScratchFolder creates the folder the sources are checked in. It is
+// next to tsconfig.json, so packages resolve from the frontend node_modules.
+func (c *SourceChecker) createScratchFolder() (string, error) {
+	parentFolder := os.TempDir()
+	if len(c.config.TsConfig) > 0 {
+		parentFolder = filepath.Dir(c.config.TsConfig)
+	}
+
+	scratchFolder, err := os.MkdirTemp(parentFolder, ".check-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create source check folder: %w", err)
+	}
+
+	return scratchFolder, nil
+}
+
+func (c *SourceChecker) typeCheck(scratchFolder string) ([]*BuildMessage, error) {
+	baseTsConfig, err := filepath.Abs(c.config.TsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", c.config.TsConfig, err)
+	}
+
+	// the compiler options are the frontend ones, only the sources change
+	tsConfig, err := json.Marshal(map[string]any{
+		"extends": baseTsConfig,
+		"include": []string{"./**/*.ts", "./**/*.tsx"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode source check tsconfig.json: %w", err)
+	}
+
+	tsConfigFile := filepath.Join(scratchFolder, "tsconfig.json")
+	err = os.WriteFile(tsConfigFile, tsConfig, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write source check tsconfig.json: %w", err)
+	}
+
+	return runTypeCheck(c.config.TypeScriptCompiler, tsConfigFile)
+}
+
+func entrypointExports(metafile string) ([]string, error) {
+	var metadata struct {
+		Outputs map[string]struct {
+			EntryPoint string   `json:"entryPoint"`
+			Exports    []string `json:"exports"`
+		} `json:"outputs"`
+	}
+	err := json.Unmarshal([]byte(metafile), &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read esbuild metafile: %w", err)
+	}
+
+	for _, output := range metadata.Outputs {
+		if len(output.EntryPoint) > 0 {
+			return output.Exports, nil
+		}
+	}
+
+	return []string{}, nil
+}
+
+// relativeSourcePath makes the files reported by tsc and esbuild, which are
+// relative to the working directory, relative to the scratch folder.
+func relativeSourcePath(scratchFolder string, file string) string {
+	if len(file) == 0 {
+		return file
+	}
+
+	absoluteScratchFolder, err := filepath.Abs(scratchFolder)
+	if err != nil {
+		return file
+	}
+	absoluteFile, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+
+	relativeFile, err := filepath.Rel(absoluteScratchFolder, absoluteFile)
+	if err != nil || strings.HasPrefix(relativeFile, "..") {
+		return file
+	}
+
+	return filepath.ToSlash(relativeFile)
+}
@@ -105,6 +105,7 @@ function CreateViewForm({
   });
 
   const [isSubmitting, setIsSubmitting] = useState(false);
+  const [progress, setProgress] = useState<GenerationProgress | null>(null);
   async function onSubmit(data: CreateViewData) {
     if (isSubmitting) {
       return;
@@ -116,6 +117,7 @@ function CreateViewForm({
     }
 
     setIsSubmitting(true);
+    setProgress(null);
 
     try {
       const body = new URLSearchParams();
@@ -123,27 +125,41 @@ function CreateViewForm({
       if (currentFeatureName != null) {
         body.set("feature", currentFeatureName);
       }
-      const response = await fetch("/create-feature", {
+      const response = await fetch("/create-feature/stream", {
         method: "post",
         headers: {
           "Content-Type": "application/x-www-form-urlencoded",
         },
         body: body,
       });
-      if (!response.ok) {
+      if (!response.ok || response.body == null) {
         const message = await response.text();
         throw new Error(`[${response.status}] ${message}`);
       }
 
-      const feature = await response.json();
-      console.log(feature);
+      let tokens = 0;
+      for await (const event of readGenerationEvents(response.body)) {
+        if (event.phase === "tokens") {
+          tokens += event.text?.length ?? 0;
+          setProgress({ phase: event.phase, tokens });
+        } else if (event.phase === "error") {
+          throw new Error(event.error);
+        } else if (event.phase === "done") {
+          console.log(event.feature);
+          onFeatureCreated(event.feature);
+          return;
+        } else {
+          setProgress({ phase: event.phase, tokens });
+        }
+      }
 
-      onFeatureCreated(feature);
+      throw new Error("feature generation stopped unexpectedly");
     } catch (error) {
       alert((error as Error).message);
       console.error(error);
     } finally {
       setIsSubmitting(false);
+      setProgress(null);
     }
   }
 
@@ -164,7 +180,7 @@ function CreateViewForm({
         </Button>
       </Form>
       {isSubmitting ? (
-        <Loader />
+        <Loader progress={progress} />
       ) : (
         promptInstructions != null && (
           <Row className="justify-content-center">
@@ -176,12 +192,77 @@ function CreateViewForm({
   );
 }
 
-function Loader() {
+const phaseDescriptions: Record<string, string> = {
+  prompt_built: "Asking the AI",
+  tokens: "Writing the feature",
+  parsed: "Reading the feature",
+  validated: "Checking the feature",
+  tested: "Trying the operations",
+  repairing: "Fixing the problems found",
+  stored: "Saving the feature",
+  bundle_built: "Building the page",
+};
+
+type GenerationProgress = {
+  phase: string;
+  tokens: number;
+};
+interface LoaderProps {
+  progress: GenerationProgress | null;
+}
+function Loader({ progress }: LoaderProps) {
   return (
-    <Row className="justify-content-center">
+    <Row className="justify-content-center align-items-center mt-3">
       <Col xs="auto">
         <Spinner animation="grow" variant="success" />
       </Col>
+      {progress != null && (
+        <Col xs="auto">
+          {phaseDescriptions[progress.phase] ?? progress.phase}
+          {progress.tokens > 0 && (
+            <small className="text-muted ms-2">
+              {progress.tokens} characters
+            </small>
+          )}
+        </Col>
+      )}
     </Row>
   );
 }
+
+type GenerationEvent = {
+  phase: string;
+  text?: string;
+  feature?: Feature;
+  error?: string;
+};
+// readGenerationEvents parses the Server-Sent Events of /create-feature/stream
+async function* readGenerationEvents(
+  body: ReadableStream<Uint8Array>
+): AsyncGenerator<GenerationEvent> {
+  const reader = body.pipeThrough(new TextDecoderStream()).getReader();
+  let buffer = "";
+  while (true) {
+    const { value, done } = await reader.read();
+    if (done) {
+      return;
+    }
+    buffer += value;
+
+    let end = buffer.indexOf("\n\n");
+    while (end >= 0) {
+      const message = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+      end = buffer.indexOf("\n\n");
+
+      const data = message
+        .split("\n")
+        .filter((line) => line.startsWith("data:"))
+        .map((line) => line.slice("data:".length).trim())
+        .join("\n");
+      if (data.length > 0) {
+        yield JSON.parse(data);
+      }
+    }
+  }
+}
@@ -0,0 +1,131 @@
+// Generated from the operation manifests whenever an operation is stored. DO NOT EDIT.
+
+export type OperationValidationError = {
+  path: string;
+  message: string;
+};
+
+export class OperationError extends Error {
+  constructor(
+    message: string,
+    readonly status: number,
+    readonly errors: OperationValidationError[] = [],
+  ) {
+    super(message);
+    this.name = "OperationError";
+  }
+}
+
+type OperationResponse<T> =
+  | { success: true; result: T }
+  | { success: false; message: string; errors?: OperationValidationError[] };
+
+async function executeOperation<T>(name: string, parameters: unknown): Promise<T> {
+  const response = await fetch(`/operations/execute/${name}`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ parameters }),
+  });
+
+  const body = (await response.json()) as OperationResponse<T>;
+  if (!body.success) {
+    throw new OperationError(body.message, response.status, body.errors);
+  }
+
+  return body.result;
+}
+
+export type CreateTaskParameters = {
+  description: string;
+  due_date: string | null;
+  priority: number;
+  title: string;
+  user_ids: Array<number>;
+};
+
+export type CreateTaskResult = {
+  success: boolean;
+  task_id: number;
+};
+
+export function createTask(parameters: CreateTaskParameters): Promise<CreateTaskResult> {
+  return executeOperation("create-task", parameters);
+}
+
+export type GetTaskStatisticsParameters = Record<string, unknown>;
+
+export type GetTaskStatisticsResult = {
+  priorityCounts: Array<{
+    count: number;
+    priority: number;
+  }>;
+  statusCounts: Array<{
+    count: number;
+    status: string;
+  }>;
+  totalTasks: number;
+  upcomingTasks: Array<{
+    due_date: string;
+    id: number;
+    status: string;
+    title: string;
+  }>;
+};
+
+export function getTaskStatistics(parameters: GetTaskStatisticsParameters = {}): Promise<GetTaskStatisticsResult> {
+  return executeOperation("get-task-statistics", parameters);
+}
+
+export type GetTasksParameters = Record<string, unknown>;
+
+export type GetTasksResult = {
+  tasks: Array<{
+    description: string;
+    due_date: string | null;
+    id: number;
+    priority: number;
+    status: string;
+    title: string;
+    users: Array<{
+      email: string;
+      id: number;
+      name: string;
+    }>;
+  }>;
+};
+
+export function getTasks(parameters: GetTasksParameters = {}): Promise<GetTasksResult> {
+  return executeOperation("get-tasks", parameters);
+}
+
+export type GetUsersParameters = Record<string, unknown>;
+
+export type GetUsersResult = {
+  users: Array<{
+    email: string;
+    id: number;
+    name: string;
+  }>;
+};
+
+export function getUsers(parameters: GetUsersParameters = {}): Promise<GetUsersResult> {
+  return executeOperation("get-users", parameters);
+}
+
+export type UpdateTaskStatusParameters = {
+  status: string;
+  task_id: number;
+};
+
+export type UpdateTaskStatusResult = {
+  status: string;
+  success: boolean;
+  task_id: number;
+};
+
+export function updateTaskStatus(parameters: UpdateTaskStatusParameters): Promise<UpdateTaskStatusResult> {
+  return executeOperation("update-task-status", parameters);
+}
+
@@ -0,0 +1,50 @@
+package http_server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+)
+
+// AIGeneratorConfigFromEnv reads AI_PROVIDER (anthropic, openai or replay,
+// defaults to anthropic), AI_MODEL, AI_MAX_TOKENS, AI_TEMPERATURE, AI_BASE_URL,
+// AI_API_KEY, AI_DISABLE_TOOLS (true asks for answers in text, for models
+// without tool calling), AI_CASSETTE, AI_RECORD (true records the answers to
+// AI_CASSETTE) and AI_REPLAY_FALLBACK. Unset variables keep the provider
+// defaults.
+func AIGeneratorConfigFromEnv() (*features.AIGeneratorConfig, error) {
+	config := &features.AIGeneratorConfig{
+		Provider: features.AIProvider(os.Getenv("AI_PROVIDER")),
+		Model:    os.Getenv("AI_MODEL"),
+		BaseURL:  os.Getenv("AI_BASE_URL"),
+		APIKey:   os.Getenv("AI_API_KEY"),
+
+		DisableTools: os.Getenv("AI_DISABLE_TOOLS") == "true",
+
+		CassettePath:   os.Getenv("AI_CASSETTE"),
+		Record:         os.Getenv("AI_RECORD") == "true",
+		ReplayFallback: features.ReplayFallback(os.Getenv("AI_REPLAY_FALLBACK")),
+	}
+
+	maxTokens := os.Getenv("AI_MAX_TOKENS")
+	if len(maxTokens) > 0 {
+		value, err := strconv.Atoi(maxTokens)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AI_MAX_TOKENS %q: %w", maxTokens, err)
+		}
+		config.MaxTokens = value
+	}
+
+	temperature := os.Getenv("AI_TEMPERATURE")
+	if len(temperature) > 0 {
+		value, err := strconv.ParseFloat(temperature, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AI_TEMPERATURE %q: %w", temperature, err)
+		}
+		config.Temperature = &value
+	}
+
+	return config, nil
+}
@@ -0,0 +1,24 @@
+package http_server
+
+import (
+	"fmt"
+
+	"github.com/victormf2/gosyringe"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+)
+
+// CollectOrphanedOperations deletes the operations no feature uses, from the
+// store backend the server is configured with. Only the stores are set up, so
+// it runs without the AI and usage configuration the server needs.
+func CollectOrphanedOperations(dryRun bool) (*features.GarbageCollection, error) {
+	container := gosyringe.NewContainer()
+	RegisterStorageServices(container)
+
+	dependencyTracker, err := gosyringe.Resolve[features.IDependencyTracker](container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to instance dependency tracker: %w", err)
+	}
+
+	return dependencyTracker.CollectOrphanedOperations(dryRun)
+}
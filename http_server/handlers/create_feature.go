@@ -1,18 +1,16 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/operations"
 	"github.com/victormf2/gosyringe"
 )
 
 func CreateFeature(container *gosyringe.Container) {
 
-	ctx := context.Background()
-
 	http.HandleFunc("/create-feature", func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
@@ -26,20 +24,10 @@ func CreateFeature(container *gosyringe.Container) {
 			return
 		}
 
-		var featureContext *features.Feature = nil
-		currentFeatureName := r.Form.Get("feature")
-		if len(currentFeatureName) > 0 {
-			featureStore, err := gosyringe.Resolve[features.IFeatureStore](container)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			featureContext, err = featureStore.GetFeature(currentFeatureName)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		featureContext, err := getFeatureContext(container, r.Form.Get("feature"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		featureGenerator, err := gosyringe.Resolve[features.IFeatureGenerator](container)
@@ -48,13 +36,48 @@ func CreateFeature(container *gosyringe.Container) {
 			return
 		}
 
-		feature, err := featureGenerator.GenerateFeature(ctx, prompt, featureContext)
+		ctx, err := generationContext(container, r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		var dryRuns []*operations.DryRunResult
+		ctx = features.WithGenerationProgress(ctx, func(event *features.GenerationEvent) {
+			if event.Phase == features.TestedPhase {
+				dryRuns = event.DryRuns
+			}
+		})
+
+		feature, err := featureGenerator.GenerateFeature(ctx, prompt, featureContext)
+		if err != nil {
+			http.Error(w, err.Error(), generationErrorStatus(err))
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(feature)
+		json.NewEncoder(w).Encode(&createFeatureResponse{Feature: feature, DryRuns: dryRuns})
 	})
 }
+
+// createFeatureResponse is the generated feature, along with the results of
+// running its operations once.
+type createFeatureResponse struct {
+	*features.Feature
+	DryRuns []*operations.DryRunResult `json:"dryRuns,omitempty"`
+}
+
+// getFeatureContext returns the feature being changed, or nil when a new
+// feature is being created.
+func getFeatureContext(container *gosyringe.Container, currentFeatureName string) (*features.Feature, error) {
+	if len(currentFeatureName) == 0 {
+		return nil, nil
+	}
+
+	featureStore, err := gosyringe.Resolve[features.IFeatureStore](container)
+	if err != nil {
+		return nil, err
+	}
+
+	return featureStore.GetFeature(currentFeatureName)
+}
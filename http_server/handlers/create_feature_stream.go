@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+// comments are sent while no event is, so proxies don't close the connection
+// during long phases such as the frontend build
+const serverSentEventsKeepAlive = 15 * time.Second
+
+func CreateFeatureStream(container *gosyringe.Container) {
+
+	// POST /create-feature/stream takes the same form as /create-feature and
+	// answers with a Server-Sent Event for each generation phase
+	http.HandleFunc("POST /create-feature/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, canFlush := w.(http.Flusher)
+		if !canFlush {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prompt := r.Form.Get("prompt")
+		if len(prompt) == 0 {
+			http.Error(w, "prompt is required", http.StatusBadRequest)
+			return
+		}
+
+		featureContext, err := getFeatureContext(container, r.Form.Get("feature"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		featureGenerator, err := gosyringe.Resolve[features.IFeatureGenerator](container)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// once the stream starts, errors can only be sent as events
+		err = checkGenerationQuota(container, r)
+		if err != nil {
+			http.Error(w, err.Error(), generationErrorStatus(err))
+			return
+		}
+
+		generationCtx, err := generationContext(container, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// disables nginx response buffering
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events := make(chan *features.GenerationEvent, 64)
+		progress := func(event *features.GenerationEvent) {
+			select {
+			case events <- event:
+			case <-r.Context().Done():
+			}
+		}
+
+		go func() {
+			defer close(events)
+
+			ctx := features.WithGenerationProgress(generationCtx, progress)
+			feature, err := featureGenerator.GenerateFeature(ctx, prompt, featureContext)
+			if err != nil {
+				log.Error().Msgf("failed to generate feature: %v", err)
+				progress(&features.GenerationEvent{Phase: features.ErrorPhase, Error: err.Error()})
+				return
+			}
+
+			progress(&features.GenerationEvent{Phase: features.DonePhase, Feature: feature})
+		}()
+
+		keepAlive := time.NewTicker(serverSentEventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, isOpen := <-events:
+				if !isOpen {
+					return
+				}
+				err = writeServerSentEvent(w, string(event.Phase), event)
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+			if err != nil {
+				log.Warn().Msgf("failed to stream feature generation: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+func writeServerSentEvent(w http.ResponseWriter, eventName string, data any) error {
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventName, err)
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventName, dataJson)
+	return err
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func DeleteFeature(container *gosyringe.Container) {
+
+	// DELETE /features/{name}?dryRun=true
+	http.HandleFunc("DELETE /features/{name}", func(w http.ResponseWriter, r *http.Request) {
+		dryRun, err := parseDryRun(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		featureManager, err := gosyringe.Resolve[features.IFeatureManager](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature manager: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		deletion, err := featureManager.DeleteFeature(r.PathValue("name"), dryRun)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to delete feature: %v", err), featureErrorStatus(err))
+			return
+		}
+
+		writeJson(w, deletion)
+	})
+}
+
+func RenameFeature(container *gosyringe.Container) {
+
+	// POST /features/{name}/rename?dryRun=true with form newName
+	http.HandleFunc("POST /features/{name}/rename", func(w http.ResponseWriter, r *http.Request) {
+		dryRun, err := parseDryRun(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		newName := r.FormValue("newName")
+		if len(newName) == 0 {
+			http.Error(w, "newName is required", http.StatusBadRequest)
+			return
+		}
+
+		featureManager, err := gosyringe.Resolve[features.IFeatureManager](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature manager: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		rename, err := featureManager.RenameFeature(r.PathValue("name"), newName, dryRun)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to rename feature: %v", err), featureErrorStatus(err))
+			return
+		}
+
+		writeJson(w, rename)
+	})
+}
+
+// parseDryRun reads the dryRun query parameter, which defaults to false.
+func parseDryRun(r *http.Request) (bool, error) {
+	dryRunValue := r.URL.Query().Get("dryRun")
+	if len(dryRunValue) == 0 {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(dryRunValue)
+	if err != nil {
+		return false, fmt.Errorf("dryRun must be true or false")
+	}
+
+	return dryRun, nil
+}
+
+func featureErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, features.ErrFeatureNotFound), errors.Is(err, features.ErrFeatureRevisionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, features.ErrInvalidFeatureName):
+		return http.StatusBadRequest
+	case errors.Is(err, features.ErrFeatureAlreadyExists), errors.Is(err, features.ErrFeatureHasRevisions):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
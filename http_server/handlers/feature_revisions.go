@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func FeatureRevisions(container *gosyringe.Container) {
+
+	// GET /features/{name}/revisions
+	http.HandleFunc("GET /features/{name}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		featureHistory, err := gosyringe.Resolve[features.IFeatureHistory](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		revisions, err := featureHistory.ListRevisions(r.PathValue("name"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list feature revisions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, revisions)
+	})
+
+	// GET /features/{name}/revisions/diff?from={revision}&to={revision}
+	http.HandleFunc("GET /features/{name}/revisions/diff", func(w http.ResponseWriter, r *http.Request) {
+		fromRevision, err := strconv.Atoi(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "from must be a revision number", http.StatusBadRequest)
+			return
+		}
+		toRevision, err := strconv.Atoi(r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "to must be a revision number", http.StatusBadRequest)
+			return
+		}
+
+		featureHistory, err := gosyringe.Resolve[features.IFeatureHistory](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		diff, err := featureHistory.DiffRevisions(r.PathValue("name"), fromRevision, toRevision)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to diff feature revisions: %v", err), featureErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(diff))
+	})
+
+	// POST /features/{name}/revisions/{revision}/rollback
+	http.HandleFunc("POST /features/{name}/revisions/{revision}/rollback", func(w http.ResponseWriter, r *http.Request) {
+		revision, err := strconv.Atoi(r.PathValue("revision"))
+		if err != nil {
+			http.Error(w, "revision must be a number", http.StatusBadRequest)
+			return
+		}
+
+		featureHistory, err := gosyringe.Resolve[features.IFeatureHistory](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		newRevision, err := featureHistory.RollbackFeature(r.PathValue("name"), revision)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to rollback feature: %v", err), featureErrorStatus(err))
+			return
+		}
+
+		writeJson(w, newRevision.FeatureRevisionInfo)
+	})
+}
+
+func writeJson(w http.ResponseWriter, value any) {
+	writeJsonStatus(w, http.StatusOK, value)
+}
+
+func writeJsonStatus(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write response JSON")
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func FeatureSessions(container *gosyringe.Container) {
+
+	// POST /sessions starts a session generating a new feature, or changing the
+	// feature in the "feature" form field
+	http.HandleFunc("POST /sessions", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		featureSessions, err := gosyringe.Resolve[features.IFeatureSessions](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		session, err := featureSessions.CreateSession(r.Form.Get("feature"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create feature session: %v", err), featureSessionErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/sessions/%s", session.ID))
+		writeJsonStatus(w, http.StatusCreated, session)
+	})
+
+	// GET /sessions?feature={name}
+	http.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		featureSessions, err := gosyringe.Resolve[features.IFeatureSessions](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		sessions, err := featureSessions.ListSessions(r.URL.Query().Get("feature"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, sessions)
+	})
+
+	// GET /sessions/{id}
+	http.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		featureSessions, err := gosyringe.Resolve[features.IFeatureSessions](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		session, err := featureSessions.GetSession(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get feature session: %v", err), featureSessionErrorStatus(err))
+			return
+		}
+
+		writeJson(w, session)
+	})
+
+	// POST /sessions/{id}/messages takes the follow-up in the "prompt" form
+	// field
+	http.HandleFunc("POST /sessions/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prompt := r.Form.Get("prompt")
+		if len(prompt) == 0 {
+			http.Error(w, "prompt is required", http.StatusBadRequest)
+			return
+		}
+
+		featureSessions, err := gosyringe.Resolve[features.IFeatureSessions](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ctx, err := generationContext(container, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		id := r.PathValue("id")
+		feature, err := featureSessions.SendPrompt(ctx, id, prompt)
+		if err != nil {
+			http.Error(w, err.Error(), featureSessionErrorStatus(err))
+			return
+		}
+
+		session, err := featureSessions.GetSession(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get feature session: %v", err), featureSessionErrorStatus(err))
+			return
+		}
+
+		writeJson(w, &sessionPromptResponse{Session: session, Feature: feature})
+	})
+
+	// POST /sessions/{id}/fork copies the feature of the session as the one in
+	// the "name" form field
+	http.HandleFunc("POST /sessions/{id}/fork", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		featureName := r.Form.Get("name")
+		if len(featureName) == 0 {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		featureSessions, err := gosyringe.Resolve[features.IFeatureSessions](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature sessions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		fork, err := featureSessions.ForkSession(r.PathValue("id"), featureName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to fork feature session: %v", err), featureSessionErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/sessions/%s", fork.ID))
+		writeJsonStatus(w, http.StatusCreated, fork)
+	})
+}
+
+// sessionPromptResponse is the feature generated by a prompt, along with the
+// session it was sent to.
+type sessionPromptResponse struct {
+	Session *features.FeatureSession `json:"session"`
+	Feature *features.Feature        `json:"feature"`
+}
+
+func featureSessionErrorStatus(err error) int {
+	invalidFeatureErr := &features.InvalidFeatureError{}
+	switch {
+	case errors.As(err, &invalidFeatureErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, features.ErrFeatureSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, features.ErrFeatureSessionBusy), errors.Is(err, features.ErrFeatureSessionHasNoFeature), errors.Is(err, features.ErrOperationAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, features.ErrGenerationQuotaExceeded):
+		return http.StatusTooManyRequests
+	}
+	return featureErrorStatus(err)
+}
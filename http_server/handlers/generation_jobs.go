@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func GenerationJobs(container *gosyringe.Container) {
+
+	// POST /jobs takes the same form as /create-feature and answers as soon as
+	// the generation is queued
+	http.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prompt := r.Form.Get("prompt")
+		if len(prompt) == 0 {
+			http.Error(w, "prompt is required", http.StatusBadRequest)
+			return
+		}
+
+		contextFeatureName := r.Form.Get("feature")
+		_, err = getFeatureContext(container, contextFeatureName)
+		if err != nil {
+			http.Error(w, err.Error(), featureErrorStatus(err))
+			return
+		}
+
+		// the quota is checked when the job is queued too, so requests over
+		// it are refused right away
+		err = checkGenerationQuota(container, r)
+		if err != nil {
+			http.Error(w, err.Error(), generationErrorStatus(err))
+			return
+		}
+
+		user, err := requestUser(container, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jobQueue, err := gosyringe.Resolve[features.IGenerationJobQueue](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance generation job queue: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		job, err := jobQueue.EnqueueJob(user, prompt, contextFeatureName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to queue generation job: %v", err), generationJobErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/jobs/%s", job.ID))
+		writeJsonStatus(w, http.StatusAccepted, job)
+	})
+
+	// GET /jobs/{id}
+	http.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		jobQueue, err := gosyringe.Resolve[features.IGenerationJobQueue](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance generation job queue: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		job, err := jobQueue.GetJob(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get generation job: %v", err), generationJobErrorStatus(err))
+			return
+		}
+
+		writeJson(w, job)
+	})
+
+	// POST /jobs/{id}/cancel
+	http.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		jobQueue, err := gosyringe.Resolve[features.IGenerationJobQueue](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance generation job queue: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		job, err := jobQueue.CancelJob(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to cancel generation job: %v", err), generationJobErrorStatus(err))
+			return
+		}
+
+		writeJson(w, job)
+	})
+}
+
+func generationJobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, features.ErrGenerationJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, features.ErrGenerationJobFinished):
+		return http.StatusConflict
+	case errors.Is(err, features.ErrGenerationQueueFull):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
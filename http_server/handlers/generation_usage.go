@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func GenerationUsage(container *gosyringe.Container) {
+
+	// GET /usage?days={days} sums the generations of the last days, today
+	// included, per day, per feature and per user. days defaults to 30.
+	http.HandleFunc("GET /usage", func(w http.ResponseWriter, r *http.Request) {
+		days := 30
+		daysParameter := r.URL.Query().Get("days")
+		if len(daysParameter) > 0 {
+			var err error
+			days, err = strconv.Atoi(daysParameter)
+			if err != nil || days < 1 {
+				http.Error(w, "days must be a positive number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		usageTracker, err := gosyringe.Resolve[features.IGenerationUsageTracker](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance generation usage tracker: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		report, err := usageTracker.Report(today.AddDate(0, 0, 1-days))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to report generation usage: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, report)
+	})
+}
+
+// requestUser returns the user a trusted proxy named in the configured
+// header, empty when no header is configured.
+func requestUser(container *gosyringe.Container, r *http.Request) (string, error) {
+	usageConfig, err := gosyringe.Resolve[*features.GenerationUsageConfig](container)
+	if err != nil {
+		return "", fmt.Errorf("failed to instance generation usage config: %w", err)
+	}
+
+	if len(usageConfig.UserHeader) == 0 {
+		return "", nil
+	}
+	return r.Header.Get(usageConfig.UserHeader), nil
+}
+
+// generationContext returns the context of a request generating a feature,
+// which accounts the generation to the user of the request.
+func generationContext(container *gosyringe.Container, r *http.Request) (context.Context, error) {
+	user, err := requestUser(container, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return features.WithGenerationUser(r.Context(), user), nil
+}
+
+// checkGenerationQuota fails when the user of the request can't generate
+// features anymore today, for requests that answer before the generation
+// starts.
+func checkGenerationQuota(container *gosyringe.Container, r *http.Request) error {
+	user, err := requestUser(container, r)
+	if err != nil {
+		return err
+	}
+
+	usageTracker, err := gosyringe.Resolve[features.IGenerationUsageTracker](container)
+	if err != nil {
+		return fmt.Errorf("failed to instance generation usage tracker: %w", err)
+	}
+
+	return usageTracker.CheckQuota(user)
+}
+
+func generationErrorStatus(err error) int {
+	if errors.Is(err, features.ErrGenerationQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
@@ -19,15 +19,20 @@ func GetAllFeatures(container *gosyringe.Container) {
 			return
 		}
 
-		features, err := featureStore.GetAllFeatures()
+		features, brokenFeatures, err := featureStore.GetAllFeatures()
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failed to get all features: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		for _, brokenFeature := range brokenFeatures {
+			log.Warn().Msgf("skipping broken feature %s: %s", brokenFeature.Name, brokenFeature.Error)
+		}
+
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(map[string]any{
-			"features": features,
+			"features":       features,
+			"brokenFeatures": brokenFeatures,
 		})
 		if err != nil {
 			log.Error().Err(fmt.Errorf("failed to write features JSON: %w", err))
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func OperationsDependencies(container *gosyringe.Container) {
+
+	http.HandleFunc("GET /operations/dependencies", func(w http.ResponseWriter, r *http.Request) {
+		dependencyTracker, err := gosyringe.Resolve[features.IDependencyTracker](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance dependency tracker: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		graph, err := dependencyTracker.BuildGraph()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to build dependency graph: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, graph)
+	})
+}
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/features"
 	"github.com/prigas-dev/backoffice-ai/operations"
 	"github.com/victormf2/gosyringe"
 )
@@ -22,17 +28,18 @@ func OperationsExecute(container *gosyringe.Container) {
 	}
 
 	type ExecuteOperationErrorResponseBody struct {
-		Success bool   `json:"success"`
-		Message string `json:"message"`
+		Success bool                         `json:"success"`
+		Message string                       `json:"message"`
+		Errors  []operations.ValidationError `json:"errors,omitempty"`
 	}
 
 	http.HandleFunc("/operations/execute/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodPost && r.Method != http.MethodGet {
 			log.Warn().Msgf("request with invalid method: %v", r.Method)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ExecuteOperationErrorResponseBody{
 				Success: false,
-				Message: "only POST method is allowed",
+				Message: "only GET and POST methods are allowed",
 			})
 			return
 		}
@@ -48,8 +55,39 @@ func OperationsExecute(container *gosyringe.Container) {
 			return
 		}
 
+		statusCode, err := checkReferencedOperation(container, operationName)
+		if err != nil {
+			log.Warn().Msgf("request for operation %s refused: %v", operationName, err)
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(ExecuteOperationErrorResponseBody{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
 		requestBody := ExecuteOperationRequestBody{}
-		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if r.Method == http.MethodGet {
+			// GET /operations/execute/{operationName}?parameters={json}
+			statusCode, err := checkQueryOperation(container, operationName)
+			if err != nil {
+				log.Warn().Msgf("invalid GET request for operation %s: %v", operationName, err)
+				w.WriteHeader(statusCode)
+				json.NewEncoder(w).Encode(ExecuteOperationErrorResponseBody{
+					Success: false,
+					Message: err.Error(),
+				})
+				return
+			}
+
+			requestBody.Parameters = map[string]any{}
+			parametersJson := r.URL.Query().Get("parameters")
+			if len(parametersJson) > 0 {
+				err = json.Unmarshal([]byte(parametersJson), &requestBody.Parameters)
+			}
+		} else {
+			err = json.NewDecoder(r.Body).Decode(&requestBody)
+		}
 		if err != nil {
 			log.Warn().Msgf("failed to parse request parameters: %v", err)
 			w.WriteHeader(http.StatusBadRequest)
@@ -71,24 +109,132 @@ func OperationsExecute(container *gosyringe.Container) {
 			return
 		}
 
-		result, err := executor.Execute(operationName, requestBody.Parameters)
+		result, err := executor.Execute(r.Context(), operationName, requestBody.Parameters)
 		if err != nil {
 			log.Error().Msgf("error on operation execution: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(ExecuteOperationErrorResponseBody{
+			responseBody := ExecuteOperationErrorResponseBody{
 				Success: false,
 				Message: fmt.Sprintf("error on operation execution: %v", err),
-			})
+			}
+
+			var argumentsErr *operations.InvalidArgumentsError
+			if errors.As(err, &argumentsErr) {
+				responseBody.Errors = argumentsErr.Errors
+			}
+
+			w.WriteHeader(getExecutionErrorStatus(err))
+			json.NewEncoder(w).Encode(responseBody)
 			return
 		}
 
-		json.NewEncoder(w).Encode(ExecuteOperationSuccessResponseBody{
+		responseBody := ExecuteOperationSuccessResponseBody{
 			Success: true,
 			Result:  result,
-		})
+		}
+
+		if r.Method == http.MethodGet {
+			err = writeCacheableJson(w, r, responseBody)
+			if err != nil {
+				log.Error().Err(err).Msgf("failed to write operation %s result", operationName)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(responseBody)
 	})
 }
 
+// checkReferencedOperation refuses operations no feature uses, which are
+// left behind when a feature is regenerated with other operations.
+func checkReferencedOperation(container *gosyringe.Container, operationName string) (int, error) {
+	dependencyTracker, err := gosyringe.Resolve[features.IDependencyTracker](container)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("error instantiating dependency tracker: %w", err)
+	}
+
+	err = dependencyTracker.CheckOperationExecutable(operationName)
+	if errors.Is(err, features.ErrOperationNotReferenced) {
+		return http.StatusForbidden, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// checkQueryOperation only lets query operations be called with GET, as GET
+// requests may be retried, prefetched and cached.
+func checkQueryOperation(container *gosyringe.Container, operationName string) (int, error) {
+	store, err := gosyringe.Resolve[operations.IOperationStore](container)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("error instantiating operation store: %w", err)
+	}
+
+	operation, err := store.GetOperation(operationName)
+	if err != nil {
+		return http.StatusNotFound, fmt.Errorf("operation %s not found: %w", operationName, err)
+	}
+
+	if !operation.IsQuery() {
+		return http.StatusMethodNotAllowed, fmt.Errorf("operation %s is not a query, it must be called with POST", operationName)
+	}
+
+	return http.StatusOK, nil
+}
+
+const queryResponseMaxAge = 5 * time.Second
+
+func writeCacheableJson(w http.ResponseWriter, r *http.Request, body any) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(content)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(hash[:16]))
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(queryResponseMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(content)
+	return err
+}
+
+// nginx's non-standard status for requests the client gave up on
+const statusClientClosedRequest = 499
+
+func getExecutionErrorStatus(err error) int {
+	var argumentsErr *operations.InvalidArgumentsError
+	if errors.As(err, &argumentsErr) {
+		return http.StatusBadRequest
+	}
+
+	var limitErr *operations.ExecutionLimitError
+	if errors.As(err, &limitErr) {
+		if limitErr.Limit == operations.TimeoutLimit {
+			return http.StatusRequestTimeout
+		}
+		return http.StatusUnprocessableEntity
+	}
+
+	var canceledErr *operations.ExecutionCanceledError
+	if errors.As(err, &canceledErr) {
+		if errors.Is(canceledErr, context.DeadlineExceeded) {
+			return http.StatusRequestTimeout
+		}
+		return statusClientClosedRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
 func getOperationName(r *http.Request) (string, error) {
 
 	pathSegments := strings.Split(
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/phuslu/log"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/victormf2/gosyringe"
+)
+
+func OperationsOpenAPI(container *gosyringe.Container) {
+
+	http.HandleFunc("/operations/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		store, err := gosyringe.Resolve[operations.IOperationStore](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance operation store: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		allOperations, _, err := store.ListOperations()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list operations: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		document := operations.NewOpenAPIDocument(operations.OpenAPIInfo{
+			Title:   "Backoffice AI operations",
+			Version: "1.0.0",
+		}, allOperations)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(document)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to write OpenAPI document JSON")
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/victormf2/gosyringe"
+)
+
+func ValidateFeature(container *gosyringe.Container) {
+
+	// POST /features/validate with a feature JSON, as generated by the AI,
+	// answers with its validation report without storing it
+	http.HandleFunc("POST /features/validate", func(w http.ResponseWriter, r *http.Request) {
+		feature := &features.Feature{}
+		err := json.NewDecoder(r.Body).Decode(feature)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid feature JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		featureValidator, err := gosyringe.Resolve[features.IFeatureValidator](container)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to instance feature validator: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		report, err := featureValidator.Validate(feature)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to validate feature: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(w, report)
+	})
+}
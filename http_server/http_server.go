@@ -3,10 +3,10 @@ package http_server
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/phuslu/log"
 	"github.com/spf13/afero"
@@ -15,6 +15,7 @@ import (
 	"github.com/prigas-dev/backoffice-ai/features"
 	"github.com/prigas-dev/backoffice-ai/frontend"
 	"github.com/prigas-dev/backoffice-ai/http_server/handlers"
+	"github.com/prigas-dev/backoffice-ai/metadata"
 	"github.com/prigas-dev/backoffice-ai/operations"
 )
 
@@ -29,13 +30,30 @@ func Start(ctx context.Context) {
 	}
 	defer db.Close()
 
+	// created before serving, so the jobs queued when the server stopped resume
+	jobQueue, err := gosyringe.Resolve[features.IGenerationJobQueue](container)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to instance generation job queue")
+	}
+	defer jobQueue.Close()
+
 	fs := http.FileServer(http.Dir("http_server/public"))
 	http.Handle("/public/", http.StripPrefix("/public/", fs))
 
 	handlers.Index()
 	handlers.OperationsExecute(container)
+	handlers.OperationsOpenAPI(container)
+	handlers.OperationsDependencies(container)
 	handlers.CreateFeature(container)
+	handlers.CreateFeatureStream(container)
+	handlers.GenerationJobs(container)
 	handlers.GetAllFeatures(container)
+	handlers.ValidateFeature(container)
+	handlers.FeatureRevisions(container)
+	handlers.FeatureSessions(container)
+	handlers.GenerationUsage(container)
+	handlers.DeleteFeature(container)
+	handlers.RenameFeature(container)
 	handlers.TestBuilder(container)
 
 	// Start the web server
@@ -51,38 +69,19 @@ func RegisterServices(c *gosyringe.Container) {
 		log.Fatal().Err(fmt.Errorf("failed to open database: %w", err))
 	}
 
-	operationsFolder := "fstore/operations"
-	err = os.MkdirAll(operationsFolder, 0755)
-	if err != nil {
-		log.Fatal().Err(fmt.Errorf("failed to create operations folder: %w", err))
-	}
-	operationsFs := afero.NewBasePathFs(afero.NewOsFs(), operationsFolder)
-
-	frontendFolder := "frontend"
-	componentsFs := afero.NewBasePathFs(afero.NewOsFs(), frontendFolder)
-
-	featuresFolder := "fstore/features"
-	err = os.MkdirAll(featuresFolder, 0755)
-	if err != nil {
-		log.Fatal().Err(fmt.Errorf("failed to create features folder: %w", err))
-	}
-	featuresFs := afero.NewBasePathFs(afero.NewOsFs(), featuresFolder)
-
 	frontendBuilderConfig := &frontend.BuilderConfig{
-		Entrypoint:        "frontend/src/main.tsx",
-		DestinationFolder: "http_server/public",
+		Entrypoint:         "frontend/src/main.tsx",
+		DestinationFolder:  "http_server/public",
+		TypeScriptCompiler: "frontend/node_modules/.bin/tsc",
+		TsConfig:           "frontend/tsconfig.json",
 	}
 
 	gosyringe.RegisterValue[*sql.DB](c, db)
 
-	gosyringe.RegisterValue[operations.OperationsFs](c, operationsFs)
-	gosyringe.RegisterSingleton[operations.IOperationStore](c, operations.NewFsOperationStore)
-	gosyringe.RegisterValue[features.ComponentsFs](c, componentsFs)
-	gosyringe.RegisterSingleton[features.IComponentStore](c, features.NewFsComponentStore)
-	gosyringe.RegisterValue[features.FeaturesFs](c, featuresFs)
-	gosyringe.RegisterSingleton[features.IFeatureStore](c, features.NewFsFeatureStore)
+	RegisterStorageServices(c)
 
 	gosyringe.RegisterSingleton[frontend.IBuilder](c, frontend.NewBuilder)
+	gosyringe.RegisterSingleton[frontend.ISourceChecker](c, frontend.NewSourceChecker)
 	gosyringe.RegisterValue[*frontend.BuilderConfig](c, frontendBuilderConfig)
 
 	gosyringe.RegisterSingleton[features.IDatabaseSchemaGenerator](c, features.NewSqliteSchemaGenerator)
@@ -98,31 +97,120 @@ These are all possible values for a task status:
 		DatabaseEngine: "sqlite3",
 	}
 	gosyringe.RegisterValue[*features.InstructionsTemplateData](c, templateData)
+	aiGeneratorConfig, err := AIGeneratorConfigFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read AI configuration")
+	}
+	gosyringe.RegisterValue[*features.AIGeneratorConfig](c, aiGeneratorConfig)
 	gosyringe.RegisterSingleton[features.IAIGenerator](c, features.NewAIGenerator)
-	// gosyringe.RegisterSingleton[features.IAIGenerator](c, NewTestAIGenerator)
 
+	gosyringe.RegisterSingleton[features.IFeatureValidator](c, features.NewFeatureValidator)
+	generationUsageConfig, err := GenerationUsageConfigFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to read usage configuration")
+	}
+	gosyringe.RegisterValue[*features.GenerationUsageConfig](c, generationUsageConfig)
+	gosyringe.RegisterSingleton[features.IGenerationUsageTracker](c, features.NewGenerationUsageTracker)
+	featureGeneratorConfig := &features.FeatureGeneratorConfig{
+		MaxAttempts: 3,
+	}
+	gosyringe.RegisterValue[*features.FeatureGeneratorConfig](c, featureGeneratorConfig)
 	gosyringe.RegisterSingleton[features.IFeatureGenerator](c, features.NewReactFeatureGenerator)
+	gosyringe.RegisterSingleton[features.IFeatureHistory](c, features.NewFeatureHistory)
+	gosyringe.RegisterSingleton[features.IFeatureManager](c, features.NewFeatureManager)
+	gosyringe.RegisterSingleton[features.IFeatureSessions](c, features.NewFeatureSessions)
+
+	generationJobsConfig := &features.GenerationJobsConfig{
+		Workers:   2,
+		QueueSize: 32,
+	}
+	gosyringe.RegisterValue[*features.GenerationJobsConfig](c, generationJobsConfig)
+	gosyringe.RegisterSingleton[features.IGenerationJobQueue](c, features.NewGenerationJobQueue)
 
+	// operations run with the default execution limits, and may raise them up
+	// to the maximum execution limits
+	operationExecutorConfig := &operations.OperationExecutorConfig{
+		RuntimePoolSize: 8,
+	}
+	gosyringe.RegisterValue[*operations.OperationExecutorConfig](c, operationExecutorConfig)
 	gosyringe.RegisterSingleton[operations.IOperationExecutor](c, operations.NewOperationExecutor)
+	gosyringe.RegisterSingleton[operations.IOperationDryRunner](c, operations.NewOperationDryRunner)
 }
 
-type TestAIGenerator struct{}
+// RegisterStorageServices registers the stores of the configured backend and
+// the dependency tracker, which is all the commands that only maintain the
+// stored features and operations need.
+func RegisterStorageServices(c *gosyringe.Container) {
+	operationsFs, err := newFolderFs(operationsFolder)
+	if err != nil {
+		log.Fatal().Err(fmt.Errorf("failed to create operations folder: %w", err))
+	}
 
-func NewTestAIGenerator() features.IAIGenerator {
-	return &TestAIGenerator{}
-}
+	componentsFs := afero.NewBasePathFs(afero.NewOsFs(), frontendFolder)
 
-func (g *TestAIGenerator) Generate(ctx context.Context, prompt string, featureContext *features.Feature) (*features.Feature, error) {
-	featureJson, err := os.ReadFile("AiGeneratedViews/kanban-board.json")
+	featuresFs, err := newFolderFs(featuresFolder)
 	if err != nil {
-		return nil, err
+		log.Fatal().Err(fmt.Errorf("failed to create features folder: %w", err))
 	}
 
-	feature := features.Feature{}
-	err = json.Unmarshal(featureJson, &feature)
+	featureRevisionsFs, err := newFolderFs(featureRevisionsFolder)
 	if err != nil {
-		return nil, err
+		log.Fatal().Err(err).Msg("failed to create feature revisions folder")
 	}
 
-	return &feature, nil
+	generationJobsFs, err := newFolderFs(generationJobsFolder)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create generation jobs folder")
+	}
+
+	featureSessionsFs, err := newFolderFs(featureSessionsFolder)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create feature sessions folder")
+	}
+
+	generationUsageFs, err := newFolderFs(generationUsageFolder)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create generation usage folder")
+	}
+
+	gosyringe.RegisterValue[features.ComponentsFs](c, componentsFs)
+
+	storeConfig := StoreConfigFromEnv()
+	switch storeConfig.Backend {
+	case SqlStoreBackend:
+		metadataDB, err := metadata.Open(storeConfig.MetadataDBPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to open metadata database")
+		}
+
+		gosyringe.RegisterValue[*metadata.DB](c, metadataDB)
+		gosyringe.RegisterSingleton[operations.IOperationStore](c, operations.NewSqlOperationStore)
+		gosyringe.RegisterSingleton[features.IComponentStore](c, features.NewSqlComponentStore)
+		gosyringe.RegisterSingleton[features.IFeatureStore](c, features.NewSqlFeatureStore)
+		gosyringe.RegisterSingleton[features.IFeatureRevisionStore](c, features.NewSqlFeatureRevisionStore)
+		gosyringe.RegisterSingleton[features.IGenerationJobStore](c, features.NewSqlGenerationJobStore)
+		gosyringe.RegisterSingleton[features.IFeatureSessionStore](c, features.NewSqlFeatureSessionStore)
+		gosyringe.RegisterSingleton[features.IGenerationUsageStore](c, features.NewSqlGenerationUsageStore)
+	default:
+		gosyringe.RegisterValue[operations.OperationsFs](c, operationsFs)
+		gosyringe.RegisterSingleton[operations.IOperationStore](c, operations.NewFsOperationStore)
+		gosyringe.RegisterSingleton[features.IComponentStore](c, features.NewFsComponentStore)
+		gosyringe.RegisterValue[features.FeaturesFs](c, featuresFs)
+		gosyringe.RegisterSingleton[features.IFeatureStore](c, features.NewFsFeatureStore)
+		gosyringe.RegisterValue[features.FeatureRevisionsFs](c, featureRevisionsFs)
+		gosyringe.RegisterSingleton[features.IFeatureRevisionStore](c, features.NewFsFeatureRevisionStore)
+		gosyringe.RegisterValue[features.GenerationJobsFs](c, generationJobsFs)
+		gosyringe.RegisterSingleton[features.IGenerationJobStore](c, features.NewFsGenerationJobStore)
+		gosyringe.RegisterValue[features.FeatureSessionsFs](c, featureSessionsFs)
+		gosyringe.RegisterSingleton[features.IFeatureSessionStore](c, features.NewFsFeatureSessionStore)
+		gosyringe.RegisterValue[features.GenerationUsageFs](c, generationUsageFs)
+		gosyringe.RegisterSingleton[features.IGenerationUsageStore](c, features.NewFsGenerationUsageStore)
+	}
+
+	dependencyConfig := &features.DependencyConfig{
+		AllowUnreferencedOperations: os.Getenv("ALLOW_UNREFERENCED_OPERATIONS") == "true",
+		GarbageCollectionMinAge:     10 * time.Minute,
+	}
+	gosyringe.RegisterValue[*features.DependencyConfig](c, dependencyConfig)
+	gosyringe.RegisterSingleton[features.IDependencyTracker](c, features.NewDependencyTracker)
 }
@@ -0,0 +1,81 @@
+package http_server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/afero"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+	"github.com/prigas-dev/backoffice-ai/metadata"
+	"github.com/prigas-dev/backoffice-ai/operations"
+)
+
+// MigrateFstore imports the features, operations, components and feature
+// revisions in fstore/ into the metadata database used by the sql store
+// backend, in a single transaction.
+func MigrateFstore() error {
+	storeConfig := StoreConfigFromEnv()
+
+	operationsFs, err := newFolderFs(operationsFolder)
+	if err != nil {
+		return err
+	}
+	featuresFs, err := newFolderFs(featuresFolder)
+	if err != nil {
+		return err
+	}
+	featureRevisionsFs, err := newFolderFs(featureRevisionsFolder)
+	if err != nil {
+		return err
+	}
+	componentsFs := afero.NewBasePathFs(afero.NewOsFs(), frontendFolder)
+
+	fsOperationStore := operations.NewFsOperationStore(operationsFs)
+	fsComponentStore := features.NewFsComponentStore(componentsFs, fsOperationStore)
+	fsFeatureStore := features.NewFsFeatureStore(featuresFs, fsOperationStore, fsComponentStore)
+
+	metadataDB, err := metadata.Open(storeConfig.MetadataDBPath)
+	if err != nil {
+		return err
+	}
+	defer metadataDB.Close()
+
+	sqlOperationStore := operations.NewSqlOperationStore(metadataDB)
+	sqlComponentStore, err := features.NewSqlComponentStore(metadataDB, componentsFs, sqlOperationStore)
+	if err != nil {
+		return err
+	}
+	sqlFeatureStore, err := features.NewSqlFeatureStore(metadataDB, sqlOperationStore, sqlComponentStore)
+	if err != nil {
+		return err
+	}
+
+	revisionFolders, err := afero.ReadDir(featureRevisionsFs, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read feature revisions folder: %w", err)
+	}
+	revisionFeatureNames := []string{}
+	for _, revisionFolder := range revisionFolders {
+		if revisionFolder.IsDir() {
+			revisionFeatureNames = append(revisionFeatureNames, revisionFolder.Name())
+		}
+	}
+
+	fsRevisionStore := features.NewFsFeatureRevisionStore(featureRevisionsFs)
+	sqlRevisionStore := features.NewSqlFeatureRevisionStore(metadataDB)
+
+	return metadataDB.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		err := features.MigrateToSql(tx, fsFeatureStore, fsOperationStore, sqlFeatureStore, sqlOperationStore)
+		if err != nil {
+			return fmt.Errorf("failed to migrate fstore to %s: %w", storeConfig.MetadataDBPath, err)
+		}
+
+		err = features.CopyFeatureRevisions(tx, revisionFeatureNames, fsRevisionStore, sqlRevisionStore)
+		if err != nil {
+			return fmt.Errorf("failed to migrate feature revisions to %s: %w", storeConfig.MetadataDBPath, err)
+		}
+
+		return nil
+	})
+}
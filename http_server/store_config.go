@@ -0,0 +1,64 @@
+package http_server
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	operationsFolder       = "fstore/operations"
+	featuresFolder         = "fstore/features"
+	featureRevisionsFolder = "fstore/feature_revisions"
+	generationJobsFolder   = "fstore/generation_jobs"
+	featureSessionsFolder  = "fstore/feature_sessions"
+	generationUsageFolder  = "fstore/generation_usage"
+	frontendFolder         = "frontend"
+)
+
+type StoreBackend string
+
+const (
+	// features, operations and components are files in fstore/
+	FsStoreBackend StoreBackend = "fs"
+
+	// features, operations and components are rows in the metadata database
+	SqlStoreBackend StoreBackend = "sql"
+)
+
+type StoreConfig struct {
+	Backend StoreBackend
+
+	// sqlite file of the metadata database, used by the sql backend
+	MetadataDBPath string
+}
+
+// StoreConfigFromEnv reads STORE_BACKEND (fs or sql, defaults to fs) and
+// METADATA_DB_PATH (defaults to metadata.db).
+func StoreConfigFromEnv() *StoreConfig {
+	config := &StoreConfig{
+		Backend:        FsStoreBackend,
+		MetadataDBPath: "metadata.db",
+	}
+
+	backend := os.Getenv("STORE_BACKEND")
+	if len(backend) > 0 {
+		config.Backend = StoreBackend(backend)
+	}
+
+	metadataDBPath := os.Getenv("METADATA_DB_PATH")
+	if len(metadataDBPath) > 0 {
+		config.MetadataDBPath = metadataDBPath
+	}
+
+	return config
+}
+
+func newFolderFs(folder string) (afero.Fs, error) {
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create folder %s: %w", folder, err)
+	}
+	return afero.NewBasePathFs(afero.NewOsFs(), folder), nil
+}
@@ -0,0 +1,72 @@
+package http_server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/prigas-dev/backoffice-ai/features"
+)
+
+// GenerationUsageConfigFromEnv reads USAGE_USER_DAILY_BUDGET and
+// USAGE_INSTANCE_DAILY_BUDGET, in USD (unset is unlimited),
+// USAGE_ESTIMATED_GENERATION_COST, in USD, what a running generation counts
+// against them,
+// AI_INPUT_PRICE and AI_OUTPUT_PRICE, in USD per million tokens, which replace
+// the default prices of every model, and USAGE_USER_HEADER, the header a
+// trusted proxy names the user with (unset is anonymous).
+func GenerationUsageConfigFromEnv() (*features.GenerationUsageConfig, error) {
+	config := &features.GenerationUsageConfig{
+		UserHeader: os.Getenv("USAGE_USER_HEADER"),
+	}
+
+	err := floatFromEnv("USAGE_USER_DAILY_BUDGET", &config.UserDailyBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	err = floatFromEnv("USAGE_INSTANCE_DAILY_BUDGET", &config.InstanceDailyBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	err = floatFromEnv("USAGE_ESTIMATED_GENERATION_COST", &config.EstimatedGenerationCost)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(os.Getenv("AI_INPUT_PRICE")) > 0 || len(os.Getenv("AI_OUTPUT_PRICE")) > 0 {
+		price := &features.ModelPrice{}
+
+		err = floatFromEnv("AI_INPUT_PRICE", &price.Input)
+		if err != nil {
+			return nil, err
+		}
+
+		err = floatFromEnv("AI_OUTPUT_PRICE", &price.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Prices = map[string]*features.ModelPrice{"": price}
+	}
+
+	return config, nil
+}
+
+// floatFromEnv parses the environment variable name into value, leaving value
+// as it is when the variable is unset.
+func floatFromEnv(name string, value *float64) error {
+	text := os.Getenv(name)
+	if len(text) == 0 {
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, text, err)
+	}
+	*value = number
+
+	return nil
+}
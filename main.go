@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/phuslu/log"
 
@@ -16,6 +18,39 @@ func main() {
 		log.Fatal().Err(fmt.Errorf("error loading .env file"))
 	}
 
+	// go run . migrate-fstore
+	if len(os.Args) > 1 && os.Args[1] == "migrate-fstore" {
+		err := http_server.MigrateFstore()
+		if err != nil {
+			log.Fatal().Err(err).Msg("migration failed")
+		}
+		log.Info().Msg("fstore migrated to the metadata database, set STORE_BACKEND=sql to use it")
+		return
+	}
+
+	// go run . gc-operations [-dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "gc-operations" {
+		flags := flag.NewFlagSet("gc-operations", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only list the operations that would be deleted")
+		flags.Parse(os.Args[2:])
+
+		collection, err := http_server.CollectOrphanedOperations(*dryRun)
+		if err != nil {
+			log.Fatal().Err(err).Msg("garbage collection failed")
+		}
+		for _, operationName := range collection.Deleted {
+			if collection.DryRun {
+				log.Info().Msgf("would delete orphaned operation %s", operationName)
+			} else {
+				log.Info().Msgf("deleted orphaned operation %s", operationName)
+			}
+		}
+		for _, operationName := range collection.Kept {
+			log.Info().Msgf("kept orphaned operation %s, it changed too recently", operationName)
+		}
+		return
+	}
+
 	ctx := context.Background()
 
 	http_server.Start(ctx)
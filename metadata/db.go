@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// DB is the database where features, operations and components are stored.
+// It is separate from the business database the operations query.
+type DB struct {
+	*sql.DB
+}
+
+//go:embed schema.sql
+var schema string
+
+// Open opens the sqlite database at path, creating the metadata tables if
+// they don't exist yet.
+func Open(path string) (*DB, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata database: %w", err)
+	}
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create metadata tables: %w", err)
+	}
+
+	return &DB{DB: db}, nil
+}
+
+// Tx is a transaction on the metadata database. Stores use AfterCommit to
+// notify listeners only once the changes are visible.
+type Tx struct {
+	*sql.Tx
+	afterCommit []func()
+}
+
+func (tx *Tx) AfterCommit(fn func()) {
+	tx.afterCommit = append(tx.afterCommit, fn)
+}
+
+// WithTx calls fn inside a transaction, which is committed when fn succeeds
+// and rolled back otherwise.
+func (db *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	sqlTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin metadata transaction: %w", err)
+	}
+
+	tx := &Tx{Tx: sqlTx}
+
+	err = fn(tx)
+	if err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+
+	err = sqlTx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit metadata transaction: %w", err)
+	}
+
+	for _, fn := range tx.afterCommit {
+		fn()
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+CREATE TABLE IF NOT EXISTS operations (
+  name TEXT PRIMARY KEY,
+  active_version INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS operation_versions (
+  operation_name TEXT NOT NULL REFERENCES operations (name) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  created_at TEXT NOT NULL,
+  manifest TEXT NOT NULL,
+  javascript_code TEXT NOT NULL,
+  PRIMARY KEY (operation_name, version)
+);
+
+CREATE TABLE IF NOT EXISTS components (
+  name TEXT PRIMARY KEY,
+  tsx_code TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS features (
+  name TEXT PRIMARY KEY,
+  label TEXT NOT NULL,
+  description TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS feature_operations (
+  feature_name TEXT NOT NULL REFERENCES features (name) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  operation_name TEXT NOT NULL,
+  PRIMARY KEY (feature_name, position)
+);
+
+CREATE TABLE IF NOT EXISTS feature_revisions (
+  feature_name TEXT NOT NULL,
+  revision INTEGER NOT NULL,
+  created_at TEXT NOT NULL,
+  prompt TEXT NOT NULL,
+  rolled_back_from INTEGER NOT NULL DEFAULT 0,
+  feature TEXT NOT NULL,
+  PRIMARY KEY (feature_name, revision)
+);
+
+CREATE TABLE IF NOT EXISTS generation_jobs (
+  id TEXT PRIMARY KEY,
+  status TEXT NOT NULL,
+  prompt TEXT NOT NULL,
+  user TEXT NOT NULL,
+  context_feature_name TEXT NOT NULL,
+  phase TEXT NOT NULL,
+  feature_name TEXT NOT NULL,
+  error TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  started_at TEXT,
+  finished_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS feature_sessions (
+  id TEXT PRIMARY KEY,
+  feature_name TEXT NOT NULL,
+  title TEXT NOT NULL,
+  forked_from TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  messages TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS generation_usage (
+  day TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  user TEXT NOT NULL,
+  feature_name TEXT NOT NULL,
+  model TEXT NOT NULL,
+  answers INTEGER NOT NULL,
+  input_tokens INTEGER NOT NULL,
+  output_tokens INTEGER NOT NULL,
+  latency_ms INTEGER NOT NULL,
+  cost REAL NOT NULL,
+  succeeded INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS generation_usage_day ON generation_usage (day);
@@ -0,0 +1,322 @@
+package operations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+var ErrNestedTransaction = errors.New("nested transactions are not supported")
+
+var ErrReadOnlyOperation = errors.New("query operations cannot write to the database")
+
+type sqlConn interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// sqlDatabase is satisfied by both *sql.DB and *sql.Conn
+type sqlDatabase interface {
+	sqlConn
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// sqlTx is satisfied by *sql.Tx and by the savepoints of dry runs
+type sqlTx interface {
+	sqlConn
+	Commit() error
+	Rollback() error
+}
+
+// openReadOnlyConn takes a connection from db where sqlite refuses any write.
+// release must be called to restore the connection before it goes back to the
+// pool.
+func openReadOnlyConn(ctx context.Context, db *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, "PRAGMA query_only = ON;")
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to set connection as read-only: %w", err)
+	}
+
+	release := func() {
+		// the operation context may be done already
+		_, err := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF;")
+		if err != nil {
+			// discards the connection instead of leaving a read-only one in the pool
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return conn, release, nil
+}
+
+// databaseGlobals are the javascript functions operations use to access the
+// database. While a transaction(fn) callback runs, every statement goes
+// through its transaction instead of the shared connection pool.
+type databaseGlobals struct {
+	ctx      context.Context
+	vm       *goja.Runtime
+	db       sqlDatabase
+	tx       sqlTx
+	readOnly bool
+
+	// beginTx starts the transactions of transaction(fn)
+	beginTx func(ctx context.Context) (sqlTx, error)
+}
+
+func newDatabaseGlobals(ctx context.Context, vm *goja.Runtime, db sqlDatabase, readOnly bool) *databaseGlobals {
+	return &databaseGlobals{
+		ctx:      ctx,
+		vm:       vm,
+		db:       db,
+		readOnly: readOnly,
+		beginTx: func(ctx context.Context) (sqlTx, error) {
+			return db.BeginTx(ctx, nil)
+		},
+	}
+}
+
+func (g *databaseGlobals) globals() map[string]any {
+	return map[string]any{
+		"query":        g.query,
+		"queryObjects": g.queryObjects,
+		"queryOne":     g.queryOne,
+		"exec":         g.exec,
+		"transaction":  g.transaction,
+	}
+}
+
+func (g *databaseGlobals) conn() sqlConn {
+	if g.tx != nil {
+		return g.tx
+	}
+	return g.db
+}
+
+func (g *databaseGlobals) query(query string, parameters ...any) ([][]any, error) {
+	_, scannedRows, err := g.scanQuery(query, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return scannedRows, nil
+}
+
+// queryObjects returns each row of the result as an object keyed by column name.
+func (g *databaseGlobals) queryObjects(query string, parameters ...any) ([]any, error) {
+	columns, scannedRows, err := g.scanQuery(query, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]any, len(scannedRows))
+	for i, values := range scannedRows {
+		objects[i] = rowToObject(columns, values)
+	}
+
+	return objects, nil
+}
+
+// queryOne returns the first row of the result as an object, or nil (null in
+// javascript) when there are no rows.
+func (g *databaseGlobals) queryOne(query string, parameters ...any) (any, error) {
+	columns, scannedRows, err := g.scanQuery(query, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scannedRows) == 0 {
+		return nil, nil
+	}
+
+	return rowToObject(columns, scannedRows[0]), nil
+}
+
+func rowToObject(columns []string, values []any) map[string]any {
+	object := make(map[string]any, len(columns))
+	for i, column := range columns {
+		object[column] = values[i]
+	}
+	return object
+}
+
+func (g *databaseGlobals) scanQuery(query string, parameters []any) ([]string, [][]any, error) {
+	rows, err := g.conn().QueryContext(g.ctx, query, parameters...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scannedRows := [][]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		scanArgs := make([]any, len(columns))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+
+		err := rows.Scan(scanArgs...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, val := range values {
+			// Ensuring byte slices are converted to string
+			if b, ok := val.([]byte); ok {
+				values[i] = string(b)
+			}
+
+			// Ensuring time.Time are converted to string
+			if t, ok := val.(time.Time); ok {
+				values[i] = t.Format(time.RFC3339)
+			}
+		}
+
+		scannedRows = append(scannedRows, values)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columns, scannedRows, nil
+}
+
+func (g *databaseGlobals) exec(query string, parameters ...any) (map[string]any, error) {
+	if g.readOnly {
+		return nil, ErrReadOnlyOperation
+	}
+
+	result, err := g.conn().ExecContext(g.ctx, query, parameters...)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"rowsAffected": rowsAffected,
+		"lastInsertId": lastInsertId,
+	}, nil
+}
+
+// transaction calls fn inside a database transaction. It commits when fn
+// returns and rolls back when fn throws. If fn returns a promise, the
+// transaction settles with it and transaction returns a promise as well.
+func (g *databaseGlobals) transaction(call goja.FunctionCall) goja.Value {
+	fn, isFunction := goja.AssertFunction(call.Argument(0))
+	if !isFunction {
+		panic(g.vm.NewTypeError("transaction expects a function"))
+	}
+
+	if g.tx != nil {
+		panic(g.vm.NewGoError(ErrNestedTransaction))
+	}
+
+	tx, err := g.beginTx(g.ctx)
+	if err != nil {
+		panic(g.vm.NewGoError(err))
+	}
+	g.tx = tx
+
+	result, err := fn(goja.Undefined())
+	if err != nil {
+		g.rollback()
+		// rethrows javascript exceptions and keeps interrupts uncatchable
+		panic(err)
+	}
+
+	promise, isPromise := result.Export().(*goja.Promise)
+	if !isPromise {
+		g.commitOrThrow()
+		return result
+	}
+
+	switch promise.State() {
+	case goja.PromiseStateFulfilled:
+		g.commitOrThrow()
+		return result
+	case goja.PromiseStateRejected:
+		g.rollback()
+		return result
+	}
+
+	transactionPromise, resolve, reject := g.vm.NewPromise()
+
+	onFulfilled := func(value goja.Value) {
+		err := g.commit()
+		if err != nil {
+			reject(g.vm.NewGoError(err))
+			return
+		}
+		resolve(value)
+	}
+	onRejected := func(reason goja.Value) {
+		g.rollback()
+		reject(reason)
+	}
+
+	then, isFunction := goja.AssertFunction(result.ToObject(g.vm).Get("then"))
+	if !isFunction {
+		g.rollback()
+		panic(g.vm.NewTypeError("transaction callback returned an invalid promise"))
+	}
+
+	_, err = then(result, g.vm.ToValue(onFulfilled), g.vm.ToValue(onRejected))
+	if err != nil {
+		g.rollback()
+		panic(err)
+	}
+
+	return g.vm.ToValue(transactionPromise)
+}
+
+func (g *databaseGlobals) commit() error {
+	tx := g.tx
+	g.tx = nil
+	return tx.Commit()
+}
+
+func (g *databaseGlobals) commitOrThrow() {
+	err := g.commit()
+	if err != nil {
+		panic(g.vm.NewGoError(err))
+	}
+}
+
+func (g *databaseGlobals) rollback() {
+	tx := g.tx
+	g.tx = nil
+	_ = tx.Rollback()
+}
+
+// close rolls back a transaction left open, e.g. by a promise that never settled.
+func (g *databaseGlobals) close() {
+	if g.tx != nil {
+		g.rollback()
+	}
+}
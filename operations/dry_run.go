@@ -0,0 +1,277 @@
+package operations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// IOperationDryRunner runs operations that are not stored yet once, with
+// synthesized arguments, to find out whether they work before users run them.
+type IOperationDryRunner interface {
+	// DryRun runs operation against the database without keeping any change.
+	// Problems of the operation are reported in the result, err is only
+	// returned when the operation couldn't be run at all.
+	DryRun(ctx context.Context, operation *Operation) (*DryRunResult, error)
+}
+
+type DryRunResult struct {
+	Operation string         `json:"operation"`
+	Kind      OperationKind  `json:"kind,omitempty"`
+	Arguments map[string]any `json:"arguments"`
+
+	// the operation was not run, because no valid arguments could be
+	// synthesized for it. The reason is in Error.
+	Skipped bool   `json:"skipped,omitempty"`
+	Success bool   `json:"success"`
+	Result  any    `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	DurationMs int64 `json:"durationMs"`
+}
+
+func (r *DryRunResult) String() string {
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("%s: skipped, %s", r.Operation, r.Error)
+	case r.Success:
+		return fmt.Sprintf("%s: ok in %dms", r.Operation, r.DurationMs)
+	default:
+		return fmt.Sprintf("%s: %s", r.Operation, r.Error)
+	}
+}
+
+func NewOperationDryRunner(db *sql.DB, config *OperationExecutorConfig) IOperationDryRunner {
+	defaultLimits, maxLimits := config.limits()
+
+	return &OperationDryRunner{
+		db:            db,
+		defaultLimits: defaultLimits,
+		maxLimits:     maxLimits,
+	}
+}
+
+// OperationDryRunner runs queries on a read-only connection, and mutations
+// inside a transaction that is always rolled back. The transactions the
+// mutations start themselves become savepoints of that transaction.
+type OperationDryRunner struct {
+	db            *sql.DB
+	defaultLimits *ExecutionLimits
+	maxLimits     *ExecutionLimits
+}
+
+func (r *OperationDryRunner) DryRun(ctx context.Context, operation *Operation) (*DryRunResult, error) {
+	result := &DryRunResult{
+		Operation: operation.Name,
+		Kind:      operation.Kind,
+		Arguments: SampleArguments(operation.Parameters),
+	}
+
+	err := validateArguments(operation.Parameters, result.Arguments)
+	if err != nil {
+		result.Skipped = true
+		result.Error = fmt.Sprintf("no valid arguments could be synthesized: %v", err)
+		return result, nil
+	}
+
+	program, err := goja.Compile(operation.Name, operation.JavascriptCode, false)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	limits := operation.Limits.Merge(r.defaultLimits).Clamp(r.maxLimits)
+
+	ctx, cancel := withExecutionTimeout(ctx, operation.Name, limits)
+	defer cancel()
+
+	vm := newRuntime()
+
+	var database *databaseGlobals
+	if operation.IsQuery() {
+		conn, release, err := openReadOnlyConn(ctx, r.db)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		database = newDatabaseGlobals(ctx, vm, conn, true)
+	} else {
+		conn, release, err := openRolledBackConn(ctx, r.db)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		database = newDatabaseGlobals(ctx, vm, conn, false)
+		database.beginTx = func(ctx context.Context) (sqlTx, error) {
+			return beginSavepoint(ctx, conn)
+		}
+	}
+	defer database.close()
+
+	startedAt := time.Now()
+	value, err := executeOperation(ctx, vm, database, operation, program, result.Arguments, limits)
+	result.DurationMs = time.Since(startedAt).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.Success = true
+	result.Result = value
+	return result, nil
+}
+
+// openRolledBackConn takes a connection from db with a transaction open on it.
+// release rolls back every change made through the connection.
+func openRolledBackConn(ctx context.Context, db *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, "BEGIN;")
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to begin dry run transaction: %w", err)
+	}
+
+	release := func() {
+		// the operation context may be done already
+		_, err := conn.ExecContext(context.Background(), "ROLLBACK;")
+		if err != nil {
+			// discards the connection instead of leaving the changes in the pool
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return conn, release, nil
+}
+
+// operations can't nest transactions, so a single savepoint name is enough
+const dryRunSavepoint = "operation_transaction"
+
+// savepointTx is the transaction of an operation being dry run, nested in the
+// dry run transaction.
+type savepointTx struct {
+	sqlConn
+	ctx context.Context
+}
+
+func beginSavepoint(ctx context.Context, conn *sql.Conn) (sqlTx, error) {
+	_, err := conn.ExecContext(ctx, "SAVEPOINT "+dryRunSavepoint+";")
+	if err != nil {
+		return nil, err
+	}
+
+	return &savepointTx{sqlConn: conn, ctx: ctx}, nil
+}
+
+func (t *savepointTx) Commit() error {
+	_, err := t.ExecContext(t.ctx, "RELEASE SAVEPOINT "+dryRunSavepoint+";")
+	return err
+}
+
+func (t *savepointTx) Rollback() error {
+	_, err := t.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT "+dryRunSavepoint+";")
+	if err != nil {
+		return err
+	}
+	_, err = t.ExecContext(t.ctx, "RELEASE SAVEPOINT "+dryRunSavepoint+";")
+	return err
+}
+
+// SampleArguments synthesizes a value for each parameter from its schema.
+// Patterns are not taken into account, so the arguments of parameters with a
+// pattern may still be invalid.
+func SampleArguments(parameters map[string]*ValueSchema) map[string]any {
+	arguments := make(map[string]any, len(parameters))
+	for name, parameter := range parameters {
+		arguments[name] = sampleValue(parameter)
+	}
+	return arguments
+}
+
+func sampleValue(schema *ValueSchema) any {
+	switch spec := schema.Spec.(type) {
+	case *StringSpec:
+		return sampleString(spec)
+	case *NumberSpec:
+		return sampleNumber(spec)
+	case *BooleanSpec:
+		return true
+	case *ObjectSpec:
+		object := make(map[string]any, len(spec.Properties))
+		for name, property := range spec.Properties {
+			object[name] = sampleValue(property)
+		}
+		return object
+	case *ArraySpec:
+		length := 1
+		if spec.MinItems != nil {
+			length = max(length, *spec.MinItems)
+		}
+		if spec.MaxItems != nil {
+			length = min(length, *spec.MaxItems)
+		}
+		array := make([]any, length)
+		for i := range array {
+			array[i] = sampleValue(spec.Items)
+		}
+		return array
+	}
+	return nil
+}
+
+func sampleString(spec *StringSpec) string {
+	if len(spec.Enum) > 0 {
+		return spec.Enum[0]
+	}
+
+	switch spec.Format {
+	case DateTimeFormat:
+		return "2024-01-01T00:00:00Z"
+	case DateFormat:
+		return "2024-01-01"
+	case EmailFormat:
+		return "user@example.com"
+	case UUIDFormat:
+		return "00000000-0000-4000-8000-000000000000"
+	}
+
+	value := "sample"
+	if spec.MinLength != nil && len(value) < *spec.MinLength {
+		value += strings.Repeat("x", *spec.MinLength-len(value))
+	}
+	if spec.MaxLength != nil && len(value) > *spec.MaxLength {
+		value = value[:*spec.MaxLength]
+	}
+	return value
+}
+
+func sampleNumber(spec *NumberSpec) float64 {
+	if len(spec.Enum) > 0 {
+		return spec.Enum[0]
+	}
+
+	value := 1.0
+	if spec.Minimum != nil && value < *spec.Minimum {
+		value = *spec.Minimum
+		if spec.Integer {
+			value = math.Ceil(value)
+		}
+	}
+	if spec.Maximum != nil && value > *spec.Maximum {
+		value = *spec.Maximum
+		if spec.Integer {
+			value = math.Floor(value)
+		}
+	}
+	return value
+}
@@ -0,0 +1,172 @@
+package operations_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationDryRunner(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	_, err = db.Exec(`
+	CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+	INSERT INTO items (name) VALUES ('a');`)
+	if err != nil {
+		panic(err)
+	}
+
+	countItems := func(t *testing.T) int {
+		var count int
+		err := db.QueryRow("SELECT count(*) FROM items;").Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+
+	numberSchema := &operations.ValueSchema{
+		Type: operations.Number,
+		Spec: &operations.NumberSpec{Nullable: true},
+	}
+
+	dryRunner := operations.NewOperationDryRunner(db, nil)
+
+	t.Run("queries", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := dryRunner.DryRun(t.Context(), &operations.Operation{
+			Name: "get-item",
+			Kind: operations.QueryKind,
+			Parameters: map[string]*operations.ValueSchema{
+				"id": {Type: operations.Number, Spec: &operations.NumberSpec{Integer: true, Minimum: ptr(1.0)}},
+			},
+			Return: &operations.ValueSchema{
+				Type: operations.String,
+				Spec: &operations.StringSpec{},
+			},
+			JavascriptCode: `function run({ id }) { return queryOne("SELECT name FROM items WHERE id = ?;", id).name }`,
+		})
+		assert.NoError(t, err)
+		assert.True(t, result.Success, result.Error)
+		assert.Equal(t, map[string]any{"id": 1.0}, result.Arguments)
+		assert.Equal(t, "a", result.Result)
+
+		result, err = dryRunner.DryRun(t.Context(), &operations.Operation{
+			Name:           "count-items",
+			Kind:           operations.QueryKind,
+			Parameters:     map[string]*operations.ValueSchema{},
+			Return:         numberSchema,
+			JavascriptCode: `function run() { return queryOne("SELECT count(*) AS total FROM item;").total }`,
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Error, "no such table: item")
+	})
+
+	t.Run("results are checked against the return schema", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := dryRunner.DryRun(t.Context(), &operations.Operation{
+			Name:           "list-items",
+			Kind:           operations.QueryKind,
+			Parameters:     map[string]*operations.ValueSchema{},
+			Return:         numberSchema,
+			JavascriptCode: `function run() { return queryObjects("SELECT * FROM items;") }`,
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, "invalid result: value is not a float64 or int64", result.Error)
+	})
+
+	t.Run("mutations are rolled back", func(t *testing.T) {
+		t.Parallel()
+
+		for _, jsCode := range []string{
+			`function run({ name }) { return exec("INSERT INTO items (name) VALUES (?);", name).rowsAffected }`,
+			`function run({ name }) {
+				return transaction(() => {
+					exec("INSERT INTO items (name) VALUES (?);", name)
+					return exec("INSERT INTO items (name) VALUES (?);", name).rowsAffected
+				})
+			}`,
+		} {
+			result, err := dryRunner.DryRun(t.Context(), &operations.Operation{
+				Name: "add-item",
+				Kind: operations.MutationKind,
+				Parameters: map[string]*operations.ValueSchema{
+					"name": {Type: operations.String, Spec: &operations.StringSpec{MinLength: ptr(10)}},
+				},
+				Return:         numberSchema,
+				JavascriptCode: jsCode,
+			})
+			assert.NoError(t, err)
+			assert.True(t, result.Success, result.Error)
+			assert.Equal(t, map[string]any{"name": "samplexxxx"}, result.Arguments)
+			assert.Equal(t, int64(1), result.Result)
+			assert.Equal(t, 1, countItems(t))
+		}
+
+		result, err := dryRunner.DryRun(t.Context(), &operations.Operation{
+			Name:           "rename-items",
+			Kind:           operations.MutationKind,
+			Parameters:     map[string]*operations.ValueSchema{},
+			Return:         numberSchema,
+			JavascriptCode: `function run() { return exec("UPDATE items SET title = 'b';").rowsAffected }`,
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Error, "no such column: title")
+	})
+
+	t.Run("arguments that can't be synthesized", func(t *testing.T) {
+		t.Parallel()
+
+		result, err := dryRunner.DryRun(t.Context(), &operations.Operation{
+			Name: "find-item",
+			Kind: operations.QueryKind,
+			Parameters: map[string]*operations.ValueSchema{
+				"code": {Type: operations.String, Spec: &operations.StringSpec{Pattern: "^[0-9]+$"}},
+			},
+			Return:         numberSchema,
+			JavascriptCode: `function run() { return 1 }`,
+		})
+		assert.NoError(t, err)
+		assert.True(t, result.Skipped)
+		assert.False(t, result.Success)
+	})
+}
+
+func TestSampleArguments(t *testing.T) {
+	t.Parallel()
+
+	parameters := map[string]*operations.ValueSchema{
+		"status":  {Type: operations.String, Spec: &operations.StringSpec{Enum: []string{"open", "closed"}}},
+		"email":   {Type: operations.String, Spec: &operations.StringSpec{Format: operations.EmailFormat}},
+		"code":    {Type: operations.String, Spec: &operations.StringSpec{MaxLength: ptr(3)}},
+		"ratio":   {Type: operations.Number, Spec: &operations.NumberSpec{Minimum: ptr(2.5)}},
+		"count":   {Type: operations.Number, Spec: &operations.NumberSpec{Integer: true, Minimum: ptr(2.5)}},
+		"done":    {Type: operations.Boolean, Spec: &operations.BooleanSpec{}},
+		"filters": {Type: operations.Object, Spec: &operations.ObjectSpec{Properties: map[string]*operations.ValueSchema{"tags": {Type: operations.Array, Spec: &operations.ArraySpec{Items: &operations.ValueSchema{Type: operations.String, Spec: &operations.StringSpec{}}, MinItems: ptr(2)}}}}},
+	}
+
+	assert.Equal(t, map[string]any{
+		"status":  "open",
+		"email":   "user@example.com",
+		"code":    "sam",
+		"ratio":   2.5,
+		"count":   3.0,
+		"done":    true,
+		"filters": map[string]any{"tags": []any{"sample", "sample"}},
+	}, operations.SampleArguments(parameters))
+}
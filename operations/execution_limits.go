@@ -0,0 +1,224 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ExecutionLimits bounds the resources a single javascript execution may use.
+// Zero values fall back to the default execution limits.
+type ExecutionLimits struct {
+	// wall-clock time the script may run, in milliseconds
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+
+	// maximum javascript function call depth
+	MaxCallStackSize int `json:"maxCallStackSize,omitempty"`
+
+	// guard against runaway scripts taking the whole server down: the script is
+	// interrupted once the process allocates more than this many bytes on the Go
+	// heap while it runs. goja has no per-runtime accounting, so allocations
+	// from concurrent work, including other scripts, count against the script
+	// too. It is not a per-script memory limit.
+	MaxProcessAllocationBytes uint64 `json:"maxProcessAllocationBytes,omitempty"`
+}
+
+// defaultExecutionLimits are the limits of scripts that don't set their own,
+// unless the OperationExecutorConfig says otherwise.
+func defaultExecutionLimits() *ExecutionLimits {
+	return &ExecutionLimits{
+		TimeoutMs:                 15_000,
+		MaxCallStackSize:          1024,
+		MaxProcessAllocationBytes: 512 << 20,
+	}
+}
+
+// maxExecutionLimits are the highest limits operations may set, unless the
+// OperationExecutorConfig says otherwise.
+func maxExecutionLimits() *ExecutionLimits {
+	return &ExecutionLimits{
+		TimeoutMs:                 60_000,
+		MaxCallStackSize:          4096,
+		MaxProcessAllocationBytes: 1 << 30,
+	}
+}
+
+func (l *ExecutionLimits) Timeout() time.Duration {
+	return time.Duration(l.TimeoutMs) * time.Millisecond
+}
+
+// Merge returns a copy of l where every zero field is taken from fallback.
+func (l *ExecutionLimits) Merge(fallback *ExecutionLimits) *ExecutionLimits {
+	merged := ExecutionLimits{}
+	if l != nil {
+		merged = *l
+	}
+	if fallback == nil {
+		return &merged
+	}
+
+	if merged.TimeoutMs == 0 {
+		merged.TimeoutMs = fallback.TimeoutMs
+	}
+	if merged.MaxCallStackSize == 0 {
+		merged.MaxCallStackSize = fallback.MaxCallStackSize
+	}
+	if merged.MaxProcessAllocationBytes == 0 {
+		merged.MaxProcessAllocationBytes = fallback.MaxProcessAllocationBytes
+	}
+
+	return &merged
+}
+
+// Clamp returns a copy of l where every field is at most the one in max. Zero
+// fields of max don't bound anything.
+func (l *ExecutionLimits) Clamp(max *ExecutionLimits) *ExecutionLimits {
+	clamped := ExecutionLimits{}
+	if l != nil {
+		clamped = *l
+	}
+	if max == nil {
+		return &clamped
+	}
+
+	if max.TimeoutMs > 0 && clamped.TimeoutMs > max.TimeoutMs {
+		clamped.TimeoutMs = max.TimeoutMs
+	}
+	if max.MaxCallStackSize > 0 && clamped.MaxCallStackSize > max.MaxCallStackSize {
+		clamped.MaxCallStackSize = max.MaxCallStackSize
+	}
+	if max.MaxProcessAllocationBytes > 0 && clamped.MaxProcessAllocationBytes > max.MaxProcessAllocationBytes {
+		clamped.MaxProcessAllocationBytes = max.MaxProcessAllocationBytes
+	}
+
+	return &clamped
+}
+
+type ExecutionLimit string
+
+const (
+	TimeoutLimit           ExecutionLimit = "timeout"
+	CallStackLimit         ExecutionLimit = "call stack"
+	ProcessAllocationLimit ExecutionLimit = "process allocation"
+)
+
+type ExecutionLimitError struct {
+	Name  string
+	Limit ExecutionLimit
+}
+
+func (e *ExecutionLimitError) Error() string {
+	return fmt.Sprintf("javascript %s exceeded the %s limit", e.Name, e.Limit)
+}
+
+// ExecutionCanceledError is returned when the context of an execution is done
+// before the script finishes, e.g. because the client went away.
+type ExecutionCanceledError struct {
+	Name string
+	Err  error
+}
+
+func (e *ExecutionCanceledError) Error() string {
+	return fmt.Sprintf("javascript %s was canceled: %v", e.Name, e.Err)
+}
+
+func (e *ExecutionCanceledError) Unwrap() error {
+	return e.Err
+}
+
+// asExecutionLimitError translates goja's uncatchable errors into an
+// *ExecutionLimitError, or returns nil if err is not caused by a limit.
+func asExecutionLimitError(name string, err error) *ExecutionLimitError {
+	var limitErr *ExecutionLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr
+	}
+
+	var stackOverflowErr *goja.StackOverflowError
+	if errors.As(err, &stackOverflowErr) {
+		return &ExecutionLimitError{Name: name, Limit: CallStackLimit}
+	}
+
+	return nil
+}
+
+// withExecutionTimeout derives a context that is done once the timeout limit
+// elapses, having an *ExecutionLimitError as its cause.
+func withExecutionTimeout(ctx context.Context, name string, limits *ExecutionLimits) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, limits.Timeout(), &ExecutionLimitError{Name: name, Limit: TimeoutLimit})
+}
+
+// contextError describes why ctx is done.
+func contextError(ctx context.Context, name string) error {
+	cause := context.Cause(ctx)
+
+	var limitErr *ExecutionLimitError
+	if errors.As(cause, &limitErr) {
+		return limitErr
+	}
+
+	return &ExecutionCanceledError{Name: name, Err: cause}
+}
+
+const allocationSampleInterval = 10 * time.Millisecond
+
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// watchdog interrupts the runtime once ctx is done or the process allocates
+// more than allowed while the script runs.
+type watchdog struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startWatchdog(ctx context.Context, vm *goja.Runtime, name string, limits *ExecutionLimits) *watchdog {
+	w := &watchdog{
+		done: make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(allocationSampleInterval)
+		defer ticker.Stop()
+
+		allocatedAtStart := readHeapAllocs()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ctx.Done():
+				vm.Interrupt(contextError(ctx, name))
+				return
+			case <-ticker.C:
+				if limits.MaxProcessAllocationBytes > 0 && readHeapAllocs()-allocatedAtStart > limits.MaxProcessAllocationBytes {
+					vm.Interrupt(&ExecutionLimitError{Name: name, Limit: ProcessAllocationLimit})
+					return
+				}
+			}
+		}
+	}()
+
+	return w
+}
+
+func (w *watchdog) stop() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+func readHeapAllocs() uint64 {
+	samples := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64()
+}
@@ -1,24 +1,126 @@
 package operations
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 
 	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
 )
 
-func ExecuteJavascript[T any](name string, script string, arguments map[string]any, globals map[string]any) (T, error) {
-	// TODO cache compiled scripts
-	vm := goja.New()
+// ExecuteJavascript compiles script and runs it with ExecuteProgram on a new
+// runtime.
+func ExecuteJavascript[T any](ctx context.Context, name string, script string, arguments map[string]any, globals map[string]any, limits *ExecutionLimits) (T, error) {
+	var zero T
+
+	program, err := goja.Compile(name, script, false)
+	if err != nil {
+		return zero, err
+	}
+
+	return ExecuteProgram[T](ctx, newRuntime(), name, program, arguments, globals, limits)
+}
+
+var ErrMissingRunFunction = errors.New("javascript does not declare a function run()")
+
+// CheckOperationScript compiles script without running it and checks that it
+// declares the run function at the top level, so broken operations are found
+// before they are stored.
+func CheckOperationScript(name string, script string) error {
+	program, err := goja.Parse(name, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = goja.CompileAST(program, false)
+	if err != nil {
+		return err
+	}
+
+	if !declaresRunFunction(program) {
+		return fmt.Errorf("%s: %w", name, ErrMissingRunFunction)
+	}
+
+	return nil
+}
+
+// declaresRunFunction looks for "function run" or a variable named run, such
+// as "const run = async () => {}".
+func declaresRunFunction(program *ast.Program) bool {
+	for _, statement := range program.Body {
+		var bindings []*ast.Binding
+		switch statement := statement.(type) {
+		case *ast.FunctionDeclaration:
+			if statement.Function.Name != nil && statement.Function.Name.Name == "run" {
+				return true
+			}
+		case *ast.VariableStatement:
+			bindings = statement.List
+		case *ast.LexicalDeclaration:
+			bindings = statement.List
+		}
+
+		for _, binding := range bindings {
+			identifier, isIdentifier := binding.Target.(*ast.Identifier)
+			if isIdentifier && identifier.Name == "run" && binding.Initializer != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ExecuteProgram runs program on vm and calls its run() function with
+// arguments. vm must not have been used before, as it keeps the state of
+// previous runs. limits may be nil, in which case the default execution limits
+// apply.
+// When a limit is exceeded the returned error is an *ExecutionLimitError, and
+// when ctx is done before the script finishes it is an *ExecutionCanceledError.
+func ExecuteProgram[T any](ctx context.Context, vm *goja.Runtime, name string, program *goja.Program, arguments map[string]any, globals map[string]any, limits *ExecutionLimits) (T, error) {
 	defer vm.Interrupt("halt")
 
-	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	limits = limits.Merge(defaultExecutionLimits())
+	vm.SetMaxCallStackSize(limits.MaxCallStackSize)
 
 	for name, value := range globals {
 		vm.Set(name, value)
 	}
 
+	ctx, cancel := withExecutionTimeout(ctx, name, limits)
+	defer cancel()
+
+	watchdog := startWatchdog(ctx, vm, name, limits)
+	result, err := runProgram[T](vm, name, program, arguments)
+	watchdog.stop()
+
+	if err != nil {
+		limitErr := asExecutionLimitError(name, err)
+		if limitErr != nil {
+			return result, limitErr
+		}
+
+		// globals such as query fail with the context error before the
+		// watchdog gets to interrupt the runtime
+		if ctx.Err() != nil {
+			return result, contextError(ctx, name)
+		}
+
+		return result, err
+	}
+
+	return result, nil
+}
+
+func newRuntime() *goja.Runtime {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	return vm
+}
+
+func runProgram[T any](vm *goja.Runtime, name string, program *goja.Program, arguments map[string]any) (T, error) {
 	var zero T
 
 	v, err := vm.RunString("Error")
@@ -27,7 +129,7 @@ func ExecuteJavascript[T any](name string, script string, arguments map[string]a
 	}
 	Error := v.ToObject(vm)
 
-	runScriptResult, err := vm.RunString(script)
+	runScriptResult, err := vm.RunProgram(program)
 	if err != nil {
 		return zero, err
 	}
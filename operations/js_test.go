@@ -1,8 +1,10 @@
 package operations_test
 
 import (
+	"context"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/prigas-dev/backoffice-ai/operations"
@@ -101,10 +103,10 @@ func TestExecuteJavascript(t *testing.T) {
 			Prigas bool   `json:"prigas"`
 		}
 
-		prigas, err := operations.ExecuteJavascript[Prigas]("",
+		prigas, err := operations.ExecuteJavascript[Prigas](t.Context(), "",
 			`function run() {
 				return { name: 'prigas', prigas: true } 
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, Prigas{Name: "prigas", Prigas: true}, prigas)
@@ -113,10 +115,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract string", func(t *testing.T) {
 		t.Parallel()
 
-		str, err := operations.ExecuteJavascript[string]("",
+		str, err := operations.ExecuteJavascript[string](t.Context(), "",
 			`function run() {
 				return 'prigas'
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, "prigas", str)
@@ -125,10 +127,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract boolean", func(t *testing.T) {
 		t.Parallel()
 
-		boolean, err := operations.ExecuteJavascript[bool]("",
+		boolean, err := operations.ExecuteJavascript[bool](t.Context(), "",
 			`function run() {
 				return true
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, true, boolean)
@@ -137,10 +139,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract integers", func(t *testing.T) {
 		t.Parallel()
 
-		integer, err := operations.ExecuteJavascript[int32]("",
+		integer, err := operations.ExecuteJavascript[int32](t.Context(), "",
 			`function run() {
 				return 32
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, int32(32), integer)
@@ -149,10 +151,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract floats", func(t *testing.T) {
 		t.Parallel()
 
-		floater, err := operations.ExecuteJavascript[float64]("",
+		floater, err := operations.ExecuteJavascript[float64](t.Context(), "",
 			`function run() {
 				return Infinity
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.True(t, math.IsInf(floater, 1))
@@ -161,10 +163,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract null from null", func(t *testing.T) {
 		t.Parallel()
 
-		nullable, err := operations.ExecuteJavascript[*int]("",
+		nullable, err := operations.ExecuteJavascript[*int](t.Context(), "",
 			`function run() {
 				return null
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Nil(t, nullable)
@@ -173,10 +175,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract null from undefined", func(t *testing.T) {
 		t.Parallel()
 
-		undefinable, err := operations.ExecuteJavascript[*int]("",
+		undefinable, err := operations.ExecuteJavascript[*int](t.Context(), "",
 			`function run() {
 				return undefined
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Nil(t, undefinable)
@@ -185,10 +187,10 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should extract Error", func(t *testing.T) {
 		t.Parallel()
 
-		_, err := operations.ExecuteJavascript[any]("",
+		_, err := operations.ExecuteJavascript[any](t.Context(), "",
 			`function run() {
 				throw new Error('banana')
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.ErrorContains(t, err, "Error: banana")
 	})
@@ -196,12 +198,12 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should resolve Promise", func(t *testing.T) {
 		t.Parallel()
 
-		result, err := operations.ExecuteJavascript[string]("",
+		result, err := operations.ExecuteJavascript[string](t.Context(), "",
 			`function run() {
 				return new Promise((resolve) => {
 					resolve('prigas')
 				})
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.NoError(t, err)
 		assert.Equal(t, "prigas", result)
@@ -210,12 +212,12 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should reject Promise", func(t *testing.T) {
 		t.Parallel()
 
-		_, err := operations.ExecuteJavascript[any]("",
+		_, err := operations.ExecuteJavascript[any](t.Context(), "",
 			`function run() {
 				return new Promise((_, reject) => {
 					reject(new Error('my error'))
 				})
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.ErrorContains(t, err, "my error")
 	})
@@ -223,12 +225,12 @@ func TestExecuteJavascript(t *testing.T) {
 	t.Run("should reject non error values", func(t *testing.T) {
 		t.Parallel()
 
-		_, err := operations.ExecuteJavascript[any]("",
+		_, err := operations.ExecuteJavascript[any](t.Context(), "",
 			`function run() {
 				return new Promise((_, reject) => {
 					reject('non error')
 				})
-			}`, map[string]any{}, map[string]any{})
+			}`, map[string]any{}, map[string]any{}, nil)
 
 		assert.ErrorContains(t, err, "non error")
 	})
@@ -242,12 +244,107 @@ func TestExecuteJavascript(t *testing.T) {
 			},
 		}
 
-		value, err := operations.ExecuteJavascript[any]("",
+		value, err := operations.ExecuteJavascript[any](t.Context(), "",
 			`function run() {
 				return banana('b')
-			}`, map[string]any{}, globals)
+			}`, map[string]any{}, globals, nil)
 		assert.NoError(t, err)
 
 		assert.Equal(t, "ab", value)
 	})
+	t.Run("should interrupt on timeout", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := operations.ExecuteJavascript[any](t.Context(), "loop",
+			`function run() {
+				while (true) {}
+			}`, map[string]any{}, map[string]any{}, &operations.ExecutionLimits{TimeoutMs: 50})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.TimeoutLimit, limitErr.Limit)
+		assert.EqualError(t, err, "javascript loop exceeded the timeout limit")
+	})
+
+	t.Run("should interrupt top level code on timeout", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := operations.ExecuteJavascript[any](t.Context(), "loop",
+			`while (true) {}
+			function run() {}`, map[string]any{}, map[string]any{}, &operations.ExecutionLimits{TimeoutMs: 50})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.TimeoutLimit, limitErr.Limit)
+	})
+
+	t.Run("should limit call stack size", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := operations.ExecuteJavascript[any](t.Context(), "recursion",
+			`function recurse(n) { return recurse(n + 1) + 1 }
+			function run() {
+				return recurse(0)
+			}`, map[string]any{}, map[string]any{}, &operations.ExecutionLimits{MaxCallStackSize: 100})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.CallStackLimit, limitErr.Limit)
+	})
+
+	t.Run("should limit process allocations", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := operations.ExecuteJavascript[any](t.Context(), "allocation",
+			`function run() {
+				const chunks = []
+				while (true) {
+					chunks.push('x'.repeat(1024) + chunks.length)
+				}
+			}`, map[string]any{}, map[string]any{}, &operations.ExecutionLimits{MaxProcessAllocationBytes: 1 << 20})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.ProcessAllocationLimit, limitErr.Limit)
+	})
+	t.Run("should interrupt when context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := operations.ExecuteJavascript[any](ctx, "loop",
+			`function run() {
+				while (true) {}
+			}`, map[string]any{}, map[string]any{}, nil)
+
+		var canceledErr *operations.ExecutionCanceledError
+		assert.ErrorAs(t, err, &canceledErr)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestCheckOperationScript(t *testing.T) {
+	t.Parallel()
+
+	for _, script := range []string{
+		`function run() { return 1 }`,
+		`async function run({ id }) { return id }`,
+		`const run = () => 1`,
+		`var run = function () { return 1 }`,
+	} {
+		assert.NoError(t, operations.CheckOperationScript("valid", script), script)
+	}
+
+	err := operations.CheckOperationScript("syntax", `function run( {`)
+	assert.ErrorContains(t, err, "syntax")
+
+	for _, script := range []string{
+		`function execute() { return 1 }`,
+		`function main() { function run() { return 1 } }`,
+		`let run`,
+	} {
+		err := operations.CheckOperationScript("missing-run", script)
+		assert.ErrorIs(t, err, operations.ErrMissingRunFunction, script)
+	}
 }
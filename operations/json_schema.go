@@ -0,0 +1,300 @@
+package operations
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var ErrUnsupportedJSONSchema = errors.New("unsupported JSON Schema")
+
+// JSONSchema is the subset of JSON Schema draft 2020-12 that can be
+// represented as a ValueSchema.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type JSONSchemaTypes `json:"type,omitempty"`
+	Enum []any           `json:"enum,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Format    string `json:"format,omitempty"`
+
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+
+	Items    *JSONSchema `json:"items,omitempty"`
+	MinItems *int        `json:"minItems,omitempty"`
+	MaxItems *int        `json:"maxItems,omitempty"`
+}
+
+type _jsonSchema JSONSchema
+
+// UnmarshalJSON rejects keywords that have no ValueSchema equivalent, instead
+// of silently dropping them.
+func (s *JSONSchema) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode((*_jsonSchema)(s))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnsupportedJSONSchema, err)
+	}
+
+	return nil
+}
+
+// JSONSchemaTypes is the "type" keyword, which is either a single type or a
+// list of types. Nullable values are represented as [type, "null"].
+type JSONSchemaTypes []string
+
+func (t JSONSchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *JSONSchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	err := json.Unmarshal(data, &single)
+	if err == nil {
+		*t = JSONSchemaTypes{single}
+		return nil
+	}
+
+	var multiple []string
+	err = json.Unmarshal(data, &multiple)
+	if err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = multiple
+	return nil
+}
+
+const (
+	jsonSchemaNull    = "null"
+	jsonSchemaInteger = "integer"
+)
+
+// ToJSONSchema converts s to an equivalent JSON Schema. FromJSONSchema converts
+// the result back to s.
+func (s *ValueSchema) ToJSONSchema() *JSONSchema {
+	schema := &JSONSchema{}
+
+	nullable := false
+
+	switch spec := s.Spec.(type) {
+	case *StringSpec:
+		nullable = spec.Nullable
+		schema.Type = JSONSchemaTypes{string(String)}
+		for _, value := range spec.Enum {
+			schema.Enum = append(schema.Enum, value)
+		}
+		schema.MinLength = spec.MinLength
+		schema.MaxLength = spec.MaxLength
+		schema.Pattern = spec.Pattern
+		schema.Format = string(spec.Format)
+	case *NumberSpec:
+		nullable = spec.Nullable
+		schema.Type = JSONSchemaTypes{string(Number)}
+		if spec.Integer {
+			schema.Type = JSONSchemaTypes{jsonSchemaInteger}
+		}
+		for _, value := range spec.Enum {
+			schema.Enum = append(schema.Enum, value)
+		}
+		schema.Minimum = spec.Minimum
+		schema.Maximum = spec.Maximum
+	case *BooleanSpec:
+		nullable = spec.Nullable
+		schema.Type = JSONSchemaTypes{string(Boolean)}
+	case *ObjectSpec:
+		nullable = spec.Nullable
+		schema.Type = JSONSchemaTypes{string(Object)}
+		schema.Properties = map[string]*JSONSchema{}
+		for _, propertyName := range slices.Sorted(maps.Keys(spec.Properties)) {
+			schema.Properties[propertyName] = spec.Properties[propertyName].ToJSONSchema()
+			if !slices.Contains(spec.Optional, propertyName) {
+				schema.Required = append(schema.Required, propertyName)
+			}
+		}
+		schema.AdditionalProperties = spec.AdditionalProperties
+	case *ArraySpec:
+		nullable = spec.Nullable
+		schema.Type = JSONSchemaTypes{string(Array)}
+		schema.Items = spec.Items.ToJSONSchema()
+		schema.MinItems = spec.MinItems
+		schema.MaxItems = spec.MaxItems
+	}
+
+	if nullable {
+		schema.Type = append(schema.Type, jsonSchemaNull)
+		// enum is checked independently of type, so null must be listed too
+		if len(schema.Enum) > 0 {
+			schema.Enum = append(schema.Enum, nil)
+		}
+	}
+
+	return schema
+}
+
+// FromJSONSchema converts a JSON Schema produced by ToJSONSchema, or written by
+// hand using the same keywords, into a ValueSchema. Optional properties are
+// listed in alphabetical order.
+func FromJSONSchema(schema *JSONSchema) (*ValueSchema, error) {
+	if len(schema.Ref) > 0 {
+		return nil, fmt.Errorf("%w: $ref is not supported", ErrUnsupportedJSONSchema)
+	}
+
+	schemaType, nullable, err := schema.valueType()
+	if err != nil {
+		return nil, err
+	}
+
+	err = schema.checkKeywords(schemaType)
+	if err != nil {
+		return nil, err
+	}
+
+	enum := slices.DeleteFunc(slices.Clone(schema.Enum), func(value any) bool { return value == nil })
+
+	switch schemaType {
+	case string(String):
+		spec := &StringSpec{
+			Nullable:  nullable,
+			MinLength: schema.MinLength,
+			MaxLength: schema.MaxLength,
+			Pattern:   schema.Pattern,
+			Format:    StringFormat(schema.Format),
+		}
+		for _, value := range enum {
+			str, isString := value.(string)
+			if !isString {
+				return nil, fmt.Errorf("%w: enum value %v is not a string", ErrUnsupportedJSONSchema, value)
+			}
+			spec.Enum = append(spec.Enum, str)
+		}
+		return &ValueSchema{Type: String, Spec: spec}, nil
+	case string(Number), jsonSchemaInteger:
+		spec := &NumberSpec{
+			Nullable: nullable,
+			Integer:  schemaType == jsonSchemaInteger,
+			Minimum:  schema.Minimum,
+			Maximum:  schema.Maximum,
+		}
+		for _, value := range enum {
+			number, isNumber := value.(float64)
+			if !isNumber {
+				return nil, fmt.Errorf("%w: enum value %v is not a number", ErrUnsupportedJSONSchema, value)
+			}
+			spec.Enum = append(spec.Enum, number)
+		}
+		return &ValueSchema{Type: Number, Spec: spec}, nil
+	case string(Boolean):
+		return &ValueSchema{Type: Boolean, Spec: &BooleanSpec{Nullable: nullable}}, nil
+	case string(Object):
+		spec := &ObjectSpec{
+			Nullable:             nullable,
+			Properties:           map[string]*ValueSchema{},
+			AdditionalProperties: schema.AdditionalProperties,
+		}
+		for _, propertyName := range slices.Sorted(maps.Keys(schema.Properties)) {
+			property, err := FromJSONSchema(schema.Properties[propertyName])
+			if err != nil {
+				return nil, fmt.Errorf("invalid property %s: %w", propertyName, err)
+			}
+			spec.Properties[propertyName] = property
+			if !slices.Contains(schema.Required, propertyName) {
+				spec.Optional = append(spec.Optional, propertyName)
+			}
+		}
+		for _, propertyName := range schema.Required {
+			_, isDeclared := schema.Properties[propertyName]
+			if !isDeclared {
+				return nil, fmt.Errorf("%w: required property %s is not declared", ErrUnsupportedJSONSchema, propertyName)
+			}
+		}
+		return &ValueSchema{Type: Object, Spec: spec}, nil
+	case string(Array):
+		if schema.Items == nil {
+			return nil, fmt.Errorf("%w: array without items", ErrUnsupportedJSONSchema)
+		}
+		items, err := FromJSONSchema(schema.Items)
+		if err != nil {
+			return nil, fmt.Errorf("invalid items: %w", err)
+		}
+		spec := &ArraySpec{
+			Nullable: nullable,
+			Items:    items,
+			MinItems: schema.MinItems,
+			MaxItems: schema.MaxItems,
+		}
+		return &ValueSchema{Type: Array, Spec: spec}, nil
+	}
+
+	return nil, fmt.Errorf("%w: type %s", ErrUnsupportedJSONSchema, schemaType)
+}
+
+// valueType returns the single non-null type of schema, and whether null is
+// allowed as well.
+func (s *JSONSchema) valueType() (string, bool, error) {
+	nullable := slices.Contains(s.Type, jsonSchemaNull)
+	types := slices.DeleteFunc(slices.Clone(s.Type), func(t string) bool { return t == jsonSchemaNull })
+
+	if len(types) != 1 {
+		return "", false, fmt.Errorf("%w: type must be a single type, optionally with null, got %v", ErrUnsupportedJSONSchema, []string(s.Type))
+	}
+
+	return types[0], nullable, nil
+}
+
+// checkKeywords fails when schema has keywords that don't apply to
+// schemaType, because a ValueSchema would have nowhere to keep them.
+func (s *JSONSchema) checkKeywords(schemaType string) error {
+	keywords := map[string]bool{
+		"enum":                 len(s.Enum) > 0,
+		"minLength":            s.MinLength != nil,
+		"maxLength":            s.MaxLength != nil,
+		"pattern":              len(s.Pattern) > 0,
+		"format":               len(s.Format) > 0,
+		"minimum":              s.Minimum != nil,
+		"maximum":              s.Maximum != nil,
+		"properties":           s.Properties != nil,
+		"required":             s.Required != nil,
+		"additionalProperties": s.AdditionalProperties != nil,
+		"items":                s.Items != nil,
+		"minItems":             s.MinItems != nil,
+		"maxItems":             s.MaxItems != nil,
+	}
+
+	allowed := map[string][]string{
+		string(String):    {"enum", "minLength", "maxLength", "pattern", "format"},
+		string(Number):    {"enum", "minimum", "maximum"},
+		jsonSchemaInteger: {"enum", "minimum", "maximum"},
+		string(Boolean):   {},
+		string(Object):    {"properties", "required", "additionalProperties"},
+		string(Array):     {"items", "minItems", "maxItems"},
+	}
+
+	for _, keyword := range slices.Sorted(maps.Keys(keywords)) {
+		if keywords[keyword] && !slices.Contains(allowed[schemaType], keyword) {
+			return fmt.Errorf("%w: keyword %s is not supported for type %s", ErrUnsupportedJSONSchema, keyword, schemaType)
+		}
+	}
+
+	return nil
+}
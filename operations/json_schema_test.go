@@ -0,0 +1,241 @@
+package operations_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		testCases := []struct {
+			desc   string
+			schema *operations.ValueSchema
+		}{
+			{
+				desc: "string",
+				schema: &operations.ValueSchema{
+					Type: operations.String,
+					Spec: &operations.StringSpec{
+						Nullable:  true,
+						Enum:      []string{"todo", "done"},
+						MinLength: ptr(1),
+						MaxLength: ptr(10),
+						Pattern:   "^[a-z]+$",
+						Format:    operations.EmailFormat,
+					},
+				},
+			},
+			{
+				desc: "number",
+				schema: &operations.ValueSchema{
+					Type: operations.Number,
+					Spec: &operations.NumberSpec{
+						Integer: true,
+						Enum:    []float64{1, 2},
+						Minimum: ptr(0.0),
+						Maximum: ptr(10.0),
+					},
+				},
+			},
+			{
+				desc: "boolean",
+				schema: &operations.ValueSchema{
+					Type: operations.Boolean,
+					Spec: &operations.BooleanSpec{Nullable: true},
+				},
+			},
+			{
+				desc: "object",
+				schema: &operations.ValueSchema{
+					Type: operations.Object,
+					Spec: &operations.ObjectSpec{
+						Properties: map[string]*operations.ValueSchema{
+							"id": {
+								Type: operations.Number,
+								Spec: &operations.NumberSpec{},
+							},
+							"name": {
+								Type: operations.String,
+								Spec: &operations.StringSpec{},
+							},
+						},
+						Optional:             []string{"name"},
+						AdditionalProperties: ptr(false),
+					},
+				},
+			},
+			{
+				desc: "array",
+				schema: &operations.ValueSchema{
+					Type: operations.Array,
+					Spec: &operations.ArraySpec{
+						Nullable: true,
+						Items: &operations.ValueSchema{
+							Type: operations.String,
+							Spec: &operations.StringSpec{},
+						},
+						MinItems: ptr(1),
+						MaxItems: ptr(3),
+					},
+				},
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				t.Parallel()
+
+				jsonSchemaJson, err := json.Marshal(tC.schema.ToJSONSchema())
+				assert.NoError(t, err)
+
+				jsonSchema := &operations.JSONSchema{}
+				err = json.Unmarshal(jsonSchemaJson, jsonSchema)
+				assert.NoError(t, err)
+
+				schema, err := operations.FromJSONSchema(jsonSchema)
+				assert.NoError(t, err)
+
+				assert.Equal(t, tC.schema, schema)
+			})
+		}
+	})
+
+	t.Run("to JSON Schema", func(t *testing.T) {
+		t.Parallel()
+
+		schema := &operations.ValueSchema{
+			Type: operations.Object,
+			Spec: &operations.ObjectSpec{
+				Properties: map[string]*operations.ValueSchema{
+					"status": {
+						Type: operations.String,
+						Spec: &operations.StringSpec{Nullable: true, Enum: []string{"todo", "done"}},
+					},
+					"count": {
+						Type: operations.Number,
+						Spec: &operations.NumberSpec{Integer: true},
+					},
+				},
+			},
+		}
+
+		jsonSchemaJson, err := json.Marshal(schema.ToJSONSchema())
+		assert.NoError(t, err)
+
+		assert.JSONEq(t, `{
+			"type": "object",
+			"properties": {
+				"count": { "type": "integer" },
+				"status": { "type": ["string", "null"], "enum": ["todo", "done", null] }
+			},
+			"required": ["count", "status"]
+		}`, string(jsonSchemaJson))
+	})
+
+	t.Run("unsupported JSON Schema", func(t *testing.T) {
+		testCases := []struct {
+			desc          string
+			jsonSchema    string
+			expectedError string
+		}{
+			{
+				desc:          "unknown keyword",
+				jsonSchema:    `{ "oneOf": [{ "type": "string" }, { "type": "number" }] }`,
+				expectedError: `unsupported JSON Schema: json: unknown field "oneOf"`,
+			},
+			{
+				desc:          "multiple types",
+				jsonSchema:    `{ "type": ["string", "number"] }`,
+				expectedError: "unsupported JSON Schema: type must be a single type, optionally with null, got [string number]",
+			},
+			{
+				desc:          "keyword of another type",
+				jsonSchema:    `{ "type": "number", "minLength": 1 }`,
+				expectedError: "unsupported JSON Schema: keyword minLength is not supported for type number",
+			},
+			{
+				desc:          "reference",
+				jsonSchema:    `{ "$ref": "#/$defs/user" }`,
+				expectedError: "unsupported JSON Schema: $ref is not supported",
+			},
+			{
+				desc:          "nested error",
+				jsonSchema:    `{ "type": "object", "properties": { "tags": { "type": "array" } } }`,
+				expectedError: "invalid property tags: unsupported JSON Schema: array without items",
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				t.Parallel()
+
+				jsonSchema := &operations.JSONSchema{}
+				err := json.Unmarshal([]byte(tC.jsonSchema), jsonSchema)
+				if err == nil {
+					_, err = operations.FromJSONSchema(jsonSchema)
+				}
+
+				assert.ErrorIs(t, err, operations.ErrUnsupportedJSONSchema)
+				assert.EqualError(t, err, tC.expectedError)
+			})
+		}
+	})
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+
+	store := operations.NewInMemoryOperationStore()
+	store.AddOperation(&operations.Operation{
+		Name: "get-user",
+		Kind: operations.QueryKind,
+		Parameters: map[string]*operations.ValueSchema{
+			"id": {
+				Type: operations.Number,
+				Spec: &operations.NumberSpec{},
+			},
+		},
+		Return: &operations.ValueSchema{
+			Type: operations.String,
+			Spec: &operations.StringSpec{},
+		},
+	})
+	store.AddOperation(&operations.Operation{
+		Name:       "delete-users",
+		Kind:       operations.MutationKind,
+		Parameters: map[string]*operations.ValueSchema{},
+		Return: &operations.ValueSchema{
+			Type: operations.Boolean,
+			Spec: &operations.BooleanSpec{},
+		},
+	})
+
+	allOperations, _, err := store.ListOperations()
+	assert.NoError(t, err)
+
+	document := operations.NewOpenAPIDocument(operations.OpenAPIInfo{Title: "test", Version: "1"}, allOperations)
+
+	assert.Equal(t, "3.1.0", document.OpenAPI)
+	assert.Len(t, document.Paths, 2)
+
+	getUser := document.Paths["/operations/execute/get-user"]
+	assert.Equal(t, "get-user", getUser.Post.OperationID)
+	assert.Equal(t,
+		&operations.JSONSchema{
+			Type:       operations.JSONSchemaTypes{"object"},
+			Properties: map[string]*operations.JSONSchema{"id": {Type: operations.JSONSchemaTypes{"number"}}},
+			Required:   []string{"id"},
+		},
+		getUser.Post.RequestBody.Content["application/json"].Schema.Properties["parameters"],
+	)
+	assert.Equal(t,
+		&operations.JSONSchema{Type: operations.JSONSchemaTypes{"string"}},
+		getUser.Post.Responses["200"].Content["application/json"].Schema.Properties["result"],
+	)
+	assert.NotNil(t, getUser.Get)
+
+	deleteUsers := document.Paths["/operations/execute/delete-users"]
+	assert.NotNil(t, deleteUsers.Post)
+	assert.Nil(t, deleteUsers.Get)
+}
@@ -0,0 +1,202 @@
+package operations
+
+import (
+	"fmt"
+)
+
+const OpenAPIVersion = "3.1.0"
+
+type OpenAPIDocument struct {
+	OpenAPI           string                  `json:"openapi"`
+	Info              OpenAPIInfo             `json:"info"`
+	JSONSchemaDialect string                  `json:"jsonSchemaDialect"`
+	Paths             map[string]*OpenAPIPath `json:"paths"`
+	Components        OpenAPIComponents       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas"`
+}
+
+type OpenAPIPath struct {
+	Get  *OpenAPIOperation `json:"get,omitempty"`
+	Post *OpenAPIOperation `json:"post,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name     string                       `json:"name"`
+	In       string                       `json:"in"`
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+const jsonMediaType = "application/json"
+
+const executionErrorSchemaName = "ExecuteOperationError"
+
+// NewOpenAPIDocument describes how to execute each operation through
+// POST /operations/execute/{name}. Query operations can also be executed
+// through GET, with the parameters JSON in the query string.
+func NewOpenAPIDocument(info OpenAPIInfo, operations []*Operation) *OpenAPIDocument {
+	document := &OpenAPIDocument{
+		OpenAPI:           OpenAPIVersion,
+		Info:              info,
+		JSONSchemaDialect: JSONSchemaDialect,
+		Paths:             map[string]*OpenAPIPath{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*JSONSchema{
+				executionErrorSchemaName: executionErrorJSONSchema(),
+			},
+		},
+	}
+
+	for _, operation := range operations {
+		parametersSchema := operation.ParametersJSONSchema()
+		responses := executionResponses(operation)
+
+		path := &OpenAPIPath{
+			Post: &OpenAPIOperation{
+				OperationID: operation.Name,
+				RequestBody: &OpenAPIRequestBody{
+					Required: true,
+					Content: map[string]*OpenAPIMediaType{
+						jsonMediaType: {
+							Schema: &JSONSchema{
+								Type:       JSONSchemaTypes{string(Object)},
+								Properties: map[string]*JSONSchema{"parameters": parametersSchema},
+								Required:   []string{"parameters"},
+							},
+						},
+					},
+				},
+				Responses: responses,
+			},
+		}
+
+		if operation.IsQuery() {
+			path.Get = &OpenAPIOperation{
+				OperationID: fmt.Sprintf("%s-get", operation.Name),
+				Parameters: []*OpenAPIParameter{
+					{
+						Name:     "parameters",
+						In:       "query",
+						Required: len(operation.Parameters) > 0,
+						Content: map[string]*OpenAPIMediaType{
+							jsonMediaType: {Schema: parametersSchema},
+						},
+					},
+				},
+				Responses: responses,
+			}
+		}
+
+		document.Paths[fmt.Sprintf("/operations/execute/%s", operation.Name)] = path
+	}
+
+	return document
+}
+
+// ParametersJSONSchema is the JSON Schema of the arguments object passed to
+// the operation.
+func (o *Operation) ParametersJSONSchema() *JSONSchema {
+	parameters := &ValueSchema{
+		Type: Object,
+		Spec: &ObjectSpec{Properties: o.Parameters},
+	}
+	return parameters.ToJSONSchema()
+}
+
+func executionResponses(operation *Operation) map[string]*OpenAPIResponse {
+	resultSchema := &JSONSchema{}
+	if operation.Return != nil {
+		resultSchema = operation.Return.ToJSONSchema()
+	}
+
+	errorContent := map[string]*OpenAPIMediaType{
+		jsonMediaType: {
+			Schema: &JSONSchema{Ref: fmt.Sprintf("#/components/schemas/%s", executionErrorSchemaName)},
+		},
+	}
+
+	return map[string]*OpenAPIResponse{
+		"200": {
+			Description: "The operation result.",
+			Content: map[string]*OpenAPIMediaType{
+				jsonMediaType: {
+					Schema: &JSONSchema{
+						Type: JSONSchemaTypes{string(Object)},
+						Properties: map[string]*JSONSchema{
+							"success": {Type: JSONSchemaTypes{string(Boolean)}},
+							"result":  resultSchema,
+						},
+						Required: []string{"success", "result"},
+					},
+				},
+			},
+		},
+		"400": {
+			Description: "The arguments do not match the parameters schema.",
+			Content:     errorContent,
+		},
+		"408": {
+			Description: "The operation exceeded its timeout.",
+			Content:     errorContent,
+		},
+		"422": {
+			Description: "The operation exceeded one of its execution limits.",
+			Content:     errorContent,
+		},
+		"500": {
+			Description: "The operation failed.",
+			Content:     errorContent,
+		},
+	}
+}
+
+func executionErrorJSONSchema() *JSONSchema {
+	return &JSONSchema{
+		Type: JSONSchemaTypes{string(Object)},
+		Properties: map[string]*JSONSchema{
+			"success": {Type: JSONSchemaTypes{string(Boolean)}},
+			"message": {Type: JSONSchemaTypes{string(String)}},
+			"errors": {
+				Type: JSONSchemaTypes{string(Array)},
+				Items: &JSONSchema{
+					Type: JSONSchemaTypes{string(Object)},
+					Properties: map[string]*JSONSchema{
+						"path":    {Type: JSONSchemaTypes{string(String)}},
+						"message": {Type: JSONSchemaTypes{string(String)}},
+					},
+					Required: []string{"path", "message"},
+				},
+			},
+		},
+		Required: []string{"success", "message"},
+	}
+}
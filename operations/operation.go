@@ -3,19 +3,128 @@ package operations
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"math"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prigas-dev/backoffice-ai/utils"
 )
 
 type Operation struct {
 	Name           string                  `json:"name"`
+	Version        int                     `json:"version,omitempty"`
+	Kind           OperationKind           `json:"kind,omitempty"`
 	JavascriptCode string                  `json:"javascriptCode"`
 	Parameters     map[string]*ValueSchema `json:"parameters"`
 	Return         *ValueSchema            `json:"return"`
+	Limits         *ExecutionLimits        `json:"limits,omitempty"`
 }
 
 type OperationManifest struct {
 	Name       string                  `json:"name"`
+	Kind       OperationKind           `json:"kind,omitempty"`
 	Parameters map[string]*ValueSchema `json:"parameters"`
 	Return     *ValueSchema            `json:"return"`
+	Limits     *ExecutionLimits        `json:"limits,omitempty"`
+}
+
+// OperationKind tells whether an operation only reads data. Operations without
+// a kind are treated as mutations.
+type OperationKind string
+
+const (
+	QueryKind    OperationKind = "query"
+	MutationKind OperationKind = "mutation"
+)
+
+func (o *Operation) IsQuery() bool {
+	return o.Kind == QueryKind
+}
+
+// CheckPatterns compiles the patterns of the parameters and return schemas,
+// returning an *InvalidPatternError for the first one that doesn't compile.
+func (o *Operation) CheckPatterns() error {
+	for _, parameterName := range slices.Sorted(maps.Keys(o.Parameters)) {
+		err := checkPatterns(joinPointer("/parameters", parameterName), o.Parameters[parameterName])
+		if err != nil {
+			return err
+		}
+	}
+
+	return checkPatterns("/return", o.Return)
+}
+
+// checkPatterns compiles the patterns in schema, whose JSON pointer is path.
+func checkPatterns(path string, schema *ValueSchema) error {
+	if schema == nil {
+		return nil
+	}
+
+	specPath := joinPointer(path, "spec")
+	switch spec := schema.Spec.(type) {
+	case *StringSpec:
+		if len(spec.Pattern) > 0 {
+			_, err := compilePattern(spec.Pattern)
+			if err != nil {
+				return &InvalidPatternError{Path: joinPointer(specPath, "pattern"), Pattern: spec.Pattern, Err: err}
+			}
+		}
+	case *ObjectSpec:
+		for _, propertyName := range slices.Sorted(maps.Keys(spec.Properties)) {
+			err := checkPatterns(joinPointer(joinPointer(specPath, "properties"), propertyName), spec.Properties[propertyName])
+			if err != nil {
+				return err
+			}
+		}
+	case *ArraySpec:
+		return checkPatterns(joinPointer(specPath, "items"), spec.Items)
+	}
+
+	return nil
+}
+
+// InvalidPatternError is returned when an operation schema has a string
+// pattern that is not a valid regular expression.
+type InvalidPatternError struct {
+	// JSON pointer to the pattern in the operation
+	Path    string
+	Pattern string
+	Err     error
+}
+
+func (e *InvalidPatternError) Error() string {
+	return fmt.Sprintf("invalid pattern %s at %s: %v", e.Pattern, e.Path, e.Err)
+}
+
+func (e *InvalidPatternError) Unwrap() error {
+	return e.Err
+}
+
+// compiledPatterns caches the compiled string patterns by their source, so
+// validating a value doesn't compile its pattern again.
+var compiledPatterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	compiled, isCompiled := compiledPatterns.Load(pattern)
+	if isCompiled {
+		return compiled.(*regexp.Regexp), nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	compiledPatterns.Store(pattern, regex)
+
+	return regex, nil
 }
 
 type ValueSchema struct {
@@ -36,45 +145,178 @@ const (
 
 type Spec interface {
 	Validate(value any) ValidationResult
+
+	// validate returns every error found in value. path is the JSON pointer of
+	// value, and is prefixed to the path of the errors.
+	validate(path string, value any) []ValidationError
 }
 
 type ValidationResult struct {
-	Success bool   `json:"success"`
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Errors  []ValidationError `json:"errors,omitempty"`
+}
+
+type ValidationError struct {
+	// JSON pointer to the invalid value, empty for the root value
+	Path    string `json:"path"`
 	Message string `json:"message"`
 }
 
+func (e ValidationError) String() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func newValidationResult(errors []ValidationError) ValidationResult {
+	if len(errors) == 0 {
+		return ValidationResult{Success: true}
+	}
+
+	messages := utils.Map(errors, ValidationError.String)
+	return ValidationResult{
+		Success: false,
+		Message: strings.Join(messages, "; "),
+		Errors:  errors,
+	}
+}
+
+// joinPointer appends a reference token to a JSON pointer (RFC 6901)
+func joinPointer(path string, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return path + "/" + token
+}
+
+type StringFormat string
+
+const (
+	DateTimeFormat StringFormat = "date-time"
+	DateFormat     StringFormat = "date"
+	EmailFormat    StringFormat = "email"
+	UUIDFormat     StringFormat = "uuid"
+)
+
 type StringSpec struct {
-	Nullable bool `json:"nullable"`
+	Nullable  bool         `json:"nullable"`
+	Enum      []string     `json:"enum,omitempty"`
+	MinLength *int         `json:"minLength,omitempty"`
+	MaxLength *int         `json:"maxLength,omitempty"`
+	Pattern   string       `json:"pattern,omitempty"`
+	Format    StringFormat `json:"format,omitempty"`
 }
 
 func (p *StringSpec) Validate(value any) ValidationResult {
+	return newValidationResult(p.validate("", value))
+}
+
+func (p *StringSpec) validate(path string, value any) []ValidationError {
 	if p.Nullable && value == nil {
-		return ValidationResult{Success: true}
+		return nil
 	}
-	_, isString := value.(string)
-	if isString {
-		return ValidationResult{Success: true}
+	str, isString := value.(string)
+	if !isString {
+		return []ValidationError{{Path: path, Message: "value is not a string"}}
+	}
+
+	errors := []ValidationError{}
+
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, str) {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must be one of %s", strings.Join(p.Enum, ", "))})
+	}
+
+	length := utf8.RuneCountInString(str)
+	if p.MinLength != nil && length < *p.MinLength {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must have at least %d characters", *p.MinLength)})
+	}
+	if p.MaxLength != nil && length > *p.MaxLength {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must have at most %d characters", *p.MaxLength)})
+	}
+
+	if len(p.Pattern) > 0 {
+		pattern, err := compilePattern(p.Pattern)
+		if err != nil {
+			errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("invalid pattern %s: %v", p.Pattern, err)})
+		} else if !pattern.MatchString(str) {
+			errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value does not match pattern %s", p.Pattern)})
+		}
+	}
+
+	if len(p.Format) > 0 && !isValidFormat(p.Format, str) {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value is not a valid %s", p.Format)})
 	}
 
-	return ValidationResult{Success: false, Message: "value is not a string"}
+	return errors
+}
+
+// isValidFormat reports whether str is in format. Unknown formats are not
+// checked, as JSON Schema does.
+func isValidFormat(format StringFormat, str string) bool {
+	switch format {
+	case DateTimeFormat:
+		_, err := time.Parse(time.RFC3339, str)
+		return err == nil
+	case DateFormat:
+		_, err := time.Parse(time.DateOnly, str)
+		return err == nil
+	case EmailFormat:
+		address, err := mail.ParseAddress(str)
+		return err == nil && address.Address == str
+	case UUIDFormat:
+		_, err := uuid.Parse(str)
+		return err == nil && len(str) == 36
+	}
+	return true
 }
 
 type NumberSpec struct {
-	Nullable bool `json:"nullable"`
+	Nullable bool      `json:"nullable"`
+	Integer  bool      `json:"integer,omitempty"`
+	Enum     []float64 `json:"enum,omitempty"`
+	Minimum  *float64  `json:"minimum,omitempty"`
+	Maximum  *float64  `json:"maximum,omitempty"`
 }
 
 func (p *NumberSpec) Validate(value any) ValidationResult {
+	return newValidationResult(p.validate("", value))
+}
+
+func (p *NumberSpec) validate(path string, value any) []ValidationError {
 	if p.Nullable && value == nil {
-		return ValidationResult{Success: true}
+		return nil
 	}
-	_, isFloat := value.(float64)
-	if !isFloat {
-		_, isInt := value.(int64)
-		if !isInt {
-			return ValidationResult{Success: false, Message: "value is not a float64 or int64"}
-		}
+
+	var number float64
+	switch value := value.(type) {
+	case float64:
+		number = value
+	case int64:
+		number = float64(value)
+	default:
+		return []ValidationError{{Path: path, Message: "value is not a float64 or int64"}}
+	}
+
+	errors := []ValidationError{}
+
+	if p.Integer && number != math.Trunc(number) {
+		errors = append(errors, ValidationError{Path: path, Message: "value is not an integer"})
+	}
+
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, number) {
+		enum := utils.Map(p.Enum, func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) })
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must be one of %s", strings.Join(enum, ", "))})
 	}
-	return ValidationResult{Success: true}
+
+	if p.Minimum != nil && number < *p.Minimum {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must be greater than or equal to %v", *p.Minimum)})
+	}
+	if p.Maximum != nil && number > *p.Maximum {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must be less than or equal to %v", *p.Maximum)})
+	}
+
+	return errors
 }
 
 type BooleanSpec struct {
@@ -82,65 +324,106 @@ type BooleanSpec struct {
 }
 
 func (p *BooleanSpec) Validate(value any) ValidationResult {
+	return newValidationResult(p.validate("", value))
+}
+
+func (p *BooleanSpec) validate(path string, value any) []ValidationError {
 	if p.Nullable && value == nil {
-		return ValidationResult{Success: true}
+		return nil
 	}
 	_, isBool := value.(bool)
 	if !isBool {
-		return ValidationResult{Success: false, Message: "value is not a bool"}
+		return []ValidationError{{Path: path, Message: "value is not a bool"}}
 	}
-	return ValidationResult{Success: true}
+	return nil
 }
 
 type ObjectSpec struct {
 	Nullable   bool                    `json:"nullable"`
 	Properties map[string]*ValueSchema `json:"properties"`
+
+	// names of properties that may be missing, every other property is required
+	Optional []string `json:"optional,omitempty"`
+
+	// whether properties not declared in Properties are allowed, defaults to true
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
 }
 
 func (p *ObjectSpec) Validate(value any) ValidationResult {
+	return newValidationResult(p.validate("", value))
+}
+
+func (p *ObjectSpec) validate(path string, value any) []ValidationError {
 	if p.Nullable && value == nil {
-		return ValidationResult{Success: true}
+		return nil
 	}
 	object, isMap := value.(map[string]any)
 	if !isMap {
-		return ValidationResult{Success: false, Message: "value is not a map"}
+		return []ValidationError{{Path: path, Message: "value is not a map"}}
 	}
-	for propertyName, property := range p.Properties {
+
+	errors := []ValidationError{}
+
+	for _, propertyName := range slices.Sorted(maps.Keys(p.Properties)) {
+		property := p.Properties[propertyName]
+
 		propertyValue, hasProperty := object[propertyName]
 		if !hasProperty {
-			return ValidationResult{Success: false, Message: fmt.Sprintf("missing property %s", propertyName)}
+			if !slices.Contains(p.Optional, propertyName) {
+				errors = append(errors, ValidationError{Path: joinPointer(path, propertyName), Message: fmt.Sprintf("missing property %s", propertyName)})
+			}
+			continue
 		}
 
-		properyValidationResult := property.Spec.Validate(propertyValue)
-		if !properyValidationResult.Success {
-			return ValidationResult{Success: false, Message: fmt.Sprintf("invalid property %s: %s", propertyName, properyValidationResult.Message)}
+		errors = append(errors, property.Spec.validate(joinPointer(path, propertyName), propertyValue)...)
+	}
+
+	if p.AdditionalProperties != nil && !*p.AdditionalProperties {
+		for _, propertyName := range slices.Sorted(maps.Keys(object)) {
+			_, isDeclared := p.Properties[propertyName]
+			if !isDeclared {
+				errors = append(errors, ValidationError{Path: joinPointer(path, propertyName), Message: fmt.Sprintf("unexpected property %s", propertyName)})
+			}
 		}
 	}
 
-	return ValidationResult{Success: true}
+	return errors
 }
 
 type ArraySpec struct {
 	Nullable bool         `json:"nullable"`
 	Items    *ValueSchema `json:"items"`
+	MinItems *int         `json:"minItems,omitempty"`
+	MaxItems *int         `json:"maxItems,omitempty"`
 }
 
 func (p *ArraySpec) Validate(value any) ValidationResult {
+	return newValidationResult(p.validate("", value))
+}
+
+func (p *ArraySpec) validate(path string, value any) []ValidationError {
 	if p.Nullable && value == nil {
-		return ValidationResult{Success: true}
+		return nil
 	}
 	array, isSlice := value.([]any)
 	if !isSlice {
-		return ValidationResult{Success: false, Message: "value is not a slice"}
+		return []ValidationError{{Path: path, Message: "value is not a slice"}}
+	}
+
+	errors := []ValidationError{}
+
+	if p.MinItems != nil && len(array) < *p.MinItems {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must have at least %d items", *p.MinItems)})
 	}
+	if p.MaxItems != nil && len(array) > *p.MaxItems {
+		errors = append(errors, ValidationError{Path: path, Message: fmt.Sprintf("value must have at most %d items", *p.MaxItems)})
+	}
+
 	for index, item := range array {
-		itemValidationResult := p.Items.Spec.Validate(item)
-		if !itemValidationResult.Success {
-			return ValidationResult{Success: false, Message: fmt.Sprintf("invalid item %d: %s", index, itemValidationResult.Message)}
-		}
+		errors = append(errors, p.Items.Spec.validate(joinPointer(path, strconv.Itoa(index)), item)...)
 	}
 
-	return ValidationResult{Success: true}
+	return errors
 }
 
 type _valueSchema ValueSchema
@@ -150,9 +433,12 @@ func (s *ValueSchema) MarshalJSON() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	s.SpecRaw = typePropertiesRaw
 
-	return json.Marshal((*_valueSchema)(s))
+	// marshals a copy, so encoding doesn't change the schema
+	encoded := *s
+	encoded.SpecRaw = typePropertiesRaw
+
+	return json.Marshal((*_valueSchema)(&encoded))
 }
 
 func (s *ValueSchema) UnmarshalJSON(data []byte) error {
@@ -199,5 +485,8 @@ func (s *ValueSchema) UnmarshalJSON(data []byte) error {
 		s.Spec = spec
 	}
 
+	// Spec holds the decoded value, the raw JSON is only needed while decoding
+	s.SpecRaw = nil
+
 	return nil
 }
@@ -1,94 +1,120 @@
 package operations
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"time"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/prigas-dev/backoffice-ai/utils"
 )
 
 type IOperationExecutor interface {
-	Execute(operationName string, arguments map[string]any) (any, error)
+	Execute(ctx context.Context, operationName string, arguments map[string]any) (any, error)
+}
+
+type OperationExecutorConfig struct {
+	// limits applied to every operation unless the operation overrides them,
+	// nil fields fall back to the default execution limits
+	DefaultLimits *ExecutionLimits
+
+	// highest limits an operation may override the defaults with, nil fields
+	// fall back to the maximum execution limits
+	MaxLimits *ExecutionLimits
+
+	// number of pre-warmed javascript runtimes, 0 disables the pool
+	RuntimePoolSize int
 }
 
-func NewOperationExecutor(db *sql.DB, store IOperationStore) IOperationExecutor {
+func NewOperationExecutor(db *sql.DB, store IOperationStore, config *OperationExecutorConfig) IOperationExecutor {
+	defaultLimits, maxLimits := config.limits()
+
+	var runtimes *RuntimePool
+	if config != nil && config.RuntimePoolSize > 0 {
+		runtimes = NewRuntimePool(config.RuntimePoolSize)
+	}
+
+	programs := NewProgramCache()
+	store.OnOperationChanged(programs.Invalidate)
+
 	return &OperationExecutor{
-		store: store,
-		db:    db,
+		store:         store,
+		db:            db,
+		defaultLimits: defaultLimits,
+		maxLimits:     maxLimits,
+		programs:      programs,
+		runtimes:      runtimes,
 	}
 }
 
+// limits returns the limits of operations that don't set their own, and the
+// highest ones they may set.
+func (c *OperationExecutorConfig) limits() (*ExecutionLimits, *ExecutionLimits) {
+	if c == nil {
+		return defaultExecutionLimits(), maxExecutionLimits()
+	}
+
+	maxLimits := c.MaxLimits.Merge(maxExecutionLimits())
+	defaultLimits := c.DefaultLimits.Merge(defaultExecutionLimits()).Clamp(maxLimits)
+
+	return defaultLimits, maxLimits
+}
+
 type OperationExecutor struct {
-	store IOperationStore
-	db    *sql.DB
+	store         IOperationStore
+	db            *sql.DB
+	defaultLimits *ExecutionLimits
+	maxLimits     *ExecutionLimits
+	programs      *ProgramCache
+	runtimes      *RuntimePool
 }
 
-func (o *OperationExecutor) Execute(operationName string, arguments map[string]any) (any, error) {
+func (o *OperationExecutor) Execute(ctx context.Context, operationName string, arguments map[string]any) (any, error) {
 	operation, err := o.store.GetOperation(operationName)
 	if err != nil {
 		return nil, err
 	}
-	for parameterName, parameter := range operation.Parameters {
-		value, hasValue := arguments[parameterName]
-		if !hasValue {
-			return nil, fmt.Errorf("argument not provided: %s", parameterName)
-		}
-		validationResult := parameter.Spec.Validate(value)
-		if !validationResult.Success {
-			return nil, fmt.Errorf("invalid argument %s: %s", parameterName, validationResult.Message)
+	err = validateArguments(operation.Parameters, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := operation.Limits.Merge(o.defaultLimits).Clamp(o.maxLimits)
+
+	// queries share the script deadline, so a timeout also cancels them
+	ctx, cancel := withExecutionTimeout(ctx, operationName, limits)
+	defer cancel()
+
+	vm := o.runtimes.Get()
+
+	var db sqlDatabase = o.db
+	if operation.IsQuery() {
+		conn, release, err := openReadOnlyConn(ctx, o.db)
+		if err != nil {
+			return nil, err
 		}
+		defer release()
+		db = conn
 	}
 
-	globals := map[string]any{
-		"query": func(query string, parameters ...any) ([][]any, error) {
-			rows, err := o.db.Query(query, parameters...)
-			if err != nil {
-				return nil, err
-			}
-			defer rows.Close()
-
-			columns, err := rows.Columns()
-			if err != nil {
-				return nil, err
-			}
-
-			scannedRows := [][]any{}
-			for rows.Next() {
-				values := make([]any, len(columns))
-				scanArgs := make([]any, len(columns))
-				for i := range values {
-					scanArgs[i] = &values[i]
-				}
-
-				err := rows.Scan(scanArgs...)
-				if err != nil {
-					return nil, err
-				}
-
-				for i, val := range values {
-					// Ensuring byte slices are converted to string
-					if b, ok := val.([]byte); ok {
-						values[i] = string(b)
-					}
-
-					// Ensuring time.Time are converted to string
-					if t, ok := val.(time.Time); ok {
-						values[i] = t.Format(time.RFC3339)
-					}
-				}
-
-				scannedRows = append(scannedRows, values)
-			}
-			err = rows.Err()
-			if err != nil {
-				return nil, err
-			}
-
-			return scannedRows, nil
-
-		},
+	database := newDatabaseGlobals(ctx, vm, db, operation.IsQuery())
+	defer database.close()
+
+	program, err := o.programs.Get(operationName, operation.JavascriptCode)
+	if err != nil {
+		return nil, err
 	}
 
-	result, err := ExecuteJavascript[any](operationName, operation.JavascriptCode, arguments, globals)
+	return executeOperation(ctx, vm, database, operation, program, arguments, limits)
+}
+
+// executeOperation runs the compiled script of operation and checks its result
+// against the operation return schema.
+func executeOperation(ctx context.Context, vm *goja.Runtime, database *databaseGlobals, operation *Operation, program *goja.Program, arguments map[string]any, limits *ExecutionLimits) (any, error) {
+	result, err := ExecuteProgram[any](ctx, vm, operation.Name, program, arguments, database.globals(), limits)
 	if err != nil {
 		return nil, err
 	}
@@ -100,3 +126,45 @@ func (o *OperationExecutor) Execute(operationName string, arguments map[string]a
 
 	return result, nil
 }
+
+// InvalidArgumentsError lists every argument that does not match the operation
+// parameters schema.
+type InvalidArgumentsError struct {
+	Errors []ValidationError
+}
+
+func (e *InvalidArgumentsError) Error() string {
+	messages := utils.Map(e.Errors, func(err ValidationError) string { return err.Message })
+	return strings.Join(messages, "; ")
+}
+
+func validateArguments(parameters map[string]*ValueSchema, arguments map[string]any) error {
+	errors := []ValidationError{}
+
+	for _, parameterName := range slices.Sorted(maps.Keys(parameters)) {
+		parameter := parameters[parameterName]
+		parameterPath := joinPointer("", parameterName)
+
+		value, hasValue := arguments[parameterName]
+		if !hasValue {
+			errors = append(errors, ValidationError{
+				Path:    parameterPath,
+				Message: fmt.Sprintf("argument not provided: %s", parameterName),
+			})
+			continue
+		}
+
+		for _, err := range parameter.Spec.validate(parameterPath, value) {
+			errors = append(errors, ValidationError{
+				Path:    err.Path,
+				Message: fmt.Sprintf("invalid argument %s: %s", strings.TrimPrefix(err.Path, "/"), err.Message),
+			})
+		}
+	}
+
+	if len(errors) > 0 {
+		return &InvalidArgumentsError{Errors: errors}
+	}
+
+	return nil
+}
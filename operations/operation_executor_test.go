@@ -1,8 +1,11 @@
 package operations_test
 
 import (
+	"context"
 	"database/sql"
+	"path/filepath"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/prigas-dev/backoffice-ai/operations"
@@ -25,9 +28,9 @@ func TestOperationExecutor(t *testing.T) {
 		t.Parallel()
 
 		store := operations.NewInMemoryOperationStore()
-		executor := operations.NewOperationExecutor(db, store)
+		executor := operations.NewOperationExecutor(db, store, nil)
 
-		_, err := executor.Execute("op", map[string]any{})
+		_, err := executor.Execute(t.Context(), "op", map[string]any{})
 
 		assert.EqualError(t, err, "operation not found")
 	})
@@ -121,9 +124,9 @@ func TestOperationExecutor(t *testing.T) {
 					JavascriptCode: tC.jsCode,
 					Return:         tC.returnSchema,
 				})
-				executor := operations.NewOperationExecutor(db, store)
+				executor := operations.NewOperationExecutor(db, store, nil)
 
-				value, err := executor.Execute("simple_return", map[string]any{})
+				value, err := executor.Execute(t.Context(), "simple_return", map[string]any{})
 				assert.NoError(t, err)
 
 				assert.Equal(t, tC.expectedReturnValue, value)
@@ -144,9 +147,9 @@ func TestOperationExecutor(t *testing.T) {
 				},
 			},
 		})
-		executor := operations.NewOperationExecutor(db, store)
+		executor := operations.NewOperationExecutor(db, store, nil)
 
-		_, err := executor.Execute("argument_not_provided", map[string]any{})
+		_, err := executor.Execute(t.Context(), "argument_not_provided", map[string]any{})
 
 		assert.EqualError(t, err, "argument not provided: stuff")
 	})
@@ -164,15 +167,57 @@ func TestOperationExecutor(t *testing.T) {
 				},
 			},
 		})
-		executor := operations.NewOperationExecutor(db, store)
+		executor := operations.NewOperationExecutor(db, store, nil)
 
-		_, err := executor.Execute("invalid_argument", map[string]any{
+		_, err := executor.Execute(t.Context(), "invalid_argument", map[string]any{
 			"stuff": 12,
 		})
 
 		assert.EqualError(t, err, "invalid argument stuff: value is not a string")
 	})
 
+	t.Run("every invalid argument is reported", func(t *testing.T) {
+		t.Parallel()
+
+		store := operations.NewInMemoryOperationStore()
+		store.AddOperation(&operations.Operation{
+			Name: "invalid_arguments",
+			Parameters: map[string]*operations.ValueSchema{
+				"email": {
+					Type: operations.String,
+					Spec: &operations.StringSpec{Format: operations.EmailFormat},
+				},
+				"ids": {
+					Type: operations.Array,
+					Spec: &operations.ArraySpec{
+						Items: &operations.ValueSchema{
+							Type: operations.Number,
+							Spec: &operations.NumberSpec{Integer: true},
+						},
+					},
+				},
+				"name": {
+					Type: operations.String,
+					Spec: &operations.StringSpec{},
+				},
+			},
+		})
+		executor := operations.NewOperationExecutor(db, store, nil)
+
+		_, err := executor.Execute(t.Context(), "invalid_arguments", map[string]any{
+			"email": "not an email",
+			"ids":   []any{1.0, 1.5},
+		})
+
+		var argumentsErr *operations.InvalidArgumentsError
+		assert.ErrorAs(t, err, &argumentsErr)
+		assert.Equal(t, []operations.ValidationError{
+			{Path: "/email", Message: "invalid argument email: value is not a valid email"},
+			{Path: "/ids/1", Message: "invalid argument ids/1: value is not an integer"},
+			{Path: "/name", Message: "argument not provided: name"},
+		}, argumentsErr.Errors)
+	})
+
 	t.Run("arguments are passed", func(t *testing.T) {
 		store := operations.NewInMemoryOperationStore()
 		store.AddOperation(&operations.Operation{
@@ -190,9 +235,9 @@ func TestOperationExecutor(t *testing.T) {
 			JavascriptCode: `function run({ prigas }) { return prigas.length }`,
 		})
 
-		executor := operations.NewOperationExecutor(db, store)
+		executor := operations.NewOperationExecutor(db, store, nil)
 
-		result, err := executor.Execute("arguments_are_passed", map[string]any{
+		result, err := executor.Execute(t.Context(), "arguments_are_passed", map[string]any{
 			"prigas": "prigas",
 		})
 		assert.NoError(t, err)
@@ -216,11 +261,454 @@ func TestOperationExecutor(t *testing.T) {
 			}`,
 		})
 
-		executor := operations.NewOperationExecutor(db, store)
+		executor := operations.NewOperationExecutor(db, store, nil)
 
-		result, err := executor.Execute("run-query", map[string]any{})
+		result, err := executor.Execute(t.Context(), "run-query", map[string]any{})
 		assert.NoError(t, err)
 
 		assert.Equal(t, "banana", result)
 	})
+	t.Run("operation limits override defaults", func(t *testing.T) {
+		t.Parallel()
+
+		store := operations.NewInMemoryOperationStore()
+		store.AddOperation(&operations.Operation{
+			Name:       "infinite-loop",
+			Parameters: map[string]*operations.ValueSchema{},
+			Return: &operations.ValueSchema{
+				Type: operations.String,
+				Spec: &operations.StringSpec{},
+			},
+			Limits:         &operations.ExecutionLimits{TimeoutMs: 50},
+			JavascriptCode: `function run() { while (true) {} }`,
+		})
+
+		executor := operations.NewOperationExecutor(db, store, &operations.OperationExecutorConfig{
+			DefaultLimits: &operations.ExecutionLimits{TimeoutMs: 60_000},
+		})
+
+		_, err := executor.Execute(t.Context(), "infinite-loop", map[string]any{})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.TimeoutLimit, limitErr.Limit)
+	})
+	t.Run("operation limits are clamped to the maximum", func(t *testing.T) {
+		t.Parallel()
+
+		store := operations.NewInMemoryOperationStore()
+		store.AddOperation(&operations.Operation{
+			Name:       "infinite-loop",
+			Parameters: map[string]*operations.ValueSchema{},
+			Return: &operations.ValueSchema{
+				Type: operations.String,
+				Spec: &operations.StringSpec{},
+			},
+			Limits:         &operations.ExecutionLimits{TimeoutMs: 60_000},
+			JavascriptCode: `function run() { while (true) {} }`,
+		})
+
+		executor := operations.NewOperationExecutor(db, store, &operations.OperationExecutorConfig{
+			MaxLimits: &operations.ExecutionLimits{TimeoutMs: 50},
+		})
+
+		_, err := executor.Execute(t.Context(), "infinite-loop", map[string]any{})
+
+		var limitErr *operations.ExecutionLimitError
+		assert.ErrorAs(t, err, &limitErr)
+		assert.Equal(t, operations.TimeoutLimit, limitErr.Limit)
+	})
+	t.Run("context cancels running query", func(t *testing.T) {
+		t.Parallel()
+
+		store := operations.NewInMemoryOperationStore()
+		store.AddOperation(&operations.Operation{
+			Name:       "slow-query",
+			Parameters: map[string]*operations.ValueSchema{},
+			Return: &operations.ValueSchema{
+				Type: operations.Number,
+				Spec: &operations.NumberSpec{},
+			},
+			JavascriptCode: `
+			function run() {
+				const result = query("WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT count(*) FROM n;")
+				return result[0][0]
+			}`,
+		})
+
+		executor := operations.NewOperationExecutor(db, store, nil)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := executor.Execute(ctx, "slow-query", map[string]any{})
+
+		var canceledErr *operations.ExecutionCanceledError
+		assert.ErrorAs(t, err, &canceledErr)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("overwritten operation runs new code", func(t *testing.T) {
+		t.Parallel()
+
+		store := operations.NewInMemoryOperationStore()
+		operation := &operations.Operation{
+			Name:       "overwritten",
+			Parameters: map[string]*operations.ValueSchema{},
+			Return: &operations.ValueSchema{
+				Type: operations.String,
+				Spec: &operations.StringSpec{},
+			},
+			JavascriptCode: `function run() { return "old" }`,
+		}
+		store.AddOperation(operation)
+
+		executor := operations.NewOperationExecutor(db, store, &operations.OperationExecutorConfig{RuntimePoolSize: 2})
+
+		result, err := executor.Execute(t.Context(), "overwritten", map[string]any{})
+		assert.NoError(t, err)
+		assert.Equal(t, "old", result)
+
+		store.AddOperation(&operations.Operation{
+			Name:           operation.Name,
+			Parameters:     operation.Parameters,
+			Return:         operation.Return,
+			JavascriptCode: `function run() { return "new" }`,
+		})
+
+		result, err = executor.Execute(t.Context(), "overwritten", map[string]any{})
+		assert.NoError(t, err)
+		assert.Equal(t, "new", result)
+	})
+}
+
+func TestOperationExecutorDatabaseGlobals(t *testing.T) {
+	t.Parallel()
+
+	openDb := func(t *testing.T) *sql.DB {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			panic(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE);")
+		if err != nil {
+			panic(err)
+		}
+
+		return db
+	}
+
+	countItems := func(t *testing.T, db *sql.DB) int {
+		var count int
+		err := db.QueryRow("SELECT count(*) FROM items;").Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+
+	execute := func(t *testing.T, db *sql.DB, jsCode string, returnSchema *operations.ValueSchema) (any, error) {
+		store := operations.NewInMemoryOperationStore()
+		store.AddOperation(&operations.Operation{
+			Name:           "op",
+			Parameters:     map[string]*operations.ValueSchema{},
+			Return:         returnSchema,
+			JavascriptCode: jsCode,
+		})
+		executor := operations.NewOperationExecutor(db, store, nil)
+
+		return executor.Execute(t.Context(), "op", map[string]any{})
+	}
+
+	numberSchema := &operations.ValueSchema{
+		Type: operations.Number,
+		Spec: &operations.NumberSpec{Nullable: true},
+	}
+
+	t.Run("exec returns rows affected and last insert id", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		result, err := execute(t, db, `
+		function run() {
+			exec("INSERT INTO items (name) VALUES (?);", "a")
+			return exec("INSERT INTO items (name) VALUES (?);", "b")
+		}`, &operations.ValueSchema{
+			Type: operations.Object,
+			Spec: &operations.ObjectSpec{
+				Properties: map[string]*operations.ValueSchema{
+					"rowsAffected": numberSchema,
+					"lastInsertId": numberSchema,
+				},
+			},
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]any{"rowsAffected": int64(1), "lastInsertId": int64(2)}, result)
+	})
+
+	t.Run("transaction commits when callback returns", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		result, err := execute(t, db, `
+		function run() {
+			return transaction(() => {
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+				exec("INSERT INTO items (name) VALUES (?);", "b")
+				return query("SELECT count(*) FROM items;")[0][0]
+			})
+		}`, numberSchema)
+		assert.NoError(t, err)
+
+		assert.Equal(t, int64(2), result)
+		assert.Equal(t, 2, countItems(t, db))
+	})
+
+	t.Run("transaction rolls back when callback throws", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		_, err := execute(t, db, `
+		function run() {
+			transaction(() => {
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+			})
+		}`, numberSchema)
+		assert.ErrorContains(t, err, "UNIQUE constraint failed")
+
+		assert.Equal(t, 0, countItems(t, db))
+	})
+
+	t.Run("transaction commits when promise resolves", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		_, err := execute(t, db, `
+		async function run() {
+			await transaction(async () => {
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+				await null
+				exec("INSERT INTO items (name) VALUES (?);", "b")
+			})
+		}`, numberSchema)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, countItems(t, db))
+	})
+
+	t.Run("transaction rolls back when promise rejects", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		_, err := execute(t, db, `
+		async function run() {
+			await transaction(async () => {
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+				await null
+				throw new Error("banana")
+			})
+		}`, numberSchema)
+		assert.ErrorContains(t, err, "banana")
+
+		assert.Equal(t, 0, countItems(t, db))
+	})
+
+	t.Run("nested transactions are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDb(t)
+
+		_, err := execute(t, db, `
+		function run() {
+			transaction(() => {
+				exec("INSERT INTO items (name) VALUES (?);", "a")
+				transaction(() => {})
+			})
+		}`, numberSchema)
+		assert.ErrorContains(t, err, operations.ErrNestedTransaction.Error())
+
+		assert.Equal(t, 0, countItems(t, db))
+	})
+}
+
+func TestOperationExecutorQueryObjects(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	_, err = db.Exec(`
+	CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, data BLOB);
+	INSERT INTO items (name, data) VALUES ('a', x'6869'), ('b', NULL);`)
+	if err != nil {
+		panic(err)
+	}
+
+	nullableString := &operations.ValueSchema{
+		Type: operations.String,
+		Spec: &operations.StringSpec{Nullable: true},
+	}
+	itemSchema := &operations.ValueSchema{
+		Type: operations.Object,
+		Spec: &operations.ObjectSpec{
+			Nullable: true,
+			Properties: map[string]*operations.ValueSchema{
+				"id": {
+					Type: operations.Number,
+					Spec: &operations.NumberSpec{},
+				},
+				"name": nullableString,
+				"data": nullableString,
+			},
+		},
+	}
+
+	testCases := []struct {
+		desc                string
+		jsCode              string
+		returnSchema        *operations.ValueSchema
+		expectedReturnValue any
+	}{
+		{
+			desc:   "queryObjects",
+			jsCode: `function run() { return queryObjects("SELECT id, name, data FROM items ORDER BY id;") }`,
+			returnSchema: &operations.ValueSchema{
+				Type: operations.Array,
+				Spec: &operations.ArraySpec{Items: itemSchema},
+			},
+			expectedReturnValue: []any{
+				map[string]any{"id": int64(1), "name": "a", "data": "hi"},
+				map[string]any{"id": int64(2), "name": "b", "data": nil},
+			},
+		},
+		{
+			desc:   "queryObjects column access",
+			jsCode: `function run() { return queryObjects("SELECT name, id FROM items WHERE id = ?;", 2)[0].name }`,
+			returnSchema: &operations.ValueSchema{
+				Type: operations.String,
+				Spec: &operations.StringSpec{},
+			},
+			expectedReturnValue: "b",
+		},
+		{
+			desc:                "queryOne",
+			jsCode:              `function run() { return queryOne("SELECT id, name, data FROM items WHERE name = ?;", "a") }`,
+			returnSchema:        itemSchema,
+			expectedReturnValue: map[string]any{"id": int64(1), "name": "a", "data": "hi"},
+		},
+		{
+			desc:                "queryOne without rows",
+			jsCode:              `function run() { return queryOne("SELECT id, name, data FROM items WHERE name = ?;", "z") }`,
+			returnSchema:        itemSchema,
+			expectedReturnValue: nil,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			t.Parallel()
+
+			store := operations.NewInMemoryOperationStore()
+			store.AddOperation(&operations.Operation{
+				Name:           "op",
+				Parameters:     map[string]*operations.ValueSchema{},
+				Return:         tC.returnSchema,
+				JavascriptCode: tC.jsCode,
+			})
+			executor := operations.NewOperationExecutor(db, store, nil)
+
+			result, err := executor.Execute(t.Context(), "op", map[string]any{})
+			assert.NoError(t, err)
+
+			assert.Equal(t, tC.expectedReturnValue, result)
+		})
+	}
+}
+
+func TestOperationExecutorQueryKind(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	// makes every operation share the connection the query operations use
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+	CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+	INSERT INTO items (name) VALUES ('a');`)
+	if err != nil {
+		panic(err)
+	}
+
+	numberSchema := &operations.ValueSchema{
+		Type: operations.Number,
+		Spec: &operations.NumberSpec{Nullable: true},
+	}
+
+	store := operations.NewInMemoryOperationStore()
+	store.AddOperation(&operations.Operation{
+		Name:           "count-items",
+		Kind:           operations.QueryKind,
+		Parameters:     map[string]*operations.ValueSchema{},
+		Return:         numberSchema,
+		JavascriptCode: `function run() { return queryOne("SELECT count(*) AS total FROM items;").total }`,
+	})
+	store.AddOperation(&operations.Operation{
+		Name:           "query-writes",
+		Kind:           operations.QueryKind,
+		Parameters:     map[string]*operations.ValueSchema{},
+		Return:         numberSchema,
+		JavascriptCode: `function run() { query("DELETE FROM items;") }`,
+	})
+	store.AddOperation(&operations.Operation{
+		Name:           "query-execs",
+		Kind:           operations.QueryKind,
+		Parameters:     map[string]*operations.ValueSchema{},
+		Return:         numberSchema,
+		JavascriptCode: `function run() { exec("DELETE FROM items;") }`,
+	})
+	store.AddOperation(&operations.Operation{
+		Name:           "add-item",
+		Kind:           operations.MutationKind,
+		Parameters:     map[string]*operations.ValueSchema{},
+		Return:         numberSchema,
+		JavascriptCode: `function run() { return exec("INSERT INTO items (name) VALUES ('b');").rowsAffected }`,
+	})
+
+	executor := operations.NewOperationExecutor(db, store, nil)
+
+	result, err := executor.Execute(t.Context(), "count-items", map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+
+	_, err = executor.Execute(t.Context(), "query-writes", map[string]any{})
+	assert.ErrorContains(t, err, "readonly database")
+
+	_, err = executor.Execute(t.Context(), "query-execs", map[string]any{})
+	assert.ErrorContains(t, err, operations.ErrReadOnlyOperation.Error())
+
+	result, err = executor.Execute(t.Context(), "add-item", map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+
+	result, err = executor.Execute(t.Context(), "count-items", map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result)
 }
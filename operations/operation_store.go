@@ -4,42 +4,240 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 )
 
+// IOperationStore keeps every version of the operations. AddOperation never
+// overwrites a version, it writes a new one and makes it the active version,
+// which is the one returned by GetOperation and ListOperations.
 type IOperationStore interface {
 	GetOperation(operationName string) (*Operation, error)
 	AddOperation(operation *Operation) error
+
+	// ListOperations returns the active version of every stored operation, sorted by name,
+	// and separately the ones that can't be read
+	ListOperations() ([]*Operation, []*BrokenOperation, error)
+
+	// DeleteOperation removes the operation with all its versions
+	DeleteOperation(operationName string) error
+
+	GetOperationVersion(operationName string, version int) (*Operation, error)
+
+	// ListOperationVersions returns the versions of an operation, oldest first
+	ListOperationVersions(operationName string) ([]*OperationVersion, error)
+
+	// RollbackOperation makes a previous version the active one
+	RollbackOperation(operationName string, version int) error
+
+	// OnOperationChanged registers a listener called after an operation is
+	// written, deleted or rolled back
+	OnOperationChanged(listener func(operationName string))
 }
 
 var ErrOperationNotFound = errors.New("operation not found")
 
+var ErrOperationVersionNotFound = errors.New("operation version not found")
+
+var ErrOperationNameConflict = errors.New("operation name conflicts with another operation")
+
+type OperationVersion struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Active    bool      `json:"active"`
+}
+
+// BrokenOperation is a stored operation that can't be read, e.g. because its
+// manifest was edited by hand.
+type BrokenOperation struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+type operationListeners struct {
+	mu        sync.RWMutex
+	listeners []func(operationName string)
+}
+
+func (l *operationListeners) OnOperationChanged(listener func(operationName string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listeners = append(l.listeners, listener)
+}
+
+func (l *operationListeners) notifyOperationChanged(operationName string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, listener := range l.listeners {
+		listener(operationName)
+	}
+}
+
 type InMemoryOperationStore struct {
-	operations map[string]*Operation
+	operationListeners
+	mu         sync.RWMutex
+	operations map[string]*inMemoryOperation
+}
+
+type inMemoryOperation struct {
+	versions      []*Operation
+	createdAt     []time.Time
+	activeVersion int
 }
 
 func NewInMemoryOperationStore() IOperationStore {
 	return &InMemoryOperationStore{
-		operations: map[string]*Operation{},
+		operations: map[string]*inMemoryOperation{},
 	}
 }
 
 func (s *InMemoryOperationStore) GetOperation(operationName string) (*Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	operation, operationExists := s.operations[operationName]
 	if !operationExists {
 		return nil, ErrOperationNotFound
 	}
 
-	return operation, nil
+	return operation.versions[operation.activeVersion-1], nil
 }
 
 func (s *InMemoryOperationStore) AddOperation(operation *Operation) error {
-	s.operations[operation.Name] = operation
+	err := operation.CheckPatterns()
+	if err != nil {
+		return fmt.Errorf("invalid operation %s: %w", operation.Name, err)
+	}
+
+	s.mu.Lock()
+	err = checkTypeScriptNameConflict(operation.Name, slices.Collect(maps.Keys(s.operations)))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	stored, operationExists := s.operations[operation.Name]
+	if !operationExists {
+		stored = &inMemoryOperation{}
+		s.operations[operation.Name] = stored
+	}
+
+	version := *operation
+	version.Version = len(stored.versions) + 1
+	stored.versions = append(stored.versions, &version)
+	stored.createdAt = append(stored.createdAt, time.Now())
+	stored.activeVersion = version.Version
+	s.mu.Unlock()
+
+	s.notifyOperationChanged(operation.Name)
 	return nil
 }
 
+func (s *InMemoryOperationStore) ListOperations() ([]*Operation, []*BrokenOperation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operations := []*Operation{}
+	for _, operationName := range slices.Sorted(maps.Keys(s.operations)) {
+		operation := s.operations[operationName]
+		operations = append(operations, operation.versions[operation.activeVersion-1])
+	}
+
+	return operations, []*BrokenOperation{}, nil
+}
+
+func (s *InMemoryOperationStore) DeleteOperation(operationName string) error {
+	s.mu.Lock()
+	_, operationExists := s.operations[operationName]
+	delete(s.operations, operationName)
+	s.mu.Unlock()
+
+	if !operationExists {
+		return ErrOperationNotFound
+	}
+
+	s.notifyOperationChanged(operationName)
+	return nil
+}
+
+func (s *InMemoryOperationStore) GetOperationVersion(operationName string, version int) (*Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operation, operationExists := s.operations[operationName]
+	if !operationExists {
+		return nil, ErrOperationNotFound
+	}
+
+	if version < 1 || version > len(operation.versions) {
+		return nil, ErrOperationVersionNotFound
+	}
+
+	return operation.versions[version-1], nil
+}
+
+func (s *InMemoryOperationStore) ListOperationVersions(operationName string) ([]*OperationVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	operation, operationExists := s.operations[operationName]
+	if !operationExists {
+		return nil, ErrOperationNotFound
+	}
+
+	versions := []*OperationVersion{}
+	for i, createdAt := range operation.createdAt {
+		versions = append(versions, &OperationVersion{
+			Version:   i + 1,
+			CreatedAt: createdAt,
+			Active:    i+1 == operation.activeVersion,
+		})
+	}
+
+	return versions, nil
+}
+
+func (s *InMemoryOperationStore) RollbackOperation(operationName string, version int) error {
+	s.mu.Lock()
+	operation, operationExists := s.operations[operationName]
+	if !operationExists {
+		s.mu.Unlock()
+		return ErrOperationNotFound
+	}
+
+	if version < 1 || version > len(operation.versions) {
+		s.mu.Unlock()
+		return ErrOperationVersionNotFound
+	}
+
+	operation.activeVersion = version
+	s.mu.Unlock()
+
+	s.notifyOperationChanged(operationName)
+	return nil
+}
+
+// FsOperationStore keeps each operation in a folder:
+//
+//	{name}/versions.json                          which versions exist and which is active
+//	{name}/versions/{version}/operation_manifest.json
+//	{name}/versions/{version}/operation.js
+//
+// Operations stored before versioning have operation_manifest.json and
+// operation.js directly in their folder. They are read as the only version,
+// and moved to version 1 when a new version is added.
 type FsOperationStore struct {
+	operationListeners
+	mu sync.Mutex
 	fs OperationsFs
 }
 type OperationsFs afero.Fs
@@ -50,8 +248,290 @@ func NewFsOperationStore(fs OperationsFs) IOperationStore {
 	}
 }
 
+type operationVersions struct {
+	Name          string              `json:"name"`
+	ActiveVersion int                 `json:"activeVersion"`
+	Versions      []*OperationVersion `json:"versions"`
+}
+
+const legacyVersion = 0
+
 func (s *FsOperationStore) GetOperation(operationName string) (*Operation, error) {
-	manifestFileName := fmt.Sprintf("%s/operation_manifest.json", operationName)
+	versions, err := s.readVersions(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readOperation(operationName, versions.ActiveVersion)
+}
+
+func (s *FsOperationStore) GetOperationVersion(operationName string, version int) (*Operation, error) {
+	versions, err := s.readVersions(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(versions.Versions, func(v *OperationVersion) bool { return v.Version == version }) {
+		return nil, ErrOperationVersionNotFound
+	}
+
+	return s.readOperation(operationName, version)
+}
+
+func (s *FsOperationStore) ListOperationVersions(operationName string) ([]*OperationVersion, error) {
+	versions, err := s.readVersions(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions.Versions {
+		version.Active = version.Version == versions.ActiveVersion
+	}
+
+	return versions.Versions, nil
+}
+
+func (s *FsOperationStore) AddOperation(operation *Operation) error {
+	s.mu.Lock()
+	err := s.addOperation(operation)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.notifyOperationChanged(operation.Name)
+
+	return nil
+}
+
+func (s *FsOperationStore) addOperation(operation *Operation) error {
+	err := operation.CheckPatterns()
+	if err != nil {
+		return fmt.Errorf("invalid operation %s: %w", operation.Name, err)
+	}
+
+	entries, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read operations folder: %w", err)
+	}
+	storedNames := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			storedNames = append(storedNames, entry.Name())
+		}
+	}
+	err = checkTypeScriptNameConflict(operation.Name, storedNames)
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.readVersions(operation.Name)
+	if errors.Is(err, ErrOperationNotFound) {
+		versions = &operationVersions{
+			Name:     operation.Name,
+			Versions: []*OperationVersion{},
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if versions.ActiveVersion == legacyVersion && len(versions.Versions) > 0 {
+		versions, err = s.migrateLegacyOperation(operation.Name)
+		if err != nil {
+			return fmt.Errorf("failed to migrate operation %s to versioned folders: %w", operation.Name, err)
+		}
+	}
+
+	version := &OperationVersion{
+		Version:   len(versions.Versions) + 1,
+		CreatedAt: time.Now(),
+	}
+
+	err = s.writeOperation(operation, versionFolder(operation.Name, version.Version))
+	if err != nil {
+		return err
+	}
+
+	versions.Versions = append(versions.Versions, version)
+	versions.ActiveVersion = version.Version
+
+	return s.writeVersions(versions)
+}
+
+// migrateLegacyOperation moves the files of an operation stored before
+// versioning into version 1.
+func (s *FsOperationStore) migrateLegacyOperation(operationName string) (*operationVersions, error) {
+	operation, err := s.readOperation(operationName, legacyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now()
+	info, err := s.fs.Stat(path.Join(operationName, "operation_manifest.json"))
+	if err == nil {
+		createdAt = info.ModTime()
+	}
+
+	err = s.writeOperation(operation, versionFolder(operationName, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := &operationVersions{
+		Name:          operationName,
+		ActiveVersion: 1,
+		Versions:      []*OperationVersion{{Version: 1, CreatedAt: createdAt}},
+	}
+	err = s.writeVersions(versions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fileName := range []string{"operation_manifest.json", "operation.js"} {
+		err = s.fs.Remove(path.Join(operationName, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove legacy file %s: %w", fileName, err)
+		}
+	}
+
+	return versions, nil
+}
+
+func (s *FsOperationStore) RollbackOperation(operationName string, version int) error {
+	s.mu.Lock()
+	err := s.rollbackOperation(operationName, version)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.notifyOperationChanged(operationName)
+
+	return nil
+}
+
+func (s *FsOperationStore) rollbackOperation(operationName string, version int) error {
+	versions, err := s.readVersions(operationName)
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(versions.Versions, func(v *OperationVersion) bool { return v.Version == version }) {
+		return ErrOperationVersionNotFound
+	}
+
+	versions.ActiveVersion = version
+
+	return s.writeVersions(versions)
+}
+
+func (s *FsOperationStore) DeleteOperation(operationName string) error {
+	s.mu.Lock()
+	_, err := s.fs.Stat(operationName)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.mu.Unlock()
+		return ErrOperationNotFound
+	}
+
+	err = s.fs.RemoveAll(operationName)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to remove operation %s folder: %w", operationName, err)
+	}
+
+	s.notifyOperationChanged(operationName)
+
+	return nil
+}
+
+func (s *FsOperationStore) ListOperations() ([]*Operation, []*BrokenOperation, error) {
+	// operations being written are listed either before or after the write
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := afero.ReadDir(s.fs, ".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read operations folder: %w", err)
+	}
+
+	operations := []*Operation{}
+	brokenOperations := []*BrokenOperation{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		operation, err := s.GetOperation(entry.Name())
+		if err != nil {
+			brokenOperations = append(brokenOperations, &BrokenOperation{
+				Name:  entry.Name(),
+				Error: fmt.Sprintf("failed to get operation %s: %v", entry.Name(), err),
+			})
+			continue
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, brokenOperations, nil
+}
+
+func versionFolder(operationName string, version int) string {
+	if version == legacyVersion {
+		return operationName
+	}
+	return path.Join(operationName, "versions", strconv.Itoa(version))
+}
+
+// readVersions returns the versions of an operation. Operations stored before
+// versioning have a single version, legacyVersion, which is also the active one.
+func (s *FsOperationStore) readVersions(operationName string) (*operationVersions, error) {
+	versionsFileName := path.Join(operationName, "versions.json")
+
+	versionsJson, err := afero.ReadFile(s.fs, versionsFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		info, err := s.fs.Stat(path.Join(operationName, "operation_manifest.json"))
+		if err != nil {
+			return nil, ErrOperationNotFound
+		}
+
+		return &operationVersions{
+			Name:          operationName,
+			ActiveVersion: legacyVersion,
+			Versions:      []*OperationVersion{{Version: legacyVersion, CreatedAt: info.ModTime()}},
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", versionsFileName, err)
+	}
+
+	versions := &operationVersions{}
+	err = json.Unmarshal(versionsJson, versions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse operation versions json from file %s: %w", versionsFileName, err)
+	}
+
+	return versions, nil
+}
+
+func (s *FsOperationStore) writeVersions(versions *operationVersions) error {
+	versionsFileName := path.Join(versions.Name, "versions.json")
+
+	versionsJson, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode operation versions: %w", err)
+	}
+
+	err = afero.WriteFile(s.fs, versionsFileName, versionsJson, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to write operation versions to file %s: %w", versionsFileName, err)
+	}
+
+	return nil
+}
+
+func (s *FsOperationStore) readOperation(operationName string, version int) (*Operation, error) {
+	folder := versionFolder(operationName, version)
+	manifestFileName := path.Join(folder, "operation_manifest.json")
 
 	manifestFile, err := s.fs.Open(manifestFileName)
 	if err != nil {
@@ -65,7 +545,7 @@ func (s *FsOperationStore) GetOperation(operationName string) (*Operation, error
 		return nil, fmt.Errorf("failed to parse operation manifest json from file %s: %w", manifestFileName, err)
 	}
 
-	javscriptCodeFileName := fmt.Sprintf("%s/operation.js", operationName)
+	javscriptCodeFileName := path.Join(folder, "operation.js")
 	javascriptCode, err := afero.ReadFile(s.fs, javscriptCodeFileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read operation javascript coe from file %s: %w", javscriptCodeFileName, err)
@@ -73,22 +553,25 @@ func (s *FsOperationStore) GetOperation(operationName string) (*Operation, error
 
 	operation := &Operation{
 		Name:           operationManifest.Name,
+		Version:        version,
+		Kind:           operationManifest.Kind,
 		JavascriptCode: string(javascriptCode),
 		Parameters:     operationManifest.Parameters,
 		Return:         operationManifest.Return,
+		Limits:         operationManifest.Limits,
 	}
 
 	return operation, nil
 }
 
-func (s *FsOperationStore) AddOperation(operation *Operation) error {
+func (s *FsOperationStore) writeOperation(operation *Operation, folder string) error {
 
-	err := s.fs.MkdirAll(operation.Name, 0755)
+	err := s.fs.MkdirAll(folder, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create operation %s folder: %w", operation.Name, err)
 	}
 
-	manifestFileName := fmt.Sprintf("%s/operation_manifest.json", operation.Name)
+	manifestFileName := path.Join(folder, "operation_manifest.json")
 
 	file, err := s.fs.Create(manifestFileName)
 	if err != nil {
@@ -98,8 +581,10 @@ func (s *FsOperationStore) AddOperation(operation *Operation) error {
 
 	operationManifest := OperationManifest{
 		Name:       operation.Name,
+		Kind:       operation.Kind,
 		Parameters: operation.Parameters,
 		Return:     operation.Return,
+		Limits:     operation.Limits,
 	}
 
 	encoder := json.NewEncoder(file)
@@ -109,7 +594,7 @@ func (s *FsOperationStore) AddOperation(operation *Operation) error {
 		return fmt.Errorf("failed to write operation manifest to file %s: %w", manifestFileName, err)
 	}
 
-	javscriptCodeFileName := fmt.Sprintf("%s/operation.js", operation.Name)
+	javscriptCodeFileName := path.Join(folder, "operation.js")
 	err = afero.WriteFile(s.fs, javscriptCodeFileName, []byte(operation.JavascriptCode), 0755)
 	if err != nil {
 		return fmt.Errorf("failed to write operation javascript code to file %s: %w", javscriptCodeFileName, err)
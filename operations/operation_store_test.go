@@ -1,8 +1,10 @@
 package operations_test
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/prigas-dev/backoffice-ai/metadata"
 	"github.com/prigas-dev/backoffice-ai/operations"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -36,6 +38,251 @@ func TestFsOperationStore(t *testing.T) {
 		storeOperation, err := store.GetOperation("op")
 		assert.NoError(t, err)
 
+		operation.Version = 1
 		assert.Equal(t, operation, storeOperation)
 	})
+
+	t.Run("operation stored before versioning", func(t *testing.T) {
+		t.Parallel()
+
+		files := afero.NewMemMapFs()
+		afero.WriteFile(files, "op/operation_manifest.json", []byte(`{
+			"name": "op",
+			"parameters": {},
+			"return": { "type": "number", "spec": {} }
+		}`), 0755)
+		afero.WriteFile(files, "op/operation.js", []byte(`function run() { return 1 }`), 0755)
+
+		store := operations.NewFsOperationStore(files)
+
+		legacyOperation, err := store.GetOperation("op")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, legacyOperation.Version)
+		assert.Equal(t, `function run() { return 1 }`, legacyOperation.JavascriptCode)
+
+		err = store.AddOperation(newNumberOperation("op", `function run() { return 2 }`))
+		assert.NoError(t, err)
+
+		versions, err := store.ListOperationVersions("op")
+		assert.NoError(t, err)
+		assert.Len(t, versions, 2)
+
+		firstVersion, err := store.GetOperationVersion("op", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, `function run() { return 1 }`, firstVersion.JavascriptCode)
+
+		hasLegacyManifest, _ := afero.Exists(files, "op/operation_manifest.json")
+		assert.False(t, hasLegacyManifest)
+	})
+
+	t.Run("broken operations are reported separately", func(t *testing.T) {
+		t.Parallel()
+
+		files := afero.NewMemMapFs()
+		store := operations.NewFsOperationStore(files)
+
+		err := store.AddOperation(newNumberOperation("op-a", `function run() { return 1 }`))
+		assert.NoError(t, err)
+		err = store.AddOperation(newNumberOperation("op-c", `function run() { return 1 }`))
+		assert.NoError(t, err)
+		afero.WriteFile(files, "op-b/operation_manifest.json", []byte(`{`), 0755)
+
+		allOperations, brokenOperations, err := store.ListOperations()
+		assert.NoError(t, err)
+		assert.Len(t, allOperations, 2)
+		assert.Equal(t, "op-a", allOperations[0].Name)
+		assert.Equal(t, "op-c", allOperations[1].Name)
+		assert.Len(t, brokenOperations, 1)
+		assert.Equal(t, "op-b", brokenOperations[0].Name)
+		assert.Contains(t, brokenOperations[0].Error, "op-b")
+	})
+
+	testOperationStore(t, func() operations.IOperationStore {
+		return operations.NewFsOperationStore(afero.NewMemMapFs())
+	})
+}
+
+func TestInMemoryOperationStore(t *testing.T) {
+	testOperationStore(t, operations.NewInMemoryOperationStore)
+}
+
+func TestSqlOperationStore(t *testing.T) {
+	testOperationStore(t, func() operations.IOperationStore {
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return operations.NewSqlOperationStore(db)
+	})
+
+	t.Run("copy from fs store", func(t *testing.T) {
+		t.Parallel()
+
+		fsStore := operations.NewFsOperationStore(afero.NewMemMapFs())
+		fsStore.AddOperation(newNumberOperation("op", `function run() { return 1 }`))
+		fsStore.AddOperation(newNumberOperation("op", `function run() { return 2 }`))
+		fsStore.RollbackOperation("op", 1)
+
+		db, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+		assert.NoError(t, err)
+		defer db.Close()
+		sqlStore := operations.NewSqlOperationStore(db)
+
+		err = db.WithTx(t.Context(), func(tx *metadata.Tx) error {
+			return operations.CopyOperations(tx, fsStore, sqlStore.(operations.ITxOperationStore))
+		})
+		assert.NoError(t, err)
+
+		operation, err := sqlStore.GetOperation("op")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, operation.Version)
+		assert.Equal(t, `function run() { return 1 }`, operation.JavascriptCode)
+		assert.Equal(t, newNumberOperation("op", "").Return, operation.Return)
+
+		versions, err := sqlStore.ListOperationVersions("op")
+		assert.NoError(t, err)
+		assert.Len(t, versions, 2)
+	})
+}
+
+func testOperationStore(t *testing.T, newStore func() operations.IOperationStore) {
+	t.Run("versions", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		changed := []string{}
+		store.OnOperationChanged(func(operationName string) {
+			changed = append(changed, operationName)
+		})
+
+		err := store.AddOperation(newNumberOperation("op", `function run() { return 1 }`))
+		assert.NoError(t, err)
+		err = store.AddOperation(newNumberOperation("op", `function run() { return 2 }`))
+		assert.NoError(t, err)
+
+		operation, err := store.GetOperation("op")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, operation.Version)
+		assert.Equal(t, `function run() { return 2 }`, operation.JavascriptCode)
+
+		versions, err := store.ListOperationVersions("op")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, []int{versions[0].Version, versions[1].Version})
+		assert.Equal(t, []bool{false, true}, []bool{versions[0].Active, versions[1].Active})
+
+		err = store.RollbackOperation("op", 1)
+		assert.NoError(t, err)
+
+		operation, err = store.GetOperation("op")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, operation.Version)
+		assert.Equal(t, `function run() { return 1 }`, operation.JavascriptCode)
+
+		err = store.AddOperation(newNumberOperation("op", `function run() { return 3 }`))
+		assert.NoError(t, err)
+
+		operation, err = store.GetOperation("op")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, operation.Version)
+
+		err = store.RollbackOperation("op", 4)
+		assert.ErrorIs(t, err, operations.ErrOperationVersionNotFound)
+
+		_, err = store.GetOperationVersion("op", 4)
+		assert.ErrorIs(t, err, operations.ErrOperationVersionNotFound)
+
+		assert.Equal(t, []string{"op", "op", "op", "op"}, changed)
+	})
+
+	t.Run("conflicting TypeScript names are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		err := store.AddOperation(newNumberOperation("get-user", `function run() { return 1 }`))
+		assert.NoError(t, err)
+
+		err = store.AddOperation(newNumberOperation("get_user", `function run() { return 1 }`))
+		assert.ErrorIs(t, err, operations.ErrOperationNameConflict)
+
+		_, err = store.GetOperation("get_user")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+
+		err = store.AddOperation(newNumberOperation("get-user", `function run() { return 2 }`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid patterns are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		operation := newNumberOperation("op", `function run() { return 1 }`)
+		operation.Parameters["items"] = &operations.ValueSchema{
+			Type: operations.Array,
+			Spec: &operations.ArraySpec{
+				Items: &operations.ValueSchema{
+					Type: operations.String,
+					Spec: &operations.StringSpec{Pattern: "[0-9"},
+				},
+			},
+		}
+
+		err := store.AddOperation(operation)
+		var patternErr *operations.InvalidPatternError
+		assert.ErrorAs(t, err, &patternErr)
+		assert.Equal(t, "/parameters/items/spec/items/spec/pattern", patternErr.Path)
+
+		_, err = store.GetOperation("op")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		t.Parallel()
+
+		store := newStore()
+
+		err := store.AddOperation(newNumberOperation("op-b", `function run() { return 1 }`))
+		assert.NoError(t, err)
+		err = store.AddOperation(newNumberOperation("op-a", `function run() { return 1 }`))
+		assert.NoError(t, err)
+		err = store.AddOperation(newNumberOperation("op-a", `function run() { return 2 }`))
+		assert.NoError(t, err)
+
+		allOperations, brokenOperations, err := store.ListOperations()
+		assert.NoError(t, err)
+		assert.Empty(t, brokenOperations)
+		assert.Len(t, allOperations, 2)
+		assert.Equal(t, "op-a", allOperations[0].Name)
+		assert.Equal(t, 2, allOperations[0].Version)
+		assert.Equal(t, "op-b", allOperations[1].Name)
+
+		err = store.DeleteOperation("op-a")
+		assert.NoError(t, err)
+
+		_, err = store.GetOperation("op-a")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+
+		allOperations, _, err = store.ListOperations()
+		assert.NoError(t, err)
+		assert.Len(t, allOperations, 1)
+
+		err = store.DeleteOperation("op-a")
+		assert.ErrorIs(t, err, operations.ErrOperationNotFound)
+	})
+}
+
+func newNumberOperation(name string, javascriptCode string) *operations.Operation {
+	return &operations.Operation{
+		Name:           name,
+		JavascriptCode: javascriptCode,
+		Parameters:     map[string]*operations.ValueSchema{},
+		Return: &operations.ValueSchema{
+			Type: operations.Number,
+			Spec: &operations.NumberSpec{},
+		},
+	}
 }
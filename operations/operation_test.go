@@ -106,7 +106,7 @@ func TestValueSchema(t *testing.T) {
 				desc:                     "invalid string",
 				spec:                     &operations.StringSpec{},
 				value:                    12,
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a string"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a string", Errors: []operations.ValidationError{{Path: "", Message: "value is not a string"}}},
 			},
 			{
 				desc:                     "valid number: float64",
@@ -130,7 +130,7 @@ func TestValueSchema(t *testing.T) {
 				desc:                     "invalid number",
 				spec:                     &operations.NumberSpec{},
 				value:                    "",
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a float64 or int64"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a float64 or int64", Errors: []operations.ValidationError{{Path: "", Message: "value is not a float64 or int64"}}},
 			},
 			{
 				desc:                     "valid boolean",
@@ -148,7 +148,7 @@ func TestValueSchema(t *testing.T) {
 				desc:                     "invalid boolean",
 				spec:                     &operations.BooleanSpec{},
 				value:                    "",
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a bool"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a bool", Errors: []operations.ValidationError{{Path: "", Message: "value is not a bool"}}},
 			},
 			{
 				desc: "valid object",
@@ -185,7 +185,7 @@ func TestValueSchema(t *testing.T) {
 					Properties: map[string]*operations.ValueSchema{},
 				},
 				value:                    "",
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a map"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a map", Errors: []operations.ValidationError{{Path: "", Message: "value is not a map"}}},
 			},
 			{
 				desc: "invalid object: missing property",
@@ -198,7 +198,7 @@ func TestValueSchema(t *testing.T) {
 					},
 				},
 				value:                    map[string]any{},
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "missing property prigas"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "/prigas: missing property prigas", Errors: []operations.ValidationError{{Path: "/prigas", Message: "missing property prigas"}}},
 			},
 			{
 				desc: "invalid object: invalid property",
@@ -213,7 +213,7 @@ func TestValueSchema(t *testing.T) {
 				value: map[string]any{
 					"prigas": "non bool",
 				},
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "invalid property prigas: value is not a bool"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "/prigas: value is not a bool", Errors: []operations.ValidationError{{Path: "/prigas", Message: "value is not a bool"}}},
 			},
 			{
 				desc: "valid array",
@@ -247,7 +247,180 @@ func TestValueSchema(t *testing.T) {
 					},
 				},
 				value:                    []any{12.0, "not a number"},
-				expectedValidationResult: operations.ValidationResult{Success: false, Message: "invalid item 1: value is not a float64 or int64"},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "/1: value is not a float64 or int64", Errors: []operations.ValidationError{{Path: "/1", Message: "value is not a float64 or int64"}}},
+			},
+			{
+				desc:                     "valid string: enum",
+				spec:                     &operations.StringSpec{Enum: []string{"todo", "done"}},
+				value:                    "done",
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc:                     "invalid string: enum",
+				spec:                     &operations.StringSpec{Enum: []string{"todo", "done"}},
+				value:                    "doing",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value must be one of todo, done", Errors: []operations.ValidationError{{Path: "", Message: "value must be one of todo, done"}}},
+			},
+			{
+				desc:                     "invalid string: length",
+				spec:                     &operations.StringSpec{MinLength: ptr(3), MaxLength: ptr(2)},
+				value:                    "😏😏",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value must have at least 3 characters", Errors: []operations.ValidationError{{Path: "", Message: "value must have at least 3 characters"}}},
+			},
+			{
+				desc:                     "invalid string: pattern",
+				spec:                     &operations.StringSpec{Pattern: "^[a-z]+$"},
+				value:                    "Prigas",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value does not match pattern ^[a-z]+$", Errors: []operations.ValidationError{{Path: "", Message: "value does not match pattern ^[a-z]+$"}}},
+			},
+			{
+				desc:                     "valid string: date-time",
+				spec:                     &operations.StringSpec{Format: operations.DateTimeFormat},
+				value:                    "2025-04-20T10:00:00Z",
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc:                     "invalid string: date-time",
+				spec:                     &operations.StringSpec{Format: operations.DateTimeFormat},
+				value:                    "2025-04-20",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a valid date-time", Errors: []operations.ValidationError{{Path: "", Message: "value is not a valid date-time"}}},
+			},
+			{
+				desc:                     "valid string: email",
+				spec:                     &operations.StringSpec{Format: operations.EmailFormat},
+				value:                    "bob@example.com",
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc:                     "invalid string: email",
+				spec:                     &operations.StringSpec{Format: operations.EmailFormat},
+				value:                    "Bob <bob@example.com>",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a valid email", Errors: []operations.ValidationError{{Path: "", Message: "value is not a valid email"}}},
+			},
+			{
+				desc:                     "valid string: uuid",
+				spec:                     &operations.StringSpec{Format: operations.UUIDFormat},
+				value:                    "3f2504e0-4f89-11d3-9a0c-0305e82c3301",
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc:                     "invalid string: uuid",
+				spec:                     &operations.StringSpec{Format: operations.UUIDFormat},
+				value:                    "3f2504e04f8911d39a0c0305e82c3301",
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not a valid uuid", Errors: []operations.ValidationError{{Path: "", Message: "value is not a valid uuid"}}},
+			},
+			{
+				desc:                     "valid number: integer",
+				spec:                     &operations.NumberSpec{Integer: true},
+				value:                    12.0,
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc:                     "invalid number: integer",
+				spec:                     &operations.NumberSpec{Integer: true},
+				value:                    12.5,
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value is not an integer", Errors: []operations.ValidationError{{Path: "", Message: "value is not an integer"}}},
+			},
+			{
+				desc:                     "invalid number: enum",
+				spec:                     &operations.NumberSpec{Enum: []float64{1, 2.5}},
+				value:                    int64(3),
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value must be one of 1, 2.5", Errors: []operations.ValidationError{{Path: "", Message: "value must be one of 1, 2.5"}}},
+			},
+			{
+				desc:                     "invalid number: range",
+				spec:                     &operations.NumberSpec{Minimum: ptr(1.0), Maximum: ptr(5.0)},
+				value:                    int64(6),
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value must be less than or equal to 5", Errors: []operations.ValidationError{{Path: "", Message: "value must be less than or equal to 5"}}},
+			},
+			{
+				desc: "valid object: optional property",
+				spec: &operations.ObjectSpec{
+					Properties: map[string]*operations.ValueSchema{
+						"prigas": {
+							Type: operations.Boolean,
+							Spec: &operations.BooleanSpec{},
+						},
+					},
+					Optional: []string{"prigas"},
+				},
+				value:                    map[string]any{},
+				expectedValidationResult: operations.ValidationResult{Success: true},
+			},
+			{
+				desc: "invalid object: additional properties",
+				spec: &operations.ObjectSpec{
+					Properties:           map[string]*operations.ValueSchema{},
+					AdditionalProperties: ptr(false),
+				},
+				value: map[string]any{
+					"prigas": true,
+				},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "/prigas: unexpected property prigas", Errors: []operations.ValidationError{{Path: "/prigas", Message: "unexpected property prigas"}}},
+			},
+			{
+				desc: "invalid array: items count",
+				spec: &operations.ArraySpec{
+					Items: &operations.ValueSchema{
+						Type: operations.Number,
+						Spec: &operations.NumberSpec{},
+					},
+					MinItems: ptr(2),
+				},
+				value:                    []any{12.0},
+				expectedValidationResult: operations.ValidationResult{Success: false, Message: "value must have at least 2 items", Errors: []operations.ValidationError{{Path: "", Message: "value must have at least 2 items"}}},
+			},
+			{
+				desc: "collects every error",
+				spec: &operations.ObjectSpec{
+					Properties: map[string]*operations.ValueSchema{
+						"name": {
+							Type: operations.String,
+							Spec: &operations.StringSpec{MinLength: ptr(1)},
+						},
+						"a/b": {
+							Type: operations.Boolean,
+							Spec: &operations.BooleanSpec{},
+						},
+						"tags": {
+							Type: operations.Array,
+							Spec: &operations.ArraySpec{
+								Items: &operations.ValueSchema{
+									Type: operations.String,
+									Spec: &operations.StringSpec{},
+								},
+							},
+						},
+						"owner": {
+							Type: operations.Object,
+							Spec: &operations.ObjectSpec{
+								Properties: map[string]*operations.ValueSchema{
+									"id": {
+										Type: operations.Number,
+										Spec: &operations.NumberSpec{},
+									},
+								},
+							},
+						},
+					},
+				},
+				value: map[string]any{
+					"name":  "",
+					"a/b":   "true",
+					"tags":  []any{"ok", 1.0, false},
+					"owner": map[string]any{},
+				},
+				expectedValidationResult: operations.ValidationResult{
+					Success: false,
+					Message: "/a~1b: value is not a bool; /name: value must have at least 1 characters; /owner/id: missing property id; /tags/1: value is not a string; /tags/2: value is not a string",
+					Errors: []operations.ValidationError{
+						{Path: "/a~1b", Message: "value is not a bool"},
+						{Path: "/name", Message: "value must have at least 1 characters"},
+						{Path: "/owner/id", Message: "missing property id"},
+						{Path: "/tags/1", Message: "value is not a string"},
+						{Path: "/tags/2", Message: "value is not a string"},
+					},
+				},
 			},
 		}
 		for _, tC := range testCases {
@@ -261,3 +434,7 @@ func TestValueSchema(t *testing.T) {
 		}
 	})
 }
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,107 @@
+package operations
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// ProgramCache keeps compiled operation scripts, so they are parsed only once
+// per operation version.
+type ProgramCache struct {
+	mu       sync.RWMutex
+	programs map[string]*cachedProgram
+}
+
+type cachedProgram struct {
+	hash    [sha256.Size]byte
+	program *goja.Program
+}
+
+func NewProgramCache() *ProgramCache {
+	return &ProgramCache{
+		programs: map[string]*cachedProgram{},
+	}
+}
+
+// Get returns the compiled script of operation name, compiling it when it is
+// not cached yet or when the cached program was compiled from another script.
+func (c *ProgramCache) Get(name string, script string) (*goja.Program, error) {
+	hash := sha256.Sum256([]byte(script))
+
+	c.mu.RLock()
+	cached, isCached := c.programs[name]
+	c.mu.RUnlock()
+
+	if isCached && cached.hash == hash {
+		return cached.program, nil
+	}
+
+	program, err := goja.Compile(name, script, false)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.programs[name] = &cachedProgram{
+		hash:    hash,
+		program: program,
+	}
+	c.mu.Unlock()
+
+	return program, nil
+}
+
+func (c *ProgramCache) Invalidate(name string) {
+	c.mu.Lock()
+	delete(c.programs, name)
+	c.mu.Unlock()
+}
+
+// RuntimePool creates runtimes ahead of time, so executions don't pay for
+// goja.New(). Runtimes are never reused, each Get returns a fresh one.
+type RuntimePool struct {
+	runtimes chan *goja.Runtime
+	done     chan struct{}
+}
+
+func NewRuntimePool(size int) *RuntimePool {
+	p := &RuntimePool{
+		runtimes: make(chan *goja.Runtime, size),
+		done:     make(chan struct{}),
+	}
+
+	go p.fill()
+
+	return p
+}
+
+func (p *RuntimePool) fill() {
+	for {
+		vm := newRuntime()
+		select {
+		case p.runtimes <- vm:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Get returns a pre-warmed runtime, or a new one if the pool is empty or nil.
+func (p *RuntimePool) Get() *goja.Runtime {
+	if p == nil {
+		return newRuntime()
+	}
+
+	select {
+	case vm := <-p.runtimes:
+		return vm
+	default:
+		return newRuntime()
+	}
+}
+
+func (p *RuntimePool) Close() {
+	close(p.done)
+}
@@ -0,0 +1,169 @@
+package operations_test
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgramCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("same script is compiled once", func(t *testing.T) {
+		t.Parallel()
+
+		cache := operations.NewProgramCache()
+
+		first, err := cache.Get("op", `function run() { return 1 }`)
+		assert.NoError(t, err)
+
+		second, err := cache.Get("op", `function run() { return 1 }`)
+		assert.NoError(t, err)
+
+		assert.Same(t, first, second)
+	})
+
+	t.Run("changed script is recompiled", func(t *testing.T) {
+		t.Parallel()
+
+		cache := operations.NewProgramCache()
+
+		first, err := cache.Get("op", `function run() { return 1 }`)
+		assert.NoError(t, err)
+
+		second, err := cache.Get("op", `function run() { return 2 }`)
+		assert.NoError(t, err)
+
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		t.Parallel()
+
+		cache := operations.NewProgramCache()
+
+		first, err := cache.Get("op", `function run() { return 1 }`)
+		assert.NoError(t, err)
+
+		cache.Invalidate("op")
+
+		second, err := cache.Get("op", `function run() { return 1 }`)
+		assert.NoError(t, err)
+
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("syntax errors are not cached", func(t *testing.T) {
+		t.Parallel()
+
+		cache := operations.NewProgramCache()
+
+		_, err := cache.Get("op", `function run() {`)
+		assert.Error(t, err)
+
+		_, err = cache.Get("op", `function run() {`)
+		assert.Error(t, err)
+	})
+}
+
+func TestRuntimePool(t *testing.T) {
+	t.Parallel()
+
+	t.Run("returns fresh runtimes", func(t *testing.T) {
+		t.Parallel()
+
+		pool := operations.NewRuntimePool(2)
+		t.Cleanup(pool.Close)
+
+		first := pool.Get()
+		second := pool.Get()
+
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("nil pool creates runtimes", func(t *testing.T) {
+		t.Parallel()
+
+		var pool *operations.RuntimePool
+
+		assert.NotNil(t, pool.Get())
+	})
+}
+
+const benchmarkScript = `
+function run({ tasks }) {
+  const statusCounts = { todo: 0, in_progress: 0, done: 0 }
+  const priorityCounts = {}
+  for (const task of tasks) {
+    statusCounts[task.status] = (statusCounts[task.status] || 0) + 1
+    priorityCounts[task.priority] = (priorityCounts[task.priority] || 0) + 1
+  }
+
+  const upcoming = tasks
+    .filter((task) => task.status !== 'done')
+    .sort((a, b) => a.priority - b.priority)
+    .slice(0, 5)
+    .map((task) => ({ id: task.id, title: task.title }))
+
+  return {
+    total: tasks.length,
+    statusCounts,
+    priorityCounts: Object.entries(priorityCounts).map(([priority, count]) => ({ priority, count })),
+    upcoming,
+  }
+}
+`
+
+func BenchmarkExecuteJavascript(b *testing.B) {
+	tasks := []any{}
+	for i := range 20 {
+		tasks = append(tasks, map[string]any{
+			"id":       i,
+			"title":    "task",
+			"status":   []string{"todo", "in_progress", "done"}[i%3],
+			"priority": i % 4,
+		})
+	}
+	arguments := map[string]any{"tasks": tasks}
+
+	b.Run("compile every call", func(b *testing.B) {
+		for b.Loop() {
+			_, err := operations.ExecuteJavascript[any](b.Context(), "bench", benchmarkScript, arguments, map[string]any{}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached program", func(b *testing.B) {
+		cache := operations.NewProgramCache()
+		for b.Loop() {
+			program, err := cache.Get("bench", benchmarkScript)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = operations.ExecuteProgram[any](b.Context(), goja.New(), "bench", program, arguments, map[string]any{}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached program and runtime pool", func(b *testing.B) {
+		cache := operations.NewProgramCache()
+		pool := operations.NewRuntimePool(16)
+		b.Cleanup(pool.Close)
+		for b.Loop() {
+			program, err := cache.Get("bench", benchmarkScript)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = operations.ExecuteProgram[any](b.Context(), pool.Get(), "bench", program, arguments, map[string]any{}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,395 @@
+package operations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prigas-dev/backoffice-ai/metadata"
+)
+
+// ITxOperationStore is a store that can add and delete operations as part of
+// a larger metadata transaction, e.g. together with the feature using them.
+type ITxOperationStore interface {
+	IOperationStore
+	AddOperationTx(tx *metadata.Tx, operation *Operation) error
+	DeleteOperationTx(tx *metadata.Tx, operationName string) error
+	RollbackOperationTx(tx *metadata.Tx, operationName string, version int) error
+}
+
+type SqlOperationStore struct {
+	operationListeners
+	db *metadata.DB
+}
+
+func NewSqlOperationStore(db *metadata.DB) IOperationStore {
+	return &SqlOperationStore{
+		db: db,
+	}
+}
+
+func (s *SqlOperationStore) GetOperation(operationName string) (*Operation, error) {
+	row := s.db.QueryRow(`
+		SELECT v.version, v.manifest, v.javascript_code
+		FROM operations o
+		JOIN operation_versions v ON v.operation_name = o.name AND v.version = o.active_version
+		WHERE o.name = ?
+	`, operationName)
+
+	operation, err := scanOperation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOperationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation %s: %w", operationName, err)
+	}
+
+	return operation, nil
+}
+
+func (s *SqlOperationStore) GetOperationVersion(operationName string, version int) (*Operation, error) {
+	row := s.db.QueryRow(`
+		SELECT version, manifest, javascript_code
+		FROM operation_versions
+		WHERE operation_name = ? AND version = ?
+	`, operationName, version)
+
+	operation, err := scanOperation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err := s.GetOperation(operationName)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrOperationVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation %s version %d: %w", operationName, version, err)
+	}
+
+	return operation, nil
+}
+
+func (s *SqlOperationStore) ListOperations() ([]*Operation, []*BrokenOperation, error) {
+	rows, err := s.db.Query(`
+		SELECT o.name, v.version, v.manifest, v.javascript_code
+		FROM operations o
+		JOIN operation_versions v ON v.operation_name = o.name AND v.version = o.active_version
+		ORDER BY o.name
+	`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	defer rows.Close()
+
+	operations := []*Operation{}
+	brokenOperations := []*BrokenOperation{}
+	for rows.Next() {
+		var operationName string
+		var version int
+		var manifestJson string
+		var javascriptCode string
+		err := rows.Scan(&operationName, &version, &manifestJson, &javascriptCode)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read operation: %w", err)
+		}
+
+		operation, err := parseOperation(version, manifestJson, javascriptCode)
+		if err != nil {
+			brokenOperations = append(brokenOperations, &BrokenOperation{
+				Name:  operationName,
+				Error: fmt.Sprintf("failed to read operation %s: %v", operationName, err),
+			})
+			continue
+		}
+		operations = append(operations, operation)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	return operations, brokenOperations, nil
+}
+
+func (s *SqlOperationStore) ListOperationVersions(operationName string) ([]*OperationVersion, error) {
+	rows, err := s.db.Query(`
+		SELECT v.version, v.created_at, v.version = o.active_version
+		FROM operations o
+		JOIN operation_versions v ON v.operation_name = o.name
+		WHERE o.name = ?
+		ORDER BY v.version
+	`, operationName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operation %s versions: %w", operationName, err)
+	}
+	defer rows.Close()
+
+	versions := []*OperationVersion{}
+	for rows.Next() {
+		version := &OperationVersion{}
+		var createdAt string
+		err := rows.Scan(&version.Version, &createdAt, &version.Active)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation %s version: %w", operationName, err)
+		}
+
+		version.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creation time of operation %s version %d: %w", operationName, version.Version, err)
+		}
+
+		versions = append(versions, version)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operation %s versions: %w", operationName, err)
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrOperationNotFound
+	}
+
+	return versions, nil
+}
+
+func (s *SqlOperationStore) AddOperation(operation *Operation) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.AddOperationTx(tx, operation)
+	})
+}
+
+func (s *SqlOperationStore) AddOperationTx(tx *metadata.Tx, operation *Operation) error {
+	err := operation.CheckPatterns()
+	if err != nil {
+		return fmt.Errorf("invalid operation %s: %w", operation.Name, err)
+	}
+
+	err = s.checkTypeScriptNameConflictTx(tx, operation.Name)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := json.Marshal(OperationManifest{
+		Name:       operation.Name,
+		Kind:       operation.Kind,
+		Parameters: operation.Parameters,
+		Return:     operation.Return,
+		Limits:     operation.Limits,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode operation %s manifest: %w", operation.Name, err)
+	}
+
+	var version int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(version), 0) + 1 FROM operation_versions WHERE operation_name = ?
+	`, operation.Name).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to get next version of operation %s: %w", operation.Name, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO operations (name, active_version) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET active_version = excluded.active_version
+	`, operation.Name, version)
+	if err != nil {
+		return fmt.Errorf("failed to write operation %s: %w", operation.Name, err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO operation_versions (operation_name, version, created_at, manifest, javascript_code)
+		VALUES (?, ?, ?, ?, ?)
+	`, operation.Name, version, time.Now().UTC().Format(time.RFC3339Nano), string(manifest), operation.JavascriptCode)
+	if err != nil {
+		return fmt.Errorf("failed to write operation %s version %d: %w", operation.Name, version, err)
+	}
+
+	tx.AfterCommit(func() {
+		s.notifyOperationChanged(operation.Name)
+	})
+
+	return nil
+}
+
+func (s *SqlOperationStore) checkTypeScriptNameConflictTx(tx *metadata.Tx, operationName string) error {
+	rows, err := tx.Query(`SELECT name FROM operations`)
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+	defer rows.Close()
+
+	storedNames := []string{}
+	for rows.Next() {
+		var storedName string
+		err := rows.Scan(&storedName)
+		if err != nil {
+			return fmt.Errorf("failed to read operation name: %w", err)
+		}
+		storedNames = append(storedNames, storedName)
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	return checkTypeScriptNameConflict(operationName, storedNames)
+}
+
+func (s *SqlOperationStore) DeleteOperation(operationName string) error {
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.DeleteOperationTx(tx, operationName)
+	})
+}
+
+func (s *SqlOperationStore) DeleteOperationTx(tx *metadata.Tx, operationName string) error {
+	_, err := tx.Exec(`DELETE FROM operation_versions WHERE operation_name = ?`, operationName)
+	if err != nil {
+		return fmt.Errorf("failed to delete operation %s versions: %w", operationName, err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM operations WHERE name = ?`, operationName)
+	if err != nil {
+		return fmt.Errorf("failed to delete operation %s: %w", operationName, err)
+	}
+
+	err = requireAffectedRow(result, ErrOperationNotFound)
+	if err != nil {
+		return err
+	}
+
+	tx.AfterCommit(func() {
+		s.notifyOperationChanged(operationName)
+	})
+
+	return nil
+}
+
+func (s *SqlOperationStore) RollbackOperation(operationName string, version int) error {
+	_, err := s.GetOperationVersion(operationName, version)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTx(context.Background(), func(tx *metadata.Tx) error {
+		return s.RollbackOperationTx(tx, operationName, version)
+	})
+}
+
+func (s *SqlOperationStore) RollbackOperationTx(tx *metadata.Tx, operationName string, version int) error {
+	result, err := tx.Exec(`
+		UPDATE operations SET active_version = ?
+		WHERE name = ? AND EXISTS (
+			SELECT 1 FROM operation_versions WHERE operation_name = ? AND version = ?
+		)
+	`, version, operationName, operationName, version)
+	if err != nil {
+		return fmt.Errorf("failed to rollback operation %s to version %d: %w", operationName, version, err)
+	}
+
+	err = requireAffectedRow(result, ErrOperationVersionNotFound)
+	if err != nil {
+		return err
+	}
+
+	tx.AfterCommit(func() {
+		s.notifyOperationChanged(operationName)
+	})
+
+	return nil
+}
+
+func requireAffectedRow(result sql.Result, notFoundErr error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFoundErr
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOperation(row rowScanner) (*Operation, error) {
+	var version int
+	var manifestJson string
+	var javascriptCode string
+	err := row.Scan(&version, &manifestJson, &javascriptCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseOperation(version, manifestJson, javascriptCode)
+}
+
+func parseOperation(version int, manifestJson string, javascriptCode string) (*Operation, error) {
+	manifest := OperationManifest{}
+	err := json.Unmarshal([]byte(manifestJson), &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse operation manifest json: %w", err)
+	}
+
+	operation := &Operation{
+		Name:           manifest.Name,
+		Version:        version,
+		Kind:           manifest.Kind,
+		JavascriptCode: javascriptCode,
+		Parameters:     manifest.Parameters,
+		Return:         manifest.Return,
+		Limits:         manifest.Limits,
+	}
+
+	return operation, nil
+}
+
+// CopyOperations copies every version of the operations in from into to,
+// keeping the same active versions, as part of tx. Versions are renumbered
+// from 1, so operations stored before versioning get version 1.
+func CopyOperations(tx *metadata.Tx, from IOperationStore, to ITxOperationStore) error {
+	allOperations, brokenOperations, err := from.ListOperations()
+	if err != nil {
+		return fmt.Errorf("failed to list operations: %w", err)
+	}
+	if len(brokenOperations) > 0 {
+		return fmt.Errorf("operation %s is broken, fix or remove it before copying the operations: %s", brokenOperations[0].Name, brokenOperations[0].Error)
+	}
+
+	for _, activeOperation := range allOperations {
+		versions, err := from.ListOperationVersions(activeOperation.Name)
+		if err != nil {
+			return fmt.Errorf("failed to list operation %s versions: %w", activeOperation.Name, err)
+		}
+
+		activeVersion := 0
+		for i, version := range versions {
+			operation, err := from.GetOperationVersion(activeOperation.Name, version.Version)
+			if err != nil {
+				return fmt.Errorf("failed to get operation %s version %d: %w", activeOperation.Name, version.Version, err)
+			}
+
+			err = to.AddOperationTx(tx, operation)
+			if err != nil {
+				return fmt.Errorf("failed to add operation %s version %d: %w", activeOperation.Name, version.Version, err)
+			}
+
+			if version.Active {
+				activeVersion = i + 1
+			}
+		}
+
+		if activeVersion != len(versions) {
+			err = to.RollbackOperationTx(tx, activeOperation.Name, activeVersion)
+			if err != nil {
+				return fmt.Errorf("failed to set operation %s active version: %w", activeOperation.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
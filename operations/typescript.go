@@ -0,0 +1,112 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prigas-dev/backoffice-ai/utils"
+)
+
+const typeScriptIndent = "  "
+
+// ToTypeScript returns the TypeScript type of the values accepted by s.
+// Nested object types are indented as if the type started at level indent.
+func (s *ValueSchema) ToTypeScript(indent int) string {
+	typeScriptType, nullable := s.typeScriptType(indent)
+	if nullable {
+		return fmt.Sprintf("%s | null", typeScriptType)
+	}
+	return typeScriptType
+}
+
+func (s *ValueSchema) typeScriptType(indent int) (string, bool) {
+	switch spec := s.Spec.(type) {
+	case *StringSpec:
+		if len(spec.Enum) > 0 {
+			return strings.Join(utils.Map(spec.Enum, typeScriptString), " | "), spec.Nullable
+		}
+		return "string", spec.Nullable
+	case *NumberSpec:
+		if len(spec.Enum) > 0 {
+			enum := utils.Map(spec.Enum, func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) })
+			return strings.Join(enum, " | "), spec.Nullable
+		}
+		return "number", spec.Nullable
+	case *BooleanSpec:
+		return "boolean", spec.Nullable
+	case *ObjectSpec:
+		if len(spec.Properties) == 0 {
+			return "Record<string, unknown>", spec.Nullable
+		}
+
+		propertyIndent := strings.Repeat(typeScriptIndent, indent+1)
+		lines := []string{"{"}
+		for _, propertyName := range slices.Sorted(maps.Keys(spec.Properties)) {
+			optional := ""
+			if slices.Contains(spec.Optional, propertyName) {
+				optional = "?"
+			}
+			property := spec.Properties[propertyName].ToTypeScript(indent + 1)
+			lines = append(lines, fmt.Sprintf("%s%s%s: %s;", propertyIndent, typeScriptPropertyName(propertyName), optional, property))
+		}
+		lines = append(lines, fmt.Sprintf("%s}", strings.Repeat(typeScriptIndent, indent)))
+
+		return strings.Join(lines, "\n"), spec.Nullable
+	case *ArraySpec:
+		return fmt.Sprintf("Array<%s>", spec.Items.ToTypeScript(indent)), spec.Nullable
+	}
+
+	return "unknown", false
+}
+
+var typeScriptIdentifierRegex = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func typeScriptPropertyName(name string) string {
+	if typeScriptIdentifierRegex.MatchString(name) {
+		return name
+	}
+	return typeScriptString(name)
+}
+
+func typeScriptString(value string) string {
+	// JSON strings are valid TypeScript string literals
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// checkTypeScriptNameConflict fails when another of storedNames has the same
+// TypeScript name as operationName, e.g. get-user and get_user, since the
+// operations client would declare it twice.
+func checkTypeScriptNameConflict(operationName string, storedNames []string) error {
+	typeName := TypeScriptName(operationName)
+	for _, storedName := range slices.Sorted(slices.Values(storedNames)) {
+		if storedName != operationName && TypeScriptName(storedName) == typeName {
+			return fmt.Errorf("operation %s and %s are both named %s in TypeScript: %w", operationName, storedName, typeName, ErrOperationNameConflict)
+		}
+	}
+	return nil
+}
+
+// TypeScriptName converts an operation name like get-task-by-id to
+// GetTaskById, to be used in TypeScript identifiers.
+func TypeScriptName(operationName string) string {
+	words := strings.FieldsFunc(operationName, func(r rune) bool {
+		return !(r == '$' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z')
+	})
+
+	name := ""
+	for _, word := range words {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		name = "Operation" + name
+	}
+
+	return name
+}
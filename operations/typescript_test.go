@@ -0,0 +1,87 @@
+package operations_test
+
+import (
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/operations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypeScript(t *testing.T) {
+	t.Run("value schema types", func(t *testing.T) {
+		testCases := []struct {
+			desc         string
+			schema       *operations.ValueSchema
+			expectedType string
+		}{
+			{
+				desc:         "nullable string",
+				schema:       &operations.ValueSchema{Type: operations.String, Spec: &operations.StringSpec{Nullable: true}},
+				expectedType: "string | null",
+			},
+			{
+				desc:         "string enum",
+				schema:       &operations.ValueSchema{Type: operations.String, Spec: &operations.StringSpec{Enum: []string{"todo", "done"}}},
+				expectedType: `"todo" | "done"`,
+			},
+			{
+				desc:         "number enum",
+				schema:       &operations.ValueSchema{Type: operations.Number, Spec: &operations.NumberSpec{Enum: []float64{1, 2.5}}},
+				expectedType: "1 | 2.5",
+			},
+			{
+				desc:         "boolean",
+				schema:       &operations.ValueSchema{Type: operations.Boolean, Spec: &operations.BooleanSpec{}},
+				expectedType: "boolean",
+			},
+			{
+				desc: "array of nullable numbers",
+				schema: &operations.ValueSchema{Type: operations.Array, Spec: &operations.ArraySpec{
+					Items: &operations.ValueSchema{Type: operations.Number, Spec: &operations.NumberSpec{Nullable: true}},
+				}},
+				expectedType: "Array<number | null>",
+			},
+			{
+				desc: "object",
+				schema: &operations.ValueSchema{Type: operations.Object, Spec: &operations.ObjectSpec{
+					Nullable: true,
+					Properties: map[string]*operations.ValueSchema{
+						"due-date": {Type: operations.String, Spec: &operations.StringSpec{}},
+						"owner": {Type: operations.Object, Spec: &operations.ObjectSpec{
+							Properties: map[string]*operations.ValueSchema{
+								"id": {Type: operations.Number, Spec: &operations.NumberSpec{}},
+							},
+						}},
+					},
+					Optional: []string{"owner"},
+				}},
+				expectedType: "{\n" +
+					"  \"due-date\": string;\n" +
+					"  owner?: {\n" +
+					"    id: number;\n" +
+					"  };\n" +
+					"} | null",
+			},
+			{
+				desc:         "object without properties",
+				schema:       &operations.ValueSchema{Type: operations.Object, Spec: &operations.ObjectSpec{}},
+				expectedType: "Record<string, unknown>",
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				t.Parallel()
+
+				assert.Equal(t, tC.expectedType, tC.schema.ToTypeScript(0))
+			})
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, "GetTaskById", operations.TypeScriptName("get-task-by-id"))
+		assert.Equal(t, "UpdateTaskStatus", operations.TypeScriptName("update_task status"))
+		assert.Equal(t, "Operation2fa", operations.TypeScriptName("2fa"))
+	})
+}
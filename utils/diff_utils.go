@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+	// lines of from and to before this line
+	fromPos int
+	toPos   int
+}
+
+// UnifiedDiff returns the changes from from to to in unified diff format,
+// with 3 lines of context. It returns an empty string when they are equal.
+func UnifiedDiff(fromName string, toName string, from string, to string) string {
+	if from == to {
+		return ""
+	}
+
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", fromName, toName)
+
+	i := 0
+	for i < len(lines) {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is close enough for their
+		// context lines to overlap
+		lastChange := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				lastChange = j
+			} else if j-lastChange > 2*diffContextLines {
+				break
+			}
+		}
+
+		start := max(0, i-diffContextLines)
+		end := min(len(lines), lastChange+diffContextLines+1)
+		writeHunk(&diff, lines[start:end])
+
+		i = end
+	}
+
+	return diff.String()
+}
+
+func writeHunk(diff *strings.Builder, lines []diffLine) {
+	fromLength := 0
+	toLength := 0
+	for _, line := range lines {
+		if line.kind != '+' {
+			fromLength++
+		}
+		if line.kind != '-' {
+			toLength++
+		}
+	}
+
+	fmt.Fprintf(diff, "@@ -%s +%s @@\n", hunkRange(lines[0].fromPos, fromLength), hunkRange(lines[0].toPos, toLength))
+
+	for _, line := range lines {
+		diff.WriteByte(line.kind)
+		diff.WriteString(line.text)
+		if !strings.HasSuffix(line.text, "\n") {
+			diff.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(linesBefore int, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", linesBefore)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", linesBefore+1)
+	}
+	return fmt.Sprintf("%d,%d", linesBefore+1, length)
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxDiffCells bounds the size of the longest common subsequence table, so
+// diffing large files doesn't take quadratic memory and time.
+const maxDiffCells = 1 << 22
+
+// diffLines aligns from and to on their longest common subsequence of lines.
+// The lines they start and end with are always common, and when the lines
+// in between are too many to align they are diffed as entirely replaced.
+func diffLines(from []string, to []string) []diffLine {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	lines := []diffLine{}
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, diffLine{kind: ' ', text: from[i], fromPos: i, toPos: i})
+	}
+
+	fromMiddle := from[prefix : len(from)-suffix]
+	toMiddle := to[prefix : len(to)-suffix]
+	if len(fromMiddle)*len(toMiddle) > maxDiffCells {
+		lines = append(lines, replacedLines(fromMiddle, toMiddle, prefix)...)
+	} else {
+		lines = append(lines, commonSubsequenceLines(fromMiddle, toMiddle, prefix)...)
+	}
+
+	for k := suffix; k > 0; k-- {
+		lines = append(lines, diffLine{kind: ' ', text: from[len(from)-k], fromPos: len(from) - k, toPos: len(to) - k})
+	}
+
+	return lines
+}
+
+// replacedLines diffs every line of from as removed and every line of to as
+// added, both after offset common lines.
+func replacedLines(from []string, to []string, offset int) []diffLine {
+	lines := []diffLine{}
+	for i, line := range from {
+		lines = append(lines, diffLine{kind: '-', text: line, fromPos: offset + i, toPos: offset})
+	}
+	for j, line := range to {
+		lines = append(lines, diffLine{kind: '+', text: line, fromPos: offset + len(from), toPos: offset + j})
+	}
+	return lines
+}
+
+// commonSubsequenceLines aligns from and to, both after offset common lines,
+// on their longest common subsequence of lines.
+func commonSubsequenceLines(from []string, to []string, offset int) []diffLine {
+	// common[i][j] is the length of the longest common subsequence of
+	// from[i:] and to[j:]
+	common := make([][]int32, len(from)+1)
+	for i := range common {
+		common[i] = make([]int32, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			lines = append(lines, diffLine{kind: ' ', text: from[i], fromPos: offset + i, toPos: offset + j})
+			i++
+			j++
+		case j == len(to) || (i < len(from) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{kind: '-', text: from[i], fromPos: offset + i, toPos: offset + j})
+			i++
+		default:
+			lines = append(lines, diffLine{kind: '+', text: to[j], fromPos: offset + i, toPos: offset + j})
+			j++
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,105 @@
+package utils_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prigas-dev/backoffice-ai/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	numbers := func(from int, to int) string {
+		var lines strings.Builder
+		for i := from; i <= to; i++ {
+			fmt.Fprintf(&lines, "%d\n", i)
+		}
+		return lines.String()
+	}
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		diff string
+	}{
+		{
+			name: "equal",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			diff: "",
+		},
+		{
+			name: "empty from",
+			from: "",
+			to:   "a\nb\n",
+			diff: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "empty to",
+			from: "a\nb\n",
+			to:   "",
+			diff: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "trailing newline added",
+			from: "a\nb",
+			to:   "a\nb\n",
+			diff: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "changed without trailing newline",
+			from: "a\nb\n",
+			to:   "a\nc",
+			diff: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "insertion",
+			from: numbers(1, 10),
+			to:   numbers(1, 3) + "x\n" + numbers(4, 10),
+			diff: "--- a\n+++ b\n@@ -1,6 +1,7 @@\n 1\n 2\n 3\n+x\n 4\n 5\n 6\n",
+		},
+		{
+			name: "deletion",
+			from: numbers(1, 10),
+			to:   numbers(1, 7) + numbers(9, 10),
+			diff: "--- a\n+++ b\n@@ -5,6 +5,5 @@\n 5\n 6\n 7\n-8\n 9\n 10\n",
+		},
+		{
+			name: "changes with overlapping context share a hunk",
+			from: numbers(1, 12),
+			to:   "x\n" + numbers(2, 7) + "y\n" + numbers(9, 12),
+			diff: "--- a\n+++ b\n@@ -1,11 +1,11 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n 9\n 10\n 11\n",
+		},
+		{
+			name: "distant changes get separate hunks",
+			from: numbers(1, 12),
+			to:   "x\n" + numbers(2, 8) + "y\n" + numbers(10, 12),
+			diff: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -6,7 +6,7 @@\n 6\n 7\n 8\n-9\n+y\n 10\n 11\n 12\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.diff, utils.UnifiedDiff("a", "b", test.from, test.to))
+		})
+	}
+
+	t.Run("large files are diffed as replaced", func(t *testing.T) {
+		t.Parallel()
+
+		from := "header\n" + numbers(1, 5000) + "footer\n"
+		to := "header\n" + numbers(5001, 10000) + "footer\n"
+
+		diff := utils.UnifiedDiff("a", "b", from, to)
+
+		assert.True(t, strings.HasPrefix(diff, "--- a\n+++ b\n@@ -1,5002 +1,5002 @@\n header\n-1\n"))
+		assert.True(t, strings.HasSuffix(diff, "+10000\n footer\n"))
+		hunk := strings.TrimPrefix(diff, "--- a\n+++ b\n")
+		assert.Equal(t, 5000, strings.Count(hunk, "\n-"))
+		assert.Equal(t, 5000, strings.Count(hunk, "\n+"))
+	})
+}
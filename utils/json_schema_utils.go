@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONSchemaViolation is a value of a document that doesn't follow its schema.
+type JSONSchemaViolation struct {
+	// Path is the JSON pointer of the value, empty for the whole document
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v *JSONSchemaViolation) String() string {
+	if len(v.Path) == 0 {
+		return v.Message
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ValidateJSONSchema returns the values of document that don't follow
+// schema. Only the draft-07 keywords the instruction files use are checked:
+// $ref to the same schema, type, enum, required, properties,
+// additionalProperties, items, allOf, anyOf, oneOf, minLength, maxLength,
+// minimum, maximum, minItems and maxItems. Other keywords are ignored.
+func ValidateJSONSchema(schema []byte, document []byte) ([]*JSONSchemaViolation, error) {
+	var rootSchema any
+	err := json.Unmarshal(schema, &rootSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	}
+
+	var value any
+	err = json.Unmarshal(document, &value)
+	if err != nil {
+		return []*JSONSchemaViolation{{Message: fmt.Sprintf("invalid JSON: %v", err)}}, nil
+	}
+
+	validator := &jsonSchemaValidator{rootSchema: rootSchema}
+	violations := validator.validate(rootSchema, value, "")
+	if validator.err != nil {
+		return nil, validator.err
+	}
+
+	return violations, nil
+}
+
+type jsonSchemaValidator struct {
+	rootSchema any
+	// err is the first problem found in the schema itself
+	err error
+}
+
+func (v *jsonSchemaValidator) validate(schema any, value any, path string) []*JSONSchemaViolation {
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			return []*JSONSchemaViolation{{Path: path, Message: "no value is allowed"}}
+		}
+		return nil
+	case map[string]any:
+		return v.validateObjectSchema(schema, value, path)
+	default:
+		v.fail(fmt.Errorf("invalid JSON schema at %s: a schema must be an object or a boolean", path))
+		return nil
+	}
+}
+
+func (v *jsonSchemaValidator) validateObjectSchema(schema map[string]any, value any, path string) []*JSONSchemaViolation {
+	ref, hasRef := schema["$ref"].(string)
+	if hasRef {
+		// keywords next to $ref are ignored in draft-07
+		refSchema, err := v.resolveRef(ref)
+		if err != nil {
+			v.fail(err)
+			return nil
+		}
+		return v.validate(refSchema, value, path)
+	}
+
+	violation := func(format string, args ...any) *JSONSchemaViolation {
+		return &JSONSchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)}
+	}
+
+	types, hasType := schemaTypes(schema["type"])
+	if hasType && !slices.ContainsFunc(types, func(t string) bool { return jsonTypeMatches(t, value) }) {
+		return []*JSONSchemaViolation{violation("must be %s, but is %s", strings.Join(types, " or "), jsonTypeOf(value))}
+	}
+
+	violations := []*JSONSchemaViolation{}
+
+	enum, hasEnum := schema["enum"].([]any)
+	if hasEnum && !slices.ContainsFunc(enum, func(option any) bool { return reflect.DeepEqual(option, value) }) {
+		options, _ := json.Marshal(enum)
+		violations = append(violations, violation("must be one of %s", options))
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		minLength, hasMinLength := schema["minLength"].(float64)
+		if hasMinLength && float64(length) < minLength {
+			violations = append(violations, violation("must have at least %v characters", minLength))
+		}
+		maxLength, hasMaxLength := schema["maxLength"].(float64)
+		if hasMaxLength && float64(length) > maxLength {
+			violations = append(violations, violation("must have at most %v characters", maxLength))
+		}
+
+	case float64:
+		minimum, hasMinimum := schema["minimum"].(float64)
+		if hasMinimum && value < minimum {
+			violations = append(violations, violation("must be at least %v", minimum))
+		}
+		maximum, hasMaximum := schema["maximum"].(float64)
+		if hasMaximum && value > maximum {
+			violations = append(violations, violation("must be at most %v", maximum))
+		}
+
+	case []any:
+		minItems, hasMinItems := schema["minItems"].(float64)
+		if hasMinItems && float64(len(value)) < minItems {
+			violations = append(violations, violation("must have at least %v items", minItems))
+		}
+		maxItems, hasMaxItems := schema["maxItems"].(float64)
+		if hasMaxItems && float64(len(value)) > maxItems {
+			violations = append(violations, violation("must have at most %v items", maxItems))
+		}
+		items, hasItems := schema["items"]
+		if hasItems {
+			for i, item := range value {
+				violations = append(violations, v.validate(items, item, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+
+	case map[string]any:
+		required, _ := schema["required"].([]any)
+		for _, propertyName := range required {
+			_, isPresent := value[propertyName.(string)]
+			if !isPresent {
+				violations = append(violations, violation("property %s is required", propertyName))
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		additionalProperties, hasAdditionalProperties := schema["additionalProperties"]
+		for _, propertyName := range slices.Sorted(maps.Keys(value)) {
+			propertyPath := fmt.Sprintf("%s/%s", path, escapeJSONPointer(propertyName))
+
+			propertySchema, isDeclared := properties[propertyName]
+			switch {
+			case isDeclared:
+				violations = append(violations, v.validate(propertySchema, value[propertyName], propertyPath)...)
+			case additionalProperties == false:
+				violations = append(violations, violation("property %s is not allowed", propertyName))
+			case hasAdditionalProperties:
+				violations = append(violations, v.validate(additionalProperties, value[propertyName], propertyPath)...)
+			}
+		}
+	}
+
+	allOf, _ := schema["allOf"].([]any)
+	for _, subschema := range allOf {
+		violations = append(violations, v.validate(subschema, value, path)...)
+	}
+
+	anyOf, hasAnyOf := schema["anyOf"].([]any)
+	if hasAnyOf {
+		matches, closestViolations := v.validateAlternatives(anyOf, value, path)
+		if matches == 0 {
+			violations = append(violations, closestViolations...)
+		}
+	}
+
+	oneOf, hasOneOf := schema["oneOf"].([]any)
+	if hasOneOf {
+		matches, closestViolations := v.validateAlternatives(oneOf, value, path)
+		if matches == 0 {
+			violations = append(violations, closestViolations...)
+		}
+		if matches > 1 {
+			violations = append(violations, violation("must match only one of the oneOf schemas, but matches %d", matches))
+		}
+	}
+
+	return violations
+}
+
+// validateAlternatives returns how many schemas value matches. When it
+// matches none, the violations of the schema it's closest to are returned,
+// which describe the problem better than saying none matched.
+func (v *jsonSchemaValidator) validateAlternatives(schemas []any, value any, path string) (int, []*JSONSchemaViolation) {
+	matches := 0
+	var closestViolations []*JSONSchemaViolation
+	for _, schema := range schemas {
+		violations := v.validate(schema, value, path)
+		if len(violations) == 0 {
+			matches++
+			continue
+		}
+		if closestViolations == nil || len(violations) < len(closestViolations) {
+			closestViolations = violations
+		}
+	}
+	return matches, closestViolations
+}
+
+// resolveRef finds the schema of a reference inside the root schema, such
+// as "#/definitions/ValueSchema".
+func (v *jsonSchemaValidator) resolveRef(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported JSON schema $ref %s, only references inside the schema are supported", ref)
+	}
+
+	schema := v.rootSchema
+	pointer := strings.TrimPrefix(ref, "#")
+	if len(pointer) == 0 {
+		return schema, nil
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		object, isObject := schema.(map[string]any)
+		if !isObject {
+			return nil, fmt.Errorf("JSON schema $ref %s not found", ref)
+		}
+		var isFound bool
+		schema, isFound = object[unescapeJSONPointer(token)]
+		if !isFound {
+			return nil, fmt.Errorf("JSON schema $ref %s not found", ref)
+		}
+	}
+
+	return schema, nil
+}
+
+func (v *jsonSchemaValidator) fail(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
+func schemaTypes(typeKeyword any) ([]string, bool) {
+	switch typeKeyword := typeKeyword.(type) {
+	case string:
+		return []string{typeKeyword}, true
+	case []any:
+		types := []string{}
+		for _, t := range typeKeyword {
+			types = append(types, fmt.Sprint(t))
+		}
+		return types, true
+	}
+	return nil, false
+}
+
+func jsonTypeMatches(t string, value any) bool {
+	if t == "integer" {
+		number, isNumber := value.(float64)
+		return isNumber && number == math.Trunc(number)
+	}
+	return jsonTypeOf(value) == t
+}
+
+func jsonTypeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}